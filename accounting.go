@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+)
+
+// ====== 渲染成本统计 ======
+//
+// 按模板累计每次渲染的近似资源消耗：墙钟耗时、输出字节数，以及标签页关闭前通过 CDP
+// Runtime.getHeapUsage 采样的 JS 堆占用。/admin/stats 的 costs 字段按累计耗时列出
+// 最昂贵的模板（?top= 指定数量，默认 10），用于决定优先优化哪些模板。
+// 统计只保存在内存中，重启后清零；渲染缓存命中与失败的渲染不计入。
+
+// heapSampleTimeout 关闭标签页前采样 JS 堆的超时，超时则放弃本次采样
+const heapSampleTimeout = 200 * time.Millisecond
+
+type renderCost struct {
+	renders   int64
+	wall      time.Duration
+	maxWall   time.Duration
+	bytes     int64
+	heap      int64 // 各次渲染 JS 堆峰值之和
+	maxHeap   int64
+	heapCount int64 // 采样到 JS 堆的渲染次数
+	lastSeen  time.Time
+}
+
+// RenderCostEntry /admin/stats 中的一项模板成本
+type RenderCostEntry struct {
+	Template    string  `json:"template"`
+	Renders     int64   `json:"renders"`
+	WallTotalMs int64   `json:"wall_total_ms"`
+	WallAvgMs   float64 `json:"wall_avg_ms"`
+	WallMaxMs   int64   `json:"wall_max_ms"`
+	BytesAvg    int64   `json:"bytes_avg"`
+	JSHeapAvg   int64   `json:"js_heap_avg,omitempty"`
+	JSHeapMax   int64   `json:"js_heap_max,omitempty"`
+	LastSeen    string  `json:"last_seen"`
+}
+
+var (
+	renderCostsMu sync.Mutex
+	renderCosts   = make(map[string]*renderCost)
+)
+
+// sampleJSHeap 记录标签页当前的 JS 堆占用，取本次渲染各标签页的最大值
+func (t *resourceTracker) sampleJSHeap(ctx context.Context) {
+	if ctx.Err() != nil {
+		return
+	}
+	sctx, cancel := context.WithTimeout(ctx, heapSampleTimeout)
+	defer cancel()
+	var used float64
+	err := chromedp.Run(sctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		var err error
+		used, _, _, _, err = runtime.GetHeapUsage().Do(ctx)
+		return err
+	}))
+	if err != nil {
+		return
+	}
+	t.mu.Lock()
+	t.jsHeap = max(t.jsHeap, int64(used))
+	t.mu.Unlock()
+}
+
+// JSHeap 本次渲染采样到的 JS 堆峰值（字节），未采样时为 0
+func (t *resourceTracker) JSHeap() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.jsHeap
+}
+
+// observeRenderCost 记录一次成功渲染的成本
+func observeRenderCost(template string, wall time.Duration, size int, jsHeap int64) {
+	key := templateKeyOf(template)
+	if key == "" {
+		return
+	}
+	renderCostsMu.Lock()
+	defer renderCostsMu.Unlock()
+	c := renderCosts[key]
+	if c == nil {
+		c = &renderCost{}
+		renderCosts[key] = c
+	}
+	c.renders++
+	c.wall += wall
+	c.maxWall = max(c.maxWall, wall)
+	c.bytes += int64(size)
+	if jsHeap > 0 {
+		c.heap += jsHeap
+		c.heapCount++
+		c.maxHeap = max(c.maxHeap, jsHeap)
+	}
+	c.lastSeen = time.Now()
+}
+
+// topRenderCosts 按累计耗时降序返回前 n 个模板
+func topRenderCosts(n int) []RenderCostEntry {
+	renderCostsMu.Lock()
+	out := make([]RenderCostEntry, 0, len(renderCosts))
+	for key, c := range renderCosts {
+		e := RenderCostEntry{
+			Template:    key,
+			Renders:     c.renders,
+			WallTotalMs: c.wall.Milliseconds(),
+			WallAvgMs:   float64(c.wall.Microseconds()) / 1000 / float64(c.renders),
+			WallMaxMs:   c.maxWall.Milliseconds(),
+			BytesAvg:    c.bytes / c.renders,
+			JSHeapMax:   c.maxHeap,
+			LastSeen:    c.lastSeen.Format(time.RFC3339),
+		}
+		if c.heapCount > 0 {
+			e.JSHeapAvg = c.heap / c.heapCount
+		}
+		out = append(out, e)
+	}
+	renderCostsMu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].WallTotalMs != out[j].WallTotalMs {
+			return out[i].WallTotalMs > out[j].WallTotalMs
+		}
+		return out[i].Template < out[j].Template
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ====== 数据适配器 ======
+//
+// 同一个站点的卡片，各家机器人都要把上游接口的原始 JSON 解析成模板需要的字段，逻辑大同小异。
+// 模板在附属配置中声明 adapter 后，请求的 data 直接传上游返回的原始数据，由内置适配器整理为统一的卡片模型：
+//
+//	# templates/bilibili/dynamic.meta.yaml
+//	adapter: bilibili
+//
+// 模板中按卡片模型取值（见 Card），原始数据保留在 .raw 中：
+//
+//	<img src="{{.author.avatar}}"> {{.author.name}} · {{formatTime .time}}
+//	<p>{{.text}}</p>
+//	{{range .images}}<img src="{{.url}}">{{end}}
+//	👍 {{.stats.likes}} 💬 {{.stats.comments}}
+//
+// 适配在数据转换阶段最先执行，之后依次为数据映射（transform.go）、WASM 转换与 schema 校验；
+// 无法识别的数据返回 422。有适配器的模板，示例数据也应为上游的原始数据。
+
+// Card 适配器输出的卡片模型，以 JSON 字段名提供给模板
+type Card struct {
+	Site    string      `json:"site"`
+	Kind    string      `json:"kind"` // dynamic、forward、video、article、live
+	ID      string      `json:"id,omitempty"`
+	URL     string      `json:"url,omitempty"`
+	Author  CardAuthor  `json:"author"`
+	Title   string      `json:"title,omitempty"`
+	Text    string      `json:"text,omitempty"`
+	Images  []CardImage `json:"images,omitempty"`
+	Cover   string      `json:"cover,omitempty"`
+	Stats   CardStats   `json:"stats"`
+	Time    string      `json:"time,omitempty"`    // 发布或开播时间，RFC 3339
+	Live    *CardLive   `json:"live,omitempty"`    // 直播间信息，kind 为 live 时存在
+	Forward *Card       `json:"forward,omitempty"` // 被转发的原内容，kind 为 forward 时存在
+	Raw     any         `json:"raw,omitempty"`     // 原始数据，被转发内容中不重复保留
+}
+
+// CardAuthor 发布者
+type CardAuthor struct {
+	ID     string `json:"id,omitempty"`
+	Name   string `json:"name"`
+	Avatar string `json:"avatar,omitempty"`
+	URL    string `json:"url,omitempty"`
+}
+
+// CardImage 配图
+type CardImage struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+}
+
+// CardStats 互动数据，上游未提供时为 0
+type CardStats struct {
+	Likes    int64 `json:"likes"`
+	Comments int64 `json:"comments"`
+	Forwards int64 `json:"forwards"`
+	Views    int64 `json:"views"`
+	Online   int64 `json:"online"`
+}
+
+// CardLive 直播间
+type CardLive struct {
+	RoomID     int64  `json:"room_id,omitempty"`
+	Status     string `json:"status"` // live、offline、round（轮播）
+	Area       string `json:"area,omitempty"`
+	ParentArea string `json:"parent_area,omitempty"`
+}
+
+// payloadAdapter 将上游原始数据转换为卡片模型，无法识别时返回 errUnrecognizedPayload
+type payloadAdapter func(data any) (*Card, error)
+
+// payloadAdapters 内置适配器，key 为附属配置中的 adapter
+var payloadAdapters = map[string]payloadAdapter{
+	"bilibili": adaptBilibili,
+}
+
+var errUnrecognizedPayload = errors.New("unrecognized payload")
+
+// validateAdapterName 检查附属配置中的 adapter
+func validateAdapterName(name string) error {
+	if name == "" {
+		return nil
+	}
+	if _, exists := payloadAdapters[name]; !exists {
+		names := make([]string, 0, len(payloadAdapters))
+		for n := range payloadAdapters {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown adapter %q, available: %s", name, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// adaptData 按适配器转换数据，返回以 JSON 字段名表示的卡片
+func adaptData(name string, data any) (any, error) {
+	card, err := payloadAdapters[name](normalizeJSON(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s adapter: %w", name, err)
+	}
+	return normalizeJSON(card), nil
+}
+
+// applyPayloadAdapter 模板声明了 adapter 时转换请求数据
+func applyPayloadAdapter(rc *RenderContext) error {
+	if rc.Meta == nil || rc.Meta.Adapter == "" {
+		return nil
+	}
+	data, err := adaptData(rc.Meta.Adapter, rc.Payload.Data)
+	if err != nil {
+		return newRenderError(http.StatusUnprocessableEntity, err)
+	}
+	rc.Payload.Data = data
+	rc.Logger.Debug("🧩 已按适配器整理请求数据", zap.String("adapter", rc.Meta.Adapter), zap.String("template", rc.Template))
+	return nil
+}
+
+// ---------- 供适配器使用的取值函数 ----------
+
+// pathString 取字符串字段，数字转为字符串，不存在时返回空串
+func pathString(v any, path string) string {
+	value, found := lookupPath(v, path)
+	if !found || value == nil {
+		return ""
+	}
+	switch s := value.(type) {
+	case string:
+		return s
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64)
+	}
+	return ""
+}
+
+// pathInt 取整数字段，支持数字字符串，不存在或无法转换时返回 0
+func pathInt(v any, path string) int64 {
+	value, found := lookupPath(v, path)
+	if !found {
+		return 0
+	}
+	n, _ := numberValue(value)
+	return int64(n)
+}
+
+// pathList 取数组字段
+func pathList(v any, path string) []any {
+	value, _ := lookupPath(v, path)
+	list, _ := value.([]any)
+	return list
+}
+
+// valueAt 取任意字段，不存在时返回 nil
+func valueAt(v any, path string) any {
+	value, _ := lookupPath(v, path)
+	return value
+}
+
+// lookupPathString 取字段并判断是否为字符串
+func lookupPathString(v any, path string) (string, bool) {
+	value, _ := lookupPath(v, path)
+	s, isString := value.(string)
+	return s, isString
+}
+
+// hasPath 字段是否存在
+func hasPath(v any, path string) bool {
+	_, found := lookupPath(v, path)
+	return found
+}
+
+// unixTime 秒级时间戳转为 RFC 3339，0 时返回空串
+func unixTime(ts int64) string {
+	if ts <= 0 {
+		return ""
+	}
+	return time.Unix(ts, 0).Format(time.RFC3339)
+}
+
+// absoluteURL 补全协议相对地址（//example.com/a.png），http 升级为 https
+func absoluteURL(u string) string {
+	switch {
+	case strings.HasPrefix(u, "//"):
+		return "https:" + u
+	case strings.HasPrefix(u, "http://"):
+		return "https://" + strings.TrimPrefix(u, "http://")
+	}
+	return u
+}
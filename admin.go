@@ -0,0 +1,306 @@
+//go:build !noadmin
+
+package main
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"net"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 管理接口 ======
+//
+// 管理接口挂载在 admin.prefix 下，始终需要认证；未配置 auth.token 时仅允许本机访问。
+
+// registerAdminRoutes 注册管理接口
+func registerAdminRoutes(r *gin.Engine) {
+	if !viper.GetBool("admin.enabled") {
+		return
+	}
+	prefix := viper.GetString("admin.prefix")
+	if prefix == "" {
+		prefix = "/admin"
+	}
+	g := r.Group(prefix, adminGuard())
+	g.GET("/config", AdminConfigHandler)
+	g.PATCH("/config", AdminPatchConfigHandler)
+	g.POST("/templates/reload", AdminReloadTemplatesHandler)
+	g.GET("/templates/usage", AdminTemplateUsageHandler)
+	g.GET("/schema/:site/:type", AdminSchemaHandler)
+	g.GET("/stats", AdminStatsHandler)
+	g.GET("/events", ReloadEventsHandler)
+	logger.Info("🛠️ 管理接口已启用", zap.String("prefix", prefix))
+}
+
+// adminGuard 未配置认证时拒绝非本机请求（配置后由 AuthMiddleware 校验）
+func adminGuard() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if p := principalFrom(c.Request.Context()); p != nil && p.scoped() {
+			c.AbortWithStatusJSON(http.StatusForbidden, errResp("token scope does not allow admin api"))
+			return
+		}
+		if !authConfigured() && !isUnixSocketRequest(c) {
+			if !isLoopbackRequest(c) {
+				loggerFor(c.Request.Context()).Warn("⛔ 管理接口仅允许本机访问", zap.String("client_ip", GetClientIP(c)))
+				c.AbortWithStatusJSON(http.StatusForbidden, errResp("admin api requires auth.token, auth.hmac or local access"))
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// isLoopbackRequest 连接来自本机，且经本机反向代理转发时原始客户端同样为本机。
+// 只依据 RemoteAddr 判断，X-Forwarded-For 等请求头可被任意客户端伪造
+func isLoopbackRequest(c *gin.Context) bool {
+	host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		host = c.Request.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return false
+	}
+	if c.GetHeader("X-Forwarded-For") != "" || c.GetHeader("X-Real-IP") != "" {
+		ip := net.ParseIP(GetClientIP(c))
+		return ip != nil && ip.IsLoopback()
+	}
+	return true
+}
+
+// AdminConfigHandler 返回生效配置，敏感字段已脱敏
+func AdminConfigHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, ok(gin.H{
+		"file":    viper.ConfigFileUsed(),
+		"version": viper.GetInt("version"),
+		"config":  effectiveConfig(),
+	}))
+}
+
+// adminMutableKeys 可通过 PATCH /admin/config 在运行时修改的配置项，校验函数返回写入 viper 的值
+var adminMutableKeys = map[string]func(v any) (any, error){
+	"render.quality": func(v any) (any, error) {
+		q, isNum := v.(float64)
+		if !isNum || q != math.Trunc(q) || q < 1 || q > 100 {
+			return nil, fmt.Errorf("must be an integer between 1 and 100, got %v", v)
+		}
+		return int(q), nil
+	},
+	"render.timeout": func(v any) (any, error) {
+		d, err := ParseDuration(v)
+		if err != nil {
+			return nil, err
+		}
+		if d < 100*time.Millisecond || d > 60*time.Second {
+			return nil, fmt.Errorf("must be between 100ms and 60s, got %v", v)
+		}
+		return d.String(), nil
+	},
+	"render.max_timeout": func(v any) (any, error) {
+		d, err := ParseDuration(v)
+		if err != nil {
+			return nil, err
+		}
+		if d < 100*time.Millisecond || d > 10*time.Minute {
+			return nil, fmt.Errorf("must be between 100ms and 10m, got %v", v)
+		}
+		return d.String(), nil
+	},
+	"logging.level": func(v any) (any, error) {
+		level, _ := v.(string)
+		switch level = strings.ToLower(level); level {
+		case "debug", "info", "warn", "error":
+			return level, nil
+		}
+		return nil, fmt.Errorf("must be one of debug, info, warn, error, got %v", v)
+	},
+}
+
+var (
+	runtimeOverridesMu sync.Mutex
+	runtimeOverrides   = make(map[string]bool) // 经 PATCH /admin/config 修改过的键
+)
+
+// clearRuntimeOverrides 撤销运行时修改，之后以配置文件中的值为准，由配置文件重新加载时调用，返回被撤销的键
+func clearRuntimeOverrides() []string {
+	runtimeOverridesMu.Lock()
+	defer runtimeOverridesMu.Unlock()
+	keys := make([]string, 0, len(runtimeOverrides))
+	for key := range runtimeOverrides {
+		viper.Set(key, nil) // viper 跳过值为 nil 的覆盖项，回退到配置文件
+		keys = append(keys, key)
+	}
+	clear(runtimeOverrides)
+	sort.Strings(keys)
+	return keys
+}
+
+// AdminPatchConfigHandler 在运行时修改配置，请求体为 {"render.quality": 80, ...}。
+// 修改不写入配置文件，重启或配置文件重新加载后失效；全部校验通过后才生效。
+func AdminPatchConfigHandler(c *gin.Context) {
+	var req map[string]any
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errResp(err.Error()))
+		return
+	}
+	if len(req) == 0 {
+		c.JSON(http.StatusBadRequest, errResp("no config keys given"))
+		return
+	}
+
+	values := make(map[string]any, len(req))
+	for key, v := range req {
+		validate, mutable := adminMutableKeys[key]
+		if !mutable {
+			c.JSON(http.StatusBadRequest, errResp(fmt.Sprintf("%s cannot be changed at runtime, mutable keys: %s", key, strings.Join(adminMutableKeyNames(), ", "))))
+			return
+		}
+		value, err := validate(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, errResp(key+": "+err.Error()))
+			return
+		}
+		values[key] = value
+	}
+
+	runtimeOverridesMu.Lock()
+	for key, value := range values {
+		viper.Set(key, value)
+		runtimeOverrides[key] = true
+	}
+	runtimeOverridesMu.Unlock()
+	ApplyDynamicConfig()
+	publishReload(ReloadConfig, nil)
+	loggerFor(c.Request.Context()).Info("🛠️ 运行时配置已修改", zap.Any("changes", values), zap.String("client_ip", GetClientIP(c)))
+	c.JSON(http.StatusOK, ok(gin.H{"changed": values, "persisted": false, "reset_on_reload": true}))
+}
+
+func adminMutableKeyNames() []string {
+	names := make([]string, 0, len(adminMutableKeys))
+	for key := range adminMutableKeys {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AdminReloadTemplatesHandler 立即重新扫描模板目录，返回模板数量与校验失败的模板
+func AdminReloadTemplatesHandler(c *gin.Context) {
+	dir := viper.GetString("template.dir")
+	if err := reloadTemplates(dir); err != nil {
+		loggerFor(c.Request.Context()).Error("❌ 模板重新加载失败", zap.String("dir", dir), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, errResp(err.Error()))
+		return
+	}
+	publishReload(ReloadTemplates, nil)
+	checks := validateTemplates()
+	invalid := []TemplateCheck{}
+	for _, check := range checks {
+		if !check.Valid {
+			invalid = append(invalid, check)
+		}
+	}
+	c.JSON(http.StatusOK, ok(gin.H{"templates": len(checks), "invalid": invalid}))
+}
+
+// AdminTemplateUsageHandler 列出模板的最近使用时间，?days= 为闲置天数阈值（默认 30），?unused=true 只返回闲置的模板
+func AdminTemplateUsageHandler(c *gin.Context) {
+	days := 30
+	if v := c.Query("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, errResp("days must be a non-negative integer"))
+			return
+		}
+		days = n
+	}
+	templateMutex.RLock()
+	templates := maps.Clone(templateMap)
+	templateMutex.RUnlock()
+	data := globalTemplateUsage.Snapshot()
+	entries := templateUsageReport(data, templates, days, time.Now())
+
+	unused := 0
+	shown := make([]TemplateUsageEntry, 0, len(entries))
+	for _, e := range entries {
+		if e.Unused {
+			unused++
+		}
+		if c.Query("unused") != "true" || e.Unused {
+			shown = append(shown, e)
+		}
+	}
+	c.JSON(http.StatusOK, ok(gin.H{
+		"since":     data.Since.Format(time.RFC3339),
+		"days":      days,
+		"total":     len(entries),
+		"unused":    unused,
+		"templates": shown,
+	}))
+}
+
+// AdminStatsHandler 返回运行状态：运行时长、渲染计数、本地浏览器进程与内存、主机负载，
+// ?top= 为渲染成本列出的模板数量（默认 10）
+func AdminStatsHandler(c *gin.Context) {
+	top := 10
+	if v := c.Query("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, errResp("top must be a non-negative integer"))
+			return
+		}
+		top = n
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	concurrentMutex.Lock()
+	inFlight, limit, queued, sites := currentConcurrent, maxConcurrent, len(renderQueue), maps.Clone(siteActive)
+	concurrentMutex.Unlock()
+
+	browser := gin.H{"mode": "local"}
+	if viper.GetString("render.remote_debugging_url") != "" {
+		browser["mode"] = "remote"
+	} else {
+		procs, rss := browserProcesses()
+		if procs == nil {
+			procs = []processInfo{}
+		}
+		browser["processes"] = procs
+		browser["rss_bytes"] = rss
+	}
+
+	c.JSON(http.StatusOK, ok(gin.H{
+		"started_at": processStart.Format(time.RFC3339),
+		"uptime":     time.Since(processStart).Round(time.Second).String(),
+		"renders": gin.H{
+			"ok":              int64(rendersTotal.Value("ok")),
+			"error":           int64(rendersTotal.Value("error")),
+			"in_flight":       inFlight,
+			"max_concurrency": limit,
+			"queued":          queued,
+			"sites":           sites, // 各站点进行中的渲染数
+		},
+		"process": gin.H{
+			"goroutines": runtime.NumGoroutine(),
+			"heap_alloc": mem.HeapAlloc,
+			"sys":        mem.Sys,
+			"go_version": runtime.Version(),
+		},
+		"browser":  browser,
+		"load":     loadStatus(),
+		"autotune": autotuneStatus(),
+		"slo":      sloStatus(),
+		"costs":    topRenderCosts(top),
+	}))
+}
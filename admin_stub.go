@@ -0,0 +1,44 @@
+//go:build noadmin
+
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// 使用 noadmin 构建时不包含管理接口
+
+func registerAdminRoutes(r *gin.Engine) {
+	if viper.GetBool("admin.enabled") {
+		logger.Warn("❕ 当前构建不包含管理接口（noadmin），已忽略 admin 配置")
+	}
+}
+
+func registerTemplateUploadRoutes(r *gin.Engine) {
+	if viper.GetBool("template.upload") {
+		logger.Warn("❕ 当前构建不包含模板上传接口（noadmin），已忽略 template.upload 配置")
+	}
+}
+
+func registerPlaygroundRoutes(r *gin.Engine) {
+	if viper.GetBool("template.playground") {
+		logger.Warn("❕ 当前构建不包含模板试验场（noadmin），已忽略 template.playground 配置")
+	}
+}
+
+func isPlaygroundPage(c *gin.Context) bool { return false }
+
+func clearRuntimeOverrides() []string { return nil }
+
+func registerFailureRoutes(r *gin.Engine) {
+	if globalFailures != nil {
+		logger.Warn("❕ 当前构建不包含失败记录接口（noadmin），失败记录仍会写入目录")
+	}
+}
+
+func registerDebugRoutes(r *gin.Engine) {
+	if viper.GetBool("debug.endpoints") {
+		logger.Warn("❕ 当前构建不包含调试接口（noadmin），已忽略 debug.endpoints 配置")
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 告警通知 ======
+//
+// 告警写入日志，并在配置 alerting.webhook 时以 JSON POST 到该地址：
+//
+//	{"alert": "slo_burn_rate", "status": "firing", "summary": "...", "labels": {...}, "values": {...}, "time": "..."}
+//
+// 通知异步发送，失败只记录日志，不影响渲染。
+
+// 告警状态
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// Alert 一条告警通知
+type Alert struct {
+	Name    string             `json:"alert"`
+	Status  string             `json:"status"`
+	Summary string             `json:"summary"`
+	Labels  map[string]string  `json:"labels,omitempty"`
+	Values  map[string]float64 `json:"values,omitempty"`
+	Time    time.Time          `json:"time"`
+}
+
+var (
+	alertsTotal        = NewCounterVec("snapcast_alerts_total", "Alert notifications by alert name and status.", "alert", "status")
+	alertNotifyFailure = NewCounterVec("snapcast_alert_notify_failures_total", "Alert webhook deliveries that failed.", "alert")
+	alertClient        = &http.Client{Timeout: 10 * time.Second}
+)
+
+// notifyAlert 记录告警并异步发送 webhook
+func notifyAlert(a Alert) {
+	if a.Time.IsZero() {
+		a.Time = time.Now()
+	}
+	alertsTotal.Inc(a.Name, a.Status)
+	fields := []zap.Field{zap.String("alert", a.Name), zap.Any("labels", a.Labels), zap.Any("values", a.Values)}
+	if a.Status == AlertFiring {
+		logger.Warn("🚨 "+a.Summary, fields...)
+	} else {
+		logger.Info("✅ "+a.Summary, fields...)
+	}
+
+	webhook := viper.GetString("alerting.webhook")
+	if webhook == "" {
+		return
+	}
+	go func() {
+		if err := postAlert(webhook, a); err != nil {
+			alertNotifyFailure.Inc(a.Name)
+			logger.Error("❌ 告警通知发送失败", zap.String("alert", a.Name), zap.Error(err))
+		}
+	}()
+}
+
+func postAlert(webhook string, a Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), alertClient.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := alertClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====== 替代文本 ======
+//
+// 模板附属配置中的 alt 为纯文本模板，数据与函数同 HTML 模板，渲染时生成卡片的文字摘要：
+//
+//	alt: "{{.user.name}} 发布了动态：{{.text}}"
+//
+// 结果以 X-SnapCast-Alt 响应头（URL 编码）返回，"response": "url" 时为返回对象的 alt 字段，
+// 投递时作为 Delivery.AltText 传给 Sink，支持图片说明的 Sink 可作为 caption 发送，
+// 方便读屏软件用户与不显示图片的通知渠道。生成失败时只记录警告，不影响渲染。
+
+const altTextHeader = "X-SnapCast-Alt"
+
+// maxAltTextRunes 替代文本的最大字符数，超出时截断
+const maxAltTextRunes = 1000
+
+var altTemplates sync.Map // 模板源码 → *template.Template
+
+// parseAltTemplate 解析并缓存替代文本模板
+func parseAltTemplate(src string) (*template.Template, error) {
+	if t, cached := altTemplates.Load(src); cached {
+		return t.(*template.Template), nil
+	}
+	t, err := template.New("alt").Option("missingkey=zero").Funcs(funcsList).Funcs(template.FuncMap{
+		"theme": func() string { return "" },
+		"lang":  func() string { return "" },
+	}).Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("alt: %w", err)
+	}
+	altTemplates.Store(src, t)
+	return t, nil
+}
+
+// renderAltText 按模板附属配置生成替代文本，未配置时返回空字符串
+func renderAltText(meta *TemplateMeta, data any, theme, lang string) (string, error) {
+	if meta == nil || meta.Alt == "" || data == nil {
+		return "", nil
+	}
+	t, err := parseAltTemplate(meta.Alt)
+	if err != nil {
+		return "", err
+	}
+	if t, err = t.Clone(); err != nil {
+		return "", err
+	}
+	t.Funcs(template.FuncMap{
+		"theme": func() string { return theme },
+		"lang":  func() string { return lang },
+		"t":     translateFunc(lang),
+	})
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("alt: %w", err)
+	}
+	return normalizeAltText(buf.String()), nil
+}
+
+// normalizeAltText 合并空白并截断到 maxAltTextRunes
+func normalizeAltText(s string) string {
+	s = strings.Join(strings.Fields(strings.ReplaceAll(s, "<no value>", "")), " ")
+	if utf8.RuneCountInString(s) <= maxAltTextRunes {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:maxAltTextRunes-1]) + "…"
+}
+
+// validateAltTemplate 检查替代文本模板的语法
+func validateAltTemplate(src string) error {
+	if src == "" {
+		return nil
+	}
+	if !utf8.ValidString(src) {
+		return errors.New("alt: invalid utf-8")
+	}
+	_, err := parseAltTemplate(src)
+	return err
+}
+
+// setAltTextHeader 写出替代文本响应头
+func setAltTextHeader(c *gin.Context, alt string) {
+	if alt != "" {
+		c.Header(altTextHeader, url.PathEscape(alt))
+	}
+}
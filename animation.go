@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// ====== 动图输出（实验性） ======
+//
+// options.animation 设置后，页面加载完成时将所有 CSS 动画重置到起点，通过 CDP
+// Page.startScreencast 录制 duration 时长，按等间隔取 frames 帧裁剪到 body，编码为 GIF
+// 或 APNG。录制期间页面无变化时 Chrome 不产生新帧，沿用上一帧。动图不经过图片后处理。
+
+// 动图格式
+const (
+	AnimationGIF  = "gif"
+	AnimationAPNG = "apng"
+)
+
+const (
+	defaultAnimationDuration = 2 * time.Second
+	maxAnimationDuration     = 10 * time.Second
+	defaultAnimationFrames   = 20
+	maxAnimationFrames       = 100
+)
+
+// AnimationOptions 动图参数
+type AnimationOptions struct {
+	Format   string `json:"format,omitempty"`   // gif（默认）、apng
+	Duration any    `json:"duration,omitempty"` // 录制时长，默认 2s，最长 10s
+	Frames   int    `json:"frames,omitempty"`   // 帧数，默认 20，最多 100
+
+	duration time.Duration
+}
+
+// withDefaults 填充默认值并校验
+func (a AnimationOptions) withDefaults() (AnimationOptions, error) {
+	switch a.Format {
+	case "":
+		a.Format = AnimationGIF
+	case AnimationGIF, AnimationAPNG:
+	default:
+		return a, optionError("options.animation.format must be gif or apng, got %q", a.Format)
+	}
+	d, err := ParseDuration(a.Duration)
+	if err != nil {
+		return a, optionError("options.animation.duration: %v", err)
+	}
+	if d == 0 {
+		d = defaultAnimationDuration
+	}
+	if d < 100*time.Millisecond || d > maxAnimationDuration {
+		return a, optionError("options.animation.duration must be between 100ms and %s", maxAnimationDuration)
+	}
+	a.duration = d
+	if a.Frames == 0 {
+		a.Frames = defaultAnimationFrames
+	}
+	if a.Frames < 2 || a.Frames > maxAnimationFrames {
+		return a, optionError("options.animation.frames must be between 2 and %d, got %d", maxAnimationFrames, a.Frames)
+	}
+	return a, nil
+}
+
+// contentType 输出的 Content-Type
+func (a *AnimationOptions) contentType() string {
+	if a.Format == AnimationAPNG {
+		return "image/apng"
+	}
+	return "image/gif"
+}
+
+type screencastFrame struct {
+	at   time.Time
+	data []byte
+}
+
+// RenderAnimation 录制页面动画并编码为 GIF 或 APNG
+func RenderAnimation(ctx context.Context, html string, opts RenderOptions) ([]byte, error) {
+	anim := opts.Animation
+	tracker := trackerFrom(ctx)
+	ctx, cancel := tracker.Tab(opts.TimeoutMs + anim.duration.Milliseconds())
+	defer cancel()
+
+	load, release, err := tracker.LoadHTML(html, opts.BaseURL, "animation")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var js string
+	runOpts := append(pageSetupActions(opts),
+		load,
+		chromedp.WaitVisible("body", chromedp.ByQuery),
+		chromedp.EvaluateAsDevTools(`(function() {
+			const r = document.body.getBoundingClientRect();
+			const sy = window.scrollY || document.documentElement.scrollTop;
+			return JSON.stringify({ x: Math.max(0, r.left), y: Math.max(0, r.top + sy), w: r.width, h: r.height, dpr: window.devicePixelRatio || 1 });
+		})()`, &js),
+	)
+	if err := chromedp.Run(ctx, runOpts...); err != nil {
+		return nil, fmt.Errorf("failed to evaluate JS: %w", err)
+	}
+	var r struct{ X, Y, W, H, DPR float64 }
+	if err := json.Unmarshal([]byte(js), &r); err != nil {
+		return nil, err
+	}
+	if r.W < 1 || r.H < 1 {
+		return nil, errors.New("body is empty")
+	}
+
+	// 视口调整为刚好容纳 body，录制的每一帧即为完整卡片
+	vw, vh := int64(math.Ceil(r.X+r.W)), int64(math.Ceil(r.Y+r.H))
+	var (
+		mu     sync.Mutex
+		frames []screencastFrame
+	)
+	chromedp.ListenTarget(ctx, func(ev any) {
+		e, ok := ev.(*page.EventScreencastFrame)
+		if !ok {
+			return
+		}
+		if data, err := base64.StdEncoding.DecodeString(e.Data); err == nil {
+			mu.Lock()
+			frames = append(frames, screencastFrame{at: time.Now(), data: data})
+			mu.Unlock()
+		}
+		go func() {
+			c := chromedp.FromContext(ctx)
+			_ = page.ScreencastFrameAck(e.SessionID).Do(cdp.WithExecutor(ctx, c.Target))
+		}()
+	})
+
+	var start time.Time
+	err = chromedp.Run(ctx,
+		emulation.SetDeviceMetricsOverride(vw, vh, r.DPR, false),
+		chromedp.Evaluate(`window.scrollTo(0, 0); document.getAnimations().forEach(a => { a.currentTime = 0; a.play(); })`, nil),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			start = time.Now()
+			return page.StartScreencast().WithFormat(page.ScreencastFormatPng).
+				WithMaxWidth(int64(float64(vw) * r.DPR)).WithMaxHeight(int64(float64(vh) * r.DPR)).Do(ctx)
+		}),
+		chromedp.Sleep(anim.duration),
+		page.StopScreencast(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record screencast: %w", err)
+	}
+
+	mu.Lock()
+	recorded := append([]screencastFrame(nil), frames...)
+	mu.Unlock()
+	if len(recorded) == 0 {
+		return nil, errors.New("screencast produced no frames")
+	}
+	crop := image.Rect(int(r.X*r.DPR), int(r.Y*r.DPR), int((r.X+r.W)*r.DPR), int((r.Y+r.H)*r.DPR))
+	images, err := sampleFrames(recorded, start, anim.duration, anim.Frames, crop)
+	if err != nil {
+		return nil, err
+	}
+	delay := anim.duration / time.Duration(anim.Frames)
+	if anim.Format == AnimationAPNG {
+		return encodeAPNG(images, delay)
+	}
+	return encodeGIF(images, delay)
+}
+
+// sampleFrames 在录制时段内等间隔取帧，每个时间点取此前最后一帧，并裁剪到 crop
+func sampleFrames(recorded []screencastFrame, start time.Time, duration time.Duration, n int, crop image.Rectangle) ([]*image.RGBA, error) {
+	sort.SliceStable(recorded, func(i, j int) bool { return recorded[i].at.Before(recorded[j].at) })
+	decoded := make(map[int]*image.RGBA)
+	out := make([]*image.RGBA, 0, n)
+	idx := 0
+	for i := 0; i < n; i++ {
+		t := start.Add(duration * time.Duration(i) / time.Duration(n))
+		for idx+1 < len(recorded) && !recorded[idx+1].at.After(t) {
+			idx++
+		}
+		img, cached := decoded[idx]
+		if !cached {
+			src, _, err := image.Decode(bytes.NewReader(recorded[idx].data))
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode screencast frame: %w", err)
+			}
+			rect := crop.Intersect(src.Bounds())
+			if rect.Empty() {
+				rect = src.Bounds()
+			}
+			img = image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+			draw.Draw(img, img.Bounds(), src, rect.Min, draw.Src)
+			decoded[idx] = img
+		}
+		out = append(out, img)
+	}
+	return out, nil
+}
+
+// encodeGIF 以所有帧共用的调色板编码 GIF，循环播放
+func encodeGIF(frames []*image.RGBA, delay time.Duration) ([]byte, error) {
+	pal := buildPalette(frames, 256)
+	anim := &gif.GIF{LoopCount: 0}
+	centis := max(2, int(delay/(10*time.Millisecond)))
+	for _, f := range frames {
+		p := image.NewPaletted(f.Bounds(), pal)
+		draw.FloydSteinberg.Draw(p, f.Bounds(), f, image.Point{})
+		anim.Image = append(anim.Image, p)
+		anim.Delay = append(anim.Delay, centis)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// buildPalette 统计各帧 15 位颜色的出现次数，取最常见的 size 种
+func buildPalette(frames []*image.RGBA, size int) color.Palette {
+	counts := make(map[uint16]int)
+	for _, f := range frames {
+		for i := 0; i+3 < len(f.Pix); i += 4 * 3 { // 隔 3 个像素采样
+			key := uint16(f.Pix[i]>>3)<<10 | uint16(f.Pix[i+1]>>3)<<5 | uint16(f.Pix[i+2]>>3)
+			counts[key]++
+		}
+	}
+	keys := make([]uint16, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > size {
+		keys = keys[:size]
+	}
+	pal := make(color.Palette, 0, max(len(keys), 2))
+	for _, k := range keys {
+		expand := func(v uint16) uint8 { return uint8(v<<3 | v>>2) }
+		pal = append(pal, color.RGBA{R: expand(k >> 10 & 31), G: expand(k >> 5 & 31), B: expand(k & 31), A: 0xff})
+	}
+	for len(pal) < 2 {
+		pal = append(pal, color.Black)
+	}
+	return pal
+}
+
+// encodeAPNG 将各帧编码为 PNG 后组装 acTL/fcTL/fdAT 块，无限循环
+func encodeAPNG(frames []*image.RGBA, delay time.Duration) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(pngSignature)
+	seq := uint32(0)
+	b := frames[0].Bounds()
+	delayMs := uint16(min(delay.Milliseconds(), math.MaxUint16))
+	for i, f := range frames {
+		var enc bytes.Buffer
+		if err := png.Encode(&enc, f); err != nil {
+			return nil, err
+		}
+		chunks, err := pngChunks(enc.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			for _, c := range chunks {
+				if c.typ == "IHDR" {
+					writePNGChunk(&buf, "IHDR", c.data)
+				}
+			}
+			actl := make([]byte, 8)
+			binary.BigEndian.PutUint32(actl[0:], uint32(len(frames)))
+			binary.BigEndian.PutUint32(actl[4:], 0) // 无限循环
+			writePNGChunk(&buf, "acTL", actl)
+		}
+		fctl := make([]byte, 26)
+		binary.BigEndian.PutUint32(fctl[0:], seq)
+		binary.BigEndian.PutUint32(fctl[4:], uint32(b.Dx()))
+		binary.BigEndian.PutUint32(fctl[8:], uint32(b.Dy()))
+		binary.BigEndian.PutUint16(fctl[20:], delayMs)
+		binary.BigEndian.PutUint16(fctl[22:], 1000)
+		// dispose_op 与 blend_op 为 0：不清除、直接覆盖
+		writePNGChunk(&buf, "fcTL", fctl)
+		seq++
+		for _, c := range chunks {
+			if c.typ != "IDAT" {
+				continue
+			}
+			if i == 0 {
+				writePNGChunk(&buf, "IDAT", c.data)
+				continue
+			}
+			fdat := make([]byte, 4+len(c.data))
+			binary.BigEndian.PutUint32(fdat, seq)
+			copy(fdat[4:], c.data)
+			writePNGChunk(&buf, "fdAT", fdat)
+			seq++
+		}
+	}
+	writePNGChunk(&buf, "IEND", nil)
+	return buf.Bytes(), nil
+}
+
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+// pngChunks 拆分 PNG 数据块
+func pngChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errors.New("not a png")
+	}
+	var chunks []pngChunk
+	for p := 8; p+12 <= len(data); {
+		n := int(binary.BigEndian.Uint32(data[p:]))
+		if p+12+n > len(data) {
+			return nil, errors.New("truncated png chunk")
+		}
+		chunks = append(chunks, pngChunk{typ: string(data[p+4 : p+8]), data: data[p+8 : p+8+n]})
+		p += 12 + n
+	}
+	return chunks, nil
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 请求归档 ======
+//
+// archive.enabled 开启后，每个渲染请求（含失败的请求）的原始 payload 连同调用方、模板文件与输出的
+// SHA-256 写入归档，合规审计时可还原某张图片当时渲染了什么、由谁请求。记录按 UTC 日期与站点分区，
+// 以 gzip 压缩的 JSON Lines 批量写出：
+//
+//	<prefix>/2026/10/16/bilibili/101500-<随机>.jsonl.gz
+//
+// storage.backend 为 s3 且已启用存储时写入同一存储桶，否则写入本地目录 archive.dir。本地归档按
+// archive.retention 与 archive.site_retention 定期删除，对象存储请在存储桶上为该前缀配置生命周期规则。
+// 本地归档目录不对外提供访问；对象存储中的归档需确保不在公开读取的前缀下。
+
+// ArchiveRecord 归档中的一条请求记录
+type ArchiveRecord struct {
+	Time           time.Time       `json:"time"`
+	RequestID      string          `json:"request_id,omitempty"`
+	Token          string          `json:"token,omitempty"` // 调用方 token 名，见 authtokens.go
+	Site           string          `json:"site"`
+	Type           string          `json:"type"`
+	Template       string          `json:"template,omitempty"`
+	TemplateSHA256 string          `json:"template_sha256,omitempty"`
+	Payload        json.RawMessage `json:"payload"`
+	HTML           string          `json:"html,omitempty"` // /render/html 请求的 HTML
+	Status         int             `json:"status"`
+	Error          string          `json:"error,omitempty"`
+	Cache          string          `json:"cache,omitempty"`
+	ContentType    string          `json:"content_type,omitempty"`
+	Size           int             `json:"size,omitempty"`
+	OutputSHA256   string          `json:"output_sha256,omitempty"`
+	DurationMs     int64           `json:"duration_ms"`
+}
+
+// archiveBatch 一个分区内尚未写出的记录
+type archiveBatch struct {
+	buf     bytes.Buffer
+	gz      *gzip.Writer
+	records int
+	raw     int // 压缩前字节数
+}
+
+type payloadArchiver struct {
+	mu      sync.Mutex
+	store   ImageStore
+	prefix  string
+	maxRaw  int
+	batches map[string]*archiveBatch // 分区路径 → 批次
+}
+
+var globalArchiver *payloadArchiver
+
+var archivedRecords = NewCounterVec("snapcast_archive_records_total", "Request records written to the payload archive, by result.", "result")
+
+// InitArchive 按 archive 配置启用请求归档（修改需重启）
+func InitArchive() {
+	if !viper.GetBool("archive.enabled") {
+		return
+	}
+	a := &payloadArchiver{
+		prefix:  strings.Trim(viper.GetString("archive.prefix"), "/"),
+		maxRaw:  8 << 20,
+		batches: make(map[string]*archiveBatch),
+	}
+	if mb := viper.GetInt("archive.max_batch_mb"); mb > 0 {
+		a.maxRaw = mb << 20
+	}
+	interval := time.Minute
+	if d, err := ParseDuration(viper.Get("archive.flush_interval")); err == nil && d > 0 {
+		interval = d
+	}
+
+	if s3, isS3 := globalImageStore.(*S3Store); isS3 {
+		a.store = s3
+		if a.prefix == "" {
+			a.prefix = "archive"
+		}
+		logger.Info("🗃️ 请求归档已启用（S3）", zap.String("bucket", s3.bucket), zap.String("prefix", a.prefix))
+		if viper.GetString("archive.retention") != "" {
+			logger.Info("💡 对象存储中的归档不会自动删除，请为该前缀配置存储桶生命周期规则", zap.String("prefix", a.prefix))
+		}
+	} else {
+		dir := viper.GetString("archive.dir")
+		if dir == "" {
+			dir = "./data/archive"
+		}
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			logger.Fatal("❌ 归档目录创建失败", zap.String("dir", dir), zap.Error(err))
+		}
+		a.store = &LocalStore{dir: dir}
+		go archiveRetentionLoop(filepath.Join(dir, filepath.FromSlash(a.prefix)))
+		logger.Info("🗃️ 请求归档已启用", zap.String("dir", dir))
+	}
+	globalArchiver = a
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			a.Flush()
+		}
+	}()
+}
+
+// archiveRender 归档一次渲染请求，raw 为进入管线前的 payload
+func archiveRender(ctx context.Context, raw json.RawMessage, payload *PushPayload, rc *RenderContext, duration time.Duration, err error) {
+	a := globalArchiver
+	if a == nil || payload.warmup {
+		return
+	}
+	rec := ArchiveRecord{
+		Time:       time.Now().UTC(),
+		RequestID:  requestIDFrom(ctx),
+		Site:       payload.Site,
+		Type:       payload.Type,
+		Template:   rc.Template,
+		Payload:    raw,
+		HTML:       payload.rawHTML,
+		Status:     http.StatusOK,
+		DurationMs: duration.Milliseconds(),
+	}
+	if p := principalFrom(ctx); p != nil {
+		rec.Token = p.name
+	}
+	if rc.Template != "" {
+		if src, err := os.ReadFile(rc.Template); err == nil {
+			rec.TemplateSHA256 = sha256Hex(src)
+		}
+	}
+	if err != nil {
+		rec.Status, rec.Error = renderErrorStatus(err), err.Error()
+	} else if rc.Result != nil {
+		rec.Cache, rec.ContentType, rec.Size = rc.Result.Cache, rc.Result.ContentType, len(rc.Result.Body)
+		if len(rc.Result.Body) > 0 {
+			rec.OutputSHA256 = sha256Hex(rc.Result.Body)
+		}
+	}
+	line, mErr := json.Marshal(rec)
+	if mErr != nil {
+		logger.Warn("⚠️ 归档记录序列化失败", zap.Error(mErr))
+		return
+	}
+	a.append(rec.Time, rec.Site, append(line, '\n'))
+}
+
+// archivePayload 序列化进入管线前的 payload，未启用归档与失败记录（见 failures.go）时返回 nil
+func archivePayload(payload *PushPayload) json.RawMessage {
+	if (globalArchiver == nil && globalFailures == nil) || payload.warmup {
+		return nil
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil
+	}
+	return raw
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// archivePartition 返回记录所在的分区路径 yyyy/mm/dd/<site>
+func archivePartition(t time.Time, site string) string {
+	if site == "" || !templateKeyRegex.MatchString(site) {
+		site = "_"
+	}
+	return t.Format("2006/01/02") + "/" + site
+}
+
+func (a *payloadArchiver) append(t time.Time, site string, line []byte) {
+	partition := archivePartition(t, site)
+	a.mu.Lock()
+	b := a.batches[partition]
+	if b == nil {
+		b = &archiveBatch{}
+		b.gz = gzip.NewWriter(&b.buf)
+		a.batches[partition] = b
+	}
+	_, _ = b.gz.Write(line)
+	b.records++
+	b.raw += len(line)
+	full := b.raw >= a.maxRaw
+	if full {
+		delete(a.batches, partition)
+	}
+	a.mu.Unlock()
+	if full {
+		a.write(partition, b)
+	}
+}
+
+// Flush 写出所有未写出的批次，停止服务时调用
+func (a *payloadArchiver) Flush() {
+	a.mu.Lock()
+	batches := a.batches
+	a.batches = make(map[string]*archiveBatch)
+	a.mu.Unlock()
+	for partition, b := range batches {
+		a.write(partition, b)
+	}
+}
+
+func (a *payloadArchiver) write(partition string, b *archiveBatch) {
+	if err := b.gz.Close(); err != nil {
+		logger.Error("❌ 归档压缩失败", zap.String("partition", partition), zap.Error(err))
+		return
+	}
+	key := path.Join(a.prefix, partition, time.Now().UTC().Format("150405")+"-"+newRequestID()+".jsonl.gz")
+	var metadata map[string]string
+	if _, local := a.store.(*LocalStore); !local { // 本地归档不需要 .meta.json
+		metadata = map[string]string{"records": strconv.Itoa(b.records)}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if _, err := a.store.Put(ctx, key, "application/gzip", b.buf.Bytes(), metadata); err != nil {
+		archivedRecords.Add(float64(b.records), "failed")
+		logger.Error("❌ 归档写入失败", zap.String("key", key), zap.Int("records", b.records), zap.Error(err))
+		return
+	}
+	archivedRecords.Add(float64(b.records), "written")
+	logger.Debug("🗃️ 已写出归档", zap.String("key", key), zap.Int("records", b.records), zap.Int("bytes", b.buf.Len()))
+}
+
+// archiveRetention 返回站点归档的保存时长，0 为永久保存
+func archiveRetention(site string) time.Duration {
+	if v := viper.Get("archive.site_retention." + site); v != nil {
+		if d, err := ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	d, _ := ParseDuration(viper.Get("archive.retention"))
+	return d
+}
+
+// archiveRetentionLoop 每小时删除本地归档中超过保存时长的分区，分区日期按 UTC 计算
+func archiveRetentionLoop(root string) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		removed := 0
+		days, _ := filepath.Glob(filepath.Join(root, "[0-9][0-9][0-9][0-9]", "[0-9][0-9]", "[0-9][0-9]"))
+		for _, day := range days {
+			rel, _ := filepath.Rel(root, day)
+			date, err := time.Parse("2006/01/02", filepath.ToSlash(rel))
+			if err != nil {
+				continue
+			}
+			sites, _ := os.ReadDir(day)
+			for _, s := range sites {
+				// 分区包含当天全部记录，保存时长从次日零点起算
+				if keep := archiveRetention(s.Name()); keep > 0 && time.Since(date.AddDate(0, 0, 1)) > keep {
+					if os.RemoveAll(filepath.Join(day, s.Name())) == nil {
+						removed++
+					}
+				}
+			}
+			// 依次清理空的日、月、年目录
+			for dir := day; dir != root; dir = filepath.Dir(dir) {
+				if os.Remove(dir) != nil {
+					break
+				}
+			}
+		}
+		if removed > 0 {
+			logger.Info("🗑️ 已删除过期的归档", zap.Int("partitions", removed))
+		}
+	}
+}
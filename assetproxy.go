@@ -0,0 +1,331 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 远程资源缓存代理 ======
+//
+// 模板中的头像、封面等远程图片经 /assets?url=...&sig=... 加载，由 SnapCast 拉取并缓存。
+// 代理地址带 HMAC 签名，Chrome 加载时无需认证 token，也无法被用作开放代理。
+
+const maxAssetSize = 10 << 20 // 单个资源上限 10MB
+
+type assetEntry struct {
+	key         string
+	contentType string
+	data        []byte
+	fetchedAt   time.Time
+}
+
+// AssetCache 内存 LRU + 可选磁盘持久化
+type AssetCache struct {
+	mu       sync.Mutex
+	ll       *list.List
+	items    map[string]*list.Element
+	size     int64
+	maxBytes int64
+	ttl      time.Duration
+	dir      string
+	client   *http.Client
+	secret   []byte
+	baseURL  string
+	endpoint string
+	rewrite  bool
+}
+
+var globalAssetCache = &AssetCache{
+	ll:    list.New(),
+	items: make(map[string]*list.Element),
+}
+
+// assetMeta 磁盘缓存的元数据，与资源文件同名加 .json 后缀
+type assetMeta struct {
+	URL         string    `json:"url"`
+	ContentType string    `json:"content_type"`
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+// InitAssetProxy 按配置初始化缓存代理，返回是否启用。
+// 未启用代理时缓存仍在内存中供 embedImage 使用。
+func InitAssetProxy() bool {
+	c := globalAssetCache
+	c.maxBytes = int64(viper.GetInt("assets.max_size_mb")) << 20
+	if c.maxBytes <= 0 {
+		c.maxBytes = 256 << 20
+	}
+	c.ttl, _ = ParseDuration(viper.Get("assets.ttl"))
+	if c.ttl <= 0 {
+		c.ttl = 24 * time.Hour
+	}
+	fetchTimeout, _ := ParseDuration(viper.Get("assets.fetch_timeout"))
+	if fetchTimeout <= 0 {
+		fetchTimeout = 10 * time.Second
+	}
+	c.client = newFetchClient(fetchTimeout) // embedImage 同样经此拉取
+	initImageEmbed()
+
+	if !viper.GetBool("assets.enabled") {
+		// 未启用时 asset 原样返回地址，模板无需修改
+		funcsList["asset"] = func(rawURL string) string { return rawURL }
+		return false
+	}
+	c.endpoint = viper.GetString("assets.endpoint")
+	if c.endpoint == "" {
+		c.endpoint = "/assets"
+	}
+	c.dir = viper.GetString("assets.cache_dir")
+	c.rewrite = viper.GetBool("assets.rewrite")
+	c.baseURL = strings.TrimRight(viper.GetString("assets.base_url"), "/")
+	if c.baseURL == "" {
+		c.baseURL = "http://127.0.0.1:" + viper.GetString("server.port")
+	}
+	if secret := viper.GetString("assets.secret"); secret != "" {
+		c.secret = []byte(secret)
+	} else {
+		// 未配置时每次启动随机生成，重启后旧链接失效
+		c.secret = make([]byte, 32)
+		_, _ = rand.Read(c.secret)
+	}
+	if c.dir != "" {
+		if err := os.MkdirAll(c.dir, 0755); err != nil {
+			logger.Warn("⚠️ 资源缓存目录创建失败，仅使用内存缓存", zap.String("dir", c.dir), zap.Error(err))
+			c.dir = ""
+		}
+	}
+
+	funcsList["asset"] = c.ProxyURL
+	if c.rewrite {
+		UseRenderMiddleware(StageCapture, "asset-rewrite", assetRewriteMiddleware)
+	}
+	go c.gcLoop()
+	logger.Info("🖼️ 资源缓存代理已启用", zap.String("endpoint", c.endpoint), zap.String("base_url", c.baseURL), zap.Bool("rewrite", c.rewrite))
+	return true
+}
+
+// sign 计算 URL 的签名
+func (c *AssetCache) sign(rawURL string) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(rawURL))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// ProxyURL 返回经代理的资源地址，非 http/https 地址原样返回（模板函数 asset）
+func (c *AssetCache) ProxyURL(rawURL string) string {
+	if !strings.HasPrefix(rawURL, "http://") && !strings.HasPrefix(rawURL, "https://") {
+		return rawURL
+	}
+	return c.baseURL + c.endpoint + "?url=" + url.QueryEscape(rawURL) + "&sig=" + c.sign(rawURL)
+}
+
+// isSignedAssetRequest 判断是否为带有效签名的资源请求，此类请求免认证与限流
+func isSignedAssetRequest(c *gin.Context) bool {
+	ac := globalAssetCache
+	if ac.secret == nil || c.Request.Method != http.MethodGet || c.Request.URL.Path != ac.endpoint {
+		return false
+	}
+	rawURL := c.Query("url")
+	return rawURL != "" && hmac.Equal([]byte(c.Query("sig")), []byte(ac.sign(rawURL)))
+}
+
+// AssetHandler 返回缓存的远程资源，未命中时拉取
+func AssetHandler(c *gin.Context) {
+	rawURL := c.Query("url")
+	if !isSignedAssetRequest(c) {
+		c.JSON(http.StatusForbidden, errResp("invalid asset signature"))
+		return
+	}
+	entry, err := globalAssetCache.Get(c.Request.Context(), rawURL)
+	if err != nil {
+		logger.Warn("⚠️ 资源拉取失败", zap.String("url", rawURL), zap.Error(err))
+		c.JSON(http.StatusBadGateway, errResp(err.Error()))
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, entry.contentType, entry.data)
+}
+
+// Get 依次查找内存、磁盘缓存，均未命中或过期时拉取远程资源
+func (c *AssetCache) Get(ctx context.Context, rawURL string) (*assetEntry, error) {
+	key := assetKey(rawURL)
+
+	c.mu.Lock()
+	if el, hit := c.items[key]; hit {
+		entry := el.Value.(*assetEntry)
+		if time.Since(entry.fetchedAt) < c.ttl {
+			c.ll.MoveToFront(el)
+			c.mu.Unlock()
+			return entry, nil
+		}
+		c.removeElement(el)
+	}
+	c.mu.Unlock()
+
+	if entry := c.loadDisk(key); entry != nil {
+		c.add(entry)
+		return entry, nil
+	}
+
+	entry, err := c.fetch(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	entry.key = key
+	c.add(entry)
+	c.saveDisk(rawURL, entry)
+	return entry, nil
+}
+
+func (c *AssetCache) fetch(ctx context.Context, rawURL string) (*assetEntry, error) {
+	if err := validateURL(rawURL); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("upstream returned %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxAssetSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxAssetSize {
+		return nil, errors.New("asset too large")
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	logger.Debug("🖼️ 资源已缓存", zap.String("url", rawURL), zap.String("size", formatBytes(len(data))))
+	return &assetEntry{contentType: contentType, data: data, fetchedAt: time.Now()}, nil
+}
+
+func (c *AssetCache) add(entry *assetEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, exists := c.items[entry.key]; exists {
+		c.removeElement(el)
+	}
+	c.items[entry.key] = c.ll.PushFront(entry)
+	c.size += int64(len(entry.data))
+	for c.size > c.maxBytes && c.ll.Len() > 1 {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// removeElement 调用方需持有锁
+func (c *AssetCache) removeElement(el *list.Element) {
+	entry := el.Value.(*assetEntry)
+	c.ll.Remove(el)
+	delete(c.items, entry.key)
+	c.size -= int64(len(entry.data))
+}
+
+func (c *AssetCache) loadDisk(key string) *assetEntry {
+	if c.dir == "" {
+		return nil
+	}
+	metaBytes, err := os.ReadFile(filepath.Join(c.dir, key+".json"))
+	if err != nil {
+		return nil
+	}
+	var meta assetMeta
+	if json.Unmarshal(metaBytes, &meta) != nil || time.Since(meta.FetchedAt) >= c.ttl {
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(c.dir, key))
+	if err != nil {
+		return nil
+	}
+	return &assetEntry{key: key, contentType: meta.ContentType, data: data, fetchedAt: meta.FetchedAt}
+}
+
+func (c *AssetCache) saveDisk(rawURL string, entry *assetEntry) {
+	if c.dir == "" {
+		return
+	}
+	meta, _ := json.Marshal(assetMeta{URL: rawURL, ContentType: entry.contentType, FetchedAt: entry.fetchedAt})
+	if err := os.WriteFile(filepath.Join(c.dir, entry.key), entry.data, 0644); err != nil {
+		logger.Debug("⚠️ 资源写入磁盘失败", zap.String("url", rawURL), zap.Error(err))
+		return
+	}
+	_ = os.WriteFile(filepath.Join(c.dir, entry.key+".json"), meta, 0644)
+}
+
+// gcLoop 定期清理磁盘上过期的资源
+func (c *AssetCache) gcLoop() {
+	if c.dir == "" {
+		return
+	}
+	ticker := time.NewTicker(time.Hour)
+	for range ticker.C {
+		entries, err := os.ReadDir(c.dir)
+		if err != nil {
+			continue
+		}
+		removed := 0
+		for _, e := range entries {
+			if !isCacheFile(e.Name()) {
+				continue // 目录中的其他文件不属于缓存
+			}
+			info, err := e.Info()
+			if err != nil || time.Since(info.ModTime()) < c.ttl {
+				continue
+			}
+			if os.Remove(filepath.Join(c.dir, e.Name())) == nil {
+				removed++
+			}
+		}
+		if removed > 0 {
+			logger.Debug("🗑️ 已清理过期资源缓存", zap.Int("files", removed))
+		}
+	}
+}
+
+func assetKey(rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return hex.EncodeToString(sum[:])
+}
+
+var remoteSrcRegex = regexp.MustCompile(`(<img\b[^>]*?\bsrc\s*=\s*["'])(https?://[^"']+)(["'])`)
+
+// assetRewriteMiddleware 将渲染结果中 <img src="http..."> 自动改写为代理地址
+func assetRewriteMiddleware(rc *RenderContext) error {
+	if rc.Payload.Output == "image" {
+		rc.HTML = remoteSrcRegex.ReplaceAllFunc(rc.HTML, func(m []byte) []byte {
+			parts := remoteSrcRegex.FindSubmatch(m)
+			// 模板已使用 html/template 转义，& 以 &amp; 形式出现
+			src := strings.ReplaceAll(string(parts[2]), "&amp;", "&")
+			return []byte(string(parts[1]) + globalAssetCache.ProxyURL(src) + string(parts[3]))
+		})
+	}
+	return rc.Next()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// 内置资源：默认配置与示例模板，首次运行无需手动放置任何文件
+//
+//go:embed assets
+var embeddedAssets embed.FS
+
+// defaultConfig 返回内置的默认配置文件内容
+func defaultConfig() []byte {
+	b, err := embeddedAssets.ReadFile("assets/snapcast.yaml")
+	if err != nil {
+		panic(err) // 构建时已嵌入，不会发生
+	}
+	return b
+}
+
+// scaffold 在 dir 下生成配置文件与示例模板，已存在的文件仅在 force 时覆盖。
+// 返回实际写入的文件列表。
+func scaffold(dir string, force bool) ([]string, error) {
+	var written []string
+	dst := filepath.Join(dir, "snapcast.yaml")
+	if ok, err := writeAsset(dst, defaultConfig(), force); err != nil {
+		return written, err
+	} else if ok {
+		written = append(written, dst)
+	}
+	files, err := scaffoldTemplates(filepath.Join(dir, "templates"), force)
+	return append(written, files...), err
+}
+
+// scaffoldTemplates 将内置示例模板及其示例数据释放到模板目录
+func scaffoldTemplates(dir string, force bool) ([]string, error) {
+	var written []string
+	err := fs.WalkDir(embeddedAssets, "assets/templates", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := embeddedAssets.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel("assets/templates", filepath.FromSlash(path))
+		dst := filepath.Join(dir, rel)
+		ok, err := writeAsset(dst, data, force)
+		if ok {
+			written = append(written, dst)
+		}
+		return err
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return written, fmt.Errorf("scaffold templates: %w", err)
+	}
+	return written, nil
+}
+
+// writeAsset 写入文件，已存在且未指定 force 时跳过，返回是否写入
+func writeAsset(dst string, data []byte, force bool) (bool, error) {
+	if _, err := os.Stat(dst); err == nil && !force {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(dst, data, 0644); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"math"
+	"path"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 多 token 与权限范围 ======
+//
+// auth.tokens 为不同的上游推送方分配独立凭据，可分别吊销：
+//
+//	auth:
+//	  tokens:
+//	    - name: "bili-bot"
+//	      token: "..."
+//	      scopes: ["bilibili/*"]   # 允许的 site/type，支持 * 通配，为空则不限
+//	      rate: 5                  # 该 token 每秒请求数，0 为不单独限流
+//	      burst: 10
+//	      claims: {team: [bili]}   # 自定义属性，供模板 .meta.yaml 中的 access 规则匹配
+//
+// 限定了 scopes 的 token 只能调用渲染与预览接口，不能使用 /capture 与管理接口。
+// auth.token 视为不限范围的 default token，不受模板 access 规则限制。
+
+// AuthToken auth.tokens 中的一项
+type AuthToken struct {
+	Name   string   `mapstructure:"name"`
+	Token  string   `mapstructure:"token"`
+	Scopes []string `mapstructure:"scopes"`
+	Rate   float64  `mapstructure:"rate"`
+	Burst  int      `mapstructure:"burst"`
+
+	Claims map[string][]string `mapstructure:"claims"`
+}
+
+// authPrincipal 通过认证的调用方
+type authPrincipal struct {
+	name   string
+	scopes []string
+	rate   float64
+	burst  int
+	claims map[string][]string
+
+	mu     sync.Mutex
+	bucket tokenBucket
+}
+
+var authTokens atomic.Pointer[map[string]*authPrincipal] // token → 调用方
+
+// ConfigureAuthTokens 加载 auth.tokens，由 ApplyDynamicConfig 调用；未变化的 token 保留限流状态
+func ConfigureAuthTokens() {
+	var list []AuthToken
+	if err := viper.UnmarshalKey("auth.tokens", &list); err != nil {
+		logger.Warn("❗ auth.tokens 格式无效", zap.Error(err))
+		return
+	}
+	var prev map[string]*authPrincipal
+	if p := authTokens.Load(); p != nil {
+		prev = *p
+	}
+	tokens := make(map[string]*authPrincipal, len(list))
+	for i, t := range list {
+		if t.Token == "" {
+			logger.Warn("❗ auth.tokens 中的 token 为空，已忽略", zap.Int("index", i), zap.String("name", t.Name))
+			continue
+		}
+		if t.Name == "" {
+			t.Name = "token-" + strconv.Itoa(i)
+		}
+		for _, scope := range t.Scopes {
+			if _, err := path.Match(scope, ""); err != nil {
+				logger.Warn("❗ auth.tokens 权限范围无效", zap.String("name", t.Name), zap.String("scope", scope))
+			}
+		}
+		if t.Rate > 0 && t.Burst <= 0 {
+			t.Burst = int(math.Ceil(t.Rate))
+		}
+		p := &authPrincipal{name: t.Name, scopes: t.Scopes, rate: t.Rate, burst: t.Burst, claims: t.Claims}
+		if old, exists := prev[t.Token]; exists && old.rate == p.rate && old.burst == p.burst {
+			old.mu.Lock()
+			p.bucket = old.bucket
+			old.mu.Unlock()
+		}
+		tokens[t.Token] = p
+	}
+	authTokens.Store(&tokens)
+}
+
+// lookupAuthToken 查找 token 对应的调用方；auth.token 匹配时返回不限范围的 default
+func lookupAuthToken(token, legacy string) *authPrincipal {
+	if token == "" {
+		return nil
+	}
+	if p := authTokens.Load(); p != nil {
+		if principal, found := (*p)[token]; found {
+			return principal
+		}
+	}
+	if legacy != "" && token == legacy {
+		return defaultPrincipal
+	}
+	return nil
+}
+
+var defaultPrincipal = &authPrincipal{name: "default"}
+
+// hasAuthTokens 是否配置了 auth.tokens
+func hasAuthTokens() bool {
+	p := authTokens.Load()
+	return p != nil && len(*p) > 0
+}
+
+// scoped 是否限定了权限范围
+func (p *authPrincipal) scoped() bool {
+	return len(p.scopes) > 0
+}
+
+// allows 是否允许渲染 site/type
+func (p *authPrincipal) allows(site, typ string) bool {
+	if !p.scoped() {
+		return true
+	}
+	target := site + "/" + typ
+	for _, scope := range p.scopes {
+		if matched, _ := path.Match(scope, target); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// canAccess 是否满足模板的 access 规则：token 名在 tokens 中，或 claims 的每一项都有相同的值。
+// 未认证（未配置认证或 HMAC 签名）与 auth.token 视为受信任的调用方，不受限制。
+func (p *authPrincipal) canAccess(a TemplateAccess) bool {
+	if a.empty() || p == nil || p == defaultPrincipal {
+		return true
+	}
+	if slices.Contains(a.Tokens, p.name) {
+		return true
+	}
+	if len(a.Claims) == 0 {
+		return false
+	}
+	for key, allowed := range a.Claims {
+		if !slices.ContainsFunc(p.claims[key], func(v string) bool { return slices.Contains(allowed, v) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// Allow token 级令牌桶限流，未配置 rate 时不限
+func (p *authPrincipal) Allow() (bool, time.Duration) {
+	if p.rate <= 0 {
+		return true, 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if p.bucket.last.IsZero() {
+		p.bucket = tokenBucket{tokens: float64(p.burst), last: now}
+	}
+	p.bucket.tokens = math.Min(float64(p.burst), p.bucket.tokens+now.Sub(p.bucket.last).Seconds()*p.rate)
+	p.bucket.last = now
+	if p.bucket.tokens >= 1 {
+		p.bucket.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - p.bucket.tokens) / p.rate * float64(time.Second))
+}
+
+type principalKey struct{}
+
+func withPrincipal(ctx context.Context, p *authPrincipal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// principalFrom 返回请求的调用方，未认证（未配置认证或 HMAC 签名）时为 nil
+func principalFrom(ctx context.Context) *authPrincipal {
+	p, _ := ctx.Value(principalKey{}).(*authPrincipal)
+	return p
+}
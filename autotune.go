@@ -0,0 +1,201 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 并发数自动调节 ======
+//
+// render.autotune.enabled 开启后，render.max_concurrency 只作为初始值，之后每个调节周期按
+// 主机 CPU/内存余量与截图平均耗时调整并发上限（加性增、乘性减）：
+//   - 任一指标超过目标：上限乘以 0.75（不低于 min）
+//   - 周期内出现排队且各项指标低于目标的 80%：上限加 1（不超过 max）
+//   - 其他情况保持不变
+//
+// 指标来自过载保护的后台采样（见 shedding.go），无需开启 render.shedding。
+
+type autotuneConfig struct {
+	enabled       bool
+	min, max      int32
+	cpu, memory   float64 // 目标使用率，0 为不检查
+	targetLatency time.Duration
+	interval      time.Duration
+}
+
+type autotuner struct {
+	mu       sync.Mutex
+	config   autotuneConfig
+	limit    int32 // 当前调节出的并发上限，未启用时为 0
+	lastTune time.Time
+	reason   string
+}
+
+var (
+	globalAutotune = &autotuner{}
+
+	// queueSaturated 调节周期内是否有请求需要排队，由 concurrentMutex 保护
+	queueSaturated bool
+
+	autotuneAdjustments = NewCounterVec("snapcast_autotune_adjustments_total", "Concurrency limit changes made by autotune, by direction.", "direction")
+)
+
+func init() {
+	NewGaugeFunc("snapcast_render_max_concurrency", "Current render concurrency limit.", func() float64 {
+		concurrentMutex.Lock()
+		defer concurrentMutex.Unlock()
+		return float64(maxConcurrent)
+	})
+}
+
+// ConfigureAutotune 读取 render.autotune，由 ApplyDynamicConfig 在 ConfigureRenderQueue 之后调用。
+// 已在调节中时保留当前上限（按新的 min/max 截断），而不是回到 max_concurrency。
+func ConfigureAutotune(initial int) {
+	cfg := autotuneConfig{
+		enabled:       viper.GetBool("render.autotune.enabled"),
+		min:           2,
+		max:           int32(max(initial*2, 4)),
+		cpu:           0.8,
+		memory:        0.85,
+		targetLatency: 3 * time.Second,
+		interval:      10 * time.Second,
+	}
+	if viper.IsSet("render.autotune.min") {
+		cfg.min = int32(viper.GetInt("render.autotune.min"))
+	}
+	if viper.IsSet("render.autotune.max") {
+		cfg.max = int32(viper.GetInt("render.autotune.max"))
+	}
+	if cfg.min < 1 || cfg.max < cfg.min {
+		logger.Warn("❗ render.autotune 需满足 1 <= min <= max", zap.Int32("min", cfg.min), zap.Int32("max", cfg.max))
+		cfg.min, cfg.max = 1, max(int32(initial), 1)
+	}
+	for key, dst := range map[string]*float64{"cpu": &cfg.cpu, "memory": &cfg.memory} {
+		if !viper.IsSet("render.autotune." + key) {
+			continue
+		}
+		if v := viper.GetFloat64("render.autotune." + key); v >= 0 && v <= 1 {
+			*dst = v
+		} else {
+			logger.Warn("❗ render.autotune."+key+" 应在 0-1 之间", zap.Float64(key, v), zap.Float64("default", *dst))
+		}
+	}
+	for key, dst := range map[string]*time.Duration{"target_latency": &cfg.targetLatency, "interval": &cfg.interval} {
+		if !viper.IsSet("render.autotune." + key) {
+			continue
+		}
+		if d, err := ParseDuration(viper.Get("render.autotune." + key)); err == nil && d > 0 {
+			*dst = d
+		} else {
+			logger.Warn("❗ render.autotune."+key+" 值无效", zap.Any(key, viper.Get("render.autotune."+key)), zap.Duration("default", *dst))
+		}
+	}
+
+	t := globalAutotune
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.config = cfg
+	if !cfg.enabled {
+		t.limit = 0
+		return
+	}
+	if t.limit == 0 {
+		t.limit = int32(initial)
+	}
+	t.limit = min(max(t.limit, cfg.min), cfg.max)
+	setMaxConcurrent(t.limit)
+}
+
+// setMaxConcurrent 更新并发上限，调大时立即唤醒排队的请求
+func setMaxConcurrent(limit int32) {
+	concurrentMutex.Lock()
+	defer concurrentMutex.Unlock()
+	maxConcurrent = limit
+	grantWaitersLocked()
+}
+
+// StartAutotune 启动后台调节，周期由 render.autotune.interval 决定
+func StartAutotune() {
+	go func() {
+		for {
+			globalAutotune.mu.Lock()
+			interval := globalAutotune.config.interval
+			globalAutotune.mu.Unlock()
+			if interval <= 0 {
+				interval = 10 * time.Second
+			}
+			time.Sleep(interval)
+			globalAutotune.tune()
+		}
+	}()
+}
+
+func (t *autotuner) tune() {
+	concurrentMutex.Lock()
+	saturated := queueSaturated || len(renderQueue) > 0
+	queueSaturated = false
+	concurrentMutex.Unlock()
+
+	globalLoad.mu.Lock()
+	cpu, memory, latency := globalLoad.cpu, globalLoad.memory, globalLoad.chromeLatency
+	globalLoad.mu.Unlock()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cfg := t.config
+	if !cfg.enabled || t.limit == 0 {
+		return
+	}
+	// 返回超过 target*factor 的指标
+	over := func(factor float64) string {
+		switch {
+		case cfg.cpu > 0 && cpu >= cfg.cpu*factor:
+			return "cpu"
+		case cfg.memory > 0 && memory >= cfg.memory*factor:
+			return "memory"
+		case cfg.targetLatency > 0 && float64(latency) >= float64(cfg.targetLatency)*factor:
+			return "latency"
+		}
+		return ""
+	}
+
+	prev := t.limit
+	if reason := over(1); reason != "" {
+		t.limit = max(cfg.min, int32(math.Floor(float64(t.limit)*0.75)))
+		t.reason = reason
+	} else if saturated && over(0.8) == "" {
+		t.limit = min(cfg.max, t.limit+1)
+		t.reason = "headroom"
+	}
+	if t.limit == prev {
+		return
+	}
+	t.lastTune = time.Now()
+	direction := "up"
+	if t.limit < prev {
+		direction = "down"
+	}
+	autotuneAdjustments.Inc(direction)
+	logger.Info("🎚️ 自动调整并发上限", zap.Int32("from", prev), zap.Int32("to", t.limit), zap.String("reason", t.reason),
+		zap.Float64("cpu", round2(cpu)), zap.Float64("memory", round2(memory)), zap.Duration("chrome_latency", latency))
+	setMaxConcurrent(t.limit)
+}
+
+// autotuneStatus 管理接口展示的调节状态，未启用时为 nil
+func autotuneStatus() map[string]any {
+	t := globalAutotune
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.config.enabled {
+		return nil
+	}
+	status := map[string]any{"limit": t.limit, "min": t.config.min, "max": t.config.max, "reason": t.reason}
+	if !t.lastTune.IsZero() {
+		status["last_adjusted"] = t.lastTune.Format(time.RFC3339)
+	}
+	return status
+}
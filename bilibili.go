@@ -0,0 +1,345 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ====== B 站适配器 ======
+//
+// adapter: bilibili 识别以下原始数据，接口响应可以带外层的 {"code": 0, "data": ...}：
+//   - 动态详情与动态列表项（x/polymer/web-dynamic，含 modules 的 item），转发动态的原动态在 forward 中
+//   - 旧版动态接口（dynamic_svr，desc + JSON 字符串 card）
+//   - 直播间信息（getInfoByRoom 的 room_info + anchor_info，或 Room/get_info）
+//   - 直播间 WebSocket 消息 LIVE、PREPARING、ROOM_CHANGE
+
+// biliTimeZone B 站接口中不带时区的时间均为北京时间
+var biliTimeZone = time.FixedZone("CST", 8*3600)
+
+func adaptBilibili(data any) (*Card, error) {
+	root := data
+	if hasPath(root, "code") && hasPath(root, "data") {
+		if code := pathInt(root, "code"); code != 0 {
+			return nil, fmt.Errorf("api error %d: %s", code, pathString(root, "message"))
+		}
+		root, _ = lookupPath(root, "data")
+	}
+	if item, found := lookupPath(root, "item"); found {
+		root = item
+	}
+
+	var card *Card
+	switch {
+	case hasPath(root, "modules"):
+		card = biliDynamic(root)
+	case hasPath(root, "desc.dynamic_id_str") || hasPath(root, "desc.dynamic_id"):
+		card = biliLegacyDynamic(root)
+	case hasPath(root, "cmd"):
+		card = biliLiveMessage(root)
+	case hasPath(root, "room_info"):
+		card = biliLiveRoom(root)
+	case hasPath(root, "room_id") && hasPath(root, "live_status"):
+		card = biliRoomInfo(root)
+	}
+	if card == nil {
+		return nil, errUnrecognizedPayload
+	}
+	card.Raw = data
+	return card, nil
+}
+
+// biliDynamic 新版动态（web-dynamic 接口的 item）
+func biliDynamic(item any) *Card {
+	author, _ := lookupPath(item, "modules.module_author")
+	dyn, _ := lookupPath(item, "modules.module_dynamic")
+	card := &Card{
+		Site: "bilibili",
+		Kind: "dynamic",
+		ID:   pathString(item, "id_str"),
+		Author: CardAuthor{
+			ID:     pathString(author, "mid"),
+			Name:   pathString(author, "name"),
+			Avatar: absoluteURL(pathString(author, "face")),
+			URL:    absoluteURL(pathString(author, "jump_url")),
+		},
+		Text: pathString(dyn, "desc.text"),
+		Stats: CardStats{
+			Likes:    pathInt(item, "modules.module_stat.like.count"),
+			Comments: pathInt(item, "modules.module_stat.comment.count"),
+			Forwards: pathInt(item, "modules.module_stat.forward.count"),
+		},
+		Time: unixTime(pathInt(author, "pub_ts")),
+	}
+	if card.ID != "" {
+		card.URL = "https://t.bilibili.com/" + card.ID
+	}
+	if card.Author.URL == "" && card.Author.ID != "" {
+		card.Author.URL = "https://space.bilibili.com/" + card.Author.ID
+	}
+
+	major, _ := lookupPath(dyn, "major")
+	switch pathString(major, "type") {
+	case "MAJOR_TYPE_DRAW":
+		for _, img := range pathList(major, "draw.items") {
+			card.Images = append(card.Images, CardImage{URL: absoluteURL(pathString(img, "src")), Width: int(pathInt(img, "width")), Height: int(pathInt(img, "height"))})
+		}
+	case "MAJOR_TYPE_OPUS":
+		card.Title = pathString(major, "opus.title")
+		if card.Text == "" {
+			card.Text = pathString(major, "opus.summary.text")
+		}
+		for _, img := range pathList(major, "opus.pics") {
+			card.Images = append(card.Images, CardImage{URL: absoluteURL(pathString(img, "url")), Width: int(pathInt(img, "width")), Height: int(pathInt(img, "height"))})
+		}
+	case "MAJOR_TYPE_ARCHIVE":
+		card.Kind = "video"
+		card.Title = pathString(major, "archive.title")
+		card.Cover = absoluteURL(pathString(major, "archive.cover"))
+		card.Stats.Views = biliCount(pathString(major, "archive.stat.play"))
+		if url := pathString(major, "archive.jump_url"); url != "" {
+			card.URL = absoluteURL(url)
+		}
+		if card.Text == "" {
+			card.Text = pathString(major, "archive.desc")
+		}
+	case "MAJOR_TYPE_ARTICLE":
+		card.Kind = "article"
+		card.Title = pathString(major, "article.title")
+		card.Cover = absoluteURL(pathString(major, "article.covers.0"))
+		if url := pathString(major, "article.jump_url"); url != "" {
+			card.URL = absoluteURL(url)
+		}
+		if card.Text == "" {
+			card.Text = pathString(major, "article.desc")
+		}
+	case "MAJOR_TYPE_LIVE_RCMD":
+		// 直播推荐的 content 为 JSON 字符串
+		var content any
+		if json.Unmarshal([]byte(pathString(major, "live_rcmd.content")), &content) == nil {
+			info, _ := lookupPath(content, "live_play_info")
+			card.Kind = "live"
+			card.Title = pathString(info, "title")
+			card.Cover = absoluteURL(pathString(info, "cover"))
+			card.Stats.Online = pathInt(info, "online")
+			card.Live = &CardLive{
+				RoomID:     pathInt(info, "room_id"),
+				Status:     biliLiveStatus(pathInt(info, "live_status")),
+				Area:       pathString(info, "area_name"),
+				ParentArea: pathString(info, "parent_area_name"),
+			}
+			if card.Live.RoomID != 0 {
+				card.URL = fmt.Sprintf("https://live.bilibili.com/%d", card.Live.RoomID)
+			}
+		}
+	}
+
+	if orig, found := lookupPath(item, "orig"); found && orig != nil {
+		card.Kind = "forward"
+		card.Forward = biliDynamic(orig)
+	}
+	return card
+}
+
+// biliLegacyDynamic 旧版动态（dynamic_svr 接口，card 为 JSON 字符串）
+func biliLegacyDynamic(item any) *Card {
+	desc, _ := lookupPath(item, "desc")
+	var body any
+	if s, isString := lookupPathString(item, "card"); isString {
+		_ = json.Unmarshal([]byte(s), &body)
+	} else {
+		body, _ = lookupPath(item, "card")
+	}
+	card := &Card{
+		Site: "bilibili",
+		Kind: "dynamic",
+		ID:   pathString(desc, "dynamic_id_str"),
+		Author: CardAuthor{
+			ID:     pathString(desc, "user_profile.info.uid"),
+			Name:   pathString(desc, "user_profile.info.uname"),
+			Avatar: absoluteURL(pathString(desc, "user_profile.info.face")),
+		},
+		Stats: CardStats{
+			Likes:    pathInt(desc, "like"),
+			Comments: pathInt(desc, "comment"),
+			Forwards: pathInt(desc, "repost"),
+			Views:    pathInt(desc, "view"),
+		},
+		Time: unixTime(pathInt(desc, "timestamp")),
+	}
+	if card.ID == "" {
+		card.ID = pathString(desc, "dynamic_id")
+	}
+	if card.Author.ID == "" {
+		card.Author.ID = pathString(desc, "uid")
+	}
+	if card.ID != "" {
+		card.URL = "https://t.bilibili.com/" + card.ID
+	}
+	if card.Author.ID != "" {
+		card.Author.URL = "https://space.bilibili.com/" + card.Author.ID
+	}
+
+	switch pathInt(desc, "type") {
+	case 1: // 转发
+		card.Kind = "forward"
+		card.Text = pathString(body, "item.content")
+		origin := map[string]any{
+			"desc": map[string]any{
+				"type":           valueAt(desc, "orig_type"),
+				"dynamic_id_str": pathString(desc, "orig_dy_id_str"),
+				"user_profile":   valueAt(body, "origin_user"),
+			},
+			"card": valueAt(body, "origin"),
+		}
+		card.Forward = biliLegacyDynamic(origin)
+	case 2: // 图文
+		card.Text = pathString(body, "item.description")
+		for _, img := range pathList(body, "item.pictures") {
+			card.Images = append(card.Images, CardImage{URL: absoluteURL(pathString(img, "img_src")), Width: int(pathInt(img, "img_width")), Height: int(pathInt(img, "img_height"))})
+		}
+	case 4: // 纯文字
+		card.Text = pathString(body, "item.content")
+	case 8: // 视频
+		card.Kind = "video"
+		card.Title = pathString(body, "title")
+		card.Text = pathString(body, "dynamic")
+		if card.Text == "" {
+			card.Text = pathString(body, "desc")
+		}
+		card.Cover = absoluteURL(pathString(body, "pic"))
+		card.Stats.Views = pathInt(body, "stat.view")
+		if url := pathString(body, "short_link_v2"); url != "" {
+			card.URL = url
+		}
+	case 64: // 专栏
+		card.Kind = "article"
+		card.Title = pathString(body, "title")
+		card.Text = pathString(body, "summary")
+		card.Cover = absoluteURL(pathString(body, "image_urls.0"))
+		if card.Cover == "" {
+			card.Cover = absoluteURL(pathString(body, "banner_url"))
+		}
+		if id := pathString(body, "id"); id != "" {
+			card.URL = "https://www.bilibili.com/read/cv" + id
+		}
+	}
+	return card
+}
+
+// biliLiveRoom 直播间信息（getInfoByRoom）
+func biliLiveRoom(data any) *Card {
+	room, _ := lookupPath(data, "room_info")
+	anchor, _ := lookupPath(data, "anchor_info.base_info")
+	card := biliRoomInfo(room)
+	card.Author.Name = pathString(anchor, "uname")
+	card.Author.Avatar = absoluteURL(pathString(anchor, "face"))
+	if card.Time == "" {
+		card.Time = unixTime(pathInt(room, "live_start_time"))
+	}
+	return card
+}
+
+// biliRoomInfo 直播间信息（Room/get_info 或 room_info）
+func biliRoomInfo(room any) *Card {
+	card := &Card{
+		Site:  "bilibili",
+		Kind:  "live",
+		ID:    pathString(room, "room_id"),
+		Title: pathString(room, "title"),
+		Text:  pathString(room, "description"),
+		Cover: absoluteURL(pathString(room, "user_cover")),
+		Author: CardAuthor{
+			ID: pathString(room, "uid"),
+		},
+		Stats: CardStats{Online: pathInt(room, "online")},
+		Time:  biliLocalTime(pathString(room, "live_time")),
+		Live: &CardLive{
+			RoomID:     pathInt(room, "room_id"),
+			Status:     biliLiveStatus(pathInt(room, "live_status")),
+			Area:       pathString(room, "area_name"),
+			ParentArea: pathString(room, "parent_area_name"),
+		},
+	}
+	if card.Cover == "" {
+		card.Cover = absoluteURL(pathString(room, "cover"))
+	}
+	if card.ID != "" {
+		card.URL = "https://live.bilibili.com/" + card.ID
+	}
+	if card.Author.ID != "" {
+		card.Author.URL = "https://space.bilibili.com/" + card.Author.ID
+	}
+	return card
+}
+
+// biliLiveMessage 直播间 WebSocket 消息，其他 cmd 视为无法识别
+func biliLiveMessage(msg any) *Card {
+	// 部分 cmd 带有协议版本后缀，如 DANMU_MSG:4:0:2:2:2:0
+	cmd, _, _ := strings.Cut(pathString(msg, "cmd"), ":")
+	roomID := pathInt(msg, "roomid")
+	if roomID == 0 {
+		roomID = pathInt(msg, "data.roomid")
+	}
+	card := &Card{Site: "bilibili", Kind: "live", Live: &CardLive{RoomID: roomID}}
+	switch cmd {
+	case "LIVE":
+		card.Live.Status = "live"
+		card.Time = unixTime(pathInt(msg, "live_time"))
+	case "PREPARING":
+		card.Live.Status = "offline"
+		if pathString(msg, "round") == "1" {
+			card.Live.Status = "round"
+		}
+	case "ROOM_CHANGE":
+		card.Live.Status = "live"
+		card.Title = pathString(msg, "data.title")
+		card.Live.Area = pathString(msg, "data.area_name")
+		card.Live.ParentArea = pathString(msg, "data.parent_area_name")
+	default:
+		return nil
+	}
+	if roomID != 0 {
+		card.ID = strconv.FormatInt(roomID, 10)
+		card.URL = "https://live.bilibili.com/" + card.ID
+	}
+	return card
+}
+
+func biliLiveStatus(status int64) string {
+	switch status {
+	case 1:
+		return "live"
+	case 2:
+		return "round"
+	}
+	return "offline"
+}
+
+// biliLocalTime 解析 "2006-01-02 15:04:05" 格式的北京时间，未开播时接口返回 0000-00-00 00:00:00
+func biliLocalTime(s string) string {
+	t, err := time.ParseInLocation(time.DateTime, s, biliTimeZone)
+	if err != nil || t.Year() < 2000 {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// biliCount 解析播放量等计数，支持 "1.2万"、"3亿" 这样的缩写
+func biliCount(s string) int64 {
+	s = strings.TrimSpace(s)
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(s, "万"):
+		multiplier, s = 1e4, strings.TrimSuffix(s, "万")
+	case strings.HasSuffix(s, "亿"):
+		multiplier, s = 1e8, strings.TrimSuffix(s, "亿")
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return int64(f * multiplier)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 浏览器回收 ======
+//
+// 本地浏览器每一代启动一个 Chrome 进程，该代的渲染都是其中的标签页，各自使用独立的浏览器上下文
+// （Cookie、存储互不可见）。长时间运行后 Chrome 会残留缓存与临时文件，内存缓慢上涨。
+// render.recycle 配置后，累计渲染次数达到 after_renders 或浏览器进程常驻内存合计超过
+// max_rss_mb 时，新标签页改用新一代浏览器，旧浏览器等待已打开的标签页结束（最长
+// drain_timeout）后关闭，由 chromedp 结束其全部进程并清理临时目录。浏览器意外退出时立即换代。
+// 远程浏览器每次渲染单独连接，不回收。
+
+// allocatorGeneration 一代浏览器
+type allocatorGeneration struct {
+	ctx     context.Context // 分配器
+	cancel  context.CancelFunc
+	tabs    sync.WaitGroup // 已打开未关闭的标签页
+	renders int64          // 已打开的标签页数，受 allocMu 保护
+	started time.Time
+
+	startMu      sync.Mutex
+	browser      context.Context // 本代共用的浏览器，首个标签页打开时启动
+	closeBrowser context.CancelFunc
+}
+
+type recycleConfig struct {
+	afterRenders int64
+	maxRSS       int64 // 字节
+	drain        time.Duration
+	minInterval  time.Duration // 两次回收的最小间隔，避免内存持续超限时反复重启
+}
+
+var (
+	allocMu      sync.Mutex
+	allocCurrent *allocatorGeneration
+	allocFactory func() (context.Context, context.CancelFunc)
+	allocRemote  bool
+	allocDrain   sync.WaitGroup // 正在排空的旧分配器
+
+	recycleSettings atomic.Pointer[recycleConfig]
+	browserRecycles = NewCounterVec("snapcast_browser_recycles_total", "Browser allocator restarts by reason.", "reason")
+)
+
+func init() {
+	NewGaugeFunc("snapcast_browser_rss_bytes", "Total resident memory of local browser processes.", func() float64 {
+		_, rss := browserProcesses()
+		return float64(rss)
+	})
+	NewGaugeFunc("snapcast_browser_processes", "Number of local browser processes.", func() float64 {
+		procs, _ := browserProcesses()
+		return float64(len(procs))
+	})
+	NewGaugeFunc("snapcast_browser_generation_renders", "Tabs opened by the current browser allocator.", func() float64 {
+		allocMu.Lock()
+		defer allocMu.Unlock()
+		if allocCurrent == nil {
+			return 0
+		}
+		return float64(allocCurrent.renders)
+	})
+}
+
+// setAllocator 以 factory 创建分配器并设置 globalAllocCancel，后者关闭当前及正在排空的分配器
+func setAllocator(factory func() (context.Context, context.CancelFunc), remote bool) {
+	ctx, cancel := factory()
+	allocMu.Lock()
+	allocFactory, allocRemote = factory, remote
+	allocCurrent = &allocatorGeneration{ctx: ctx, cancel: cancel, started: time.Now()}
+	allocMu.Unlock()
+	globalAllocCancel = closeAllocators
+}
+
+// closeAllocators 关闭当前分配器，并等待排空中的旧分配器关闭
+func closeAllocators() {
+	allocMu.Lock()
+	cur := allocCurrent
+	allocCurrent = nil
+	allocMu.Unlock()
+	if cur != nil {
+		cur.close()
+	}
+	allocDrain.Wait()
+}
+
+// close 关闭本代浏览器及其分配器
+func (g *allocatorGeneration) close() {
+	g.startMu.Lock()
+	if g.closeBrowser != nil {
+		g.closeBrowser()
+	}
+	g.startMu.Unlock()
+	g.cancel()
+}
+
+// sharedBrowser 返回本代共用的浏览器，首次调用时启动；启动失败返回 nil，由标签页各自启动浏览器并报告错误
+func (g *allocatorGeneration) sharedBrowser() context.Context {
+	g.startMu.Lock()
+	defer g.startMu.Unlock()
+	if g.browser != nil || g.ctx.Err() != nil {
+		return g.browser
+	}
+	ctx, cancel := chromedp.NewContext(g.ctx)
+	if err := chromedp.Run(ctx); err != nil {
+		cancel()
+		logger.Warn("⚠️ 启动浏览器失败", zap.Error(err))
+		return nil
+	}
+	g.browser, g.closeBrowser = ctx, cancel
+	go g.watchCrash(ctx)
+	return ctx
+}
+
+// watchCrash 浏览器进程意外退出时立即换代，已打开的标签页随之失败
+func (g *allocatorGeneration) watchCrash(ctx context.Context) {
+	select {
+	case <-chromedp.FromContext(ctx).Browser.LostConnection:
+	case <-ctx.Done():
+		return
+	}
+	if ctx.Err() != nil {
+		return // 正常关闭
+	}
+	allocMu.Lock()
+	defer allocMu.Unlock()
+	if allocCurrent == g {
+		logger.Error("❌ 浏览器意外退出，启动新浏览器")
+		replaceLocked("crash", 0)
+	}
+}
+
+// acquireBrowser 返回新标签页的父 context，release 在标签页关闭时调用。
+// shared 为 true 时父 context 为本代共用的浏览器；dedicated 或远程浏览器时为分配器，标签页单独启动（连接）浏览器
+func acquireBrowser(dedicated bool) (ctx context.Context, shared bool, release func()) {
+	allocMu.Lock()
+	cfg := recycleSettings.Load()
+	if cfg != nil && cfg.afterRenders > 0 && allocCurrent != nil && allocCurrent.renders >= cfg.afterRenders {
+		recycleLocked("renders", cfg)
+	}
+	gen := allocCurrent
+	if gen == nil { // 已关闭，返回已取消的 context
+		allocMu.Unlock()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		return ctx, false, func() {}
+	}
+	gen.renders++
+	gen.tabs.Add(1)
+	remote := allocRemote
+	allocMu.Unlock()
+	var once sync.Once
+	release = func() { once.Do(gen.tabs.Done) }
+	if !remote && !dedicated {
+		if browser := gen.sharedBrowser(); browser != nil {
+			return browser, true, release
+		}
+	}
+	return gen.ctx, false, release
+}
+
+// recycleLocked 切换到新一代浏览器，旧浏览器在后台排空后关闭，需持有 allocMu
+func recycleLocked(reason string, cfg *recycleConfig) bool {
+	old := allocCurrent
+	if old == nil || allocRemote || allocFactory == nil || time.Since(old.started) < cfg.minInterval {
+		return false
+	}
+	logger.Info("♻️ 回收浏览器", zap.String("reason", reason), zap.Int64("renders", old.renders), zap.Duration("age", time.Since(old.started).Round(time.Second)))
+	replaceLocked(reason, cfg.drain)
+	return true
+}
+
+// replaceLocked 以新分配器替换当前一代，旧一代等待标签页结束（最长 drain）后关闭，需持有 allocMu
+func replaceLocked(reason string, drain time.Duration) {
+	old := allocCurrent
+	ctx, cancel := allocFactory()
+	allocCurrent = &allocatorGeneration{ctx: ctx, cancel: cancel, started: time.Now()}
+	browserRecycles.Inc(reason)
+
+	allocDrain.Add(1)
+	go func() {
+		defer allocDrain.Done()
+		done := make(chan struct{})
+		go func() {
+			old.tabs.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(drain):
+			if drain > 0 {
+				logger.Warn("⚠️ 旧浏览器排空超时，强制关闭", zap.Duration("drain_timeout", drain))
+			}
+		}
+		old.close()
+	}()
+}
+
+// ConfigureBrowserRecycle 读取 render.recycle 配置，由 ApplyDynamicConfig 调用
+func ConfigureBrowserRecycle() {
+	cfg := &recycleConfig{
+		afterRenders: viper.GetInt64("render.recycle.after_renders"),
+		maxRSS:       viper.GetInt64("render.recycle.max_rss_mb") << 20,
+		drain:        60 * time.Second,
+		minInterval:  time.Minute,
+	}
+	if d, err := ParseDuration(viper.Get("render.recycle.drain_timeout")); err != nil {
+		logger.Warn("❗ render.recycle.drain_timeout 无效，使用 60s", zap.Error(err))
+	} else if d > 0 {
+		cfg.drain = d
+	}
+	if d, err := ParseDuration(viper.Get("render.recycle.min_interval")); err != nil {
+		logger.Warn("❗ render.recycle.min_interval 无效，使用 1m", zap.Error(err))
+	} else if d > 0 {
+		cfg.minInterval = d
+	}
+	if cfg.afterRenders <= 0 && cfg.maxRSS <= 0 {
+		recycleSettings.Store(nil)
+		return
+	}
+	if viper.GetString("render.remote_debugging_url") != "" {
+		logger.Warn("⚠️ 远程浏览器不支持 render.recycle，需由浏览器所在的服务自行重启")
+	}
+	recycleSettings.Store(cfg)
+}
+
+// StartBrowserRecycler 定期检查浏览器进程内存，超过 render.recycle.max_rss_mb 时回收
+func StartBrowserRecycler(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			cfg := recycleSettings.Load()
+			if cfg == nil || cfg.maxRSS <= 0 {
+				continue
+			}
+			_, rss := browserProcesses()
+			if rss <= cfg.maxRSS {
+				continue
+			}
+			allocMu.Lock()
+			if recycleLocked("memory", cfg) {
+				logger.Warn("⚠️ 浏览器内存超过上限", zap.Int64("rss_mb", rss>>20), zap.Int64("max_rss_mb", cfg.maxRSS>>20))
+			}
+			allocMu.Unlock()
+		}
+	}()
+}
@@ -1,17 +1,14 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"image"
-	"image/draw"
-	"image/png"
 	"net"
 	"net/http"
 	"net/url"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/chromedp/cdproto/emulation"
@@ -32,6 +29,9 @@ type CaptureOptions struct {
 	UserAgent string           `json:"user_agent,omitempty"`
 	Viewport  *ViewportOptions `json:"viewport,omitempty"`
 	FullPage  *bool            `json:"full_page,omitempty"` // nil 表示默认 true
+
+	PostProcess *PostProcessOptions `json:"postprocess,omitempty"` // 图片后处理，覆盖 render.postprocess
+	Watermark   *bool               `json:"watermark,omitempty"`   // false 时不叠加水印
 }
 
 type ViewportOptions struct {
@@ -57,20 +57,20 @@ func isPrivateIP(ipStr string) bool {
 	if ip == nil {
 		return false
 	}
-	// 10.0.0.0/8
+	// 10.0.0.0/8、172.16.0.0/12、192.168.0.0/16、fc00::/7
 	if ip.IsPrivate() {
 		return true
 	}
-	// 169.254.0.0/16 (link-local)
-	if bytes.HasPrefix(ip, []byte{169, 254}) {
+	// 169.254.0.0/16、fe80::/10 (link-local，含云厂商元数据地址)
+	if ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
 		return true
 	}
-	// 127.0.0.0/8 (loopback)
+	// 127.0.0.0/8、::1 (loopback)
 	if ip.IsLoopback() {
 		return true
 	}
-	// 0.0.0.0/8
-	if ip.Equal(net.IPv4zero) {
+	// 0.0.0.0/8、::
+	if ip.IsUnspecified() || (ip.To4() != nil && ip.To4()[0] == 0) {
 		return true
 	}
 	return false
@@ -135,40 +135,89 @@ func validateURL(rawURL string) error {
 	return nil
 }
 
-// ====== 处理器 ======
+// newFetchClient 返回服务端拉取远程资源用的 http.Client：每次跳转都重新经过 validateURL，
+// 建立连接时再检查实际连接的 IP，防止 DNS 重绑定绕过校验。经 HTTP(S)_PROXY 代理时由代理解析域名，只校验地址本身。
+func newFetchClient(timeout time.Duration) *http.Client {
+	guarded := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if isPrivateIP(host) {
+				return fmt.Errorf("禁止访问内网 IP: %s", host)
+			}
+			return nil
+		},
+	}
+	plain := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	proxies := envProxyAddrs()
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if proxies[addr] {
+			return plain.DialContext(ctx, network, addr)
+		}
+		return guarded.DialContext(ctx, network, addr)
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return validateURL(req.URL.String())
+		},
+	}
+}
 
-func CaptureHandler(c *gin.Context) {
-	// 获取信号量，超时 5 秒
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
-	defer cancel()
+// envProxyAddrs 环境变量中配置的代理地址（host:port）
+func envProxyAddrs() map[string]bool {
+	addrs := make(map[string]bool)
+	for _, scheme := range []string{"http", "https"} {
+		u, err := http.ProxyFromEnvironment(&http.Request{URL: &url.URL{Scheme: scheme, Host: "snapcast.invalid"}})
+		if err != nil || u == nil {
+			continue
+		}
+		port := u.Port()
+		if port == "" {
+			port = map[string]string{"http": "80", "https": "443", "socks5": "1080"}[u.Scheme]
+		}
+		addrs[net.JoinHostPort(u.Hostname(), port)] = true
+	}
+	return addrs
+}
 
-	_ = ctx // ctx 用于超时控制，实际渲染使用新 tab
+// ====== 处理器 ======
 
+func CaptureHandler(c *gin.Context) {
 	// 尝试获取并发许可
-	concurrentMutex.Lock()
-	if currentConcurrent >= maxConcurrent {
-		concurrentMutex.Unlock()
-		c.JSON(http.StatusServiceUnavailable, errResp("server busy, try again later"))
+	release, acquired := acquireRequestSlot(c, "capture", 0)
+	if !acquired {
 		return
 	}
-	currentConcurrent++
-	concurrentMutex.Unlock()
-	defer func() {
-		concurrentMutex.Lock()
-		currentConcurrent--
-		concurrentMutex.Unlock()
-	}()
+	defer release()
 
+	log := loggerFor(c.Request.Context())
+	if p := principalFrom(c.Request.Context()); p != nil && p.scoped() {
+		log.Warn("⛔ token 权限范围不包含 capture", zap.String("token", p.name))
+		c.JSON(http.StatusForbidden, errResp("token scope does not allow capture"))
+		return
+	}
 	var payload CapturePayload
 	if err := c.ShouldBindJSON(&payload); err != nil {
-		logger.Error("❕ 传递参数有误", zap.Error(err))
+		log.Error("❕ 传递参数有误", zap.Error(err))
+		c.Set("render_error", err.Error())
 		c.JSON(http.StatusBadRequest, errResp(err.Error()))
 		return
 	}
 
 	// 校验 URL
 	if err := validateURL(payload.URL); err != nil {
-		logger.Warn("⛔ URL 校验失败", zap.String("url", payload.URL), zap.Error(err))
+		log.Warn("⛔ URL 校验失败", zap.String("url", payload.URL), zap.Error(err))
+		c.Set("render_error", err.Error())
 		c.JSON(http.StatusBadRequest, errResp(err.Error()))
 		return
 	}
@@ -185,63 +234,73 @@ func CaptureHandler(c *gin.Context) {
 		fullPage = *opts.FullPage
 	}
 
-	// 解析 timeout
-	timeout, err := ParseDuration(opts.Timeout)
+	// 解析并校验渲染参数，视口缺失的字段使用 capture.viewport 默认值
+	ro, err := RenderOptions{Timeout: opts.Timeout, UserAgent: opts.UserAgent, Viewport: opts.Viewport, PostProcess: opts.PostProcess, Watermark: opts.Watermark}.withDefaults(currentRenderDefaults(), true)
 	if err != nil {
-		logger.Warn("❕ 无效的 timeout 参数", zap.Any("timeout", opts.Timeout))
+		log.Warn("❕ 无效的捕获参数", zap.Error(err))
+		c.Set("render_error", err.Error())
 		c.JSON(http.StatusBadRequest, errResp(err.Error()))
 		return
 	}
-	timeoutMs := timeout.Milliseconds()
-	if timeoutMs <= 0 {
-		timeoutMs = renderTimeout.Load()
-	}
-
-	// 设置 UserAgent
-	userAgent := opts.UserAgent
 
-	logger.Debug("🔍 开始捕获", zap.String("url", payload.URL), zap.Int64("timeout", timeoutMs), zap.String("ua", userAgent), zap.Bool("full_page", fullPage))
+	log.Debug("🔍 开始捕获", zap.String("url", payload.URL), zap.Int64("timeout", ro.TimeoutMs), zap.String("ua", ro.UserAgent), zap.Bool("full_page", fullPage))
 
 	// 执行截图
-	imgBytes, err := CaptureScreenshot(payload.URL, timeoutMs, userAgent, opts.Viewport, fullPage)
+	start := time.Now()
+	tracker := newResourceTracker(log)
+	defer tracker.Close()
+	ctx := withResourceTracker(c.Request.Context(), tracker)
+	imgBytes, err := CaptureScreenshot(ctx, payload.URL, ro, fullPage)
+	c.Set("capture_url", payload.URL)
+	if err == nil && ro.PostProcess.active() {
+		imgBytes, err = postProcessPNG(imgBytes, ro.PostProcess)
+	}
+	if err == nil && watermarkEnabled(ro) {
+		if marked, werr := watermarkPNG(ctx, imgBytes, ro); werr != nil {
+			log.Warn("❕ 水印叠加失败，输出不带水印的图片", zap.Error(werr))
+		} else {
+			imgBytes = marked
+		}
+	}
+	if err == nil {
+		imgBytes, err = applyColorProfile(imgBytes)
+	}
+	if err == nil {
+		err = checkOutputSize("image", len(imgBytes))
+	}
+	if err == nil && globalSigner != nil {
+		var sig string
+		imgBytes, sig = globalSigner.Sign(imgBytes, "image/png")
+		setSignatureHeaders(c, sig)
+	}
 	if err != nil {
-		logger.Error("❌ 捕获失败", zap.Error(err), zap.String("url", payload.URL))
+		log.Error("❌ 捕获失败", zap.Error(err), zap.String("url", payload.URL))
+		c.Set("render_error", err.Error())
 		c.JSON(http.StatusInternalServerError, errResp(err.Error()))
 		return
 	}
 
-	c.Header("Content-Type", "image/png")
-	c.Writer.Write(imgBytes)
-	c.Set("capture_url", payload.URL)
-	c.Set("capture_img_size", len(imgBytes))
+	writeBody(c, "image/png", imgBytes)
+	c.Set("render_duration", time.Since(start))
+	c.Set("render_img_size", len(imgBytes))
 }
 
-func CaptureScreenshot(rawURL string, timeoutMs int64, userAgent string, viewport *ViewportOptions, fullPage bool) ([]byte, error) {
-	ctx, cancel := NewTabContext(timeoutMs)
+func CaptureScreenshot(ctx context.Context, rawURL string, opts RenderOptions, fullPage bool) ([]byte, error) {
+	ctx, cancel := trackerFrom(ctx).Tab(opts.TimeoutMs)
 	defer cancel()
 
 	// 构建 chromedp 选项
 	var runOpts []chromedp.Action
 
 	// 设置 UserAgent 和 Viewport（始终设置默认 viewport 保证页面布局一致）
-	width := captureViewportWidth.Load()
-	height := captureViewportHeight.Load()
-	scale := captureViewportScale.Load()
-	if viewport != nil {
-		if viewport.Width > 0 {
-			width = int64(viewport.Width)
-		}
-		if viewport.Height > 0 {
-			height = int64(viewport.Height)
-		}
-		if viewport.Scale > 0 {
-			scale = viewport.Scale
-		}
+	if opts.UserAgent != "" {
+		runOpts = append(runOpts, emulation.SetUserAgentOverride(opts.UserAgent))
 	}
-	if userAgent != "" {
-		runOpts = append(runOpts, emulation.SetUserAgentOverride(userAgent))
+	vp := opts.Viewport
+	runOpts = append(runOpts, emulation.SetDeviceMetricsOverride(int64(vp.Width), int64(vp.Height), vp.Scale, false))
+	if opts.ColorScheme != "" {
+		runOpts = append(runOpts, emulateColorScheme(opts.ColorScheme))
 	}
-	runOpts = append(runOpts, emulation.SetDeviceMetricsOverride(width, height, scale, false))
 
 	// 导航到目标 URL
 	runOpts = append(runOpts, chromedp.Navigate(rawURL))
@@ -255,88 +314,33 @@ func CaptureScreenshot(rawURL string, timeoutMs int64, userAgent string, viewpor
 		return nil, fmt.Errorf("navigate failed: %w", err)
 	}
 
-	// 根据 fullPage 决定截图方式
-	var full []byte
-	if fullPage {
-		// 全页截图
-		err = chromedp.Run(ctx, chromedp.FullScreenshot(&full, int(renderQuality.Load())))
-		if err != nil {
-			return nil, fmt.Errorf("full screenshot failed: %w", err)
-		}
-	} else {
+	if !fullPage {
 		// 视口截图
-		err = chromedp.Run(ctx, chromedp.CaptureScreenshot(&full))
+		var shot []byte
+		err = chromedp.Run(ctx, chromedp.CaptureScreenshot(&shot))
 		if err != nil {
 			return nil, fmt.Errorf("capture screenshot failed: %w", err)
 		}
-	}
-
-	if len(full) == 0 {
-		return nil, fmt.Errorf("screenshot data is empty")
-	}
-
-	// 如果是全页截图，需要裁剪到 body 范围
-	if fullPage {
-		img, err := png.Decode(bytes.NewReader(full))
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode screenshot: %w", err)
-		}
-
-		if img == nil {
-			return nil, fmt.Errorf("decoded image is nil")
-		}
-
-		// 获取 body 范围
-		var js string
-		err = chromedp.Run(ctx,
-			chromedp.EvaluateAsDevTools(`(function() {
-				const el = document.querySelector('body');
-				const r = el.getBoundingClientRect();
-				const x = Math.max(0, Math.floor(r.left));
-				const y = Math.max(0, Math.floor(r.top + (window.scrollY || document.documentElement.scrollTop)));
-				const w = Math.ceil(r.width);
-				const h = Math.ceil(r.height);
-				const dpr = window.devicePixelRatio || 1;
-				return JSON.stringify({ x, y, w, h, dpr });
-			})()`, &js),
-		)
-		if err != nil {
-			// 无法获取 body 范围，直接返回原始截图
-			logger.Debug("⚠️ 无法获取 body 范围", zap.Error(err))
-			return full, nil
-		}
-
-		type Rect struct {
-			X, Y, W, H, DPR float64
+		if len(shot) == 0 {
+			return nil, fmt.Errorf("screenshot data is empty")
 		}
-		var r Rect
-		err = json.Unmarshal([]byte(js), &r)
-		if err != nil {
-			return full, nil
-		}
-
-		x := int(r.X * r.DPR)
-		y := int(r.Y * r.DPR)
-		w := int(r.W * r.DPR)
-		h := int(r.H * r.DPR)
-
-		bounds := img.Bounds()
-		x = max(0, x)
-		y = max(0, y)
-		w = min(w, bounds.Dx()-x)
-		h = min(h, bounds.Dy()-y)
-
-		crop := image.Rect(x, y, x+w, y+h)
-		sub := image.NewRGBA(crop)
-		draw.Draw(sub, crop, img, crop.Min, draw.Src)
+		return shot, nil
+	}
 
-		var out bytes.Buffer
-		err = png.Encode(&out, sub)
-		if err != nil {
-			return nil, err
+	// 全页截图：由 Chrome 按 body 范围裁剪，见 screenshot.go
+	r, err := bodyRect(ctx)
+	if err != nil || r.W <= 0 || r.H <= 0 {
+		// 无法获取 body 范围，截取整个页面
+		logger.Debug("⚠️ 无法获取 body 范围", zap.Error(err))
+		var full []byte
+		if err := chromedp.Run(ctx, chromedp.FullScreenshot(&full, 100)); err != nil {
+			return nil, fmt.Errorf("full screenshot failed: %w", err)
 		}
-		return out.Bytes(), nil
+		return full, nil
 	}
-
-	return full, nil
+	shot, err := clipScreenshot(ctx, r, opts.Quality)
+	if err != nil {
+		return nil, fmt.Errorf("full screenshot failed: %w", err)
+	}
+	return shot, nil
 }
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== CDP 事件日志 ======
+//
+// 请求中设置 options.trace: true 时，将本次渲染与 Chrome 之间完整的 DevTools 协议消息
+// （发送的命令与收到的事件/响应）写入 debug.cdp_trace.dir，便于离线分析字体缺失、绘制不完整等问题。
+// 需在配置中启用 debug.cdp_trace.enabled，文件名包含请求 ID，通过 X-SnapCast-Trace 响应头返回。
+
+const cdpTraceHeader = "X-SnapCast-Trace"
+
+// cdpTrace 单次渲染的 CDP 日志文件
+type cdpTrace struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	w       *bufio.Writer
+	written int64
+	limit   int64
+	dropped bool
+}
+
+// openCDPTrace 创建日志文件，并清理超出保留数量的旧文件
+func openCDPTrace(requestID, site, typ string) (*cdpTrace, error) {
+	if !viper.GetBool("debug.cdp_trace.enabled") {
+		return nil, newRenderError(http.StatusBadRequest, errors.New("options.trace requires debug.cdp_trace.enabled"))
+	}
+	dir := viper.GetString("debug.cdp_trace.dir")
+	if dir == "" {
+		dir = "./traces"
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	pruneCDPTraces(dir, viper.GetInt("debug.cdp_trace.max_files"))
+
+	name := fmt.Sprintf("%s_%s_%s_%s.cdp.log", time.Now().Format("20060102-150405"), site, typ, requestID)
+	path := filepath.Join(dir, name)
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	limit := int64(viper.GetInt("debug.cdp_trace.max_size_mb")) << 20
+	if limit <= 0 {
+		limit = 50 << 20
+	}
+	return &cdpTrace{path: path, file: file, w: bufio.NewWriter(file), limit: limit}, nil
+}
+
+// logf 作为 chromedp 的 Debugf/Logf/Errorf 回调，每条消息一行
+func (t *cdpTrace) logf(format string, args ...any) {
+	line := time.Now().Format("15:04:05.000000") + " " + fmt.Sprintf(format, args...) + "\n"
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.dropped {
+		return
+	}
+	if t.written+int64(len(line)) > t.limit {
+		t.w.WriteString("... truncated: debug.cdp_trace.max_size_mb reached\n")
+		t.dropped = true
+		return
+	}
+	n, _ := t.w.WriteString(line)
+	t.written += int64(n)
+}
+
+// contextOptions 返回挂载日志回调的 chromedp 选项
+func (t *cdpTrace) contextOptions() []chromedp.ContextOption {
+	return []chromedp.ContextOption{
+		chromedp.WithDebugf(t.logf),
+		chromedp.WithLogf(func(format string, args ...any) { t.logf("LOG "+format, args...) }),
+		chromedp.WithErrorf(func(format string, args ...any) { t.logf("ERROR "+format, args...) }),
+	}
+}
+
+func (t *cdpTrace) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.w.Flush()
+	return t.file.Close()
+}
+
+// pruneCDPTraces 仅保留最新的 keep-1 个日志文件，为新文件腾出位置
+func pruneCDPTraces(dir string, keep int) {
+	if keep <= 0 {
+		keep = 20
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".cdp.log") {
+			files = append(files, e.Name())
+		}
+	}
+	sort.Strings(files) // 文件名以时间开头
+	for len(files) >= keep {
+		if err := os.Remove(filepath.Join(dir, files[0])); err != nil {
+			logger.Debug("🗑️ CDP 日志清理失败", zap.String("file", files[0]), zap.Error(err))
+		}
+		files = files[1:]
+	}
+}
+
+// traceMiddleware 为设置了 options.trace 的请求打开 CDP 日志，渲染结束后关闭
+func traceMiddleware(rc *RenderContext) error {
+	if !rc.Options.Trace {
+		return rc.Next()
+	}
+	trace, err := openCDPTrace(requestIDFrom(rc.Ctx), rc.Payload.Site, rc.Payload.Type)
+	if err != nil {
+		return err
+	}
+	defer trace.Close()
+	trackerFrom(rc.Ctx).trace = trace
+	rc.Logger.Info("🔬 CDP 事件日志已开启", zap.String("file", trace.path))
+
+	err = rc.Next()
+	if rc.Result != nil {
+		rc.Result.TracePath = trace.path
+	}
+	return err
+}
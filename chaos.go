@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 故障注入（测试模式） ======
+//
+// debug.chaos.enabled 开启后按配置的概率向渲染注入故障，用于在真实事故之前验证
+// 重试、告警与排队配置是否符合预期。该配置不在默认配置文件中列出，切勿在生产环境开启：
+//
+//	debug:
+//	  chaos:
+//	    enabled: true
+//	    crash_rate: 0.05          # 浏览器标签页崩溃（Page.crash）
+//	    slow_rate: 0.1            # 导航前等待 slow_delay
+//	    slow_delay: "5s"
+//	    template_error_rate: 0.05 # 模板阶段直接返回错误
+
+// 故障类型
+const (
+	chaosCrash         = "crash"
+	chaosSlow          = "slow"
+	chaosTemplateError = "template_error"
+)
+
+var errChaosTemplate = errors.New("chaos: injected template error")
+
+type chaosConfig struct {
+	enabled           bool
+	crashRate         float64
+	slowRate          float64
+	slowDelay         time.Duration
+	templateErrorRate float64
+}
+
+// chaosFault 一次渲染中注入到浏览器的故障
+type chaosFault struct {
+	crash bool
+	delay time.Duration
+}
+
+var (
+	chaosSettings      atomic.Pointer[chaosConfig]
+	chaosInjectedTotal = NewCounterVec("snapcast_chaos_injected_total", "Faults injected by debug.chaos.", "fault")
+)
+
+// ConfigureChaos 读取 debug.chaos，由 ApplyDynamicConfig 调用
+func ConfigureChaos() {
+	cfg := &chaosConfig{enabled: viper.GetBool("debug.chaos.enabled"), slowDelay: 5 * time.Second}
+	for key, dst := range map[string]*float64{"crash_rate": &cfg.crashRate, "slow_rate": &cfg.slowRate, "template_error_rate": &cfg.templateErrorRate} {
+		v := viper.GetFloat64("debug.chaos." + key)
+		if v < 0 || v > 1 {
+			logger.Warn("❗ debug.chaos."+key+" 应在 0-1 之间，已忽略", zap.Float64(key, v))
+			continue
+		}
+		*dst = v
+	}
+	if viper.IsSet("debug.chaos.slow_delay") {
+		if d, err := ParseDuration(viper.Get("debug.chaos.slow_delay")); err != nil || d < 0 {
+			logger.Warn("❗ debug.chaos.slow_delay 值无效", zap.Any("slow_delay", viper.Get("debug.chaos.slow_delay")), zap.String("default", "5s"))
+		} else {
+			cfg.slowDelay = d
+		}
+	}
+	if prev := chaosSettings.Swap(cfg); cfg.enabled && (prev == nil || !prev.enabled) {
+		logger.Warn("🐒 故障注入已开启，切勿在生产环境使用", zap.Float64("crash_rate", cfg.crashRate), zap.Float64("slow_rate", cfg.slowRate), zap.Duration("slow_delay", cfg.slowDelay), zap.Float64("template_error_rate", cfg.templateErrorRate))
+	}
+}
+
+// chaosMiddleware 在模板阶段之前决定本次渲染注入的故障
+func chaosMiddleware(rc *RenderContext) error {
+	cfg := chaosSettings.Load()
+	if cfg == nil || !cfg.enabled {
+		return rc.Next()
+	}
+	if rand.Float64() < cfg.templateErrorRate {
+		chaosInjectedTotal.Inc(chaosTemplateError)
+		rc.Logger.Warn("🐒 注入模板错误", zap.String("template", rc.Template))
+		return errChaosTemplate
+	}
+	var fault chaosFault
+	if rand.Float64() < cfg.slowRate {
+		chaosInjectedTotal.Inc(chaosSlow)
+		fault.delay = cfg.slowDelay
+		rc.Logger.Warn("🐒 注入慢导航", zap.Duration("delay", fault.delay))
+	}
+	if rand.Float64() < cfg.crashRate {
+		chaosInjectedTotal.Inc(chaosCrash)
+		fault.crash = true
+		rc.Logger.Warn("🐒 注入浏览器崩溃")
+	}
+	if fault.crash || fault.delay > 0 {
+		rc.Options.Chaos = &fault
+	}
+	return rc.Next()
+}
+
+// actions 导航前执行的故障动作
+func (f *chaosFault) actions() []chromedp.Action {
+	if f == nil {
+		return nil
+	}
+	var actions []chromedp.Action
+	if f.delay > 0 {
+		actions = append(actions, chromedp.Sleep(f.delay))
+	}
+	if f.crash {
+		// 使渲染进程崩溃，之后的 CDP 调用与真实崩溃一样返回错误
+		actions = append(actions, chromedp.ActionFunc(func(ctx context.Context) error {
+			// 崩溃后不会有响应，不等待
+			ctx, cancel := context.WithTimeout(ctx, time.Second)
+			defer cancel()
+			_ = page.Crash().Do(ctx)
+			return nil
+		}))
+	}
+	return actions
+}
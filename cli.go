@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// ====== 命令行子命令 ======
+//
+//	snapcast            启动 HTTP 服务
+//	snapcast init       在当前目录生成配置文件与示例模板
+//	snapcast setup      交互式配置向导
+//	snapcast config     配置文件相关命令
+//	snapcast verify     验证渲染结果签名
+//	snapcast render     不启动服务，直接渲染一次
+//	snapcast test       渲染所有模板并与基准图比较
+//	snapcast templates  模板目录相关命令
+//	snapcast schema     由请求数据推断 JSON Schema 与模板骨架
+
+// runCommand 执行子命令，返回进程退出码。未识别的参数返回 -1 表示继续启动服务。
+func runCommand(args []string) int {
+	if len(args) == 0 || isServerFlag(args[0]) {
+		return -1
+	}
+	switch args[0] {
+	case "init":
+		return cmdInit(args[1:])
+	case "setup":
+		return cmdSetup(args[1:])
+	case "config":
+		return cmdConfig(args[1:])
+	case "verify":
+		return cmdVerify(args[1:])
+	case "render":
+		return cmdRender(args[1:])
+	case "test":
+		return cmdTest(args[1:])
+	case "templates":
+		return cmdTemplates(args[1:])
+	case "schema":
+		return cmdSchema(args[1:])
+	case "help", "-h", "--help":
+		printUsage()
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "未知命令: %s\n\n", args[0])
+		printUsage()
+		return 2
+	}
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, `用法: snapcast [命令] | snapcast [--config 文件] [--host 地址] [--port 端口]
+
+命令:
+  (无)        启动 HTTP 服务，配置项可由 SNAPCAST_ 前缀的环境变量覆盖，如 SNAPCAST_SERVER_PORT
+  init        在目标目录生成配置文件与示例模板
+  setup       交互式配置向导：检测浏览器、生成 token、写入配置并测试渲染
+  config      配置文件管理（show、migrate、keygen、encrypt）
+  verify      验证渲染结果的签名
+  render      不启动服务，直接渲染一次并写出图片（模板开发、CI、定时任务）
+  test        用示例数据渲染所有模板并与基准图比较，发现模板回归
+  templates   模板目录管理（migrate、usage）
+  schema      由请求数据推断 JSON Schema 并生成模板骨架
+  help        显示帮助`)
+}
+
+func cmdInit(args []string) int {
+	fset := flag.NewFlagSet("init", flag.ContinueOnError)
+	force := fset.Bool("force", false, "覆盖已存在的文件")
+	fset.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: snapcast init [--force] [目录]")
+		fset.PrintDefaults()
+	}
+	if err := fset.Parse(args); err != nil {
+		return 2
+	}
+	dir := "."
+	if fset.NArg() > 0 {
+		dir = fset.Arg(0)
+	}
+
+	written, err := scaffold(dir, *force)
+	for _, f := range written {
+		fmt.Println("✅ 已生成", f)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ 初始化失败:", err)
+		return 1
+	}
+	if len(written) == 0 {
+		fmt.Println("❕ 文件均已存在，未做修改（使用 --force 覆盖）")
+	}
+	return 0
+}
+
+func cmdConfig(args []string) int {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, `用法: snapcast config <子命令>
+
+子命令:
+  show [--json] [--reveal] [文件]  输出合并后的生效配置，敏感字段默认脱敏
+  migrate [--dry-run] [文件]       将配置文件迁移到当前版本，默认 snapcast.yaml
+  keygen                          生成加密配置值所用的密钥
+  encrypt [值]                    加密一个值（省略时从标准输入读取），需设置 SNAPCAST_CONFIG_KEY`)
+	}
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+	switch args[0] {
+	case "show":
+		return cmdConfigShow(args[1:])
+	case "migrate":
+		fset := flag.NewFlagSet("config migrate", flag.ContinueOnError)
+		dryRun := fset.Bool("dry-run", false, "仅输出迁移结果，不写入文件")
+		if err := fset.Parse(args[1:]); err != nil {
+			return 2
+		}
+		file := setupConfigFile
+		if fset.NArg() > 0 {
+			file = fset.Arg(0)
+		}
+		return cmdConfigMigrate(file, *dryRun)
+	case "keygen":
+		return cmdConfigKeygen()
+	case "encrypt":
+		return cmdConfigEncrypt(args[1:])
+	default:
+		usage()
+		return 2
+	}
+}
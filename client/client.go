@@ -0,0 +1,411 @@
+// Package client 是 SnapCast 的 Go 客户端。
+//
+//	c := client.New("http://127.0.0.1:8080", client.WithToken("secret"))
+//	res, err := c.Render(ctx, &client.RenderRequest{Site: "bilibili", Type: "live", Data: data})
+//	// res.Body 为 PNG
+//
+// 连接失败、429 与 502/503/504 按指数退避重试（优先使用服务端的 Retry-After），
+// 指定了投递目标而未设置 IdempotencyKey 时自动生成，重试不会重复投递。
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"SnapCast/extension"
+)
+
+// ====== 客户端 ======
+
+// Client 调用一个 SnapCast 服务，可并发使用
+type Client struct {
+	baseURL    string
+	endpoint   string
+	token      string
+	hmacSecret []byte
+	signReq    bool
+	httpClient *http.Client
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// Option 客户端选项
+type Option func(*Client)
+
+// WithToken 以 Authorization: Bearer 携带 auth.token 或 auth.tokens 中的 token
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithHMAC 对每个请求签名（auth.hmac.secret），同时设置 token 时以签名为准
+func WithHMAC(secret string) Option {
+	return func(c *Client) { c.hmacSecret = []byte(secret) }
+}
+
+// WithHMACSignRequest 签名同时覆盖请求方法与路径，对应服务端的 auth.hmac.sign_request
+func WithHMACSignRequest() Option {
+	return func(c *Client) { c.signReq = true }
+}
+
+// WithHTTPClient 使用自定义的 http.Client，如配置代理或客户端证书
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithUnixSocket 经 Unix 域套接字（server.listen: unix://...）连接，baseURL 的主机部分被忽略
+func WithUnixSocket(path string) Option {
+	return func(c *Client) {
+		var d net.Dialer
+		c.httpClient = &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return d.DialContext(ctx, "unix", path)
+			},
+		}}
+	}
+}
+
+// WithEndpoint 渲染接口路径，与服务端 server.endpoint 一致，默认 /render
+func WithEndpoint(path string) Option {
+	return func(c *Client) { c.endpoint = path }
+}
+
+// WithRetries 最多重试次数（默认 2）与退避区间（默认 500ms ~ 10s），retries 为 0 时不重试
+func WithRetries(retries int, minBackoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = retries
+		if minBackoff > 0 {
+			c.minBackoff = minBackoff
+		}
+		if maxBackoff > 0 {
+			c.maxBackoff = maxBackoff
+		}
+	}
+}
+
+// New 创建客户端，baseURL 如 http://127.0.0.1:8080
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		endpoint:   "/render",
+		httpClient: http.DefaultClient,
+		maxRetries: 2,
+		minBackoff: 500 * time.Millisecond,
+		maxBackoff: 10 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// ====== 请求与结果 ======
+
+// RenderRequest 渲染请求，字段含义与 /render 请求体一致
+type RenderRequest struct {
+	Site     string         `json:"site"`
+	Type     string         `json:"type"`
+	Data     any            `json:"data"`
+	Output   string         `json:"output,omitempty"`   // image（默认）、html、json
+	Theme    string         `json:"theme,omitempty"`    // 主题变体，如 dark
+	Lang     string         `json:"lang,omitempty"`     // 卡片语言，如 zh-CN、en
+	Response string         `json:"response,omitempty"` // url 时保存后返回访问地址，见 RenderResult.Object
+	Priority int            `json:"priority,omitempty"` // 排队优先级，数值大的优先
+	Options  map[string]any `json:"options,omitempty"`  // 渲染参数，如 {"quality": 80, "viewport": {"width": 800}}
+
+	Timeout time.Duration `json:"-"` // 服务端渲染超时，0 使用服务端默认值
+
+	Deliver        []extension.Target `json:"deliver,omitempty"` // 渲染完成后投递的目标
+	IdempotencyKey string             `json:"idempotency_key,omitempty"`
+}
+
+// StoredObject response 为 url 时保存的渲染结果
+type StoredObject struct {
+	URL       string            `json:"url"`
+	Key       string            `json:"key"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at,omitzero"`
+	Alt       string            `json:"alt,omitempty"`
+}
+
+// RenderResult 渲染结果，按请求的 output/response/deliver 填充对应字段
+type RenderResult struct {
+	RequestID   string // 服务端的 X-Request-ID，排查问题时提供
+	Cache       string // 渲染缓存状态，如 HIT、MISS
+	Alt         string // 替代文本，模板配置了 alt 时返回
+	ContentType string
+	Body        []byte // output 为 image 或 html 时的内容
+
+	JSON       json.RawMessage     // output 为 json 时的数据
+	Object     *StoredObject       // response 为 url 时保存的对象
+	DeliveryID string              // 指定了 deliver 时的投递 ID
+	Deliveries []extension.Receipt // 指定了 deliver 时各目标的投递回执
+}
+
+// Template 服务端可用的模板
+type Template struct {
+	Key    string   `json:"key"` // site/type
+	Site   string   `json:"site"`
+	Type   string   `json:"type"`
+	Themes []string `json:"themes,omitempty"`
+}
+
+// Error 服务端返回的错误
+type Error struct {
+	StatusCode int
+	Message    string
+	RequestID  string
+	RetryAfter time.Duration // 429/503 时服务端建议的等待时间
+	Fields     []FieldError  // 422 时不符合模板 schema 的字段
+}
+
+// FieldError 请求数据中不符合模板 schema 的字段
+type FieldError struct {
+	Field string `json:"field"` // 如 data.owner.name
+	Error string `json:"error"`
+}
+
+func (e *Error) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("snapcast: %d %s (request %s)", e.StatusCode, e.Message, e.RequestID)
+	}
+	return fmt.Sprintf("snapcast: %d %s", e.StatusCode, e.Message)
+}
+
+// Temporary 是否为可重试的错误
+func (e *Error) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// apiResponse 服务端 JSON 响应的外层结构
+type apiResponse struct {
+	Status  string          `json:"status"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// ====== 接口 ======
+
+// Render 渲染并等待结果
+func (c *Client) Render(ctx context.Context, req *RenderRequest) (*RenderResult, error) {
+	body := *req
+	if body.Timeout > 0 {
+		if body.Options == nil {
+			body.Options = make(map[string]any, 1)
+		} else {
+			body.Options = cloneMap(body.Options)
+		}
+		if _, set := body.Options["timeout"]; !set {
+			body.Options["timeout"] = body.Timeout.Milliseconds()
+		}
+	}
+	if len(body.Deliver) > 0 && body.IdempotencyKey == "" {
+		body.IdempotencyKey = randomKey()
+	}
+	raw, err := json.Marshal(&body)
+	if err != nil {
+		return nil, err
+	}
+	resp, respBody, err := c.do(ctx, http.MethodPost, c.endpoint, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &RenderResult{
+		RequestID:   resp.Header.Get("X-Request-ID"),
+		Cache:       resp.Header.Get("X-SnapCast-Cache"),
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	res.Alt, _ = url.PathUnescape(resp.Header.Get("X-SnapCast-Alt"))
+	if !strings.HasPrefix(res.ContentType, "application/json") {
+		res.Body = respBody
+		return res, nil
+	}
+	var api apiResponse
+	if err := json.Unmarshal(respBody, &api); err != nil {
+		return nil, fmt.Errorf("snapcast: decode response: %w", err)
+	}
+	switch {
+	case len(body.Deliver) > 0:
+		var d struct {
+			DeliveryID string              `json:"delivery_id"`
+			Deliveries []extension.Receipt `json:"deliveries"`
+		}
+		err = json.Unmarshal(api.Data, &d)
+		res.DeliveryID, res.Deliveries = d.DeliveryID, d.Deliveries
+	case body.Response == "url":
+		res.Object = &StoredObject{}
+		err = json.Unmarshal(api.Data, res.Object)
+	default:
+		res.JSON = api.Data
+	}
+	if err != nil {
+		return nil, fmt.Errorf("snapcast: decode response: %w", err)
+	}
+	return res, nil
+}
+
+// Call 一次异步渲染，完成后 Call 本身被发送到 Done
+type Call struct {
+	Request *RenderRequest
+	Result  *RenderResult
+	Error   error
+	Done    chan *Call
+}
+
+// RenderAsync 在后台渲染，立即返回。done 为 nil 时新建容量为 1 的通道；
+// 多个请求可共用一个带缓冲的 done 通道，与 net/rpc 的 Client.Go 相同
+func (c *Client) RenderAsync(ctx context.Context, req *RenderRequest, done chan *Call) *Call {
+	if done == nil {
+		done = make(chan *Call, 1)
+	} else if cap(done) == 0 {
+		panic("snapcast: RenderAsync done channel is unbuffered")
+	}
+	call := &Call{Request: req, Done: done}
+	go func() {
+		call.Result, call.Error = c.Render(ctx, req)
+		call.Done <- call
+	}()
+	return call
+}
+
+// ListTemplates 列出当前 token 可使用的模板
+func (c *Client) ListTemplates(ctx context.Context) ([]Template, error) {
+	_, respBody, err := c.do(ctx, http.MethodGet, "/templates", nil)
+	if err != nil {
+		return nil, err
+	}
+	var api apiResponse
+	if err := json.Unmarshal(respBody, &api); err != nil {
+		return nil, fmt.Errorf("snapcast: decode response: %w", err)
+	}
+	var data struct {
+		Templates []Template `json:"templates"`
+	}
+	if err := json.Unmarshal(api.Data, &data); err != nil {
+		return nil, fmt.Errorf("snapcast: decode response: %w", err)
+	}
+	return data.Templates, nil
+}
+
+// ====== 传输 ======
+
+// do 发送请求，可重试的失败按退避重试，返回 2xx 响应与读取后的响应体
+func (c *Client) do(ctx context.Context, method, path string, body []byte) (*http.Response, []byte, error) {
+	var lastErr error
+	var signedAt int64 // 上一次尝试的签名时间戳
+	for attempt := 0; ; attempt++ {
+		resp, respBody, err := c.once(ctx, method, path, body, &signedAt)
+		if err == nil {
+			return resp, respBody, nil
+		}
+		lastErr = err
+		var apiErr *Error
+		retryable := !errors.As(err, &apiErr) || apiErr.Temporary()
+		if !retryable || attempt >= c.maxRetries || ctx.Err() != nil {
+			return nil, nil, lastErr
+		}
+		wait := min(c.minBackoff<<attempt, c.maxBackoff)
+		if apiErr != nil && apiErr.RetryAfter > 0 {
+			wait = min(apiErr.RetryAfter, c.maxBackoff)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil, lastErr
+		case <-time.After(wait):
+		}
+	}
+}
+
+// once 发送一次请求，signedAt 为同一请求上一次尝试的签名时间戳
+func (c *Client) once(ctx context.Context, method, path string, body []byte, signedAt *int64) (*http.Response, []byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	switch {
+	case len(c.hmacSecret) > 0:
+		// 相同请求体在同一秒内的签名相同，会被服务端视为重放，重试时使用更晚的时间戳
+		*signedAt = max(time.Now().Unix(), *signedAt+1)
+		ts := strconv.FormatInt(*signedAt, 10)
+		mac := hmac.New(sha256.New, c.hmacSecret)
+		mac.Write([]byte(ts + "."))
+		if c.signReq {
+			mac.Write([]byte(req.Method + "." + req.URL.RequestURI() + "."))
+		}
+		mac.Write(body)
+		req.Header.Set("X-Timestamp", ts)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, respBody, nil
+	}
+	apiErr := &Error{StatusCode: resp.StatusCode, RequestID: resp.Header.Get("X-Request-ID")}
+	var api apiResponse
+	if json.Unmarshal(respBody, &api) == nil && api.Message != "" {
+		apiErr.Message = api.Message
+		var data struct {
+			Errors []FieldError `json:"errors"`
+		}
+		if json.Unmarshal(api.Data, &data) == nil {
+			apiErr.Fields = data.Errors
+		}
+	} else {
+		apiErr.Message = http.StatusText(resp.StatusCode)
+	}
+	if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s > 0 {
+		apiErr.RetryAfter = time.Duration(s) * time.Second
+	}
+	return nil, nil, apiErr
+}
+
+func randomKey() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func cloneMap(m map[string]any) map[string]any {
+	out := make(map[string]any, len(m)+1)
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
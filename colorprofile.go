@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ====== 色彩配置 ======
+//
+// 不同主机的显示配置会让 Chrome 以不同色彩空间光栅化，导致截图偏色。
+// render.color_profile 通过 --force-color-profile 固定光栅化色彩空间；
+// render.icc_profile 为输出的 PNG 写入色彩配置，使查看端按同一色彩空间解释像素。
+
+const colorProfileSRGB = "srgb"
+
+// colorProfile 嵌入输出 PNG 的色彩配置，icc 为空时写入 sRGB 块
+type colorProfile struct {
+	name string
+	icc  []byte
+}
+
+// loadColorProfile 解析 render.icc_profile：空或 none 不嵌入，srgb 写入 sRGB/gAMA/cHRM 块，其他值视为 ICC 文件路径
+func loadColorProfile(spec string) (*colorProfile, error) {
+	switch strings.ToLower(spec) {
+	case "", "none":
+		return nil, nil
+	case colorProfileSRGB:
+		return &colorProfile{name: colorProfileSRGB}, nil
+	}
+	icc, err := os.ReadFile(spec)
+	if err != nil {
+		return nil, err
+	}
+	if len(icc) < 128 || string(icc[36:40]) != "acsp" {
+		return nil, fmt.Errorf("%s is not an ICC profile", spec)
+	}
+	name := strings.TrimSuffix(filepath.Base(spec), filepath.Ext(spec))
+	if len(name) > 79 { // iCCP 名称上限
+		name = name[:79]
+	}
+	return &colorProfile{name: name, icc: icc}, nil
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// 与嵌入的色彩配置冲突、需要移除的原有块
+var pngColorChunks = map[string]bool{"iCCP": true, "sRGB": true, "gAMA": true, "cHRM": true}
+
+// embed 在 IHDR 之后写入色彩配置块，并移除原有的色彩相关块
+func (p *colorProfile) embed(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errors.New("not a png image")
+	}
+	var out bytes.Buffer
+	out.Grow(len(data) + len(p.icc) + 64)
+	out.Write(pngSignature)
+
+	rest := data[len(pngSignature):]
+	first := true
+	for len(rest) >= 12 {
+		length := binary.BigEndian.Uint32(rest)
+		if uint64(length)+12 > uint64(len(rest)) {
+			return nil, errors.New("truncated png chunk")
+		}
+		chunk := rest[:length+12]
+		typ := string(chunk[4:8])
+		rest = rest[length+12:]
+
+		if pngColorChunks[typ] {
+			continue
+		}
+		out.Write(chunk)
+		if first {
+			if typ != "IHDR" {
+				return nil, errors.New("png does not start with IHDR")
+			}
+			if err := p.writeChunks(&out); err != nil {
+				return nil, err
+			}
+			first = false
+		}
+	}
+	return out.Bytes(), nil
+}
+
+func (p *colorProfile) writeChunks(w *bytes.Buffer) error {
+	if p.icc == nil {
+		// sRGB 块（感知意图），以及供不识别 sRGB 块的解码器使用的 gAMA/cHRM（PNG 规范推荐值）
+		writePNGChunk(w, "sRGB", []byte{0})
+		writePNGChunk(w, "gAMA", binary.BigEndian.AppendUint32(nil, 45455))
+		var chrm []byte
+		for _, v := range []uint32{31270, 32900, 64000, 33000, 30000, 60000, 15000, 6000} {
+			chrm = binary.BigEndian.AppendUint32(chrm, v)
+		}
+		writePNGChunk(w, "cHRM", chrm)
+		return nil
+	}
+	var body bytes.Buffer
+	body.WriteString(p.name)
+	body.Write([]byte{0, 0}) // 名称结束符、压缩方式 deflate
+	zw := zlib.NewWriter(&body)
+	if _, err := zw.Write(p.icc); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	writePNGChunk(w, "iCCP", body.Bytes())
+	return nil
+}
+
+func writePNGChunk(w *bytes.Buffer, typ string, data []byte) {
+	var hdr [8]byte
+	binary.BigEndian.PutUint32(hdr[:4], uint32(len(data)))
+	copy(hdr[4:], typ)
+	w.Write(hdr[:])
+	w.Write(data)
+	crc := crc32.NewIEEE()
+	crc.Write(hdr[4:])
+	crc.Write(data)
+	binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+// applyColorProfile 为 PNG 写入当前配置的色彩配置，未配置时原样返回
+func applyColorProfile(data []byte) ([]byte, error) {
+	p := currentRenderDefaults().ColorProfile
+	if p == nil {
+		return data, nil
+	}
+	return p.embed(data)
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
+	"maps"
+	"math"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
@@ -12,86 +16,108 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
-func InitConfig() {
-	ensureConfigFile("snapcast.yaml")
-	viper.SetConfigName("snapcast")
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath(".") // 当前目录
-	err := viper.ReadInConfig()
-	if err != nil {
-		logger.Fatal("❌ 配置文件加载失败", zap.Error(err))
+func InitConfig(flags serverFlags) {
+	bindEnv()
+	file := setupConfigFile
+	if flags.config != "" {
+		file = flags.config
+	}
+	if err := ensureConfigFile(file); err != nil {
+		// 只读文件系统等情况下仍可只用环境变量配置
+		logger.Warn("⚠️ 配置文件生成失败，使用内置默认配置", zap.String("file", file), zap.Error(err))
+		if err := readDefaultConfig(); err != nil {
+			logger.Fatal("❌ 内置默认配置加载失败", zap.Error(err))
+		}
+	} else {
+		viper.SetConfigFile(file)
+		viper.SetConfigType("yaml")
+		if err := viper.ReadInConfig(); err != nil {
+			logger.Fatal("❌ 配置文件加载失败", zap.Error(err))
+		}
+		if err := applyConfigMigration(); err != nil {
+			logger.Fatal("❌ 配置迁移或解密失败", zap.Error(err))
+		}
 	}
+	flags.apply()
 	ApplyDynamicConfig()
 	logger.Info("✅ 配置文件加载成功", zap.String("file", viper.ConfigFileUsed()))
+	logEnvOverrides()
 	logActiveConfig()
 }
 
 func logActiveConfig() {
 	logger.Debug("📋 生效配置")
-	logger.Debug("   server", zap.String("host", viper.GetString("server.host")), zap.String("port", viper.GetString("server.port")), zap.String("endpoint", viper.GetString("server.endpoint")), zap.Int("max_connections", viper.GetInt("server.max_connections")))
-	logger.Debug("   auth", zap.String("token", viper.GetString("auth.token")))
+	logger.Debug("   server", zap.String("host", viper.GetString("server.host")), zap.String("port", viper.GetString("server.port")), zap.String("listen", viper.GetString("server.listen")), zap.Bool("socket_auth", viper.GetBool("server.socket_auth")), zap.String("endpoint", viper.GetString("server.endpoint")), zap.String("html_endpoint", htmlEndpoint()), zap.String("ws_endpoint", wsEndpoint()), zap.Int("ws_max_inflight", viper.GetInt("server.ws_max_inflight")), zap.Int("version", viper.GetInt("version")), zap.Bool("http2", viper.GetBool("server.http2")), zap.String("tls.cert_file", viper.GetString("server.tls.cert_file")), zap.String("tls.client_ca_file", viper.GetString("server.tls.client_ca_file")), zap.String("tls.client_auth", viper.GetString("server.tls.client_auth")))
+	logger.Debug("   auth", zap.String("token", maskedIfSet(viper.GetString("auth.token"))), zap.String("hmac.secret", maskedIfSet(viper.GetString("auth.hmac.secret"))), zap.Any("hmac.max_skew", viper.Get("auth.hmac.max_skew")), zap.Bool("hmac.sign_request", viper.GetBool("auth.hmac.sign_request")))
 	logger.Debug("   ip_filter", zap.String("whitelist", fmt.Sprintf("%v", viper.Get("ip_filter.whitelist"))), zap.String("blacklist", fmt.Sprintf("%v", viper.Get("ip_filter.blacklist"))))
-	logger.Debug("   rate_limit", zap.Bool("enabled", viper.GetBool("rate_limit.enabled")), zap.String("window", viper.GetString("rate_limit.window")), zap.Int("max_requests", viper.GetInt("rate_limit.max_requests")), zap.Int("mask", viper.GetInt("rate_limit.mask")))
-	logger.Debug("   template", zap.String("dir", viper.GetString("template.dir")), zap.Bool("watch", viper.GetBool("template.watch")))
-	logger.Debug("   render", zap.String("browser_path", viper.GetString("render.browser_path")), zap.Any("timeout", viper.Get("render.timeout")), zap.Int("quality", viper.GetInt("render.quality")))
+	logger.Debug("   rate_limit", zap.Bool("enabled", viper.GetBool("rate_limit.enabled")), zap.String("window", viper.GetString("rate_limit.window")), zap.Int("max_requests", viper.GetInt("rate_limit.max_requests")), zap.Int("mask", viper.GetInt("rate_limit.mask")), zap.String("algorithm", viper.GetString("rate_limit.algorithm")), zap.String("key", viper.GetString("rate_limit.key")), zap.Float64("rate", viper.GetFloat64("rate_limit.rate")), zap.Int("burst", viper.GetInt("rate_limit.burst")))
+	logger.Debug("   render.shedding", zap.Bool("enabled", viper.GetBool("render.shedding.enabled")), zap.Any("cpu", viper.Get("render.shedding.cpu")), zap.Any("memory", viper.Get("render.shedding.memory")), zap.Any("chrome_latency", viper.Get("render.shedding.chrome_latency")), zap.Any("min_priority", viper.Get("render.shedding.min_priority")))
+	logger.Debug("   watermark", zap.Bool("enabled", viper.GetBool("watermark.enabled")), zap.String("image", viper.GetString("watermark.image")), zap.String("text", viper.GetString("watermark.text")), zap.String("position", viper.GetString("watermark.position")), zap.Any("opacity", viper.Get("watermark.opacity")))
+	logger.Debug("   slo", zap.Any("burn_rate", viper.Get("slo.burn_rate")), zap.Any("min_requests", viper.Get("slo.min_requests")), zap.Any("objectives", viper.Get("slo.objectives")))
+	logger.Debug("   alerting", zap.String("webhook", maskedIfSet(viper.GetString("alerting.webhook"))))
+	logger.Debug("   render.recycle", zap.Int64("after_renders", viper.GetInt64("render.recycle.after_renders")), zap.Int64("max_rss_mb", viper.GetInt64("render.recycle.max_rss_mb")), zap.Any("drain_timeout", viper.Get("render.recycle.drain_timeout")), zap.Any("min_interval", viper.Get("render.recycle.min_interval")))
+	logger.Debug("   render.retry", zap.Int("count", viper.GetInt("render.retry.count")), zap.Any("backoff", viper.Get("render.retry.backoff")), zap.Bool("blank", viper.GetBool("render.retry.blank")))
+	logger.Debug("   render.sandbox", zap.Int64("max_dom_nodes", viper.GetInt64("render.sandbox.max_dom_nodes")), zap.Int64("max_requests", viper.GetInt64("render.sandbox.max_requests")), zap.Int64("max_resource_mb", viper.GetInt64("render.sandbox.max_resource_mb")), zap.Any("script_timeout", viper.Get("render.sandbox.script_timeout")))
+	logger.Debug("   render.autotune", zap.Bool("enabled", viper.GetBool("render.autotune.enabled")), zap.Any("min", viper.Get("render.autotune.min")), zap.Any("max", viper.Get("render.autotune.max")), zap.Any("cpu", viper.Get("render.autotune.cpu")), zap.Any("memory", viper.Get("render.autotune.memory")), zap.Any("target_latency", viper.Get("render.autotune.target_latency")), zap.Any("interval", viper.Get("render.autotune.interval")))
+	logger.Debug("   render.queue", zap.Int("size", viper.GetInt("render.queue.size")), zap.Any("timeout", viper.Get("render.queue.timeout")))
+	logger.Debug("   render.fairness", zap.Float64("max_share", viper.GetFloat64("render.fairness.max_share")), zap.Any("sites", viper.Get("render.fairness.sites")))
+	logger.Debug("   template", zap.String("dir", viper.GetString("template.dir")), zap.Bool("watch", viper.GetBool("template.watch")), zap.Bool("preview", viper.GetBool("template.preview")), zap.String("usage_file", viper.GetString("template.usage_file")), zap.Bool("warmup", viper.GetBool("template.warmup.enabled")), zap.String("i18n.default", viper.GetString("template.i18n.default")), zap.String("schema", viper.GetString("template.schema")), zap.Bool("playground", viper.GetBool("template.playground")), zap.Bool("upload", viper.GetBool("template.upload")), zap.Bool("git", viper.GetString("template.git.url") != ""), zap.String("git.branch", viper.GetString("template.git.branch")), zap.Any("git.interval", viper.Get("template.git.interval")), zap.String("remote_url", viper.GetString("template.remote_url")), zap.Bool("remote_sha256", viper.GetString("template.remote_sha256") != ""), zap.Any("remote_interval", viper.Get("template.remote_interval")))
+	logger.Debug("   render", zap.String("browser_path", viper.GetString("render.browser_path")), zap.Int("max_concurrency", viper.GetInt("render.max_concurrency")), zap.String("remote_debugging_url", viper.GetString("render.remote_debugging_url")), zap.Any("timeout", viper.Get("render.timeout")), zap.Any("max_timeout", viper.Get("render.max_timeout")), zap.Any("max_output_size_mb", viper.Get("render.max_output_size_mb")), zap.Int("quality", viper.GetInt("render.quality")), zap.String("pdf_page_size", viper.GetString("render.pdf.page_size")), zap.Any("pdf_margin", viper.Get("render.pdf.margin")), zap.Any("postprocess", viper.Get("render.postprocess")), zap.Any("overflow", viper.Get("render.overflow")), zap.String("color_profile", viper.GetString("render.color_profile")), zap.String("icc_profile", viper.GetString("render.icc_profile")), zap.Any("font", viper.Get("render.font")), zap.String("fonts_dir", viper.GetString("render.fonts_dir")), zap.String("document", viper.GetString("render.document")), zap.String("base_url", viper.GetString("render.base_url")))
 	logger.Debug("   capture", zap.String("endpoint", viper.GetString("capture.endpoint")), zap.Int64("viewport_width", viper.GetInt64("capture.viewport.width")), zap.Int64("viewport_height", viper.GetInt64("capture.viewport.height")), zap.Float64("viewport_scale", viper.GetFloat64("capture.viewport.scale")))
+	logger.Debug("   assets", zap.Bool("enabled", viper.GetBool("assets.enabled")), zap.String("endpoint", viper.GetString("assets.endpoint")), zap.String("base_url", viper.GetString("assets.base_url")), zap.Bool("rewrite", viper.GetBool("assets.rewrite")), zap.String("cache_dir", viper.GetString("assets.cache_dir")), zap.Int("max_size_mb", viper.GetInt("assets.max_size_mb")), zap.String("ttl", viper.GetString("assets.ttl")))
+	logger.Debug("   assets.embed", zap.Bool("auto", viper.GetBool("assets.embed.auto")), zap.Any("timeout", viper.Get("assets.embed.timeout")), zap.Any("retries", viper.Get("assets.embed.retries")), zap.Any("max_size_mb", viper.Get("assets.embed.max_size_mb")))
+	logger.Debug("   metrics", zap.Bool("enabled", viper.GetBool("metrics.enabled")), zap.String("endpoint", viper.GetString("metrics.endpoint")))
+	logger.Debug("   admin", zap.Bool("enabled", viper.GetBool("admin.enabled")), zap.String("prefix", viper.GetString("admin.prefix")))
+	logger.Debug("   sites", zap.Strings("sites", slices.Sorted(maps.Keys(viper.GetStringMap("sites")))))
+	logger.Debug("   schema", zap.Int("samples", viper.GetInt("schema.samples")), zap.Int("max_keys", viper.GetInt("schema.max_keys")))
+	logger.Debug("   moderation", zap.Bool("enabled", viper.GetBool("moderation.enabled")), zap.String("action", viper.GetString("moderation.action")), zap.Int("keywords", len(viper.GetStringSlice("moderation.keywords"))), zap.String("api", viper.GetString("moderation.api.url")))
+	logger.Debug("   delivery.receipts", zap.Any("ttl", viper.Get("delivery.receipts.ttl")), zap.String("file", viper.GetString("delivery.receipts.file")))
+	logger.Debug("   delivery.telegram", zap.Bool("token_set", viper.GetString("delivery.telegram.token") != ""))
+	logger.Debug("   delivery.discord_webhook", zap.Bool("enabled", viper.GetBool("delivery.discord_webhook.enabled")), zap.Int("presets", len(viper.GetStringMap("delivery.discord_webhook.presets"))))
+	logger.Debug("   storage", zap.Bool("enabled", viper.GetBool("storage.enabled")), zap.String("backend", viper.GetString("storage.backend")), zap.Any("ttl", viper.Get("storage.ttl")), zap.String("dir", viper.GetString("storage.local.dir")), zap.String("base_url", viper.GetString("storage.local.base_url")))
+	logger.Debug("   storage.s3", zap.String("endpoint", viper.GetString("storage.s3.endpoint")), zap.String("bucket", viper.GetString("storage.s3.bucket")), zap.String("access_key", maskedIfSet(viper.GetString("storage.s3.access_key"))), zap.String("secret_key", maskedIfSet(viper.GetString("storage.s3.secret_key"))), zap.String("public_url", viper.GetString("storage.s3.public_url")))
+	logger.Debug("   tracing", zap.Bool("enabled", viper.GetBool("tracing.enabled")), zap.String("endpoint", viper.GetString("tracing.endpoint")), zap.Float64("sample_ratio", viper.GetFloat64("tracing.sample_ratio")))
+	logger.Debug("   failures", zap.Bool("enabled", viper.GetBool("failures.enabled")), zap.String("dir", viper.GetString("failures.dir")), zap.Int("max_entries", viper.GetInt("failures.max_entries")), zap.Any("max_age", viper.Get("failures.max_age")))
+	logger.Debug("   archive", zap.Bool("enabled", viper.GetBool("archive.enabled")), zap.String("dir", viper.GetString("archive.dir")), zap.String("prefix", viper.GetString("archive.prefix")), zap.Any("flush_interval", viper.Get("archive.flush_interval")), zap.Any("retention", viper.Get("archive.retention")))
+	logger.Debug("   cache", zap.Bool("enabled", viper.GetBool("cache.enabled")), zap.Any("ttl", viper.Get("cache.ttl")), zap.Int("max_size_mb", viper.GetInt("cache.max_size_mb")), zap.String("dir", viper.GetString("cache.dir")))
 	logger.Debug("   logging", zap.String("level", viper.GetString("logging.level")))
+	logger.Debug("   debug", zap.Bool("endpoints", viper.GetBool("debug.endpoints")), zap.Bool("cdp_trace", viper.GetBool("debug.cdp_trace.enabled")), zap.String("cdp_trace_dir", viper.GetString("debug.cdp_trace.dir")), zap.Bool("chaos", viper.GetBool("debug.chaos.enabled")))
 }
 
+// ensureConfigFile 配置文件不存在时，终端可交互则运行配置向导，否则写入默认配置
 func ensureConfigFile(path string) error {
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		defaultConfig := []byte(`
-# SnapCast 服务配置
-# 完整配置说明: https://github.com/xxx/SnapCast#configuration
-
-server:
-  host: "0.0.0.0"       # 监听地址
-  port: 8080            # 监听端口
-  endpoint: "/render"   # 渲染接口路径
-  max_connections: 10   # 最大并发渲染数
-
-auth:
-  token: ""             # 认证 token，为空则禁用认证
-
-ip_filter:
-  whitelist: []         # 白名单模式，为空则使用黑名单模式
-  blacklist: []         # 黑名单，支持单个 IP 或 CIDR 网段，如 192.168.1.0/24
-
-rate_limit:
-  enabled: false        # 是否启用 IP 限流
-  window: "1s"          # 时间窗口，支持 "1s", "1m"
-  max_requests: 60      # 单个 IP/网段每窗口最大请求数
-  mask: 24              # IP 掩码位数，24=/24 网段共享限额
-
-template:
-  dir: "./templates"    # 模板目录
-  watch: true           # 是否监听模板文件变化热重载
-
-render:
-  browser_path: ""      # 浏览器路径，为空则自动检测
-  timeout: 10000        # 渲染超时，支持数字(毫秒)、"10s"、"10000ms"
-  quality: 100          # 图片质量 0-100
-
-capture:
-  endpoint: "/capture"  # 截图接口路径
-  viewport:
-    width: 1920         # 默认视口宽度
-    height: 1080        # 默认视口高度
-    scale: 1.0          # 默认设备像素比
-
-logging:
-  level: "info"         # 日志级别: debug, info, warn, error
-`)
-		return os.WriteFile(path, defaultConfig, 0644)
-	}
-	return nil
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return nil
+	}
+	if path == setupConfigFile && isInteractive() {
+		logger.Info("🧙 未找到配置文件，进入配置向导")
+		if err := runSetup(bufio.NewReader(os.Stdin)); err != nil {
+			return err
+		}
+		if _, err := os.Stat(path); err == nil {
+			return nil
+		}
+	}
+	logger.Info("📝 未找到配置文件，已生成默认配置，可运行 snapcast setup 交互式配置", zap.String("file", path))
+	return os.WriteFile(path, defaultConfig(), 0644)
 }
 
 func WatchConfigChanges() {
+	if viper.ConfigFileUsed() == "" { // 使用内置默认配置
+		return
+	}
 	viper.WatchConfig()
 	viper.OnConfigChange(func(e fsnotify.Event) {
 		logger.Info("🔄 配置文件变更", zap.String("file", e.Name))
+		if err := applyConfigMigration(); err != nil {
+			logger.Error("❌ 配置迁移或解密失败，保留原配置", zap.Error(err))
+			return
+		}
+		if keys := clearRuntimeOverrides(); len(keys) > 0 {
+			logger.Info("🛠️ 运行时修改的配置已撤销，使用配置文件中的值", zap.Strings("keys", keys))
+		}
 		ApplyDynamicConfig()
+		publishReload(ReloadConfig, nil)
 	})
 }
 
@@ -99,6 +125,13 @@ func ApplyDynamicConfig() {
 	newToken := viper.GetString("auth.token")
 	globalAuthToken.Store(newToken)
 
+	hmacSkew, _ := ParseDuration(viper.Get("auth.hmac.max_skew"))
+	if hmacSkew <= 0 {
+		hmacSkew = 5 * time.Minute
+	}
+	ConfigureHMACAuth(viper.GetString("auth.hmac.secret"), hmacSkew, viper.GetBool("auth.hmac.sign_request"))
+	ConfigureAuthTokens()
+
 	newLogLevel := viper.GetString("logging.level")
 	logLevel.SetLevel(parseLogLevel(newLogLevel))
 
@@ -106,14 +139,25 @@ func ApplyDynamicConfig() {
 	globalBrowserPath.Store(newBrowserPath)
 
 	// 最大并发数热重载
-	newMaxConn := viper.GetInt("server.max_connections")
+	newMaxConn := viper.GetInt("render.max_concurrency")
 	if newMaxConn <= 0 {
-		logger.Warn("❗ server.max_connections 必须大于 0", zap.Int("max_connections", newMaxConn))
+		logger.Warn("❗ render.max_concurrency 必须大于 0", zap.Int("max_concurrency", newMaxConn))
 		newMaxConn = 10
 	}
-	concurrentMutex.Lock()
-	maxConcurrent = int32(newMaxConn)
-	concurrentMutex.Unlock()
+	ConfigureRenderQueue(newMaxConn)
+	ConfigureRenderFairness()
+	ConfigureAutotune(newMaxConn)
+	ConfigureLoadShedding()
+	ConfigurePayloadSamples()
+	ConfigureSiteProfiles()
+	ConfigureDocumentLoading()
+	ConfigureSLO()
+	ConfigureChaos()
+	ConfigureWatermark()
+	ConfigureBrowserRecycle()
+	ConfigureI18n()
+	ConfigureSandbox()
+	ConfigureRenderRetry()
 
 	// IP 黑白名单热重载
 	whitelist := viper.GetStringSlice("ip_filter.whitelist")
@@ -140,13 +184,38 @@ func ApplyDynamicConfig() {
 	}
 	ConfigureRateLimiter(rlEnabled, rlWindow, rlMaxReqs, rlMask)
 
+	rlAlgorithm := viper.GetString("rate_limit.algorithm")
+	if rlAlgorithm == "" {
+		rlAlgorithm = RateLimitWindow
+	}
+	if rlAlgorithm != RateLimitWindow && rlAlgorithm != RateLimitTokenBucket {
+		logger.Warn("❗ rate_limit.algorithm 无效", zap.String("algorithm", rlAlgorithm), zap.String("default", RateLimitWindow))
+		rlAlgorithm = RateLimitWindow
+	}
+	rlKey := viper.GetString("rate_limit.key")
+	if rlKey == "" {
+		rlKey = RateLimitByIP
+	}
+	if rlKey != RateLimitByIP && rlKey != RateLimitByToken {
+		logger.Warn("❗ rate_limit.key 无效", zap.String("key", rlKey), zap.String("default", RateLimitByIP))
+		rlKey = RateLimitByIP
+	}
+	rlRate := viper.GetFloat64("rate_limit.rate")
+	if rlRate <= 0 {
+		rlRate = 10
+	}
+	rlBurst := viper.GetInt("rate_limit.burst")
+	if rlBurst <= 0 {
+		rlBurst = int(math.Ceil(rlRate))
+	}
+	ConfigureTokenBucket(rlAlgorithm, rlKey, rlRate, rlBurst)
+
 	// quality 范围校验 (0-100)
 	newQuality := viper.GetInt32("render.quality")
 	if newQuality < 0 || newQuality > 100 {
 		logger.Warn("❗ render.quality 值无效", zap.Int32("quality", newQuality), zap.String("default", "100"))
 		newQuality = 100
 	}
-	renderQuality.Store(newQuality)
 
 	// timeout 解析 (100ms - 60s)
 	newTimeout, err := ParseDuration(viper.Get("render.timeout"))
@@ -158,7 +227,19 @@ func ApplyDynamicConfig() {
 		}
 		newTimeout = 10000 * time.Millisecond
 	}
-	renderTimeout.Store(newTimeout.Milliseconds())
+	// 请求可指定的最大超时，不小于 render.timeout
+	maxTimeout := 60 * time.Second
+	if viper.IsSet("render.max_timeout") {
+		if d, err := ParseDuration(viper.Get("render.max_timeout")); err != nil || d <= 0 {
+			logger.Warn("❗ render.max_timeout 值无效", zap.Any("max_timeout", viper.Get("render.max_timeout")), zap.String("default", "60s"))
+		} else {
+			maxTimeout = d
+		}
+	}
+	if maxTimeout < newTimeout {
+		logger.Warn("❗ render.max_timeout 小于 render.timeout，使用 render.timeout", zap.Duration("max_timeout", maxTimeout), zap.Duration("timeout", newTimeout))
+		maxTimeout = newTimeout
+	}
 
 	// capture viewport 配置（带兜底）
 	width := int64(viper.GetInt("capture.viewport.width"))
@@ -176,9 +257,76 @@ func ApplyDynamicConfig() {
 		scale = 1.0
 		logger.Warn("❗ capture.viewport.scale 无效，使用默认值 1.0", zap.Float64("value", scale))
 	}
-	captureViewportWidth.Store(width)
-	captureViewportHeight.Store(height)
-	captureViewportScale.Store(scale)
+	// PDF 默认页面参数
+	pdfDefaults := PDFOptions{PageSize: "a4", Margin: "10mm"}
+	if configured, err := (PDFOptions{
+		PageSize:  viper.GetString("render.pdf.page_size"),
+		Landscape: viper.GetBool("render.pdf.landscape"),
+		Margin:    viper.Get("render.pdf.margin"),
+	}).withDefaults(pdfDefaults); err != nil {
+		logger.Warn("❗ render.pdf 配置无效，使用默认值 A4/10mm", zap.Error(err))
+	} else {
+		pdfDefaults = configured
+	}
+
+	// 图片后处理默认参数
+	var postProcess PostProcessOptions
+	if err := viper.UnmarshalKey("render.postprocess", &postProcess); err != nil {
+		logger.Warn("❗ render.postprocess 格式无效，不做后处理", zap.Error(err))
+	} else if postProcess, err = postProcess.withDefaults(PostProcessOptions{}); err != nil {
+		logger.Warn("❗ render.postprocess 配置无效，不做后处理", zap.Error(err))
+		postProcess = PostProcessOptions{}
+	}
+
+	// 超长卡片默认处理方式
+	var overflow OverflowOptions
+	if err := viper.UnmarshalKey("render.overflow", &overflow); err != nil {
+		logger.Warn("❗ render.overflow 格式无效，不限制高度", zap.Error(err))
+	} else if overflow, err = overflow.withDefaults(OverflowOptions{}); err != nil {
+		logger.Warn("❗ render.overflow 配置无效，不限制高度", zap.Error(err))
+		overflow = OverflowOptions{}
+	}
+
+	// 单次输出大小上限，负数为不限制
+	maxOutput := defaultMaxOutputBytes
+	if mb := viper.GetInt("render.max_output_size_mb"); mb > 0 {
+		maxOutput = mb << 20
+	} else if mb < 0 {
+		maxOutput = 0
+	}
+
+	// 渲染结果缓存，重载时清空内存缓存
+	cacheTTL, _ := ParseDuration(viper.Get("cache.ttl"))
+	if cacheTTL <= 0 {
+		cacheTTL = time.Minute
+	}
+	cacheMaxBytes := int64(viper.GetInt("cache.max_size_mb")) << 20
+	if cacheMaxBytes <= 0 {
+		cacheMaxBytes = 128 << 20
+	}
+	globalRenderCache.Configure(viper.GetBool("cache.enabled"), cacheTTL, cacheMaxBytes, viper.GetString("cache.dir"))
+
+	// 投递前内容审核规则
+	ConfigureModeration()
+
+	// 输出 PNG 的色彩配置
+	colorProfile, err := loadColorProfile(viper.GetString("render.icc_profile"))
+	if err != nil {
+		logger.Warn("❗ render.icc_profile 加载失败，不嵌入色彩配置", zap.Error(err))
+	}
+
+	renderDefaults.Store(&RenderDefaults{
+		Quality:      int(newQuality),
+		TimeoutMs:    newTimeout.Milliseconds(),
+		MaxTimeoutMs: maxTimeout.Milliseconds(),
+		Viewport:     ViewportOptions{Width: int(width), Height: int(height), Scale: scale},
+		PDF:          pdfDefaults,
+		PostProcess:  postProcess,
+		ColorProfile: colorProfile,
+
+		MaxOutputBytes: maxOutput,
+		Overflow:       overflow,
+	})
 }
 
 func parseLogLevel(level string) zapcore.Level {
@@ -195,3 +343,11 @@ func parseLogLevel(level string) zapcore.Level {
 		return zapcore.InfoLevel
 	}
 }
+
+// maskedIfSet 日志中隐藏已设置的敏感值
+func maskedIfSet(v string) string {
+	if v == "" {
+		return ""
+	}
+	return maskedValue
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// ====== 配置版本与迁移 ======
+//
+// 配置文件顶层的 version 字段标记结构版本，缺省视为 1。
+// 加载时自动将旧版本配置在内存中迁移到当前版本（不修改文件），
+// 运行 snapcast config migrate 可将迁移结果写回文件。
+// 新增不兼容的配置变更时，递增 configVersion 并在 configMigrations 末尾追加一项。
+
+const configVersion = 2
+
+type configMigration struct {
+	to          int // 迁移后的版本
+	description string
+	apply       func(root *yaml.Node) []string // 返回实际变更的说明
+}
+
+var configMigrations = []configMigration{
+	{
+		to:          2,
+		description: "并发限制移入 render 段",
+		apply: func(root *yaml.Node) []string {
+			return renameConfigKey(root, "server.max_connections", "render.max_concurrency")
+		},
+	},
+}
+
+// migrateConfig 将配置迁移到当前版本，返回迁移前的版本与变更说明
+func migrateConfig(root *yaml.Node) (int, []string, error) {
+	doc := documentMapping(root)
+	if doc == nil {
+		return 0, nil, fmt.Errorf("config root must be a mapping")
+	}
+	from := 1
+	if v := mappingValue(doc, "version"); v != nil {
+		n, err := strconv.Atoi(v.Value)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid config version %q", v.Value)
+		}
+		from = n
+	}
+	if from > configVersion {
+		return from, nil, fmt.Errorf("config version %d is newer than supported version %d", from, configVersion)
+	}
+
+	var changes []string
+	for _, m := range configMigrations {
+		if m.to <= from {
+			continue
+		}
+		for _, c := range m.apply(doc) {
+			changes = append(changes, fmt.Sprintf("v%d %s: %s", m.to, m.description, c))
+		}
+	}
+	if from < configVersion {
+		setMappingValue(doc, "version", strconv.Itoa(configVersion), true)
+	}
+	return from, changes, nil
+}
+
+// applyConfigMigration 读取已加载的配置文件，若版本过旧或含加密值，则将迁移、解密后的结果加载到 viper。
+// InitConfig 与配置热重载时调用。
+func applyConfigMigration() error {
+	file := viper.ConfigFileUsed()
+	if file == "" {
+		return nil
+	}
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(raw, &root); err != nil {
+		return err
+	}
+	if documentMapping(&root) == nil {
+		return nil
+	}
+	from, changes, err := migrateConfig(&root)
+	if err != nil {
+		return err
+	}
+	decrypted, err := decryptConfigNodes(&root)
+	if err != nil {
+		return err
+	}
+	if from == configVersion && decrypted == 0 {
+		return nil
+	}
+	out, err := yaml.Marshal(&root)
+	if err != nil {
+		return err
+	}
+	if err := viper.ReadConfig(bytes.NewReader(out)); err != nil {
+		return err
+	}
+	if decrypted > 0 {
+		logger.Debug("🔐 已解密配置中的加密值", zap.Int("count", decrypted))
+	}
+	if from == configVersion {
+		return nil
+	}
+	logger.Warn("❕ 配置文件版本过旧，已在内存中迁移，运行 snapcast config migrate 更新文件",
+		zap.Int("from", from), zap.Int("to", configVersion), zap.Strings("changes", changes))
+	return nil
+}
+
+// renameConfigKey 将 old 路径的值移动到 new 路径，new 已存在时仅删除 old
+func renameConfigKey(doc *yaml.Node, oldPath, newPath string) []string {
+	oldParent, oldKey := walkMapping(doc, oldPath, false)
+	if oldParent == nil {
+		return nil
+	}
+	idx := mappingIndex(oldParent, oldKey)
+	if idx < 0 {
+		return nil
+	}
+	keyNode, valueNode := oldParent.Content[idx], oldParent.Content[idx+1]
+	oldParent.Content = append(oldParent.Content[:idx], oldParent.Content[idx+2:]...)
+
+	newParent, newKey := walkMapping(doc, newPath, true)
+	if mappingIndex(newParent, newKey) >= 0 {
+		return []string{fmt.Sprintf("删除 %s（%s 已存在）", oldPath, newPath)}
+	}
+	keyNode.Value = newKey
+	newParent.Content = append(newParent.Content, keyNode, valueNode)
+	return []string{fmt.Sprintf("%s → %s", oldPath, newPath)}
+}
+
+// walkMapping 返回 path 最后一级所在的 mapping 节点与键名，create 为 true 时创建缺失的中间层
+func walkMapping(doc *yaml.Node, path string, create bool) (*yaml.Node, string) {
+	parts := strings.Split(path, ".")
+	node := doc
+	for _, p := range parts[:len(parts)-1] {
+		next := mappingValue(node, p)
+		if next == nil || next.Kind != yaml.MappingNode {
+			if !create {
+				return nil, ""
+			}
+			next = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			setMappingNode(node, p, next)
+		}
+		node = next
+	}
+	return node, parts[len(parts)-1]
+}
+
+func documentMapping(root *yaml.Node) *yaml.Node {
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil
+	}
+	return root
+}
+
+func mappingIndex(m *yaml.Node, key string) int {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func mappingValue(m *yaml.Node, key string) *yaml.Node {
+	if i := mappingIndex(m, key); i >= 0 {
+		return m.Content[i+1]
+	}
+	return nil
+}
+
+func setMappingNode(m *yaml.Node, key string, value *yaml.Node) {
+	if i := mappingIndex(m, key); i >= 0 {
+		m.Content[i+1] = value
+		return
+	}
+	m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+// setMappingValue 设置标量值，prepend 为 true 时新键插入到最前
+func setMappingValue(m *yaml.Node, key, value string, prepend bool) {
+	if v := mappingValue(m, key); v != nil {
+		v.Kind, v.Tag, v.Value = yaml.ScalarNode, "", value
+		return
+	}
+	k := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+	v := &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	if prepend {
+		// 文件头部注释保持在最前
+		if len(m.Content) > 0 {
+			k.HeadComment, m.Content[0].HeadComment = m.Content[0].HeadComment, ""
+		}
+		m.Content = append([]*yaml.Node{k, v}, m.Content...)
+		return
+	}
+	m.Content = append(m.Content, k, v)
+}
+
+// cmdConfigMigrate 将配置文件迁移到当前版本，原文件备份为 .bak
+func cmdConfigMigrate(file string, dryRun bool) int {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ 读取配置失败:", err)
+		return 1
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(raw, &root); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ 解析配置失败:", err)
+		return 1
+	}
+	from, changes, err := migrateConfig(&root)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ 迁移失败:", err)
+		return 1
+	}
+	if from == configVersion {
+		fmt.Printf("✅ %s 已是最新版本 v%d\n", file, configVersion)
+		return 0
+	}
+	fmt.Printf("🔧 %s: v%d → v%d\n", file, from, configVersion)
+	for _, c := range changes {
+		fmt.Println("   -", c)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&root); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ 生成配置失败:", err)
+		return 1
+	}
+	if dryRun {
+		fmt.Println()
+		fmt.Print(buf.String())
+		return 0
+	}
+	if err := os.WriteFile(file+".bak", raw, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ 备份失败:", err)
+		return 1
+	}
+	if err := os.WriteFile(file, buf.Bytes(), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ 写入失败:", err)
+		return 1
+	}
+	fmt.Println("✅ 已更新，原文件备份为", file+".bak")
+	return 0
+}
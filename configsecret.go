@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ====== 加密配置值 ======
+//
+// 配置文件需要提交到共享仓库时，敏感值可以加密保存：
+//
+//	auth:
+//	  token: "ENC[AES256_GCM,3q2+7w...]"
+//
+// 加载时使用环境变量 SNAPCAST_CONFIG_KEY（base64 编码的 32 字节密钥）或
+// SNAPCAST_CONFIG_KEY_FILE 指向的密钥文件解密，解密结果只保存在内存中。
+// snapcast config keygen 生成密钥，snapcast config encrypt 加密单个值。
+
+const (
+	configKeyEnv     = "SNAPCAST_CONFIG_KEY"
+	configKeyFileEnv = "SNAPCAST_CONFIG_KEY_FILE"
+	encryptedPrefix  = "ENC[AES256_GCM,"
+	encryptedSuffix  = "]"
+	configKeySize    = 32
+)
+
+// isEncryptedValue 是否为加密的配置值
+func isEncryptedValue(s string) bool {
+	return strings.HasPrefix(s, encryptedPrefix) && strings.HasSuffix(s, encryptedSuffix)
+}
+
+// loadConfigKey 从环境变量或密钥文件读取密钥
+func loadConfigKey() ([]byte, error) {
+	encoded := os.Getenv(configKeyEnv)
+	if encoded == "" {
+		file := os.Getenv(configKeyFileEnv)
+		if file == "" {
+			return nil, errors.New("未设置 " + configKeyEnv + " 或 " + configKeyFileEnv)
+		}
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("读取密钥文件失败: %w", err)
+		}
+		encoded = string(raw)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != configKeySize {
+		return nil, fmt.Errorf("密钥应为 base64 编码的 %d 字节", configKeySize)
+	}
+	return key, nil
+}
+
+func configCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptConfigValue 加密单个值，输出 ENC[AES256_GCM,base64(nonce|密文)]
+func encryptConfigValue(key []byte, plaintext string) (string, error) {
+	aead, err := configCipher(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed) + encryptedSuffix, nil
+}
+
+// decryptConfigValue 解密 ENC[...] 格式的值
+func decryptConfigValue(aead cipher.AEAD, value string) (string, error) {
+	encoded := strings.TrimSuffix(strings.TrimPrefix(value, encryptedPrefix), encryptedSuffix)
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("格式无效")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("解密失败，密钥不匹配或内容被修改")
+	}
+	return string(plain), nil
+}
+
+// decryptConfigNodes 就地解密配置树中所有加密值，返回解密的数量。
+// 存在加密值但没有密钥时返回错误，不加载含密文的配置。
+func decryptConfigNodes(root *yaml.Node) (int, error) {
+	var aead cipher.AEAD
+	count := 0
+	var walk func(n *yaml.Node, path string) error
+	walk = func(n *yaml.Node, path string) error {
+		switch n.Kind {
+		case yaml.DocumentNode, yaml.SequenceNode:
+			for i, child := range n.Content {
+				p := path
+				if n.Kind == yaml.SequenceNode {
+					p = fmt.Sprintf("%s[%d]", path, i)
+				}
+				if err := walk(child, p); err != nil {
+					return err
+				}
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				p := n.Content[i].Value
+				if path != "" {
+					p = path + "." + p
+				}
+				if err := walk(n.Content[i+1], p); err != nil {
+					return err
+				}
+			}
+		case yaml.ScalarNode:
+			if !isEncryptedValue(n.Value) {
+				return nil
+			}
+			if aead == nil {
+				key, err := loadConfigKey()
+				if err != nil {
+					return fmt.Errorf("%s: 配置含加密值，%w", path, err)
+				}
+				if aead, err = configCipher(key); err != nil {
+					return err
+				}
+			}
+			plain, err := decryptConfigValue(aead, n.Value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			n.Value, n.Tag, n.Style = plain, "!!str", 0
+			count++
+		}
+		return nil
+	}
+	return count, walk(root, "")
+}
+
+// cmdConfigKeygen 生成新的配置密钥
+func cmdConfigKeygen() int {
+	key := make([]byte, configKeySize)
+	if _, err := rand.Read(key); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ 生成密钥失败:", err)
+		return 1
+	}
+	fmt.Println(base64.StdEncoding.EncodeToString(key))
+	return 0
+}
+
+// cmdConfigEncrypt 加密参数或标准输入中的值
+func cmdConfigEncrypt(args []string) int {
+	key, err := loadConfigKey()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+	var value string
+	switch len(args) {
+	case 0:
+		// 从标准输入读取，避免明文留在 shell 历史中
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			fmt.Fprintln(os.Stderr, "❌ 读取失败:", err)
+			return 1
+		}
+		value = strings.TrimRight(line, "\r\n")
+	case 1:
+		value = args[0]
+	default:
+		fmt.Fprintln(os.Stderr, "用法: snapcast config encrypt [值]")
+		return 2
+	}
+	if value == "" {
+		fmt.Fprintln(os.Stderr, "❌ 值为空")
+		return 1
+	}
+	out, err := encryptConfigValue(key, value)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ 加密失败:", err)
+		return 1
+	}
+	fmt.Println(out)
+	return 0
+}
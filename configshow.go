@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v3"
+)
+
+// ====== 生效配置 ======
+
+const maskedValue = "******"
+
+// secretKeyParts 键名包含这些片段时视为敏感字段，后几项对应请求头配置（如 sites.<name>.headers）中的凭据
+var secretKeyParts = []string{"token", "secret", "password", "passwd", "api_key", "access_key", "private_key", "authorization", "cookie", "api-key", "apikey"}
+
+// secretSections 其下所有值都视为敏感的配置段，如链路导出器的认证请求头
+var secretSections = []string{"tracing.headers"}
+
+// secretValueChecks 判断值本身是否为凭据（如带 token 的 webhook 地址），由各 Sink 在 init 中注册
+var secretValueChecks []func(string) bool
+
+func isSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, part := range secretKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// maskSecrets 递归替换敏感字段的非空值
+func maskSecrets(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, item := range val {
+			if isSecretKey(k) {
+				if s, ok := item.(string); !ok || s != "" {
+					out[k] = maskedValue
+					continue
+				}
+			}
+			out[k] = maskSecrets(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, item := range val {
+			out[i] = maskSecrets(item)
+		}
+		return out
+	case string:
+		for _, check := range secretValueChecks {
+			if check(val) {
+				return maskedValue
+			}
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// effectiveConfig 返回 viper 合并后的完整配置（已迁移到当前版本），敏感字段已脱敏
+func effectiveConfig() map[string]any {
+	settings := maskSecrets(viper.AllSettings()).(map[string]any)
+	for _, section := range secretSections {
+		maskSection(settings, strings.Split(section, "."))
+	}
+	return settings
+}
+
+// maskSection 替换 path 所指配置段中的全部非空值，settings 为 maskSecrets 返回的副本
+func maskSection(settings map[string]any, path []string) {
+	item, found := settings[path[0]]
+	if !found {
+		return
+	}
+	section, isMap := item.(map[string]any)
+	if !isMap {
+		return
+	}
+	if len(path) > 1 {
+		maskSection(section, path[1:])
+		return
+	}
+	for k, v := range section {
+		if s, isString := v.(string); !isString || s != "" {
+			section[k] = maskedValue
+		}
+	}
+}
+
+// cmdConfigShow 加载配置文件并输出生效配置
+func cmdConfigShow(args []string) int {
+	fset := flag.NewFlagSet("config show", flag.ContinueOnError)
+	asJSON := fset.Bool("json", false, "以 JSON 格式输出")
+	reveal := fset.Bool("reveal", false, "显示敏感字段原值")
+	if err := fset.Parse(args); err != nil {
+		return 2
+	}
+	file := setupConfigFile
+	if fset.NArg() > 0 {
+		file = fset.Arg(0)
+	}
+
+	InitLogger()
+	logLevel.SetLevel(zapcore.ErrorLevel) // 避免日志混入输出
+	viper.SetConfigFile(file)
+	if err := viper.ReadInConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ 配置文件加载失败:", err)
+		return 1
+	}
+	if err := applyConfigMigration(); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ 配置迁移或解密失败:", err)
+		return 1
+	}
+
+	settings := viper.AllSettings()
+	if !*reveal {
+		settings = effectiveConfig()
+	}
+	if *asJSON {
+		b, _ := json.MarshalIndent(settings, "", "  ")
+		fmt.Println(string(b))
+		return 0
+	}
+	fmt.Printf("# 配置文件: %s\n", viper.ConfigFileUsed())
+	// 顶层按字母排序输出，便于对比
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(map[string]any{k: settings[k]}); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ 输出失败:", err)
+			return 1
+		}
+		fmt.Print(buf.String())
+	}
+	return 0
+}
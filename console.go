@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	cdplog "github.com/chromedp/cdproto/log"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// ====== 页面控制台 ======
+//
+// 每个标签页的 console 输出、未捕获的异常与浏览器日志（资源加载失败等）记录在渲染的追踪器中，
+// 模板脚本出错时卡片往往只是空白或错位而不报错，这些输出是唯一的线索：
+//   - 日志级别为 debug 时逐条写入日志
+//   - 请求设置 "debug": true 时，失败响应的 data.console 中附带全部输出
+//   - 渲染失败时随失败记录一起保存（见 failures.go）
+// 每次渲染最多保留 maxConsoleEntries 条。
+
+const (
+	maxConsoleEntries = 200
+	maxConsoleText    = 2000
+)
+
+// ConsoleEntry 页面控制台的一条输出
+type ConsoleEntry struct {
+	Time   time.Time `json:"time"`
+	Level  string    `json:"level"`  // log、info、warning、error、debug
+	Source string    `json:"source"` // console、exception（未捕获的异常）或浏览器日志来源（network 等）
+	Text   string    `json:"text"`
+	URL    string    `json:"url,omitempty"`
+	Line   int64     `json:"line,omitempty"` // 从 1 开始
+}
+
+// pageConsole 一次渲染中所有标签页的控制台输出
+type pageConsole struct {
+	mu      sync.Mutex
+	entries []ConsoleEntry
+	dropped int
+}
+
+// watch 监听标签页的控制台事件
+func (pc *pageConsole) watch(ctx context.Context) {
+	chromedp.ListenTarget(ctx, func(ev any) {
+		switch e := ev.(type) {
+		case *runtime.EventConsoleAPICalled:
+			parts := make([]string, 0, len(e.Args))
+			for _, arg := range e.Args {
+				parts = append(parts, remoteObjectText(arg))
+			}
+			entry := ConsoleEntry{Level: consoleLevel(e.Type), Source: "console", Text: strings.Join(parts, " ")}
+			if e.StackTrace != nil && len(e.StackTrace.CallFrames) > 0 {
+				frame := e.StackTrace.CallFrames[0]
+				entry.URL, entry.Line = frame.URL, frame.LineNumber+1
+			}
+			pc.add(entry)
+		case *runtime.EventExceptionThrown:
+			d := e.ExceptionDetails
+			text := d.Text
+			if d.Exception != nil && d.Exception.Description != "" {
+				text = d.Exception.Description
+			}
+			pc.add(ConsoleEntry{Level: "error", Source: "exception", Text: text, URL: d.URL, Line: d.LineNumber + 1})
+		case *cdplog.EventEntryAdded:
+			entry := ConsoleEntry{Level: string(e.Entry.Level), Source: string(e.Entry.Source), Text: e.Entry.Text, URL: e.Entry.URL}
+			if e.Entry.LineNumber > 0 {
+				entry.Line = e.Entry.LineNumber + 1
+			}
+			pc.add(entry)
+		}
+	})
+}
+
+func (pc *pageConsole) add(e ConsoleEntry) {
+	e.Time = time.Now()
+	if len(e.Text) > maxConsoleText {
+		e.Text = e.Text[:maxConsoleText] + "…"
+	}
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if len(pc.entries) >= maxConsoleEntries {
+		pc.dropped++
+		return
+	}
+	pc.entries = append(pc.entries, e)
+}
+
+// Entries 返回已记录的输出与因超出条数而丢弃的数量
+func (pc *pageConsole) Entries() ([]ConsoleEntry, int) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return append([]ConsoleEntry(nil), pc.entries...), pc.dropped
+}
+
+// logConsole 在 debug 日志中逐条输出页面控制台，模板脚本出错导致空白或错位的卡片可据此定位
+func logConsole(log *zap.Logger, entries []ConsoleEntry, dropped int) {
+	if !log.Core().Enabled(zapcore.DebugLevel) {
+		return
+	}
+	for _, e := range entries {
+		fields := []zap.Field{zap.String("level", e.Level), zap.String("source", e.Source), zap.String("text", e.Text)}
+		if e.URL != "" {
+			fields = append(fields, zap.String("url", e.URL), zap.Int64("line", e.Line))
+		}
+		log.Debug("🖥️ 页面控制台", fields...)
+	}
+	if dropped > 0 {
+		log.Debug("🖥️ 页面控制台输出过多，已丢弃", zap.Int("dropped", dropped))
+	}
+}
+
+// renderErrorResp 渲染失败的响应体：数据不符合模板 schema 时在 data.errors 中列出字段，
+// 请求设置了 debug: true 时在 data.console 中附带页面控制台输出
+func renderErrorResp(payload *PushPayload, err error) APIResponse {
+	resp := errResp(err.Error())
+	data := gin.H{}
+	var serr *SchemaError
+	if errors.As(err, &serr) {
+		data["errors"] = serr.Violations
+	}
+	if payload.Debug {
+		console := payload.console
+		if console == nil {
+			console = []ConsoleEntry{}
+		}
+		data["console"] = console
+	}
+	if len(data) > 0 {
+		resp.Data = data
+	}
+	return resp
+}
+
+// consoleLevel 将 console API 的类型归并为日志级别，如 console.warn → warning
+func consoleLevel(t runtime.APIType) string {
+	switch t {
+	case runtime.APITypeError, runtime.APITypeAssert:
+		return "error"
+	case runtime.APITypeWarning:
+		return "warning"
+	case runtime.APITypeDebug:
+		return "debug"
+	case runtime.APITypeInfo:
+		return "info"
+	}
+	return "log"
+}
+
+// remoteObjectText 将 console 参数转换为文本：字符串原样输出，其他基本类型输出 JSON，对象使用描述
+func remoteObjectText(o *runtime.RemoteObject) string {
+	if o == nil {
+		return ""
+	}
+	if len(o.Value) > 0 {
+		var s string
+		if json.Unmarshal(o.Value, &s) == nil {
+			return s
+		}
+		return string(o.Value)
+	}
+	if o.UnserializableValue != "" {
+		return string(o.UnserializableValue)
+	}
+	if o.Description != "" {
+		return o.Description
+	}
+	return string(o.Type)
+}
@@ -0,0 +1,558 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 请求数据校验 ======
+//
+// 模板旁的 <type>.schema.json（如 bilibili/live.schema.json）声明模板需要的数据结构（JSON Schema），
+// 请求的 data 在数据转换之后、执行模板之前按它校验，不符合时返回 422 并列出缺失或类型不对的字段，
+// 而不是渲染出一张缺了几块内容的卡片。主题变体没有单独的 schema 时使用基础模板的。
+//
+// 支持 JSON Schema 中常用的关键字：type、properties、required、additionalProperties、items、
+// enum、const、minLength/maxLength、pattern、format（uri、date-time、email）、minimum/maximum、
+// exclusiveMinimum/exclusiveMaximum、multipleOf、minItems/maxItems、uniqueItems、
+// minProperties/maxProperties、allOf/anyOf/oneOf/not 以及指向本文件 $defs/definitions 的 $ref，
+// 其他关键字忽略。GET /admin/schema/:site/:type 推断出的 schema 可以直接作为起点。
+//
+// template.schema 控制校验方式：enforce（默认）拒绝不符合的请求，warn 只记录日志照常渲染，off 不校验。
+
+const maxSchemaViolations = 20
+
+// SchemaViolation 一处不符合 schema 的字段
+type SchemaViolation struct {
+	Field string `json:"field"` // 如 data.owner.name、data.pics[2]
+	Error string `json:"error"`
+}
+
+// SchemaError 请求数据不符合模板的 schema
+type SchemaError struct {
+	Violations []SchemaViolation
+	Truncated  bool // 超过 maxSchemaViolations 条时只保留前面的
+}
+
+func (e *SchemaError) Error() string {
+	parts := make([]string, 0, 3)
+	for i, v := range e.Violations {
+		if i == 3 {
+			break
+		}
+		parts = append(parts, v.Field+" "+v.Error)
+	}
+	msg := "data does not match template schema: " + strings.Join(parts, "; ")
+	if more := len(e.Violations) - len(parts); e.Truncated {
+		msg += fmt.Sprintf(" (and %d+ more)", more)
+	} else if more > 0 {
+		msg += fmt.Sprintf(" (and %d more)", more)
+	}
+	return msg
+}
+
+var schemaRejected = NewCounterVec("snapcast_data_schema_violations_total", "Requests whose data did not match the template schema, by template and mode.", "template", "mode")
+
+// dataSchema 已解析的 schema 文件
+type dataSchema struct {
+	root     any
+	patterns map[string]*regexp.Regexp
+}
+
+type cachedSchema struct {
+	modTime time.Time
+	size    int64
+	schema  *dataSchema
+}
+
+// schemaCache schema 文件路径 → 解析结果，文件修改后重新解析
+var schemaCache sync.Map
+
+// schemaPath 返回模板对应的 schema 路径，如 bilibili_live.html → bilibili_live.schema.json
+func schemaPath(tmplPath string) string {
+	return strings.TrimSuffix(tmplPath, ".html") + ".schema.json"
+}
+
+// loadTemplateSchema 读取模板的 schema，没有时返回 nil
+func loadTemplateSchema(tmplPath string) (*dataSchema, error) {
+	path := schemaPath(tmplPath)
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		dir, name := filepath.Split(tmplPath)
+		if base, _, isVariant := strings.Cut(name, "."); isVariant && base+".html" != name {
+			path = schemaPath(dir + base + ".html")
+			info, err = os.Stat(path)
+		}
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := schemaCache.Load(path); ok {
+		if c := v.(*cachedSchema); c.modTime.Equal(info.ModTime()) && c.size == info.Size() {
+			return c.schema, nil
+		}
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := parseDataSchema(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template schema %s: %w", path, err)
+	}
+	schemaCache.Store(path, &cachedSchema{modTime: info.ModTime(), size: info.Size(), schema: s})
+	return s, nil
+}
+
+// parseDataSchema 解析 schema 并预编译其中的 pattern
+func parseDataSchema(b []byte) (*dataSchema, error) {
+	var root any
+	if err := json.Unmarshal(b, &root); err != nil {
+		return nil, err
+	}
+	if _, isObject := root.(map[string]any); !isObject {
+		return nil, errors.New("schema must be a JSON object")
+	}
+	s := &dataSchema{root: root, patterns: make(map[string]*regexp.Regexp)}
+	if err := s.compile(root); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *dataSchema) compile(node any) error {
+	switch n := node.(type) {
+	case map[string]any:
+		for key, v := range n {
+			if p, isString := v.(string); isString && key == "pattern" {
+				re, err := regexp.Compile(p)
+				if err != nil {
+					return fmt.Errorf("pattern %q: %w", p, err)
+				}
+				s.patterns[p] = re
+				continue
+			}
+			if key == "enum" || key == "const" {
+				continue
+			}
+			if err := s.compile(v); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, v := range n {
+			if err := s.compile(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Validate 校验数据，全部符合时返回 nil
+func (s *dataSchema) Validate(data any) *SchemaError {
+	// 统一为 JSON 解码后的类型（map[string]any、[]any、float64），数据转换的结果可能是其他 Go 类型
+	b, err := json.Marshal(data)
+	if err != nil {
+		return &SchemaError{Violations: []SchemaViolation{{Field: "data", Error: "is not valid JSON: " + err.Error()}}}
+	}
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return &SchemaError{Violations: []SchemaViolation{{Field: "data", Error: "is not valid JSON: " + err.Error()}}}
+	}
+	vs := &schemaValidator{schema: s}
+	vs.validate(s.root, v, "data", 0)
+	if len(vs.violations) == 0 {
+		return nil
+	}
+	return &SchemaError{Violations: vs.violations, Truncated: vs.truncated}
+}
+
+type schemaValidator struct {
+	schema     *dataSchema
+	violations []SchemaViolation
+	truncated  bool
+}
+
+func (vs *schemaValidator) fail(field, format string, args ...any) {
+	if len(vs.violations) >= maxSchemaViolations {
+		vs.truncated = true
+		return
+	}
+	vs.violations = append(vs.violations, SchemaViolation{Field: field, Error: fmt.Sprintf(format, args...)})
+}
+
+// valid 在不记录错误的情况下判断是否符合，用于 anyOf/oneOf/not
+func (vs *schemaValidator) valid(node, v any, depth int) bool {
+	sub := &schemaValidator{schema: vs.schema}
+	sub.validate(node, v, "", depth)
+	return len(sub.violations) == 0 && !sub.truncated
+}
+
+func (vs *schemaValidator) resolve(ref string) (any, bool) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, false
+	}
+	node := vs.schema.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#"), "/") {
+		if part == "" {
+			continue
+		}
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		m, isObject := node.(map[string]any)
+		if !isObject {
+			return nil, false
+		}
+		var found bool
+		if node, found = m[part]; !found {
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+func (vs *schemaValidator) validate(node, v any, field string, depth int) {
+	if depth > 64 {
+		vs.fail(field, "schema nesting is too deep")
+		return
+	}
+	switch n := node.(type) {
+	case bool:
+		if !n {
+			vs.fail(field, "is not allowed")
+		}
+		return
+	case map[string]any:
+		if ref, isString := n["$ref"].(string); isString {
+			target, found := vs.resolve(ref)
+			if !found {
+				vs.fail(field, "references unknown schema %s", ref)
+				return
+			}
+			vs.validate(target, v, field, depth+1)
+		}
+		vs.validateObjectSchema(n, v, field, depth)
+	}
+}
+
+func (vs *schemaValidator) validateObjectSchema(n map[string]any, v any, field string, depth int) {
+	if t, exists := n["type"]; exists && !matchesType(t, v) {
+		vs.fail(field, "must be %s, got %s", typeNames(t), jsonTypeOf(v))
+		return
+	}
+	if c, exists := n["const"]; exists && !reflect.DeepEqual(c, v) {
+		vs.fail(field, "must be %s", compactJSON(c))
+	}
+	if e, isList := n["enum"].([]any); isList {
+		found := false
+		for _, option := range e {
+			if reflect.DeepEqual(option, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			vs.fail(field, "must be one of %s", compactJSON(e))
+		}
+	}
+
+	for _, sub := range schemaList(n["allOf"]) {
+		vs.validate(sub, v, field, depth+1)
+	}
+	if subs := schemaList(n["anyOf"]); len(subs) > 0 {
+		matched := false
+		for _, sub := range subs {
+			if vs.valid(sub, v, depth+1) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			vs.fail(field, "does not match any of the allowed schemas")
+		}
+	}
+	if subs := schemaList(n["oneOf"]); len(subs) > 0 {
+		matched := 0
+		for _, sub := range subs {
+			if vs.valid(sub, v, depth+1) {
+				matched++
+			}
+		}
+		if matched != 1 {
+			vs.fail(field, "must match exactly one of the allowed schemas, matched %d", matched)
+		}
+	}
+	if not, exists := n["not"]; exists && vs.valid(not, v, depth+1) {
+		vs.fail(field, "must not match the excluded schema")
+	}
+
+	switch v := v.(type) {
+	case string:
+		vs.validateString(n, v, field)
+	case float64:
+		vs.validateNumber(n, v, field)
+	case []any:
+		vs.validateArray(n, v, field, depth)
+	case map[string]any:
+		vs.validateObject(n, v, field, depth)
+	}
+}
+
+func (vs *schemaValidator) validateString(n map[string]any, v, field string) {
+	length := utf8.RuneCountInString(v)
+	if min, exists := schemaNumber(n["minLength"]); exists && float64(length) < min {
+		if min == 1 {
+			vs.fail(field, "must not be empty")
+		} else {
+			vs.fail(field, "must be at least %g characters", min)
+		}
+	}
+	if max, exists := schemaNumber(n["maxLength"]); exists && float64(length) > max {
+		vs.fail(field, "must be at most %g characters", max)
+	}
+	if p, isString := n["pattern"].(string); isString {
+		if re := vs.schema.patterns[p]; re != nil && !re.MatchString(v) {
+			vs.fail(field, "must match pattern %s", p)
+		}
+	}
+	if format, isString := n["format"].(string); isString && !matchesFormat(format, v) {
+		vs.fail(field, "must be a valid %s", format)
+	}
+}
+
+func (vs *schemaValidator) validateNumber(n map[string]any, v float64, field string) {
+	if min, exists := schemaNumber(n["minimum"]); exists && v < min {
+		vs.fail(field, "must be >= %g", min)
+	}
+	if max, exists := schemaNumber(n["maximum"]); exists && v > max {
+		vs.fail(field, "must be <= %g", max)
+	}
+	if min, exists := schemaNumber(n["exclusiveMinimum"]); exists && v <= min {
+		vs.fail(field, "must be > %g", min)
+	}
+	if max, exists := schemaNumber(n["exclusiveMaximum"]); exists && v >= max {
+		vs.fail(field, "must be < %g", max)
+	}
+	if m, exists := schemaNumber(n["multipleOf"]); exists && m > 0 {
+		if q := v / m; math.Abs(q-math.Round(q)) > 1e-9 {
+			vs.fail(field, "must be a multiple of %g", m)
+		}
+	}
+}
+
+func (vs *schemaValidator) validateArray(n map[string]any, v []any, field string, depth int) {
+	if min, exists := schemaNumber(n["minItems"]); exists && float64(len(v)) < min {
+		vs.fail(field, "must have at least %g items", min)
+	}
+	if max, exists := schemaNumber(n["maxItems"]); exists && float64(len(v)) > max {
+		vs.fail(field, "must have at most %g items", max)
+	}
+	if unique, _ := n["uniqueItems"].(bool); unique {
+	outer:
+		for i := range v {
+			for j := 0; j < i; j++ {
+				if reflect.DeepEqual(v[i], v[j]) {
+					vs.fail(fmt.Sprintf("%s[%d]", field, i), "duplicates %s[%d]", field, j)
+					break outer
+				}
+			}
+		}
+	}
+	if items, exists := n["items"]; exists {
+		for i, item := range v {
+			vs.validate(items, item, fmt.Sprintf("%s[%d]", field, i), depth+1)
+		}
+	}
+}
+
+func (vs *schemaValidator) validateObject(n map[string]any, v map[string]any, field string, depth int) {
+	if min, exists := schemaNumber(n["minProperties"]); exists && float64(len(v)) < min {
+		vs.fail(field, "must have at least %g properties", min)
+	}
+	if max, exists := schemaNumber(n["maxProperties"]); exists && float64(len(v)) > max {
+		vs.fail(field, "must have at most %g properties", max)
+	}
+	if required, isList := n["required"].([]any); isList {
+		for _, r := range required {
+			if key, isString := r.(string); isString {
+				if _, exists := v[key]; !exists {
+					vs.fail(childField(field, key), "is required")
+				}
+			}
+		}
+	}
+	props, _ := n["properties"].(map[string]any)
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys) // 错误顺序稳定
+	additional, hasAdditional := n["additionalProperties"]
+	for _, key := range keys {
+		if sub, declared := props[key]; declared {
+			vs.validate(sub, v[key], childField(field, key), depth+1)
+		} else if hasAdditional {
+			if allowed, isBool := additional.(bool); isBool && !allowed {
+				vs.fail(childField(field, key), "is not an allowed field")
+			} else if !isBool {
+				vs.validate(additional, v[key], childField(field, key), depth+1)
+			}
+		}
+	}
+}
+
+// childField 拼接字段路径，非标识符的键使用 ["key"]
+func childField(field, key string) string {
+	if identRegex.MatchString(key) {
+		return field + "." + key
+	}
+	return field + "[" + strconv.Quote(key) + "]"
+}
+
+func schemaList(v any) []any {
+	list, _ := v.([]any)
+	return list
+}
+
+func schemaNumber(v any) (float64, bool) {
+	f, isNumber := v.(float64)
+	return f, isNumber
+}
+
+// jsonTypeOf 返回值的 JSON Schema 类型，整数返回 integer
+func jsonTypeOf(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return "unknown"
+}
+
+func matchesType(t, v any) bool {
+	actual := jsonTypeOf(v)
+	match := func(name string) bool {
+		return name == actual || (name == "number" && actual == "integer")
+	}
+	switch t := t.(type) {
+	case string:
+		return match(t)
+	case []any:
+		for _, name := range t {
+			if s, isString := name.(string); isString && match(s) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func typeNames(t any) string {
+	if list, isList := t.([]any); isList {
+		names := make([]string, 0, len(list))
+		for _, name := range list {
+			names = append(names, fmt.Sprint(name))
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+var emailRegex = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+// matchesFormat 校验常用 format，未知的 format 不校验
+func matchesFormat(format, v string) bool {
+	switch format {
+	case "uri", "url":
+		u, err := url.Parse(v)
+		return err == nil && u.Scheme != "" && (u.Host != "" || u.Opaque != "")
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, v)
+		return err == nil
+	case "date":
+		_, err := time.Parse(time.DateOnly, v)
+		return err == nil
+	case "email":
+		return emailRegex.MatchString(v)
+	}
+	return true
+}
+
+func compactJSON(v any) string {
+	b, _ := json.Marshal(v)
+	if len(b) > 120 {
+		return string(b[:117]) + "..."
+	}
+	return string(b)
+}
+
+// schemaMode 读取 template.schema：enforce、warn 或 off
+func schemaMode() string {
+	switch mode := viper.GetString("template.schema"); mode {
+	case "warn", "off":
+		return mode
+	}
+	return "enforce"
+}
+
+// validatePayloadSchema 按模板的 schema 校验数据，enforce 模式下不符合时返回 422
+func validatePayloadSchema(rc *RenderContext) error {
+	if rc.Template == "" {
+		return nil
+	}
+	mode := schemaMode()
+	if mode == "off" {
+		return nil
+	}
+	schema, err := loadTemplateSchema(rc.Template)
+	if err != nil {
+		rc.Logger.Error("❌ 模板 schema 读取失败", zap.Error(err), zap.String("template", rc.Template))
+		return err
+	}
+	if schema == nil {
+		return nil
+	}
+	serr := schema.Validate(rc.Payload.Data)
+	if serr == nil {
+		return nil
+	}
+	schemaRejected.Inc(templateKeyOf(rc.Template), mode)
+	if mode == "warn" {
+		rc.Logger.Warn("❕ 请求数据不符合模板 schema，继续渲染", zap.String("template", rc.Template), zap.Any("violations", serr.Violations))
+		return nil
+	}
+	rc.Logger.Warn("❕ 请求数据不符合模板 schema", zap.String("template", rc.Template), zap.Any("violations", serr.Violations))
+	return newRenderError(http.StatusUnprocessableEntity, serr)
+}
@@ -0,0 +1,73 @@
+//go:build !noadmin
+
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 运行时调试接口 ======
+//
+// debug.endpoints 开启后提供 net/http/pprof 与 /debug/renders，与管理接口相同，
+// 始终需要认证，未配置认证时仅允许本机访问（修改需重启）：
+//
+//	go tool pprof http://127.0.0.1:8080/debug/pprof/heap
+//	curl http://127.0.0.1:8080/debug/pprof/goroutine?debug=2   # chromedp 卡住时查看阻塞位置
+//	curl http://127.0.0.1:8080/debug/renders                   # 进行中的渲染及其所处阶段
+
+// registerDebugRoutes 注册调试接口
+func registerDebugRoutes(r *gin.Engine) {
+	if !viper.GetBool("debug.endpoints") {
+		return
+	}
+	g := r.Group("/debug", adminGuard())
+	g.GET("/renders", DebugRendersHandler)
+	g.GET("/pprof/*name", pprofHandler)
+	g.POST("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	logger.Warn("🩺 调试接口已启用，请勿在不受信任的网络中开放", zap.String("prefix", "/debug"))
+}
+
+// pprofHandler 按路径分派到 net/http/pprof，pprof.Index 要求路径以 /debug/pprof/ 开头
+func pprofHandler(c *gin.Context) {
+	switch c.Param("name") {
+	case "/cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "/profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "/symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "/trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		pprof.Index(c.Writer, c.Request)
+	}
+}
+
+// DebugRendersHandler 列出进行中的渲染，耗时长的在前
+func DebugRendersHandler(c *gin.Context) {
+	renders := inflightSnapshot()
+	overdue := 0
+	for _, r := range renders {
+		if r.Overdue {
+			overdue++
+		}
+	}
+	concurrentMutex.Lock()
+	inFlight, queued := currentConcurrent, len(renderQueue)
+	concurrentMutex.Unlock()
+	c.JSON(http.StatusOK, ok(gin.H{
+		"time":       time.Now().Format(time.RFC3339),
+		"renders":    renders,
+		"overdue":    overdue,
+		"slots_used": inFlight,
+		"queued":     queued,
+		"goroutines": runtime.NumGoroutine(),
+	}))
+}
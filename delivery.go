@@ -0,0 +1,147 @@
+//go:build !nodelivery
+
+package main
+
+import (
+	"context"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"SnapCast/extension"
+)
+
+var sinkInstances = make(map[string]extension.Sink)
+
+// startSinks 按配置创建 Sink 实例，调用方需持有 extMutex
+func startSinks() {
+	configureReceiptStore()
+	for name, cfg := range extensionConfigs("sinks") {
+		driver := extension.DriverName(name, cfg)
+		factory, found := extension.SinkFactoryFor(driver)
+		if !found {
+			logger.Warn("❕ 未注册的 Sink", zap.String("name", name), zap.String("type", driver), zap.Strings("registered", extension.SinkNames()))
+			continue
+		}
+		sink, err := factory(extension.SinkOptions{Name: name, Config: cfg, Logger: logger.With(zap.String("sink", name))})
+		if err != nil {
+			logger.Error("❌ Sink 创建失败", zap.String("name", name), zap.Error(err))
+			continue
+		}
+		sinkInstances[name] = sink
+		logger.Info("🔌 Sink 已加载", zap.String("name", name), zap.String("type", driver))
+	}
+	// delivery 下配置了内置 Sink 且未声明同名实例时自动创建，见 telegram.go、discord.go
+	implicit := map[string]bool{
+		"telegram": viper.GetString("delivery.telegram.token") != "",
+		"discord":  viper.GetBool("delivery.discord_webhook.enabled"),
+	}
+	for name, enabled := range implicit {
+		if _, exists := sinkInstances[name]; exists || !enabled {
+			continue
+		}
+		factory, _ := extension.SinkFactoryFor(name)
+		sink, err := factory(extension.SinkOptions{Name: name, Logger: logger.With(zap.String("sink", name))})
+		if err != nil {
+			logger.Error("❌ Sink 创建失败", zap.String("name", name), zap.Error(err))
+			continue
+		}
+		sinkInstances[name] = sink
+		logger.Info("🔌 Sink 已加载", zap.String("name", name), zap.String("type", name))
+	}
+}
+
+// stopSinks 关闭全部 Sink 实例，调用方需持有 extMutex
+func stopSinks() {
+	for name, sink := range sinkInstances {
+		if err := sink.Close(); err != nil {
+			logger.Warn("⚠️ Sink 关闭失败", zap.String("name", name), zap.Error(err))
+		}
+		delete(sinkInstances, name)
+	}
+}
+
+// deliverResult 将渲染结果依次投递到请求指定的 Sink，单个目标失败不影响其余目标。
+// 同一投递 ID 已成功投递的目标不再重复投递，见 receipts.go。
+func deliverResult(ctx context.Context, payload *PushPayload, result *RenderResult) []extension.Receipt {
+	log := loggerFor(ctx)
+	id := deliveryID(payload)
+	result.DeliveryID = id
+	unlock := globalReceipts.Lock(id)
+	defer unlock()
+
+	receipts := make([]extension.Receipt, 0, len(payload.Deliver))
+	verdict := moderate(ctx, payload, result)
+	frames := deliveryFrames(result)
+	result.Moderation = verdict
+	for _, target := range payload.Deliver {
+		if verdict != nil && verdict.Blocked {
+			receipts = append(receipts, extension.Receipt{Sink: target.Sink, Error: "blocked by moderation: " + verdict.Reason})
+			continue
+		}
+		key := targetKey(target)
+		if prev, delivered := globalReceipts.Lookup(id, key); delivered {
+			extra := make(map[string]any, len(prev.Extra)+1)
+			for k, v := range prev.Extra {
+				extra[k] = v
+			}
+			extra["duplicate"] = true
+			prev.Extra = extra
+			receipts = append(receipts, prev)
+			log.Info("⏭️ 目标已投递过，跳过", zap.String("sink", target.Sink), zap.String("delivery_id", id), zap.String("message_id", prev.MessageID))
+			continue
+		}
+		extMutex.RLock()
+		sink, found := sinkInstances[target.Sink]
+		extMutex.RUnlock()
+		if !found {
+			receipts = append(receipts, extension.Receipt{Sink: target.Sink, Error: "sink not configured"})
+			continue
+		}
+		receipt, err := sink.Deliver(ctx, &extension.Delivery{
+			Site:        payload.Site,
+			Type:        payload.Type,
+			ContentType: result.ContentType,
+			Body:        result.Body,
+			Frames:      frames,
+			AltText:     result.Alt,
+			Data:        payload.Data,
+			Params:      target.Params,
+		})
+		if err != nil {
+			log.Error("❌ 投递失败", zap.String("sink", target.Sink), zap.Error(err))
+			receipts = append(receipts, extension.Receipt{Sink: target.Sink, Error: err.Error()})
+			continue
+		}
+		if receipt == nil {
+			receipt = &extension.Receipt{}
+		}
+		receipt.Sink = target.Sink
+		if verdict != nil && verdict.Flagged {
+			if receipt.Extra == nil {
+				receipt.Extra = make(map[string]any)
+			}
+			receipt.Extra["moderation_flagged"] = verdict.Reason
+		}
+		receipts = append(receipts, *receipt)
+		globalReceipts.Record(id, payload, key, *receipt)
+		log.Info("📨 投递成功", zap.String("sink", target.Sink), zap.String("message_id", receipt.MessageID), zap.String("delivery_id", id))
+	}
+	return receipts
+}
+
+// deliveryFrames 投递时的逐帧图片，非多帧结果返回 nil
+func deliveryFrames(result *RenderResult) []extension.Frame {
+	frames := result.Frames
+	if frames == nil && result.ContentType == zipContentType {
+		frames, _ = unzipFrames(result.Body)
+	}
+	if len(frames) == 0 {
+		return nil
+	}
+	out := make([]extension.Frame, len(frames))
+	for i, f := range frames {
+		out[i] = extension.Frame{ContentType: "image/png", Body: f}
+	}
+	return out
+}
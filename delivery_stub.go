@@ -0,0 +1,33 @@
+//go:build nodelivery
+
+package main
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"SnapCast/extension"
+)
+
+// 使用 nodelivery 构建时不包含投递功能，sinks 配置被忽略
+
+func startSinks() {
+	if len(extensionConfigs("sinks")) > 0 {
+		logger.Warn("❕ 当前构建不包含投递功能（nodelivery），已忽略 sinks 配置")
+	}
+}
+
+func stopSinks() {}
+
+func registerDeliveryRoutes(_ *gin.Engine) {}
+
+func deliverResult(_ context.Context, payload *PushPayload, _ *RenderResult) []extension.Receipt {
+	receipts := make([]extension.Receipt, 0, len(payload.Deliver))
+	for _, target := range payload.Deliver {
+		receipts = append(receipts, extension.Receipt{Sink: target.Sink, Error: "delivery not included in this build"})
+	}
+	logger.Debug("❕ 投递功能未编译", zap.Int("targets", len(payload.Deliver)))
+	return receipts
+}
@@ -0,0 +1,297 @@
+//go:build !nodelivery
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"SnapCast/extension"
+)
+
+// ====== Discord Webhook 投递 ======
+//
+// 内置的 discord Sink 将渲染结果作为附件上传到 Discord Webhook，可附带 embed：
+//
+//	delivery:
+//	  discord_webhook:
+//	    enabled: true                  # 自动创建名为 discord 的 Sink
+//	    presets:                       # 具名 webhook，请求中以 params.webhook 引用
+//	      news: "https://discord.com/api/webhooks/123/abc"
+//	    username: "SnapCast"           # 覆盖 webhook 的显示名称与头像，可选
+//	    avatar_url: ""
+//
+// 请求中指定 webhook（具名预设或完整地址）与可选的 embed：
+//
+//	"deliver": [{"sink": "discord", "params": {"webhook": "news"}}]
+//	"deliver": [{"sink": "discord", "params": {"webhook_url": "https://discord.com/api/webhooks/123/abc",
+//	    "content": "开播啦", "embed": {"title": "直播间", "url": "https://live.bilibili.com/1", "color": 16486972}}]
+//
+// 完整地址只允许 Discord 的 /api/webhooks/ 路径，避免被用来访问其他地址。embed 未设置 image 时
+// 使用上传的第一张图片。回执的 message_id 为 Discord 返回的消息 ID。
+// 多帧结果每条消息最多 10 个附件；遇到 429 时按 retry_after 等待后重试一次（最多 10 秒）。
+
+const (
+	discordMaxAttachments = 10
+	discordMaxFileBytes   = 10 << 20
+	discordMaxRetryAfter  = 10 * time.Second
+)
+
+func init() {
+	extension.RegisterSink("discord", newDiscordSink)
+	// webhook 地址中含有 token，生效配置中脱敏
+	secretValueChecks = append(secretValueChecks, isDiscordWebhook)
+}
+
+// discordConfig sinks.<name> 或 delivery.discord_webhook 中 discord 的配置
+type discordConfig struct {
+	Presets   map[string]string `mapstructure:"presets"`
+	Username  string            `mapstructure:"username"`
+	AvatarURL string            `mapstructure:"avatar_url"`
+	Timeout   any               `mapstructure:"timeout"`
+}
+
+type discordSink struct {
+	cfg    discordConfig
+	client *http.Client
+	log    *zap.Logger
+}
+
+func newDiscordSink(opts extension.SinkOptions) (extension.Sink, error) {
+	var cfg, defaults discordConfig
+	if err := viper.UnmarshalKey("delivery.discord_webhook", &defaults); err != nil {
+		return nil, err
+	}
+	if err := viper.UnmarshalKey("sinks."+opts.Name, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Presets == nil {
+		cfg.Presets = defaults.Presets
+	}
+	if cfg.Username == "" {
+		cfg.Username = defaults.Username
+	}
+	if cfg.AvatarURL == "" {
+		cfg.AvatarURL = defaults.AvatarURL
+	}
+	for name, u := range cfg.Presets {
+		if !isDiscordWebhook(u) {
+			return nil, fmt.Errorf("presets.%s is not a Discord webhook URL", name)
+		}
+	}
+	timeout := 60 * time.Second
+	if cfg.Timeout != nil {
+		d, err := ParseDuration(cfg.Timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid timeout %v", cfg.Timeout)
+		}
+		timeout = d
+	}
+	return &discordSink{cfg: cfg, client: &http.Client{Timeout: timeout}, log: opts.Logger}, nil
+}
+
+func (s *discordSink) Close() error { return nil }
+
+// isDiscordWebhook 是否为 Discord 的 webhook 地址
+func isDiscordWebhook(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.User != nil {
+		return false
+	}
+	switch u.Hostname() {
+	case "discord.com", "discordapp.com", "ptb.discord.com", "canary.discord.com":
+	default:
+		return false
+	}
+	return strings.HasPrefix(u.Path, "/api/webhooks/") || strings.HasPrefix(u.Path, "/api/v10/webhooks/")
+}
+
+func (s *discordSink) Deliver(ctx context.Context, d *extension.Delivery) (*extension.Receipt, error) {
+	webhook, err := s.webhookURL(d.Params)
+	if err != nil {
+		return nil, err
+	}
+	images, err := deliveryImages(d)
+	if err != nil {
+		return nil, err
+	}
+	for i, img := range images {
+		if len(img.Body) > discordMaxFileBytes {
+			return nil, fmt.Errorf("image %d is %s, exceeds Discord's %s limit", i+1, formatBytes(len(img.Body)), formatBytes(discordMaxFileBytes))
+		}
+	}
+	u, err := url.Parse(webhook)
+	if err != nil {
+		return nil, err
+	}
+	// webhook 地址自身可能已带查询参数（如 thread_id），合并而非拼接
+	q := u.Query()
+	q.Set("wait", "true")
+	if thread := paramString(d.Params, "thread_id"); thread != "" {
+		q.Set("thread_id", thread)
+	}
+	u.RawQuery = q.Encode()
+	webhook = u.String()
+
+	var ids []string
+	for start := 0; start < len(images); start += discordMaxAttachments {
+		end := min(start+discordMaxAttachments, len(images))
+		payload := map[string]any{}
+		if s.cfg.Username != "" {
+			payload["username"] = s.cfg.Username
+		}
+		if s.cfg.AvatarURL != "" {
+			payload["avatar_url"] = s.cfg.AvatarURL
+		}
+		var attachments []map[string]any
+		for i, img := range images[start:end] {
+			a := map[string]any{"id": i, "filename": fmt.Sprintf("card%d%s", start+i+1, contentTypeExt[img.ContentType])}
+			if d.AltText != "" {
+				a["description"] = truncateRunes(d.AltText, 1024)
+			}
+			attachments = append(attachments, a)
+		}
+		payload["attachments"] = attachments
+		// 文字与 embed 只随第一条消息发送
+		if start == 0 {
+			if content := paramString(d.Params, "content"); content != "" {
+				payload["content"] = truncateRunes(content, 2000)
+			}
+			if embed, isObject := d.Params["embed"].(map[string]any); isObject {
+				e := make(map[string]any, len(embed)+1)
+				for k, v := range embed {
+					e[k] = v
+				}
+				if _, hasImage := e["image"]; !hasImage {
+					e["image"] = map[string]any{"url": "attachment://" + attachments[0]["filename"].(string)}
+				}
+				payload["embeds"] = []any{e}
+			}
+		}
+		var msg struct {
+			ID string `json:"id"`
+		}
+		if err := s.execute(ctx, webhook, payload, images[start:end], attachments, &msg); err != nil {
+			return nil, err
+		}
+		ids = append(ids, msg.ID)
+	}
+	receipt := &extension.Receipt{MessageID: ids[0]}
+	if len(ids) > 1 {
+		receipt.Extra = map[string]any{"message_ids": ids}
+	}
+	return receipt, nil
+}
+
+// webhookURL 由 params.webhook（预设名）或 params.webhook_url 得到 webhook 地址
+func (s *discordSink) webhookURL(params map[string]any) (string, error) {
+	if name := paramString(params, "webhook"); name != "" {
+		u, found := s.cfg.Presets[name]
+		if !found {
+			return "", fmt.Errorf("discord webhook preset %q not configured", name)
+		}
+		return u, nil
+	}
+	u := paramString(params, "webhook_url")
+	if u == "" {
+		return "", errors.New("params.webhook or params.webhook_url is required")
+	}
+	if !isDiscordWebhook(u) {
+		return "", errors.New("params.webhook_url is not a Discord webhook URL")
+	}
+	return strings.TrimRight(u, "/"), nil
+}
+
+// execute 上传一条消息，429 时按 retry_after 等待后重试一次
+func (s *discordSink) execute(ctx context.Context, webhook string, payload map[string]any, files []extension.Frame, attachments []map[string]any, out any) error {
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := s.post(ctx, webhook, payload, files, attachments, out)
+		if retryAfter <= 0 || retryAfter > discordMaxRetryAfter || attempt > 0 {
+			return err
+		}
+		s.log.Warn("⏳ Discord 限流，等待后重试", zap.Duration("retry_after", retryAfter))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryAfter):
+		}
+	}
+}
+
+func (s *discordSink) post(ctx context.Context, webhook string, payload map[string]any, files []extension.Frame, attachments []map[string]any, out any) (time.Duration, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	if err := w.WriteField("payload_json", string(payloadJSON)); err != nil {
+		return 0, err
+	}
+	for i, f := range files {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="files[%d]"; filename="%s"`, i, attachments[i]["filename"]))
+		header.Set("Content-Type", f.ContentType)
+		part, err := w.CreatePart(header)
+		if err != nil {
+			return 0, err
+		}
+		part.Write(f.Body)
+	}
+	if err := w.Close(); err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, &body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// 错误信息中的地址带有 webhook token，不原样返回
+		return 0, fmt.Errorf("discord webhook: %w", errors.Unwrap(err))
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode == http.StatusTooManyRequests {
+		var limited struct {
+			RetryAfter float64 `json:"retry_after"`
+		}
+		json.Unmarshal(b, &limited)
+		if limited.RetryAfter == 0 {
+			limited.RetryAfter, _ = strconv.ParseFloat(resp.Header.Get("Retry-After"), 64)
+		}
+		return time.Duration(limited.RetryAfter * float64(time.Second)), errors.New("discord webhook rate limited")
+	}
+	if resp.StatusCode >= 300 {
+		var failed struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(b, &failed)
+		return 0, fmt.Errorf("discord webhook returned %s: %s", resp.Status, failed.Message)
+	}
+	return 0, json.Unmarshal(b, out)
+}
+
+// truncateRunes 按字符截断，超出时以省略号结尾
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
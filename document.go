@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"html"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 页面加载方式 ======
+//
+// render.document 为 inline（默认）时，标签页先打开一个固定的空白页，再通过 CDP
+// Page.setDocumentContent 写入渲染后的 HTML，每次渲染不再落盘临时文件。空白页位于
+// 本地文件中，页面仍是 file:// 来源，内置字体等本地资源照常加载。为 file 时沿用
+// 写入临时文件后以 file:// 打开的方式。
+//
+// 两种方式都会在 <head> 中插入 <base href>，模板中的相对路径按 render.base_url 解析，
+// 未配置时按模板所在目录解析。
+//
+// 使用远程浏览器时本地文件对浏览器不可见，inline 方式改为打开 about:blank，且不再默认按模板目录解析。
+
+// 页面加载方式
+const (
+	DocumentInline = "inline"
+	DocumentFile   = "file"
+)
+
+type documentConfig struct {
+	mode    string
+	baseURL string
+}
+
+var documentSettings atomic.Pointer[documentConfig]
+
+var baseTagRegex = regexp.MustCompile(`(?i)<base[\s>]`)
+
+// ConfigureDocumentLoading 读取 render.document 与 render.base_url，由 ApplyDynamicConfig 调用
+func ConfigureDocumentLoading() {
+	cfg := documentConfig{mode: strings.ToLower(viper.GetString("render.document"))}
+	switch cfg.mode {
+	case "":
+		cfg.mode = DocumentInline
+	case DocumentInline, DocumentFile:
+	default:
+		logger.Warn("❗ render.document 无效，使用 inline", zap.String("document", cfg.mode))
+		cfg.mode = DocumentInline
+	}
+	if base := viper.GetString("render.base_url"); base != "" {
+		u, err := url.Parse(base)
+		if err != nil || !u.IsAbs() {
+			logger.Warn("❗ render.base_url 不是绝对地址，已忽略", zap.String("base_url", base))
+		} else {
+			// 不以 / 结尾时最后一段会被当作文件名，相对路径解析到上一级
+			if !strings.HasSuffix(u.Path, "/") {
+				u.Path += "/"
+			}
+			cfg.baseURL = u.String()
+		}
+	}
+	documentSettings.Store(&cfg)
+}
+
+func currentDocumentConfig() *documentConfig {
+	if cfg := documentSettings.Load(); cfg != nil {
+		return cfg
+	}
+	return &documentConfig{mode: DocumentInline}
+}
+
+// documentBaseURL 模板中相对路径的解析地址，优先使用 render.base_url，其次为模板所在目录
+func documentBaseURL(templatePath string) string {
+	if base := currentDocumentConfig().baseURL; base != "" {
+		return base
+	}
+	if templatePath == "" || remoteBrowser() {
+		return ""
+	}
+	dir, err := filepath.Abs(filepath.Dir(templatePath))
+	if err != nil {
+		return ""
+	}
+	return fileURL(dir) + "/"
+}
+
+// fileURL 本地路径对应的 file:// 地址
+func fileURL(absPath string) string {
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(absPath)}
+	if !strings.HasPrefix(u.Path, "/") {
+		u.Path = "/" + u.Path // Windows 盘符路径
+	}
+	return u.String()
+}
+
+// LoadHTML 返回在标签页中加载 HTML 的动作，及加载完成后释放资源的函数。baseURL 为空时不插入 <base>。
+func (t *resourceTracker) LoadHTML(doc, baseURL, name string) (chromedp.Action, func(), error) {
+	doc = injectBaseURL(doc, baseURL)
+	if currentDocumentConfig().mode == DocumentFile {
+		fileURL, release, err := t.TempHTML(doc, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		return t.guardLoad(fileURL, chromedp.Navigate(fileURL)), release, nil
+	}
+	blank, err := blankPageURL()
+	if err != nil {
+		return nil, nil, err
+	}
+	return t.guardLoad(blank, setDocumentContent(blank, doc)), func() {}, nil
+}
+
+// guardLoad 调用方提供的 HTML 在加载前启用请求拦截，见 renderhtml.go
+func (t *resourceTracker) guardLoad(docURL string, load chromedp.Action) chromedp.Action {
+	if !t.blockPrivate {
+		return load
+	}
+	return chromedp.Tasks{blockPrivateRequests(docURL, t.log), load}
+}
+
+// blankPageName 空白页文件名，不使用 tempFilePrefix 以免被临时文件清理删除
+const blankPageName = "snapcast-blank.html"
+
+// remoteBrowser 是否连接远程浏览器
+func remoteBrowser() bool {
+	return viper.GetString("render.remote_debugging_url") != ""
+}
+
+// blankPageURL 返回空白页地址，文件不存在时（如系统临时目录被清理）重新创建
+func blankPageURL() (string, error) {
+	if remoteBrowser() {
+		return "about:blank", nil
+	}
+	path := filepath.Join(os.TempDir(), blankPageName)
+	if _, err := os.Stat(path); err != nil {
+		if err := os.WriteFile(path, []byte("<!DOCTYPE html><html><head></head><body></body></html>"), 0o644); err != nil {
+			return "", err
+		}
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return fileURL(abs), nil
+}
+
+// setDocumentContent 打开空白页并写入 HTML，等待页面资源加载完成
+func setDocumentContent(blank, doc string) chromedp.Action {
+	return chromedp.Tasks{
+		chromedp.Navigate(blank),
+		chromedp.ActionFunc(func(ctx context.Context) error {
+			tree, err := page.GetFrameTree().Do(ctx)
+			if err != nil {
+				return err
+			}
+			return page.SetDocumentContent(tree.Frame.ID, doc).Do(ctx)
+		}),
+		// 超时由标签页上下文控制
+		chromedp.Poll(`document.readyState === 'complete'`, nil, chromedp.WithPollingTimeout(0)),
+	}
+}
+
+// injectBaseURL 在 <head> 开头插入 <base href>，文档已有 <base> 时不做修改
+func injectBaseURL(doc, base string) string {
+	if base == "" {
+		return doc
+	}
+	if baseTagRegex.MatchString(doc) {
+		return doc
+	}
+	tag := `<base href="` + html.EscapeString(base) + `">`
+	if loc := headTagRegex.FindStringIndex(doc); loc != nil {
+		return doc[:loc[1]] + tag + doc[loc[1]:]
+	}
+	return tag + doc
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 远程图片内联 ======
+//
+// 模板函数 embedImage 在服务端拉取远程图片并内联为 data URI，截图时无需再访问 CDN，
+// 避免 CDN 慢或防盗链导致图片裂开：
+//
+//	<img src="{{embedImage .face}}">
+//
+// 拉取结果与资源缓存代理共用缓存；失败或超出大小时返回原地址，由浏览器自行加载。
+// 开启 assets.embed.auto 时在截图前将 HTML 中所有 <img src="http..."> 内联，模板无需修改。
+
+const (
+	embedConcurrency = 8 // 自动内联时并发拉取数
+)
+
+var errNotImage = errors.New("not an image")
+
+// imageEmbedConfig 拉取参数，由 initImageEmbed 设置
+var imageEmbedConfig = struct {
+	timeout time.Duration
+	retries int
+	maxSize int
+}{timeout: 5 * time.Second, retries: 2, maxSize: 2 << 20}
+
+var embedImageTotal = NewCounterVec("snapcast_embed_image_total", "Remote images fetched for data URI embedding by result.", "result")
+
+// initImageEmbed 读取 assets.embed 配置，开启 auto 时注册自动内联中间件
+func initImageEmbed() {
+	if d, err := ParseDuration(viper.Get("assets.embed.timeout")); err == nil && d > 0 {
+		imageEmbedConfig.timeout = d
+	}
+	if viper.IsSet("assets.embed.retries") {
+		imageEmbedConfig.retries = max(viper.GetInt("assets.embed.retries"), 0)
+	}
+	if mb := viper.GetFloat64("assets.embed.max_size_mb"); mb > 0 {
+		imageEmbedConfig.maxSize = int(mb * (1 << 20))
+	}
+	if viper.GetBool("assets.embed.auto") {
+		UseRenderMiddleware(StageCapture, "image-embed", imageEmbedMiddleware)
+		logger.Info("🖼️ 已开启远程图片自动内联", zap.Duration("timeout", imageEmbedConfig.timeout), zap.Int("retries", imageEmbedConfig.retries))
+	}
+}
+
+// fetchImageDataURI 拉取图片并编码为 data URI，失败时按配置重试
+func fetchImageDataURI(ctx context.Context, rawURL string) (string, error) {
+	if err := validateURL(rawURL); err != nil {
+		return "", err // 不重试
+	}
+	var lastErr error
+	for attempt := 0; attempt <= imageEmbedConfig.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(time.Duration(attempt) * 200 * time.Millisecond):
+			}
+		}
+		attemptCtx, cancel := context.WithTimeout(ctx, imageEmbedConfig.timeout)
+		entry, err := globalAssetCache.Get(attemptCtx, rawURL)
+		cancel()
+		if err != nil {
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		contentType, _, _ := strings.Cut(entry.contentType, ";")
+		if !strings.HasPrefix(contentType, "image/") {
+			return "", fmt.Errorf("%w: %s", errNotImage, contentType)
+		}
+		if len(entry.data) > imageEmbedConfig.maxSize {
+			return "", fmt.Errorf("image too large to embed: %s", formatBytes(len(entry.data)))
+		}
+		return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(entry.data), nil
+	}
+	return "", lastErr
+}
+
+// embedImage 模板函数，返回图片的 data URI，非 http/https 地址或拉取失败时返回原地址
+func embedImage(ctx context.Context, rawURL string) template.URL {
+	if !strings.HasPrefix(rawURL, "http://") && !strings.HasPrefix(rawURL, "https://") {
+		return template.URL(rawURL)
+	}
+	uri, err := fetchImageDataURI(ctx, rawURL)
+	if err != nil {
+		embedImageTotal.Inc("error")
+		loggerFor(ctx).Warn("⚠️ 图片内联失败，使用原地址", zap.String("url", rawURL), zap.Error(err))
+		return template.URL(rawURL)
+	}
+	embedImageTotal.Inc("ok")
+	return template.URL(uri)
+}
+
+// imageEmbedMiddleware 截图前将 HTML 中的 <img src="http..."> 并发拉取并内联
+func imageEmbedMiddleware(rc *RenderContext) error {
+	if rc.Payload.Output != "image" {
+		return rc.Next()
+	}
+	matches := remoteSrcRegex.FindAllSubmatch(rc.HTML, -1)
+	if len(matches) == 0 {
+		return rc.Next()
+	}
+	uris := make(map[string]string)
+	for _, m := range matches {
+		uris[strings.ReplaceAll(string(m[2]), "&amp;", "&")] = ""
+	}
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, embedConcurrency)
+	)
+	for src := range uris {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			uri := string(embedImage(rc.Ctx, src))
+			mu.Lock()
+			uris[src] = uri
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	rc.HTML = remoteSrcRegex.ReplaceAllFunc(rc.HTML, func(m []byte) []byte {
+		parts := remoteSrcRegex.FindSubmatch(m)
+		src := strings.ReplaceAll(string(parts[2]), "&amp;", "&")
+		if uri := uris[src]; strings.HasPrefix(uri, "data:") {
+			return []byte(string(parts[1]) + uri + string(parts[3]))
+		}
+		return m
+	})
+	return rc.Next()
+}
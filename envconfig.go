@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 环境变量与命令行参数 ======
+//
+// 所有配置键都可以用 SNAPCAST_ 前缀的环境变量覆盖，键中的 . 换成 _ 并大写，
+// 如 server.port → SNAPCAST_SERVER_PORT、auth.token → SNAPCAST_AUTH_TOKEN，
+// 列表以空格分隔。优先级：命令行参数 > 环境变量 > 配置文件 > 默认值。
+// 容器中不挂载配置文件时，缺少的配置文件无法写入则使用内置默认配置。
+
+const envPrefix = "SNAPCAST"
+
+// serverFlags 启动服务时的命令行参数
+type serverFlags struct {
+	config string
+	host   string
+	port   string
+}
+
+// isServerFlag 参数以 - 开头时视为启动服务的参数而不是子命令
+func isServerFlag(arg string) bool {
+	return strings.HasPrefix(arg, "-") && arg != "-h" && arg != "--help" && arg != "-help"
+}
+
+// parseServerFlags 解析启动服务的命令行参数，--config 默认取环境变量 SNAPCAST_CONFIG，
+// 出错时已输出到标准错误
+func parseServerFlags(args []string) (serverFlags, error) {
+	var f serverFlags
+	fset := flag.NewFlagSet("snapcast", flag.ContinueOnError)
+	fset.StringVar(&f.config, "config", os.Getenv(envPrefix+"_CONFIG"), "配置文件路径，默认为当前目录的 "+setupConfigFile)
+	fset.StringVar(&f.host, "host", "", "监听地址，覆盖 server.host")
+	fset.StringVar(&f.port, "port", "", "监听端口，覆盖 server.port")
+	fset.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: snapcast [--config 文件] [--host 地址] [--port 端口]")
+		fset.PrintDefaults()
+	}
+	if err := fset.Parse(args); err != nil {
+		return f, err
+	}
+	if fset.NArg() > 0 {
+		err := fmt.Errorf("未知参数: %s", fset.Arg(0))
+		fmt.Fprintln(os.Stderr, err)
+		fset.Usage()
+		return f, err
+	}
+	return f, nil
+}
+
+// apply 命令行参数覆盖配置，viper.Set 的值在配置热重载后仍然生效
+func (f serverFlags) apply() {
+	if f.host != "" {
+		viper.Set("server.host", f.host)
+	}
+	if f.port != "" {
+		viper.Set("server.port", f.port)
+	}
+}
+
+// bindEnv 开启 SNAPCAST_ 环境变量覆盖
+func bindEnv() {
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+}
+
+// readDefaultConfig 读取内置默认配置，配置文件不可用时使用
+func readDefaultConfig() error {
+	viper.SetConfigType("yaml")
+	return viper.ReadConfig(bytes.NewReader(defaultConfig()))
+}
+
+// envOverrides 返回已设置且对应已知配置键的环境变量名，只用于日志，不含值
+func envOverrides() []string {
+	var names []string
+	for _, key := range viper.AllKeys() {
+		name := envPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+		if _, set := os.LookupEnv(name); set {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// logEnvOverrides 输出生效的环境变量覆盖
+func logEnvOverrides() {
+	if names := envOverrides(); len(names) > 0 {
+		logger.Info("🌱 环境变量覆盖配置", zap.Strings("env", names))
+	}
+}
@@ -0,0 +1,230 @@
+// Package extension 定义 SnapCast 的扩展接口。
+//
+// 第三方代码在自己的包里调用 RegisterSource / RegisterSink 注册工厂函数，
+// 再在 SnapCast 主程序中以空白导入（import _ "example.com/mysink"）引入即可，
+// 无需修改核心文件。实例的创建、启动与关闭由主程序按配置统一管理。
+package extension
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// ====== 渲染任务 ======
+
+// Target 指定一次渲染结果要投递到的 Sink 及其参数
+type Target struct {
+	Sink   string         `json:"sink"`             // Sink 实例名，对应配置 sinks.<name>
+	Params map[string]any `json:"params,omitempty"` // 投递参数，如群号、频道 ID
+}
+
+// Job 是 Source 提交给主程序的渲染任务，字段含义与 /render 请求一致
+type Job struct {
+	Site    string   `json:"site"`
+	Type    string   `json:"type"`
+	Output  string   `json:"output,omitempty"` // "image" (default), "html", or "json"
+	Data    any      `json:"data,omitempty"`
+	Deliver []Target `json:"deliver,omitempty"` // 渲染完成后投递的目标
+
+	Priority       int    `json:"priority,omitempty"`        // 排队优先级，数值大的优先，与 HTTP 请求的 priority 相同
+	IdempotencyKey string `json:"idempotency_key,omitempty"` // 投递 ID，重试的任务使用相同的值以跳过已成功投递的目标
+}
+
+// Result 是一次渲染的产物
+type Result struct {
+	Site        string
+	Type        string
+	Template    string // 实际使用的模板路径
+	ContentType string
+	Body        []byte
+	Receipts    []Receipt // 投递回执，仅当 Job.Deliver 非空时填充
+}
+
+// Host 由主程序实现，供 Source 提交渲染任务
+type Host interface {
+	Render(ctx context.Context, job Job) (*Result, error)
+}
+
+// ====== Source ======
+
+// SourceOptions 是创建 Source 时传入的参数
+type SourceOptions struct {
+	Name   string         // 实例名，即配置 sources.<name> 中的 name
+	Config map[string]any // sources.<name> 下的全部配置
+	Host   Host
+	Logger *zap.Logger
+}
+
+// Source 产生渲染任务（如轮询 RSS、消费消息队列）。
+// Start 应当立即返回，后台工作在 ctx 取消或 Stop 调用后结束。
+type Source interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// SourceFactory 根据配置创建 Source 实例
+type SourceFactory func(opts SourceOptions) (Source, error)
+
+// ====== Sink ======
+
+// SinkOptions 是创建 Sink 时传入的参数
+type SinkOptions struct {
+	Name   string         // 实例名，即配置 sinks.<name> 中的 name
+	Config map[string]any // sinks.<name> 下的全部配置
+	Logger *zap.Logger
+}
+
+// Delivery 是一次投递的内容
+type Delivery struct {
+	Site        string
+	Type        string
+	ContentType string
+	Body        []byte
+	Frames      []Frame        // options.frames 开启时的逐帧图片，Body 为打包后的 zip
+	AltText     string         // 卡片的替代文本，支持图片说明的 Sink 可作为 caption 发送，模板未配置时为空
+	Data        any            // 原始渲染数据
+	Params      map[string]any // Target.Params
+}
+
+// Frame 是多帧结果中的一张图片。支持多图消息的 Sink 可将 Delivery.Frames 作为相册发送，
+// 不支持的 Sink 忽略该字段、直接投递 Body 即可。
+type Frame struct {
+	ContentType string
+	Body        []byte
+}
+
+// Receipt 是投递回执
+type Receipt struct {
+	Sink      string         `json:"sink"`
+	MessageID string         `json:"message_id,omitempty"`
+	Error     string         `json:"error,omitempty"`
+	Extra     map[string]any `json:"extra,omitempty"`
+}
+
+// Sink 接收渲染结果并投递到外部系统（如聊天机器人、Webhook）
+type Sink interface {
+	Deliver(ctx context.Context, d *Delivery) (*Receipt, error)
+	Close() error
+}
+
+// SinkFactory 根据配置创建 Sink 实例
+type SinkFactory func(opts SinkOptions) (Sink, error)
+
+// ====== 注册表 ======
+
+// driverKey 是实例配置中指定工厂名的字段，缺省时使用实例名
+const driverKey = "type"
+
+var (
+	mu      sync.RWMutex
+	sources = make(map[string]SourceFactory)
+	sinks   = make(map[string]SinkFactory)
+)
+
+// RegisterSource 注册 Source 工厂，通常在 init 中调用。重复注册会 panic。
+func RegisterSource(name string, factory SourceFactory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if factory == nil {
+		panic("extension: RegisterSource factory is nil")
+	}
+	if _, dup := sources[name]; dup {
+		panic("extension: RegisterSource called twice for " + name)
+	}
+	sources[name] = factory
+}
+
+// RegisterSink 注册 Sink 工厂，通常在 init 中调用。重复注册会 panic。
+func RegisterSink(name string, factory SinkFactory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if factory == nil {
+		panic("extension: RegisterSink factory is nil")
+	}
+	if _, dup := sinks[name]; dup {
+		panic("extension: RegisterSink called twice for " + name)
+	}
+	sinks[name] = factory
+}
+
+// SourceFactoryFor 按名称查找 Source 工厂
+func SourceFactoryFor(name string) (SourceFactory, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	f, ok := sources[name]
+	return f, ok
+}
+
+// SinkFactoryFor 按名称查找 Sink 工厂
+func SinkFactoryFor(name string) (SinkFactory, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	f, ok := sinks[name]
+	return f, ok
+}
+
+// SourceNames 返回已注册的 Source 名称（已排序）
+func SourceNames() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return sortedKeys(sources)
+}
+
+// SinkNames 返回已注册的 Sink 名称（已排序）
+func SinkNames() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return sortedKeys(sinks)
+}
+
+// DriverName 返回实例配置所使用的工厂名：优先取 type 字段，否则使用实例名
+func DriverName(instance string, cfg map[string]any) string {
+	if v, ok := cfg[driverKey]; ok {
+		if s := fmt.Sprint(v); s != "" {
+			return s
+		}
+	}
+	return instance
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	names := make([]string, 0, len(m))
+	for k := range m {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ====== 模板函数 ======
+
+var templateFuncs = make(map[string]any)
+
+// RegisterTemplateFunc 注册模板函数，在模板加载前合并进全局函数表。
+// 与内置函数同名时覆盖内置实现。重复注册会 panic。
+func RegisterTemplateFunc(name string, fn any) {
+	mu.Lock()
+	defer mu.Unlock()
+	if fn == nil {
+		panic("extension: RegisterTemplateFunc fn is nil")
+	}
+	if _, dup := templateFuncs[name]; dup {
+		panic("extension: RegisterTemplateFunc called twice for " + name)
+	}
+	templateFuncs[name] = fn
+}
+
+// TemplateFuncs 返回已注册模板函数的副本
+func TemplateFuncs() map[string]any {
+	mu.RLock()
+	defer mu.RUnlock()
+	out := make(map[string]any, len(templateFuncs))
+	for k, v := range templateFuncs {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"SnapCast/extension"
+)
+
+// ====== 扩展实例管理 ======
+//
+// 配置示例：
+//
+//	sinks:
+//	  my_webhook:          # 实例名，请求中 deliver[].sink 引用此名称
+//	    type: webhook      # 工厂名，缺省时与实例名相同
+//	    enabled: true      # 缺省为 true
+//	    url: "https://..." # 其余字段原样传给工厂
+//	sources:
+//	  my_feed:
+//	    type: rss
+
+var (
+	extMutex        sync.RWMutex
+	sourceInstances = make(map[string]extension.Source)
+)
+
+// applyExtensionFuncs 将扩展注册的模板函数合并进全局函数表，需在模板加载前调用
+func applyExtensionFuncs() {
+	for name, fn := range extension.TemplateFuncs() {
+		if _, exists := funcsList[name]; exists {
+			logger.Warn("❕ 扩展模板函数覆盖内置函数", zap.String("name", name))
+		}
+		funcsList[name] = fn
+	}
+}
+
+// StartExtensions 按配置创建并启动全部 Source/Sink 实例
+func StartExtensions(ctx context.Context) {
+	extMutex.Lock()
+	defer extMutex.Unlock()
+
+	startSinks()
+
+	for name, cfg := range extensionConfigs("sources") {
+		driver := extension.DriverName(name, cfg)
+		factory, found := extension.SourceFactoryFor(driver)
+		if !found {
+			logger.Warn("❕ 未注册的 Source", zap.String("name", name), zap.String("type", driver), zap.Strings("registered", extension.SourceNames()))
+			continue
+		}
+		source, err := factory(extension.SourceOptions{Name: name, Config: cfg, Host: renderHost{}, Logger: logger.With(zap.String("source", name))})
+		if err != nil {
+			logger.Error("❌ Source 创建失败", zap.String("name", name), zap.Error(err))
+			continue
+		}
+		if err := source.Start(ctx); err != nil {
+			logger.Error("❌ Source 启动失败", zap.String("name", name), zap.Error(err))
+			continue
+		}
+		sourceInstances[name] = source
+		logger.Info("🔌 Source 已启动", zap.String("name", name), zap.String("type", driver))
+	}
+}
+
+// StopExtensions 先停止 Source 不再产生任务，再关闭 Sink
+func StopExtensions(ctx context.Context) {
+	extMutex.Lock()
+	defer extMutex.Unlock()
+
+	for name, source := range sourceInstances {
+		if err := source.Stop(ctx); err != nil {
+			logger.Warn("⚠️ Source 停止失败", zap.String("name", name), zap.Error(err))
+		}
+		delete(sourceInstances, name)
+	}
+	stopSinks()
+}
+
+// extensionConfigs 读取 sinks/sources 下启用的实例配置
+func extensionConfigs(section string) map[string]map[string]any {
+	out := make(map[string]map[string]any)
+	for name := range viper.GetStringMap(section) {
+		cfg := viper.GetStringMap(section + "." + name)
+		if enabled, set := cfg["enabled"].(bool); set && !enabled {
+			continue
+		}
+		out[name] = cfg
+	}
+	return out
+}
+
+// renderHost 为 Source 提供渲染能力，与 HTTP 请求共享并发限额
+type renderHost struct{}
+
+func (renderHost) Render(ctx context.Context, job extension.Job) (*extension.Result, error) {
+	release, _, err := acquireRenderSlot(ctx, job.Site, job.Priority)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if requestIDFrom(ctx) == "" {
+		ctx = withRequestID(ctx, newRequestID())
+	}
+	payload := PushPayload{Site: job.Site, Type: job.Type, Output: job.Output, Data: job.Data, Deliver: job.Deliver, Priority: job.Priority, IdempotencyKey: job.IdempotencyKey}
+	result, err := renderPayload(ctx, &payload)
+	if err != nil {
+		return nil, fmt.Errorf("render %s/%s: %w", job.Site, job.Type, err)
+	}
+	return &extension.Result{
+		Site:        job.Site,
+		Type:        job.Type,
+		Template:    result.Template,
+		ContentType: result.ContentType,
+		Body:        result.Body,
+		Receipts:    result.Receipts,
+	}, nil
+}
@@ -0,0 +1,75 @@
+//go:build !noadmin
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====== 失败记录接口 ======
+//
+//	GET /failures?site=bilibili&limit=50   最近的失败记录，新的在前
+//	GET /failures/:id                      单条记录，含页面控制台输出
+//	GET /failures/:id/payload              原始请求体，可直接 POST 到 /render 重现
+//	GET /failures/:id/html                 模板渲染出的 HTML
+
+// registerFailureRoutes 启用失败记录时注册查询接口，权限与管理接口相同
+func registerFailureRoutes(r *gin.Engine) {
+	if globalFailures == nil {
+		return
+	}
+	g := r.Group("/failures", adminGuard())
+	g.GET("", FailuresHandler)
+	g.GET("/:id", FailureHandler)
+	g.GET("/:id/payload", failureFileHandler(failurePayloadFile, "application/json"))
+	g.GET("/:id/html", failureFileHandler(failureHTMLFile, "text/plain; charset=utf-8"))
+}
+
+// FailuresHandler 列出最近的失败记录
+func FailuresHandler(c *gin.Context) {
+	limit := 50
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, errResp("limit must be a positive integer"))
+			return
+		}
+		limit = min(n, 500)
+	}
+	c.JSON(http.StatusOK, ok(gin.H{"failures": globalFailures.List(c.Query("site"), limit)}))
+}
+
+// FailureHandler 返回单条失败记录
+func FailureHandler(c *gin.Context) {
+	rec, err := globalFailures.Get(c.Param("id"))
+	if errors.Is(err, os.ErrNotExist) {
+		c.JSON(http.StatusNotFound, errResp("failure not found"))
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, errResp(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, ok(rec))
+}
+
+// failureFileHandler 返回记录中的文件；HTML 以纯文本返回，避免在接口域名下执行模板脚本
+func failureFileHandler(name, contentType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path, err := globalFailures.File(c.Param("id"), name)
+		if errors.Is(err, os.ErrNotExist) {
+			c.JSON(http.StatusNotFound, errResp("failure file not found"))
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, errResp(err.Error()))
+			return
+		}
+		c.Header("Content-Type", contentType)
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.File(path)
+	}
+}
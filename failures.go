@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 失败记录 ======
+//
+// failures.enabled 开启后，每次失败的渲染保存为 failures.dir 下的一个目录，用户反馈卡片异常时
+// 可以按请求 ID 找到当时的数据原样重放：
+//
+//	<dir>/20261016-101500_<请求 ID>/
+//	  failure.json   时间、站点、模板、状态码、错误与页面控制台输出
+//	  payload.json   进入管线前的请求体，可直接 POST 到 /render 重现
+//	  page.html      模板渲染出的 HTML（未到达 template 阶段时没有）
+//
+// 请求参数错误（400/401/403/404）不记录。超过 max_entries 条或 max_age 的记录在写入新记录时删除。
+// 失败记录包含请求数据，GET /failures 与管理接口权限相同，见 failureroutes.go。
+
+const (
+	failureRecordFile  = "failure.json"
+	failurePayloadFile = "payload.json"
+	failureHTMLFile    = "page.html"
+)
+
+// FailureRecord 一次失败的渲染
+type FailureRecord struct {
+	ID             string         `json:"id"`
+	Time           time.Time      `json:"time"`
+	RequestID      string         `json:"request_id,omitempty"`
+	Token          string         `json:"token,omitempty"`
+	Site           string         `json:"site"`
+	Type           string         `json:"type"`
+	Template       string         `json:"template,omitempty"`
+	Stage          string         `json:"stage,omitempty"` // 失败时所处的管线阶段
+	Status         int            `json:"status"`
+	Error          string         `json:"error"`
+	DurationMs     int64          `json:"duration_ms"`
+	HasHTML        bool           `json:"has_html"`
+	Console        []ConsoleEntry `json:"console,omitempty"`
+	ConsoleDropped int            `json:"console_dropped,omitempty"`
+}
+
+type failureStore struct {
+	dir        string
+	maxEntries int
+	maxAge     time.Duration
+	mu         sync.Mutex // 串行化写入与清理
+}
+
+var globalFailures *failureStore
+
+var failuresRecorded = NewCounterVec("snapcast_failures_recorded_total", "Failed renders saved to the failure directory, by result.", "result")
+
+// InitFailures 按 failures 配置启用失败记录（修改需重启）
+func InitFailures() {
+	if !viper.GetBool("failures.enabled") {
+		return
+	}
+	s := &failureStore{
+		dir:        viper.GetString("failures.dir"),
+		maxEntries: viper.GetInt("failures.max_entries"),
+	}
+	if s.dir == "" {
+		s.dir = "./data/failures"
+	}
+	if s.maxEntries <= 0 {
+		s.maxEntries = 500
+	}
+	if v := viper.Get("failures.max_age"); v != nil && v != "" {
+		d, err := ParseDuration(v)
+		if err != nil || d < 0 {
+			logger.Warn("❗ failures.max_age 值无效，不按时间删除", zap.Any("max_age", v))
+		} else {
+			s.maxAge = d
+		}
+	}
+	if err := os.MkdirAll(s.dir, 0750); err != nil {
+		logger.Fatal("❌ 失败记录目录创建失败", zap.String("dir", s.dir), zap.Error(err))
+	}
+	globalFailures = s
+	logger.Info("🧾 失败记录已启用", zap.String("dir", s.dir), zap.Int("max_entries", s.maxEntries), zap.Duration("max_age", s.maxAge))
+}
+
+// recordableFailure 请求参数错误不记录
+func recordableFailure(status int) bool {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return false
+	}
+	return true
+}
+
+// recordFailure 保存一次失败的渲染，raw 为进入管线前的 payload
+func recordFailure(ctx context.Context, raw json.RawMessage, payload *PushPayload, rc *RenderContext, stage RenderStage, duration time.Duration, err error) {
+	s := globalFailures
+	if s == nil || payload.warmup || !recordableFailure(renderErrorStatus(err)) {
+		return
+	}
+	now := time.Now()
+	requestID := requestIDFrom(ctx)
+	idPart := strings.ReplaceAll(requestID, ":", "-")
+	if idPart == "" {
+		idPart = newRequestID()
+	}
+	rec := FailureRecord{
+		ID:         now.Format("20060102-150405") + "_" + idPart,
+		Time:       now,
+		RequestID:  requestID,
+		Site:       payload.Site,
+		Type:       payload.Type,
+		Template:   rc.Template,
+		Stage:      string(stage),
+		Status:     renderErrorStatus(err),
+		Error:      err.Error(),
+		DurationMs: duration.Milliseconds(),
+		HasHTML:    len(rc.HTML) > 0,
+	}
+	if p := principalFrom(ctx); p != nil {
+		rec.Token = p.name
+	}
+	rec.Console, rec.ConsoleDropped = trackerFrom(ctx).Console()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.write(rec, raw, rc.HTML); err != nil {
+		failuresRecorded.Inc("failed")
+		logger.Warn("⚠️ 失败记录写入失败", zap.String("id", rec.ID), zap.Error(err))
+		return
+	}
+	failuresRecorded.Inc("written")
+	loggerFor(ctx).Debug("🧾 已保存失败记录", zap.String("id", rec.ID))
+	s.prune()
+}
+
+func (s *failureStore) write(rec FailureRecord, raw json.RawMessage, html []byte) error {
+	dir := filepath.Join(s.dir, rec.ID)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, failureRecordFile), b, 0640); err != nil {
+		return err
+	}
+	if len(raw) > 0 {
+		if err := os.WriteFile(filepath.Join(dir, failurePayloadFile), raw, 0640); err != nil {
+			return err
+		}
+	}
+	if len(html) > 0 {
+		if err := os.WriteFile(filepath.Join(dir, failureHTMLFile), html, 0640); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ids 返回全部记录 ID，新的在前（ID 以时间开头）
+func (s *failureStore) ids() []string {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil
+	}
+	ids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			ids = append(ids, e.Name())
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+	return ids
+}
+
+// prune 删除超出条数或保存时长的记录
+func (s *failureStore) prune() {
+	removed := 0
+	for i, id := range s.ids() {
+		expired := false
+		if s.maxAge > 0 {
+			t, err := time.ParseInLocation("20060102-150405", strings.SplitN(id, "_", 2)[0], time.Local)
+			expired = err == nil && time.Since(t) > s.maxAge
+		}
+		if i >= s.maxEntries || expired {
+			if os.RemoveAll(filepath.Join(s.dir, id)) == nil {
+				removed++
+			}
+		}
+	}
+	if removed > 0 {
+		logger.Debug("🗑️ 已删除旧的失败记录", zap.Int("removed", removed))
+	}
+}
+
+// Get 读取一条记录，ID 不合法或不存在时返回 os.ErrNotExist
+func (s *failureStore) Get(id string) (*FailureRecord, error) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return nil, os.ErrNotExist
+	}
+	b, err := os.ReadFile(filepath.Join(s.dir, id, failureRecordFile))
+	if err != nil {
+		return nil, err
+	}
+	var rec FailureRecord
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// File 返回记录中 payload.json 或 page.html 的路径
+func (s *failureStore) File(id, name string) (string, error) {
+	if _, err := s.Get(id); err != nil {
+		return "", err
+	}
+	path := filepath.Join(s.dir, id, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// List 返回最近的记录，不含控制台输出；site 非空时只返回该站点的记录
+func (s *failureStore) List(site string, limit int) []FailureRecord {
+	list := make([]FailureRecord, 0)
+	for _, id := range s.ids() {
+		if len(list) >= limit {
+			break
+		}
+		rec, err := s.Get(id)
+		if err != nil {
+			continue
+		}
+		if site != "" && rec.Site != site {
+			continue
+		}
+		rec.Console, rec.ConsoleDropped = nil, 0
+		list = append(list, *rec)
+	}
+	return list
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"maps"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 按站点公平调度 ======
+//
+// 所有站点共享 render.max_concurrency 个渲染许可，某个站点突发大量请求（如 B 站批量推送动态）时
+// 会占满许可，其他站点的卡片只能排在后面。render.fairness 配置后：
+//   - 单个站点同时进行的渲染数不超过上限：render.fairness.sites 中单独设置的值，或 max_share × 最大并发数
+//   - 排队的请求在 priority 相同时，优先分配给当前渲染数最少的站点，而不是先到先得
+// 达到上限的站点即使有空闲许可也需要排队，等待本站点的渲染结束。支持热重载。
+
+type fairnessPolicy struct {
+	maxShare float64
+	sites    map[string]int
+}
+
+// 以下变量由 concurrentMutex 保护
+var (
+	fairSettings *fairnessPolicy        // 未配置时为 nil，保持按 priority 先到先得
+	siteActive   = make(map[string]int) // 站点 → 进行中的渲染数
+)
+
+var siteLimited = NewCounterVec("snapcast_render_site_limited_total", "Renders that waited because their site reached its concurrency cap.", "site")
+
+// ConfigureRenderFairness 读取 render.fairness，由 ApplyDynamicConfig 调用；上限放宽时立即唤醒排队的请求
+func ConfigureRenderFairness() {
+	var p *fairnessPolicy
+	share := viper.GetFloat64("render.fairness.max_share")
+	if share < 0 || share > 1 {
+		logger.Warn("❗ render.fairness.max_share 应在 0-1 之间，已忽略", zap.Float64("max_share", share))
+		share = 0
+	}
+	sites := make(map[string]int)
+	for site, v := range viper.GetStringMap("render.fairness.sites") {
+		n := viper.GetInt("render.fairness.sites." + site)
+		if n <= 0 {
+			logger.Warn("❗ render.fairness.sites 并发上限必须为正整数，已忽略", zap.String("site", site), zap.Any("limit", v))
+			continue
+		}
+		sites[site] = n
+	}
+	if share > 0 || len(sites) > 0 {
+		p = &fairnessPolicy{maxShare: share, sites: sites}
+	}
+
+	concurrentMutex.Lock()
+	defer concurrentMutex.Unlock()
+	fairSettings = p
+	grantWaitersLocked()
+}
+
+// siteLimitLocked 返回站点的并发上限，0 为不限
+func siteLimitLocked(site string) int {
+	p := fairSettings
+	if p == nil {
+		return 0
+	}
+	if n, ok := p.sites[site]; ok {
+		return n
+	}
+	if p.maxShare > 0 {
+		return max(int(float64(maxConcurrent)*p.maxShare), 1)
+	}
+	return 0
+}
+
+// siteAllowedLocked 站点是否还能开始新的渲染
+func siteAllowedLocked(site string) bool {
+	limit := siteLimitLocked(site)
+	return limit == 0 || siteActive[site] < limit
+}
+
+// nextWaiterLocked 返回下一个获得许可的排队请求，全部受站点上限限制时为 nil
+func nextWaiterLocked() *slotWaiter {
+	if fairSettings == nil {
+		return renderQueue[0]
+	}
+	var best *slotWaiter
+	for _, w := range renderQueue {
+		if !siteAllowedLocked(w.site) {
+			continue
+		}
+		if best == nil || w.priority > best.priority ||
+			(w.priority == best.priority && (siteActive[w.site] < siteActive[best.site] ||
+				(siteActive[w.site] == siteActive[best.site] && w.seq < best.seq))) {
+			best = w
+		}
+	}
+	return best
+}
+
+// siteActiveSnapshot 返回各站点进行中的渲染数
+func siteActiveSnapshot() map[string]int {
+	concurrentMutex.Lock()
+	defer concurrentMutex.Unlock()
+	return maps.Clone(siteActive)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/chromedp/chromedp"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 内置字体 ======
+//
+// 精简的 Linux 容器通常没有中文与 emoji 字体，渲染结果出现方框。render.fonts_dir 中的字体：
+//   - Linux 本地浏览器：生成 fontconfig 配置并通过 FONTCONFIG_FILE 传给 Chrome，作为系统字体参与回退；
+//   - 所有平台：以文件名为 font-family 生成 @font-face 注入页面，模板可直接引用。
+// 字体在启动时扫描，增删字体需重启。
+
+var fontExtensions = map[string]string{
+	".ttf":   "truetype",
+	".otf":   "opentype",
+	".ttc":   "truetype",
+	".woff":  "woff",
+	".woff2": "woff2",
+}
+
+var (
+	fontFaceCSS  string
+	headTagRegex = regexp.MustCompile(`(?i)<head(\s[^>]*)?>`)
+)
+
+// InitFonts 扫描 render.fonts_dir 并生成 @font-face 样式，返回需追加的浏览器启动参数
+func InitFonts() []chromedp.ExecAllocatorOption {
+	dir := viper.GetString("render.fonts_dir")
+	if dir == "" {
+		return nil
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		logger.Warn("⚠️ 字体目录无效", zap.String("dir", dir), zap.Error(err))
+		return nil
+	}
+	families, err := scanFonts(abs)
+	if err != nil {
+		logger.Warn("⚠️ 字体目录读取失败", zap.String("dir", abs), zap.Error(err))
+		return nil
+	}
+	if len(families) == 0 {
+		logger.Warn("❕ 字体目录中没有字体文件", zap.String("dir", abs))
+		return nil
+	}
+	if viper.GetString("render.remote_debugging_url") != "" {
+		logger.Warn("⚠️ 远程浏览器无法访问本地字体目录，render.fonts_dir 需挂载到浏览器所在主机的相同路径")
+	}
+	fontFaceCSS = buildFontFaceCSS(families)
+	UseRenderMiddleware(StageCapture, "font-face", fontFaceMiddleware)
+	logger.Info("🔤 已加载内置字体", zap.String("dir", abs), zap.Int("fonts", len(families)))
+
+	if runtime.GOOS != "linux" {
+		return nil
+	}
+	confPath, err := writeFontconfig(abs)
+	if err != nil {
+		logger.Warn("⚠️ fontconfig 配置生成失败，仅通过 @font-face 使用内置字体", zap.Error(err))
+		return nil
+	}
+	return []chromedp.ExecAllocatorOption{chromedp.Env("FONTCONFIG_FILE=" + confPath)}
+}
+
+// scanFonts 递归查找字体文件，返回 font-family → 文件路径
+func scanFonts(dir string) (map[string]string, error) {
+	families := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if _, ok := fontExtensions[ext]; !ok {
+			return nil
+		}
+		family := strings.TrimSuffix(d.Name(), filepath.Ext(d.Name()))
+		if prev, exists := families[family]; exists {
+			logger.Warn("❕ 字体名重复，忽略", zap.String("family", family), zap.String("path", path), zap.String("used", prev))
+			return nil
+		}
+		families[family] = path
+		return nil
+	})
+	return families, err
+}
+
+func buildFontFaceCSS(families map[string]string) string {
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("<style>\n")
+	for _, name := range names {
+		path := families[name]
+		u := url.URL{Scheme: "file", Path: filepath.ToSlash(path)}
+		if runtime.GOOS == "windows" {
+			u.Path = "/" + u.Path
+		}
+		fmt.Fprintf(&b, "@font-face { font-family: %q; src: url(%q) format(%q); font-display: block; }\n",
+			name, u.String(), fontExtensions[strings.ToLower(filepath.Ext(path))])
+	}
+	b.WriteString("</style>\n")
+	return b.String()
+}
+
+// writeFontconfig 生成包含系统配置与字体目录的 fontconfig 配置文件
+func writeFontconfig(dir string) (string, error) {
+	cacheDir := filepath.Join(os.TempDir(), "snapcast-fontconfig-cache")
+	conf := fmt.Sprintf(`<?xml version="1.0"?>
+<!DOCTYPE fontconfig SYSTEM "fonts.dtd">
+<fontconfig>
+  <include ignore_missing="yes">/etc/fonts/fonts.conf</include>
+  <dir>%s</dir>
+  <cachedir>%s</cachedir>
+</fontconfig>
+`, xmlEscape(dir), xmlEscape(cacheDir))
+	path := filepath.Join(os.TempDir(), "snapcast-fonts.conf")
+	return path, os.WriteFile(path, []byte(conf), 0644)
+}
+
+func xmlEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// fontFaceMiddleware 在 <head> 开头注入 @font-face，无 <head> 时放在文档开头
+func fontFaceMiddleware(rc *RenderContext) error {
+	if rc.Payload.Output != "html" && fontFaceCSS != "" {
+		if loc := headTagRegex.FindIndex(rc.HTML); loc != nil {
+			var b bytes.Buffer
+			b.Grow(len(rc.HTML) + len(fontFaceCSS))
+			b.Write(rc.HTML[:loc[1]])
+			b.WriteString(fontFaceCSS)
+			b.Write(rc.HTML[loc[1]:])
+			rc.HTML = b.Bytes()
+		} else {
+			rc.HTML = append([]byte(fontFaceCSS), rc.HTML...)
+		}
+	}
+	return rc.Next()
+}
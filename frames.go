@@ -0,0 +1,138 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/chromedp"
+)
+
+// ====== 多帧输出 ======
+//
+// options.frames 为 true 时，模板中每个带 data-frame 属性的元素截成一张图片，
+// 按文档顺序编号打包为 zip（001.png、002.png…）返回。投递时 Delivery.Frames
+// 携带逐帧图片，支持多图消息的 Sink 可以作为相册发送，其余 Sink 收到 zip。
+
+const zipContentType = "application/zip"
+
+// errNoFrames 模板中没有 data-frame 元素
+var errNoFrames = errors.New("options.frames requires elements with a data-frame attribute in the template")
+
+// frameRectsJS 返回所有 [data-frame] 元素相对文档的位置与文档大小
+const frameRectsJS = `(function() {
+	const sy = window.scrollY || document.documentElement.scrollTop;
+	const sx = window.scrollX || document.documentElement.scrollLeft;
+	const rects = Array.from(document.querySelectorAll('[data-frame]')).map(el => {
+		const r = el.getBoundingClientRect();
+		return { x: r.left + sx, y: r.top + sy, w: r.width, h: r.height };
+	});
+	const doc = document.documentElement;
+	return JSON.stringify({ rects, width: doc.scrollWidth, height: doc.scrollHeight });
+})()`
+
+// frameRect 文档坐标中的一块区域（CSS 像素），也用作 body 的截图区域
+type frameRect struct {
+	X, Y, W, H float64
+}
+
+// RenderFrames 截图并按 data-frame 元素切分为多张 PNG
+func RenderFrames(ctx context.Context, html string, opts RenderOptions) ([][]byte, error) {
+	tracker := trackerFrom(ctx)
+	ctx, cancel := tracker.Tab(opts.TimeoutMs)
+	defer cancel()
+
+	load, release, err := tracker.LoadHTML(html, opts.BaseURL, "frames")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var js string
+	runOpts := append(pageSetupActions(opts),
+		load,
+		emulation.SetDefaultBackgroundColorOverride().WithColor(&cdp.RGBA{R: 0, G: 0, B: 0, A: 0}),
+		chromedp.WaitVisible("body", chromedp.ByQuery),
+		chromedp.EvaluateAsDevTools(frameRectsJS, &js),
+	)
+	if err := chromedp.Run(ctx, runOpts...); err != nil {
+		return nil, fmt.Errorf("failed to evaluate JS: %w", err)
+	}
+
+	var layout struct {
+		Rects  []frameRect `json:"rects"`
+		Width  float64     `json:"width"`
+		Height float64     `json:"height"`
+	}
+	if err := json.Unmarshal([]byte(js), &layout); err != nil {
+		return nil, err
+	}
+	if len(layout.Rects) == 0 {
+		return nil, errNoFrames
+	}
+
+	// 每一帧由 Chrome 按元素区域裁剪，见 screenshot.go
+	frames := make([][]byte, 0, len(layout.Rects))
+	for i, r := range layout.Rects {
+		clip, ok := clampRect(r, layout.Width, layout.Height)
+		if !ok {
+			return nil, fmt.Errorf("frame %d is empty or outside the page", i+1)
+		}
+		frame, err := clipScreenshot(ctx, clip, opts.Quality)
+		if err != nil {
+			return nil, fmt.Errorf("failed to take screenshot of frame %d: %w", i+1, err)
+		}
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// zipFrames 将各帧按顺序打包为 001.png、002.png…
+func zipFrames(frames [][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	now := time.Now()
+	for i, frame := range frames {
+		// PNG 已压缩，直接存储
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: fmt.Sprintf("%03d.png", i+1), Method: zip.Store, Modified: now})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(frame); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// unzipFrames 从 zipFrames 的结果中还原各帧，用于缓存命中时投递
+func unzipFrames(body []byte) ([][]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, err
+	}
+	frames := make([][]byte, 0, len(zr.File))
+	for _, f := range zr.File {
+		rd, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		b, err := io.ReadAll(rd)
+		rd.Close()
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, b)
+	}
+	return frames, nil
+}
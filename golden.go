@@ -0,0 +1,469 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	htmltemplate "html/template"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ====== 基准图回归测试 ======
+//
+//	snapcast test [--update] [site/type ...]
+//
+// 用每个模板的示例数据渲染 PNG，与 <golden>/<site>/<type>[.<theme>].png 比较，命名场景的
+// 示例数据（见 scenarios.go）分别与 <type>[.<theme>]@<场景>.png 比较。
+// 差异像素占比超过 --threshold 时失败，并在 --diff 目录写出实际结果与差异图（差异像素标红）及 HTML 报告。
+// --update 用当前渲染结果覆盖基准图。模板的 .meta.yaml 可单独设置阈值与忽略区域：
+//
+//	golden:
+//	  threshold: 0.01          # 覆盖 --threshold
+//	  pixel_threshold: 0.2     # 覆盖 --pixel-threshold
+//	  ignore:                  # 不参与比较的区域（截图像素），如时间戳
+//	    - {x: 20, y: 300, width: 200, height: 40}
+
+// goldenCase 一个待测试的模板
+type goldenCase struct {
+	key      string // site/type[.theme]，命名场景为 site/type[.theme]@scenario
+	site     string
+	typ      string
+	theme    string
+	tmpl     string
+	scenario string // 示例数据场景，空为默认
+}
+
+// goldenCases 返回与 filters 匹配的模板，按 key 排序；filters 为空时返回全部
+func goldenCases(filters []string) []goldenCase {
+	templateMutex.RLock()
+	defer templateMutex.RUnlock()
+	var cases []goldenCase
+	for key, tmpl := range templateMap {
+		site, rest, _ := strings.Cut(key, "/")
+		typ, theme, _ := strings.Cut(rest, ".")
+		if len(filters) > 0 && !matchAny(filters, key) {
+			continue
+		}
+		cases = append(cases, goldenCase{key: key, site: site, typ: typ, theme: theme, tmpl: tmpl})
+	}
+	sort.Slice(cases, func(i, j int) bool { return cases[i].key < cases[j].key })
+	return cases
+}
+
+// goldenScenarioCases 将匹配的模板按示例数据场景展开，filters 可匹配模板或 key@scenario
+func goldenScenarioCases(filters []string) []goldenCase {
+	var cases []goldenCase
+	for _, tc := range goldenCases(nil) {
+		scenarios := sampleScenarios(tc.tmpl)
+		if len(scenarios) == 0 {
+			scenarios = []string{defaultScenario} // 无示例数据，按默认场景跳过
+		}
+		for _, s := range scenarios {
+			c := tc
+			if s != defaultScenario {
+				c.key, c.scenario = tc.key+"@"+s, s
+			}
+			if len(filters) == 0 || matchAny(filters, tc.key) || matchAny(filters, c.key) {
+				cases = append(cases, c)
+			}
+		}
+	}
+	return cases
+}
+
+func matchAny(patterns []string, key string) bool {
+	for _, p := range patterns {
+		if matched, _ := path.Match(p, key); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// goldenFile 基准图路径：site/type.theme → <dir>/site/type.theme.png
+func goldenFile(dir, key string) string {
+	return filepath.Join(dir, filepath.FromSlash(key)+".png")
+}
+
+// goldenOptions 比较参数，模板的 .meta.yaml 中 golden 段可单独覆盖阈值
+type goldenOptions struct {
+	goldenDir      string
+	diffDir        string
+	update         bool
+	threshold      float64
+	pixelThreshold float64
+	timeout        time.Duration
+}
+
+// goldenResult 单个模板的测试结果
+type goldenResult struct {
+	Key       string
+	Status    string // passed、failed、skipped、updated
+	Message   string
+	Ratio     float64
+	Threshold float64
+	Golden    string // 以下为图片路径，不存在时为空
+	Actual    string
+	Diff      string
+}
+
+// cmdTest 渲染所有模板并与基准图比较，存在差异时返回 1
+func cmdTest(args []string) int {
+	fset := flag.NewFlagSet("test", flag.ContinueOnError)
+	var opts goldenOptions
+	fset.StringVar(&opts.goldenDir, "golden", "golden", "基准图目录")
+	fset.StringVar(&opts.diffDir, "diff", "golden-diff", "差异图输出目录")
+	fset.BoolVar(&opts.update, "update", false, "用当前渲染结果更新基准图")
+	fset.Float64Var(&opts.threshold, "threshold", 0.001, "允许的差异像素占比（0-1），模板可在 .meta.yaml 中覆盖")
+	fset.Float64Var(&opts.pixelThreshold, "pixel-threshold", 0.1, "单个像素的颜色差异阈值（0-1），越小越严格，模板可在 .meta.yaml 中覆盖")
+	fset.DurationVar(&opts.timeout, "timeout", time.Minute, "单个模板的渲染超时")
+	report := fset.String("report", "", "HTML 报告路径，默认 <diff>/report.html，\"-\" 不生成")
+	configFile := fset.String("config", setupConfigFile, "配置文件，不存在时使用内置默认配置")
+	templateDir := fset.String("templates", "", "模板目录，默认使用配置中的 template.dir")
+	verbose := fset.Bool("v", false, "输出详细日志")
+	fset.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: snapcast test [--update] [选项] [site/type[@场景] 或通配符 ...]")
+		fset.PrintDefaults()
+	}
+	if err := fset.Parse(args); err != nil {
+		return 2
+	}
+	if !validRatio(opts.threshold) || !validRatio(opts.pixelThreshold) {
+		fmt.Fprintln(os.Stderr, "❌ --threshold 与 --pixel-threshold 应在 0-1 之间")
+		return 2
+	}
+	if *report == "" {
+		*report = filepath.Join(opts.diffDir, "report.html")
+	}
+
+	if err := initOneShotRender(*configFile, *templateDir, *verbose); err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+	defer globalAllocCancel()
+
+	cases := goldenScenarioCases(fset.Args())
+	if len(cases) == 0 {
+		fmt.Fprintln(os.Stderr, "❌ 没有匹配的模板")
+		return 1
+	}
+	counts := make(map[string]int)
+	results := make([]goldenResult, 0, len(cases))
+	for _, tc := range cases {
+		res := runGoldenCase(tc, opts)
+		counts[res.Status]++
+		results = append(results, res)
+		switch res.Status {
+		case "passed":
+			fmt.Printf("✅ %s\n", res.Key)
+		case "skipped":
+			fmt.Printf("⏭️  %s: %s\n", res.Key, res.Message)
+		case "updated":
+			fmt.Printf("📝 %s: %s\n", res.Key, res.Message)
+		default:
+			fmt.Printf("❌ %s: %s\n", res.Key, res.Message)
+		}
+	}
+
+	if opts.update {
+		fmt.Printf("\n已更新 %d 个基准图，跳过 %d 个，失败 %d 个\n", counts["updated"], counts["skipped"], counts["failed"])
+	} else {
+		fmt.Printf("\n通过 %d 个，失败 %d 个，跳过 %d 个\n", counts["passed"], counts["failed"], counts["skipped"])
+		if *report != "-" {
+			if err := writeGoldenReport(*report, results); err != nil {
+				fmt.Fprintln(os.Stderr, "❌ 报告写入失败:", err)
+			} else {
+				fmt.Println("报告:", *report)
+			}
+		}
+	}
+	if counts["failed"] > 0 {
+		return 1
+	}
+	return 0
+}
+
+func validRatio(v float64) bool {
+	return v >= 0 && v <= 1
+}
+
+// runGoldenCase 渲染一个模板并与基准图比较
+func runGoldenCase(tc goldenCase, opts goldenOptions) goldenResult {
+	res := goldenResult{Key: tc.key, Status: "failed", Threshold: opts.threshold}
+	meta, err := loadTemplateMeta(tc.tmpl)
+	if err != nil {
+		res.Message = err.Error()
+		return res
+	}
+	pixelThreshold := opts.pixelThreshold
+	if meta.Golden.Threshold != nil {
+		res.Threshold = *meta.Golden.Threshold
+	}
+	if meta.Golden.PixelThreshold != nil {
+		pixelThreshold = *meta.Golden.PixelThreshold
+	}
+
+	data, err := loadSampleScenario(tc.tmpl, tc.scenario)
+	if errors.Is(err, os.ErrNotExist) {
+		res.Status, res.Message = "skipped", "无示例数据，跳过"
+		return res
+	}
+	if err != nil {
+		res.Message = err.Error()
+		return res
+	}
+
+	payload := PushPayload{Site: tc.site, Type: tc.typ, Theme: tc.theme, Output: "image", Data: data}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	result, err := renderPayload(ctx, &payload)
+	cancel()
+	if err != nil {
+		res.Message = fmt.Sprintf("渲染失败: %v", err)
+		return res
+	}
+	if result.ContentType != "image/png" {
+		res.Status, res.Message = "skipped", fmt.Sprintf("输出为 %s，仅比较 PNG，跳过", result.ContentType)
+		return res
+	}
+
+	golden := goldenFile(opts.goldenDir, tc.key)
+	if opts.update {
+		if err := writeFileAll(golden, result.Body); err != nil {
+			res.Message = fmt.Sprintf("写入基准图失败: %v", err)
+			return res
+		}
+		res.Status, res.Message = "updated", "已更新 "+golden
+		return res
+	}
+
+	actual := goldenFile(opts.diffDir, tc.key+".actual")
+	expected, err := os.ReadFile(golden)
+	if errors.Is(err, os.ErrNotExist) {
+		res.Message = fmt.Sprintf("缺少基准图 %s，使用 --update 生成", golden)
+		if writeFileAll(actual, result.Body) == nil {
+			res.Actual = actual
+		}
+		return res
+	}
+	if err != nil {
+		res.Message = err.Error()
+		return res
+	}
+	res.Golden = golden
+	cmp, err := compareImages(expected, result.Body, pixelThreshold, meta.Golden.ignoreRects())
+	if err != nil {
+		res.Message = err.Error()
+		if writeFileAll(actual, result.Body) == nil {
+			res.Actual = actual
+		}
+		return res
+	}
+	res.Ratio = cmp.Ratio()
+	if res.Ratio <= res.Threshold {
+		res.Status = "passed"
+		return res
+	}
+
+	diffPath := goldenFile(opts.diffDir, tc.key+".diff")
+	if writeFileAll(actual, result.Body) == nil {
+		res.Actual = actual
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, cmp.Diff); err == nil && writeFileAll(diffPath, buf.Bytes()) == nil {
+		res.Diff = diffPath
+	}
+	res.Message = fmt.Sprintf("%.3f%% 像素不同（%d/%d），差异图 %s", res.Ratio*100, cmp.Different, cmp.Total, diffPath)
+	return res
+}
+
+func writeFileAll(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(name, data, 0644)
+}
+
+// imageComparison 图片比较结果
+type imageComparison struct {
+	Different int         // 差异像素数
+	Total     int         // 参与比较的像素数，不含忽略区域
+	Diff      *image.RGBA // 差异图：相同像素淡化为灰度，差异像素标红，忽略区域标蓝
+}
+
+func (c imageComparison) Ratio() float64 {
+	if c.Total == 0 {
+		return 0
+	}
+	return float64(c.Different) / float64(c.Total)
+}
+
+// maxYIQDelta YIQ 空间中两个颜色的最大差异，见 pixelmatch
+const maxYIQDelta = 35215.0
+
+// compareImages 逐像素比较两张 PNG，颜色差异按 YIQ 感知亮度计算，ignore 中的区域不参与比较；尺寸不同时返回错误
+func compareImages(expected, actual []byte, pixelThreshold float64, ignore []image.Rectangle) (imageComparison, error) {
+	a, err := png.Decode(bytes.NewReader(expected))
+	if err != nil {
+		return imageComparison{}, fmt.Errorf("基准图解码失败: %w", err)
+	}
+	b, err := png.Decode(bytes.NewReader(actual))
+	if err != nil {
+		return imageComparison{}, fmt.Errorf("渲染结果解码失败: %w", err)
+	}
+	if a.Bounds().Size() != b.Bounds().Size() {
+		return imageComparison{}, fmt.Errorf("尺寸不同: 基准图 %v，渲染结果 %v", a.Bounds().Size(), b.Bounds().Size())
+	}
+
+	maxDelta := maxYIQDelta * pixelThreshold * pixelThreshold
+	size := a.Bounds().Size()
+	diff := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+	cmp := imageComparison{Diff: diff}
+	ao, bo := a.Bounds().Min, b.Bounds().Min
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			if ignored(ignore, x, y) {
+				diff.SetRGBA(x, y, color.RGBA{R: 200, G: 220, B: 255, A: 255})
+				continue
+			}
+			cmp.Total++
+			ca, cb := a.At(ao.X+x, ao.Y+y), b.At(bo.X+x, bo.Y+y)
+			if colorDelta(ca, cb) > maxDelta {
+				cmp.Different++
+				diff.SetRGBA(x, y, color.RGBA{R: 255, A: 255})
+				continue
+			}
+			// 相同像素：灰度后向白色淡化，突出差异
+			l := uint8(255 - (255-yiqY(blendWhite(ca)))*0.1)
+			diff.SetRGBA(x, y, color.RGBA{R: l, G: l, B: l, A: 255})
+		}
+	}
+	return cmp, nil
+}
+
+func ignored(rects []image.Rectangle, x, y int) bool {
+	p := image.Pt(x, y)
+	for _, r := range rects {
+		if p.In(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// blendWhite 将半透明颜色混合到白色背景，返回 0-255 的 RGB
+func blendWhite(c color.Color) [3]float64 {
+	r, g, b, a := c.RGBA()
+	alpha := float64(a) / 0xffff
+	blend := func(v uint32) float64 {
+		return float64(v)/0xffff*255 + 255*(1-alpha) // RGBA() 返回预乘 alpha 的值
+	}
+	return [3]float64{blend(r), blend(g), blend(b)}
+}
+
+func yiqY(c [3]float64) float64 {
+	return c[0]*0.29889531 + c[1]*0.58662247 + c[2]*0.11448223
+}
+
+// colorDelta 两个颜色在 YIQ 空间中的加权平方差
+func colorDelta(a, b color.Color) float64 {
+	ca, cb := blendWhite(a), blendWhite(b)
+	y := yiqY(ca) - yiqY(cb)
+	i := (ca[0]*0.59597799 - ca[1]*0.2741761 - ca[2]*0.32180189) - (cb[0]*0.59597799 - cb[1]*0.2741761 - cb[2]*0.32180189)
+	q := (ca[0]*0.21147017 - ca[1]*0.52261711 + ca[2]*0.31114694) - (cb[0]*0.21147017 - cb[1]*0.52261711 + cb[2]*0.31114694)
+	return 0.5053*y*y + 0.299*i*i + 0.1957*q*q
+}
+
+// goldenReportTemplate 差异报告，图片以相对报告文件的路径引用
+var goldenReportTemplate = htmltemplate.Must(htmltemplate.New("report").Funcs(htmltemplate.FuncMap{
+	"percent": func(v float64) string { return fmt.Sprintf("%.3f%%", v*100) },
+}).Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>SnapCast 基准图测试报告</title>
+<style>
+body { font-family: sans-serif; margin: 24px; color: #222; }
+section { border-top: 1px solid #ddd; padding: 16px 0; }
+h2 { font-size: 16px; margin: 0 0 8px; }
+.failed h2 { color: #c00; }
+.passed h2 { color: #080; }
+.skipped h2 { color: #888; }
+.images { display: flex; gap: 16px; align-items: flex-start; }
+figure { margin: 0; }
+figure img { max-width: 400px; border: 1px solid #ccc; }
+figcaption { font-size: 12px; color: #666; }
+</style>
+</head>
+<body>
+<h1>基准图测试报告</h1>
+<p>{{.Time}}：通过 {{.Passed}} 个，失败 {{.Failed}} 个，跳过 {{.Skipped}} 个</p>
+{{range .Results}}
+<section class="{{.Status}}">
+<h2>{{.Key}}</h2>
+{{if .Message}}<p>{{.Message}}</p>{{end}}
+{{if or .Golden .Actual}}<p>差异 {{percent .Ratio}}，阈值 {{percent .Threshold}}</p>{{end}}
+<div class="images">
+{{if .Golden}}<figure><img src="{{.Golden}}"><figcaption>基准图</figcaption></figure>{{end}}
+{{if .Actual}}<figure><img src="{{.Actual}}"><figcaption>实际结果</figcaption></figure>{{end}}
+{{if .Diff}}<figure><img src="{{.Diff}}"><figcaption>差异</figcaption></figure>{{end}}
+</div>
+</section>
+{{end}}
+</body>
+</html>
+`))
+
+// writeGoldenReport 写出 HTML 报告，失败的模板排在前面
+func writeGoldenReport(name string, results []goldenResult) error {
+	dir := filepath.Dir(name)
+	rel := func(p string) string {
+		if p == "" {
+			return ""
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return ""
+		}
+		absDir, _ := filepath.Abs(dir)
+		r, err := filepath.Rel(absDir, abs)
+		if err != nil {
+			return ""
+		}
+		return filepath.ToSlash(r)
+	}
+	view := struct {
+		Time                    string
+		Passed, Failed, Skipped int
+		Results                 []goldenResult
+	}{Time: time.Now().Format("2006-01-02 15:04:05")}
+	for _, r := range results {
+		switch r.Status {
+		case "passed":
+			view.Passed++
+		case "failed":
+			view.Failed++
+		case "skipped":
+			view.Skipped++
+		}
+		r.Golden, r.Actual, r.Diff = rel(r.Golden), rel(r.Actual), rel(r.Diff)
+		view.Results = append(view.Results, r)
+	}
+	sort.SliceStable(view.Results, func(i, j int) bool {
+		return view.Results[i].Status == "failed" && view.Results[j].Status != "failed"
+	})
+	var buf bytes.Buffer
+	if err := goldenReportTemplate.Execute(&buf, view); err != nil {
+		return err
+	}
+	return writeFileAll(name, buf.Bytes())
+}
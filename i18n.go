@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// ====== 模板多语言 ======
+//
+// 模板目录下 i18n/<语言>.yaml 为语言包，如 i18n/zh-CN.yaml、i18n/en.yaml，嵌套的键以 . 连接：
+//
+//	live:
+//	  status: 直播中
+//	  viewers: "%d 人在看"
+//
+// 模板中 {{t "live.status"}} 按请求的语言（options.lang 或 lang）取文案，附加参数时按 fmt 格式化，
+// 如 {{t "live.viewers" .online}}。查找顺序：完整语言（zh-CN）→ 主语言（zh）→ template.i18n.default
+// → 键本身。语言包随模板一起热重载。
+
+// localeBundles 语言（小写）→ 键 → 文案
+var localeBundles atomic.Pointer[map[string]map[string]string]
+
+// localeVersion 语言包文件的修改时间与大小，参与渲染缓存的键
+var localeVersion atomic.Value
+
+// defaultLocale 找不到请求语言的文案时使用的语言，小写
+var defaultLocale atomic.Value
+
+// ConfigureI18n 读取 template.i18n.default，由 ApplyDynamicConfig 调用
+func ConfigureI18n() {
+	lang := "zh-CN"
+	if viper.IsSet("template.i18n.default") {
+		lang = viper.GetString("template.i18n.default")
+	}
+	if lang != "" && !langTagRegex.MatchString(lang) {
+		logger.Warn("❗ template.i18n.default 不是有效的语言标签，使用 zh-CN", zap.String("default", lang))
+		lang = "zh-CN"
+	}
+	defaultLocale.Store(strings.ToLower(lang))
+}
+
+// loadLocaleBundles 加载 <dir>/i18n 下的语言包，目录不存在时清空
+func loadLocaleBundles(dir string) error {
+	bundles := make(map[string]map[string]string)
+	var version strings.Builder
+	defer func() {
+		localeBundles.Store(&bundles)
+		localeVersion.Store(version.String())
+	}()
+
+	i18nDir := filepath.Join(dir, "i18n")
+	entries, err := os.ReadDir(i18nDir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		lang := strings.TrimSuffix(e.Name(), ext)
+		if !langTagRegex.MatchString(lang) {
+			logger.Warn("⚠️ 语言包文件名不是有效的语言标签，已跳过", zap.String("file", e.Name()))
+			continue
+		}
+		path := filepath.Join(i18nDir, e.Name())
+		if info, err := e.Info(); err == nil {
+			fmt.Fprintf(&version, "%s:%d:%d;", e.Name(), info.ModTime().UnixNano(), info.Size())
+		}
+		messages, err := readLocaleBundle(path)
+		if err != nil {
+			logger.Warn("⚠️ 语言包加载失败", zap.String("file", path), zap.Error(err))
+			continue
+		}
+		bundles[strings.ToLower(lang)] = messages
+		logger.Info("🌐 已加载语言包", zap.String("lang", lang), zap.Int("keys", len(messages)))
+	}
+	return nil
+}
+
+// readLocaleBundle 读取语言包并展开嵌套的键
+func readLocaleBundle(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	messages := make(map[string]string)
+	flattenLocale("", raw, messages)
+	return messages, nil
+}
+
+func flattenLocale(prefix string, node map[string]any, out map[string]string) {
+	for k, v := range node {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch v := v.(type) {
+		case map[string]any:
+			flattenLocale(key, v, out)
+		case nil:
+		default:
+			out[key] = fmt.Sprint(v)
+		}
+	}
+}
+
+// translate 按语言查找文案，找不到时返回键本身
+func translate(lang, key string, args ...any) string {
+	msg, found := lookupLocale(lang, key)
+	if !found {
+		return key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+func lookupLocale(lang, key string) (string, bool) {
+	p := localeBundles.Load()
+	if p == nil {
+		return "", false
+	}
+	bundles := *p
+	lang = strings.ToLower(lang)
+	candidates := []string{lang}
+	if base, _, found := strings.Cut(lang, "-"); found {
+		candidates = append(candidates, base)
+	}
+	if def, _ := defaultLocale.Load().(string); def != "" {
+		candidates = append(candidates, def)
+		if base, _, found := strings.Cut(def, "-"); found {
+			candidates = append(candidates, base)
+		}
+	}
+	for _, l := range candidates {
+		if msg, ok := bundles[l][key]; l != "" && ok {
+			return msg, true
+		}
+	}
+	return "", false
+}
+
+// translateFunc 模板函数 t，lang 为请求的语言
+func translateFunc(lang string) func(key string, args ...any) string {
+	return func(key string, args ...any) string {
+		return translate(lang, key, args...)
+	}
+}
+
+// currentLocaleVersion 返回已加载语言包的版本，语言包变更后渲染缓存随之失效
+func currentLocaleVersion() string {
+	v, _ := localeVersion.Load().(string)
+	return v
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ====== 进行中的渲染 ======
+//
+// 每次渲染在管线开始时登记、结束时注销，记录当前所处的阶段，供 /debug/renders 排查
+// chromedp 不返回导致的请求卡死：长时间停留在 capture 阶段的渲染即为可疑对象。
+
+// inflightRender 一次进行中的渲染
+type inflightRender struct {
+	requestID string
+	site      string
+	typ       string
+	start     time.Time
+	warmup    bool
+
+	stage    atomic.Value // RenderStage
+	template atomic.Value // string，validate 阶段选定后写入
+	timeout  atomic.Int64 // 毫秒，validate 阶段合并默认值后写入
+}
+
+// InflightRender /debug/renders 返回的一项
+type InflightRender struct {
+	RequestID string    `json:"request_id,omitempty"`
+	Site      string    `json:"site"`
+	Type      string    `json:"type"`
+	Template  string    `json:"template,omitempty"`
+	Stage     string    `json:"stage"`
+	StartedAt time.Time `json:"started_at"`
+	ElapsedMs int64     `json:"elapsed_ms"`
+	TimeoutMs int64     `json:"timeout_ms,omitempty"`
+	Overdue   bool      `json:"overdue,omitempty"` // 已超过渲染超时仍未结束
+	Warmup    bool      `json:"warmup,omitempty"`
+}
+
+var inflightRenders sync.Map // *inflightRender → struct{}
+
+// trackInflight 登记一次渲染，返回注销函数
+func trackInflight(rc *RenderContext) (*inflightRender, func()) {
+	r := &inflightRender{
+		requestID: requestIDFrom(rc.Ctx),
+		site:      rc.Payload.Site,
+		typ:       rc.Payload.Type,
+		start:     time.Now(),
+		warmup:    rc.Payload.warmup,
+	}
+	r.stage.Store(StageValidate)
+	inflightRenders.Store(r, struct{}{})
+	return r, func() { inflightRenders.Delete(r) }
+}
+
+// stageTracker 包装管线中的处理函数，执行前记录所处阶段
+func (r *inflightRender) stageTracker(stage RenderStage, fn RenderMiddleware) RenderMiddleware {
+	return func(rc *RenderContext) error {
+		r.stage.Store(stage)
+		if stage != StageValidate {
+			if rc.Template != "" {
+				r.template.Store(rc.Template)
+			}
+			r.timeout.Store(rc.Options.TimeoutMs)
+		}
+		return fn(rc)
+	}
+}
+
+// inflightSnapshot 返回进行中的渲染，耗时长的在前
+func inflightSnapshot() []InflightRender {
+	now := time.Now()
+	list := make([]InflightRender, 0)
+	inflightRenders.Range(func(k, _ any) bool {
+		r := k.(*inflightRender)
+		item := InflightRender{
+			RequestID: r.requestID,
+			Site:      r.site,
+			Type:      r.typ,
+			Stage:     string(r.stage.Load().(RenderStage)),
+			StartedAt: r.start,
+			ElapsedMs: now.Sub(r.start).Milliseconds(),
+			TimeoutMs: r.timeout.Load(),
+			Warmup:    r.warmup,
+		}
+		if tmpl, set := r.template.Load().(string); set {
+			item.Template = tmpl
+		}
+		item.Overdue = item.TimeoutMs > 0 && item.ElapsedMs > item.TimeoutMs
+		list = append(list, item)
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool { return list[i].ElapsedMs > list[j].ElapsedMs })
+	return list
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/chromedp"
+)
+
+// ====== 请求语言 ======
+//
+// options.lang 显式指定卡片语言，未指定时取请求头 Accept-Language 中优先级最高的语言。
+// 模板中通过 lang 函数读取，浏览器中的 Intl / toLocaleString 等按该语言格式化。
+
+var langTagRegex = regexp.MustCompile(`^[A-Za-z]{1,8}(-[A-Za-z0-9]{1,8})*$`)
+
+// parseAcceptLanguage 返回 Accept-Language 中优先级最高的语言，无有效语言时返回空
+func parseAcceptLanguage(header string) string {
+	type langQ struct {
+		tag string
+		q   float64
+	}
+	var langs []langQ
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" || !langTagRegex.MatchString(tag) {
+			continue
+		}
+		q := 1.0
+		if v, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > 0 {
+			langs = append(langs, langQ{tag, q})
+		}
+	}
+	if len(langs) == 0 {
+		return ""
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+	return langs[0].tag
+}
+
+// applyAcceptLanguage 请求未指定 lang 或 options.lang 时使用 Accept-Language，返回是否采用了请求头
+func applyAcceptLanguage(payload *PushPayload, header string) bool {
+	if payload.Lang != "" || (payload.Options != nil && payload.Options.Lang != "") {
+		return false
+	}
+	lang := parseAcceptLanguage(header)
+	if lang == "" {
+		return false
+	}
+	if payload.Options == nil {
+		payload.Options = &RenderOptions{}
+	}
+	payload.Options.Lang = lang
+	return true
+}
+
+// emulateLocale 设置页面的默认语言环境
+func emulateLocale(lang string) chromedp.Action {
+	return emulation.SetLocaleOverride().WithLocale(strings.ReplaceAll(lang, "-", "_"))
+}
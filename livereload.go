@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+)
+
+// ====== 实时重载通知 ======
+//
+// 模板目录或配置文件变更后，通过 WebSocket 向管理面板与预览页推送事件，模板作者保存文件后
+// 页面自动重新渲染，无需手动刷新：
+//
+//	{"type": "templates", "keys": ["bilibili/live"], "time": "..."}   // keys 为空表示所有模板可能受影响
+//	{"type": "config", "time": "..."}
+//
+// 管理接口为 <admin.prefix>/events，预览接口为 /preview/events；预览地址加 ?live=1 时返回自动刷新的
+// 预览页。连接每 30 秒收到一次 {"type": "ping"}。
+
+// 事件类型
+const (
+	ReloadTemplates = "templates"
+	ReloadConfig    = "config"
+	reloadPing      = "ping"
+)
+
+// ReloadEvent 推送给订阅方的变更事件
+type ReloadEvent struct {
+	Type string    `json:"type"`
+	Keys []string  `json:"keys,omitempty"`
+	Time time.Time `json:"time,omitzero"`
+}
+
+// reloadHub 重载事件的订阅者
+type reloadHub struct {
+	mu   sync.Mutex
+	subs map[chan ReloadEvent]struct{}
+}
+
+var globalReloadHub = &reloadHub{subs: make(map[chan ReloadEvent]struct{})}
+
+func init() {
+	NewGaugeFunc("snapcast_reload_subscribers", "WebSocket connections subscribed to reload events.", func() float64 {
+		globalReloadHub.mu.Lock()
+		defer globalReloadHub.mu.Unlock()
+		return float64(len(globalReloadHub.subs))
+	})
+}
+
+func (h *reloadHub) subscribe() chan ReloadEvent {
+	ch := make(chan ReloadEvent, 16)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *reloadHub) unsubscribe(ch chan ReloadEvent) {
+	h.mu.Lock()
+	delete(h.subs, ch)
+	h.mu.Unlock()
+}
+
+// publishReload 推送变更事件，订阅者处理不过来时丢弃
+func publishReload(typ string, keys []string) {
+	ev := ReloadEvent{Type: typ, Keys: keys, Time: time.Now()}
+	h := globalReloadHub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// changedTemplateKeys 返回受变更文件影响的模板键，存在无法对应到模板的文件（如语言包、公共样式）时返回 nil，表示全部
+func changedTemplateKeys(files []string) []string {
+	templateMutex.RLock()
+	defer templateMutex.RUnlock()
+	seen := make(map[string]bool)
+	for _, f := range files {
+		f = filepath.Clean(f)
+		matched := false
+		for key, path := range templateMap {
+			// 模板本身及同名的示例数据、附属配置，如 live.html、live.sample.json、live.meta.yaml
+			if base := strings.TrimSuffix(filepath.Clean(path), ".html"); f == filepath.Clean(path) || strings.HasPrefix(f, base+".") {
+				seen[key], matched = true, true
+			}
+		}
+		if !matched {
+			return nil
+		}
+	}
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sameOriginHandshake 拒绝其他站点页面发起的连接，非浏览器客户端可不带 Origin
+func sameOriginHandshake(config *websocket.Config, req *http.Request) error {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || !strings.EqualFold(u.Host, req.Host) {
+		return fmt.Errorf("cross-origin websocket from %q", origin)
+	}
+	config.Origin = u
+	return nil
+}
+
+// ReloadEventsHandler 以 WebSocket 推送重载事件
+func ReloadEventsHandler(c *gin.Context) {
+	server := websocket.Server{
+		Handshake: sameOriginHandshake,
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			_ = ws.SetDeadline(time.Time{}) // 清除 server.write_timeout 等遗留的连接超时
+			ch := globalReloadHub.subscribe()
+			defer globalReloadHub.unsubscribe(ch)
+
+			closed := make(chan struct{})
+			go func() { // 读取直到对方关闭连接，客户端发来的内容忽略
+				var discard []byte
+				for websocket.Message.Receive(ws, &discard) == nil {
+				}
+				close(closed)
+			}()
+			ping := time.NewTicker(30 * time.Second)
+			defer ping.Stop()
+			for {
+				var ev ReloadEvent
+				select {
+				case <-closed:
+					return
+				case ev = <-ch:
+				case <-ping.C:
+					ev = ReloadEvent{Type: reloadPing}
+				}
+				_ = ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
+				if err := websocket.JSON.Send(ws, ev); err != nil {
+					return
+				}
+			}
+		},
+	}
+	logger.Debug("🔌 重载事件订阅", zap.String("client_ip", GetClientIP(c)), zap.String("path", c.Request.URL.Path))
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// livePreviewPage 预览页外壳：iframe 加载去掉 live 参数的预览地址，收到该模板或配置的变更事件时重新加载
+var livePreviewPage = template.Must(template.New("live").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>{{.Key}} · SnapCast</title>
+<style>html,body{margin:0;height:100%;background:#f5f5f5}iframe{border:0;width:100%;height:100%}
+#s{position:fixed;right:8px;bottom:8px;font:12px sans-serif;color:#888}</style></head>
+<body><iframe id="f" src="{{.Src}}"></iframe><div id="s"></div>
+<script>
+const key = {{.Key}}, frame = document.getElementById('f'), status = document.getElementById('s');
+function connect() {
+  const ws = new WebSocket((location.protocol === 'https:' ? 'wss://' : 'ws://') + location.host + {{.Events}});
+  ws.onopen = () => { status.textContent = '● live'; };
+  ws.onmessage = (m) => {
+    const ev = JSON.parse(m.data);
+    if (ev.type === 'ping') return;
+    if (ev.type === 'config' || !ev.keys || ev.keys.includes(key)) {
+      frame.src = {{.Src}} + '&_=' + Date.now();
+      status.textContent = '● reloaded ' + new Date().toLocaleTimeString();
+    }
+  };
+  ws.onclose = () => { status.textContent = '○ reconnecting'; setTimeout(connect, 2000); };
+}
+connect();
+</script></body></html>`))
+
+// writeLivePreview 返回自动刷新的预览页，tmplPath 为预览地址选中的模板
+func writeLivePreview(c *gin.Context, tmplPath string) {
+	key := ""
+	templateMutex.RLock()
+	for k, p := range templateMap {
+		if p == tmplPath {
+			key = k
+		}
+	}
+	templateMutex.RUnlock()
+	q := c.Request.URL.Query()
+	q.Set("live", "0") // 保证 src 带查询参数，刷新时可直接追加
+	src := c.Request.URL.Path + "?" + q.Encode()
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := livePreviewPage.Execute(c.Writer, map[string]string{"Key": key, "Src": src, "Events": "/preview/events"}); err != nil {
+		logger.Warn("⚠️ 预览页输出失败", zap.Error(err))
+	}
+}
@@ -6,11 +6,16 @@ import (
 )
 
 func InitLogger() {
+	initLogger("stdout")
+}
+
+// initLogger 创建输出到 output 的日志，命令行输出结果到 stdout 时日志改写 stderr
+func initLogger(output string) {
 	cfg := zap.Config{
 		Level:            logLevel,
 		Development:      false,
 		Encoding:         "console",
-		OutputPaths:      []string{"stdout"},
+		OutputPaths:      []string{output},
 		ErrorOutputPaths: []string{"stderr"},
 		EncoderConfig: zapcore.EncoderConfig{
 			TimeKey:     "time",
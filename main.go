@@ -1,21 +1,21 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"html/template"
-	"image"
-	"image/draw"
-	"image/png"
+	_ "image/jpeg"
+	"math"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/chromedp/cdproto/cdp"
@@ -25,7 +25,8 @@ import (
 	"github.com/spf13/viper"
 	uatomic "go.uber.org/atomic"
 	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
+
+	"SnapCast/extension"
 )
 
 // ====== 数据结构 ======
@@ -36,7 +37,25 @@ type PushPayload struct {
 	Output    string      `json:"output"` // "image" (default), "html", or "json"
 	Data      interface{} `json:"data"`
 	Timeout   any         `json:"timeout"`    // 自定义超时(ms)，支持数字或字符串如 "60s", "3000ms"
-	UserAgent string      `json:"user_agent"` // 自定义 UA
+	TimeoutMs int64       `json:"timeout_ms"` // 自定义超时(ms)，与 timeout 同时设置时以 timeout 为准
+	Priority  int         `json:"priority"`   // 排队优先级，数值大的优先，默认 0
+
+	IdempotencyKey string `json:"idempotency_key,omitempty"` // 投递 ID，重试时跳过已成功投递的目标，默认取请求头 Idempotency-Key
+	UserAgent      string `json:"user_agent"`                // 自定义 UA
+	Theme          string `json:"theme"`                     // 主题，如 light、dark：优先使用 <type>.<theme>.html 变体，模板中通过 theme 函数读取
+	Lang           string `json:"lang"`                      // 卡片语言，options.lang 的简写，同时设置时以 options.lang 为准
+	Response       string `json:"response"`                  // "body"（默认）直接返回内容，"url" 保存后返回访问地址（需启用 storage）
+
+	Options *RenderOptions `json:"options,omitempty"` // 渲染参数，覆盖配置默认值
+
+	Deliver []extension.Target `json:"deliver,omitempty"` // 渲染完成后投递的目标，对应配置 sinks.<name>
+
+	Debug bool `json:"debug,omitempty"` // 渲染失败时在响应中附带页面控制台输出，见 console.go
+
+	rawHTML        string         // /render/html 请求的 HTML，非空时跳过模板
+	templateSource string         // 模板试验场提交的模板源码，非空时代替模板文件，见 playground.go
+	console        []ConsoleEntry // debug 为 true 时渲染结束后写入的页面控制台输出
+	warmup         bool           // 模板预热，不计入统计与缓存，见 warmup.go
 }
 
 type APIResponse struct {
@@ -91,13 +110,7 @@ var (
 	logLevel           = zap.NewAtomicLevelAt(parseLogLevel(viper.GetString("logging.level")))
 	globalAuthToken       uatomic.String
 	globalBrowserPath     uatomic.String
-	renderTimeout         uatomic.Int64
-	renderQuality        uatomic.Int32
-	captureViewportWidth  uatomic.Int64
-	captureViewportHeight uatomic.Int64
-	captureViewportScale  uatomic.Float64
-	globalAllocCtx       context.Context
-	globalAllocCancel    context.CancelFunc
+	globalAllocCancel    context.CancelFunc // 关闭浏览器分配器，见 browserrecycle.go
 	concurrentMutex     sync.Mutex
 	currentConcurrent   int32
 	maxConcurrent       int32 // 最大并发数，可动态调整
@@ -106,39 +119,82 @@ var (
 // ====== 主程序 ======
 
 func main() {
+	if code := runCommand(os.Args[1:]); code >= 0 {
+		os.Exit(code)
+	}
+	flags, err := parseServerFlags(os.Args[1:])
+	if err != nil {
+		os.Exit(2)
+	}
 	InitLogger()
-	InitConfig()
+	InitConfig(flags)
 	WatchConfigChanges()
 	ConfigureRateLimiter(false, time.Second, 100, 24) // 默认禁用，启动后由 ApplyDynamicConfig 配置
 	StartRateLimiterCleanup(time.Minute)
-	browserPath := resolveBrowserPath()
-	InitGlobalAllocator(browserPath)
+	StartOrphanSweep(time.Hour)
+	StartRenderCacheGC(time.Hour)
+	StartLoadMonitor(2 * time.Second)
+	StartAutotune()
+	StartSLOEvaluator(30 * time.Second)
+	StartBrowserRecycler(30 * time.Second)
+	LoadPlugins(viper.GetString("plugins.dir"))
+	LoadWasmModules(viper.GetString("wasm.dir"))
+	applyExtensionFuncs()
+	UseRenderMiddleware(StageTransform, "render-cache", renderCacheMiddleware)
+	UseRenderMiddleware(StageTransform, "cdp-trace", traceMiddleware)
+	UseRenderMiddleware(StageTemplate, "chaos", chaosMiddleware)
+	assetProxyEnabled := InitAssetProxy()
+	fontOpts := InitFonts()
+	signingEnabled := InitSigning()
+	localStore := InitStorage()
+	InitArchive()
+	InitFailures()
+	InitTracing()
+	if remoteURL := viper.GetString("render.remote_debugging_url"); remoteURL != "" {
+		InitRemoteAllocator(remoteURL)
+	} else {
+		InitGlobalAllocator(resolveBrowserPath(), fontOpts...)
+	}
 	defer globalAllocCancel()
 
 	templateDir := viper.GetString("template.dir")
-	err := loadTemplates(templateDir)
+	InitTemplateRepo()
+	InitTemplateBundle()
+	err = loadTemplates(templateDir)
 	if err != nil {
 		logger.Fatal("❌ 加载模板失败", zap.Error(err))
 		return
 	}
+	if failed := logTemplateChecks(validateTemplates()); failed > 0 {
+		logger.Warn("⚠️ 部分模板存在语法错误，相关请求将失败", zap.Int("failed", failed))
+	}
 	if viper.GetBool("template.watch") {
 		watchTemplateDir(templateDir)
 	}
+	InitTemplateUsage()
+	TriggerTemplateWarmup()
 
-	port := viper.GetString("server.port")
-	if port == "" {
-		logger.Fatal("❌ server.port 不能为空")
-		return
+	addr, socket, err := listenAddr()
+	if err != nil {
+		logger.Fatal("❌ 监听地址无效", zap.Error(err))
+	}
+	tlsConfig, err := serverTLSConfig()
+	if err != nil {
+		logger.Fatal("❌ TLS 配置无效", zap.Error(err))
 	}
-	host := viper.GetString("server.host")
 
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
 	r.Use(gin.Recovery())
+	r.Use(RequestIDMiddleware())
+	r.Use(TracingMiddleware())
+	r.Use(requestLoggerMiddleware()) // 在过滤类中间件之前，被拒绝的请求同样记录访问日志
 	r.Use(IPFilterMiddleware())
+	if clientAuthMode() == ClientAuthOptional {
+		r.Use(ClientCertMiddleware())
+	}
 	r.Use(RateLimitMiddleware())
 	r.Use(AuthMiddleware())
-	r.Use(requestLoggerMiddleware())
 	r.NoRoute(func(c *gin.Context) {
 		logger.Warn("❕ 路由未找到", zap.String("path", c.Request.URL.Path))
 		c.JSON(http.StatusNotFound, errResp("endpoint not found"))
@@ -149,147 +205,308 @@ func main() {
 	})
 	r.POST(viper.GetString("server.endpoint"), RenderHandler)
 	r.POST(viper.GetString("capture.endpoint"), CaptureHandler)
-	err = r.Run(host + ":" + port)
+	if endpoint := htmlEndpoint(); endpoint != "" {
+		r.POST(endpoint, HTMLRenderHandler)
+	}
+	if endpoint := wsEndpoint(); endpoint != "" {
+		r.GET(endpoint, WSRenderHandler)
+	}
+	if viper.GetBool("template.preview") {
+		r.GET("/preview/:site/:type", PreviewHandler)
+		r.GET("/preview/events", ReloadEventsHandler)
+		r.GET("/preview/:site/:type/scenarios", PreviewScenariosHandler)
+	}
+	r.GET("/templates", TemplatesHandler)
+	r.POST("/templates/validate", TemplateValidateHandler)
+	if globalTemplateRepo != nil {
+		r.POST(gitWebhookPath, GitWebhookHandler)
+	}
+	if viper.GetBool("metrics.enabled") {
+		endpoint := viper.GetString("metrics.endpoint")
+		if endpoint == "" {
+			endpoint = "/metrics"
+		}
+		r.GET(endpoint, MetricsHandler)
+	}
+	if assetProxyEnabled {
+		r.GET(globalAssetCache.endpoint, AssetHandler)
+	}
+	if signingEnabled {
+		r.GET("/signing/public-key", PublicKeyHandler)
+	}
+	if localStore != nil {
+		r.GET(localStore.endpoint+"/*key", localStore.ServeHTTP)
+		r.HEAD(localStore.endpoint+"/*key", localStore.ServeHTTP)
+	}
+	registerDeliveryRoutes(r)
+	registerAdminRoutes(r)
+	registerTemplateUploadRoutes(r)
+	registerPlaygroundRoutes(r)
+	registerFailureRoutes(r)
+	registerDebugRoutes(r)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	StartExtensions(ctx)
+
+	srv := newHTTPServer(addr, r, tlsConfig)
+	ln, err := newListener()
 	if err != nil {
 		logger.Fatal("❌ 服务器启动失败", zap.Error(err))
-		return
+	}
+	if socket != "" {
+		defer os.Remove(socket)
+	}
+	go func() {
+		var err error
+		if srv.TLSConfig != nil {
+			err = srv.ServeTLS(ln, "", "") // 证书由 TLSConfig.GetCertificate 提供
+		} else {
+			err = srv.Serve(ln)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatal("❌ 服务器启动失败", zap.Error(err))
+		}
+	}()
+	logger.Info("🚀 服务已启动", zap.String("addr", srv.Addr), zap.Bool("tls", srv.TLSConfig != nil), zap.String("client_auth", clientAuthMode()))
+
+	<-ctx.Done()
+	logger.Info("👋 正在关闭服务")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("⚠️ 服务关闭超时", zap.Error(err))
+	}
+	StopExtensions(shutdownCtx)
+	ShutdownTracing(shutdownCtx)
+	if globalArchiver != nil {
+		globalArchiver.Flush()
+	}
+	if err := globalTemplateUsage.Flush(); err != nil {
+		logger.Warn("⚠️ 模板使用记录写入失败", zap.Error(err))
 	}
 }
 
-func InitGlobalAllocator(browserPath string) {
+func InitGlobalAllocator(browserPath string, extra ...chromedp.ExecAllocatorOption) {
 	opts := append(chromedp.DefaultExecAllocatorOptions[:],
 		chromedp.ExecPath(browserPath),
 		chromedp.Flag("headless", true),
 		chromedp.Flag("disable-gpu", true),
-		chromedp.Flag("no-sandbox", true),
 	)
-	globalAllocCtx, globalAllocCancel = chromedp.NewExecAllocator(context.Background(), opts...)
+	// 固定光栅化色彩空间，避免截图颜色随主机显示配置变化
+	if profile := viper.GetString("render.color_profile"); profile != "" {
+		opts = append(opts, chromedp.Flag("force-color-profile", profile))
+	}
+	opts = append(opts, fontRenderingFlags()...)
+	opts = append(opts, extra...)
+	opts = append(opts, browserFlags()...) // 最后追加，extra_flags 可覆盖以上参数
+	setAllocator(func() (context.Context, context.CancelFunc) {
+		return chromedp.NewExecAllocator(context.Background(), opts...)
+	}, false)
 }
 
-func RenderHandler(c *gin.Context) {
-	// 获取信号量，超时 5 秒
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
-	defer cancel()
-
-	_ = ctx // ctx 用于超时控制，实际渲染使用新 tab
+// fontRenderingFlags 按 render.font 生成文字渲染相关的启动参数，未设置的项保持 Chrome 默认
+func fontRenderingFlags() []chromedp.ExecAllocatorOption {
+	var opts []chromedp.ExecAllocatorOption
+	if viper.IsSet("render.font.lcd_text") {
+		if viper.GetBool("render.font.lcd_text") {
+			opts = append(opts, chromedp.Flag("enable-lcd-text", true))
+		} else {
+			opts = append(opts, chromedp.Flag("disable-lcd-text", true))
+		}
+	}
+	switch hinting := strings.ToLower(viper.GetString("render.font.hinting")); hinting {
+	case "":
+	case "none", "slight", "medium", "full":
+		opts = append(opts, chromedp.Flag("font-render-hinting", hinting))
+	default:
+		logger.Warn("❗ render.font.hinting 无效，使用 Chrome 默认值", zap.String("hinting", hinting))
+	}
+	if viper.IsSet("render.font.subpixel_positioning") {
+		if viper.GetBool("render.font.subpixel_positioning") {
+			opts = append(opts, chromedp.Flag("enable-font-subpixel-positioning", true))
+		} else {
+			opts = append(opts, chromedp.Flag("disable-font-subpixel-positioning", true))
+		}
+	}
+	return opts
+}
 
-	// 尝试获取并发许可
-	concurrentMutex.Lock()
-	if currentConcurrent >= maxConcurrent {
-		concurrentMutex.Unlock()
-		c.JSON(http.StatusServiceUnavailable, errResp("server busy, try again later"))
-		return
+// browserFlags 按 render 配置生成沙箱、代理、用户目录与自定义启动参数
+func browserFlags() []chromedp.ExecAllocatorOption {
+	// 容器中通常无法使用 Chrome 沙箱，默认关闭
+	opts := []chromedp.ExecAllocatorOption{
+		chromedp.Flag("no-sandbox", !viper.GetBool("render.sandbox")),
+		// /dev/shm 过小（Docker 默认 64MB）时改用 /tmp，避免大页面崩溃
+		chromedp.Flag("disable-dev-shm-usage", !viper.IsSet("render.disable_dev_shm_usage") || viper.GetBool("render.disable_dev_shm_usage")),
+	}
+	if proxy := viper.GetString("render.proxy_server"); proxy != "" {
+		opts = append(opts, chromedp.ProxyServer(proxy))
+		if bypass := viper.GetString("render.proxy_bypass_list"); bypass != "" {
+			opts = append(opts, chromedp.Flag("proxy-bypass-list", bypass))
+		}
 	}
-	currentConcurrent++
-	concurrentMutex.Unlock()
-	defer func() {
-		concurrentMutex.Lock()
-		currentConcurrent--
-		concurrentMutex.Unlock()
-	}()
+	if dir := viper.GetString("render.user_data_dir"); dir != "" {
+		opts = append(opts, chromedp.UserDataDir(dir))
+	}
+	for _, raw := range viper.GetStringSlice("render.extra_flags") {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(strings.TrimSpace(raw), "-"), "=")
+		if name == "" {
+			continue
+		}
+		switch {
+		case !hasValue:
+			opts = append(opts, chromedp.Flag(name, true))
+		case value == "false":
+			opts = append(opts, chromedp.Flag(name, false)) // 移除默认参数
+		default:
+			opts = append(opts, chromedp.Flag(name, value))
+		}
+	}
+	return opts
+}
 
-	var payload PushPayload
-	if err := c.ShouldBindJSON(&payload); err != nil {
-		logger.Error("❕ 传递参数有误", zap.Error(err))
-		c.JSON(http.StatusBadRequest, errResp(err.Error()))
-		return
+// InitRemoteAllocator 连接已运行的 Chrome（如 browserless/chrome 容器），不再启动本地浏览器。
+// 支持 ws://host:9222/devtools/browser/<id>，或 http://host:9222 由 /json/version 自动解析。
+func InitRemoteAllocator(remoteURL string) {
+	logger.Info("🛰️ 使用远程浏览器", zap.String("url", remoteURL))
+	if viper.GetString("render.color_profile") != "" {
+		logger.Warn("⚠️ 远程浏览器不支持 render.color_profile，需在浏览器启动参数中设置 --force-color-profile")
 	}
-	if payload.Output == "" {
-		payload.Output = "image"
+	if len(fontRenderingFlags()) > 0 {
+		logger.Warn("⚠️ 远程浏览器不支持 render.font，需在浏览器启动参数中设置对应的文字渲染参数")
 	}
-	// output 字段校验
-	if payload.Output != "image" && payload.Output != "html" && payload.Output != "json" {
-		logger.Warn("❕ 无效的 output 参数", zap.String("output", payload.Output))
-		c.JSON(http.StatusBadRequest, errResp("invalid output: must be image, html, or json"))
-		return
+	if len(viper.GetStringSlice("render.extra_flags")) > 0 || viper.GetString("render.proxy_server") != "" || viper.GetString("render.user_data_dir") != "" {
+		logger.Warn("⚠️ 远程浏览器不支持 render.extra_flags/proxy_server/user_data_dir，需在浏览器启动参数中设置")
 	}
-	// 解析 timeout
-	timeout, err := ParseDuration(payload.Timeout)
-	if err != nil {
-		logger.Warn("❕ 无效的 timeout 参数", zap.Any("timeout", payload.Timeout))
+	setAllocator(func() (context.Context, context.CancelFunc) {
+		return chromedp.NewRemoteAllocator(context.Background(), remoteURL)
+	}, true)
+}
+
+func RenderHandler(c *gin.Context) {
+	var payload PushPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		loggerFor(c.Request.Context()).Error("❕ 传递参数有误", zap.Error(err))
+		c.Set("render_error", err.Error())
 		c.JSON(http.StatusBadRequest, errResp(err.Error()))
 		return
 	}
-	timeoutMs := timeout.Milliseconds()
-	if timeoutMs <= 0 {
-		timeoutMs = renderTimeout.Load()
+	c.Set("render_site", payload.Site)
+	c.Set("render_type", payload.Type)
+	if applyAcceptLanguage(&payload, c.GetHeader("Accept-Language")) {
+		c.Header("Vary", "Accept-Language")
 	}
-	if logLevel.Level() == zapcore.DebugLevel {
-		debugPayload(payload)
+	if payload.IdempotencyKey == "" {
+		payload.IdempotencyKey = c.GetHeader("Idempotency-Key")
 	}
 
-	tmplPath := selectTemplate(payload)
-	if tmplPath == "" {
-		logger.Warn("❔ 未找到模板", zap.String("site", payload.Site), zap.String("type", payload.Type))
-		c.JSON(http.StatusBadRequest, errResp("no template found"))
+	release, acquired := acquireRequestSlot(c, payload.Site, payload.Priority)
+	if !acquired {
 		return
 	}
+	defer release()
 
-	// 渲染 HTML
-	var buf bytes.Buffer
-	tmpl, err := template.New(filepath.Base(tmplPath)).Funcs(funcsList).ParseFiles(tmplPath)
+	ctx := withCacheDirective(c.Request.Context(), ParseCacheControl(c.GetHeader("Cache-Control")))
+	result, err := renderPayload(ctx, &payload)
 	if err != nil {
-		logger.Error("❌ 模板解析失败", zap.Error(err), zap.String("template", tmplPath))
-		c.JSON(http.StatusInternalServerError, errResp(err.Error()))
+		c.Set("render_error", err.Error())
+		c.JSON(renderErrorStatus(err), renderErrorResp(&payload, err))
 		return
 	}
-	if payload.Data != nil {
-		if logLevel.Level() == zapcore.DebugLevel {
-			debugFields(payload.Data)
-		}
-		err = safeExecuteTemplate(tmpl, payload.Data, &buf)
-		if err != nil {
-			logger.Error("❌ 模板渲染失败", zap.Error(err), zap.String("template", tmplPath))
-			c.JSON(http.StatusInternalServerError, errResp(fmt.Sprintf("execute template failed: %v", err)))
-			return
-		}
-	}
+	writeRenderResult(c, &payload, result)
+}
 
-	// 输出类型: html 直接返回渲染后的 HTML
-	if payload.Output == "html" {
-		c.Header("Content-Type", "text/html; charset=utf-8")
-		c.Writer.Write(buf.Bytes())
-		c.Set("render_site", payload.Site)
-		c.Set("render_type", payload.Type)
-		c.Set("render_template", tmplPath)
-		c.Set("render_output", payload.Output)
-		c.Set("render_html_size", buf.Len())
+// writeRenderResult 按 output 写出渲染结果，并记录请求日志所需的字段
+func writeRenderResult(c *gin.Context, payload *PushPayload, result *RenderResult) {
+	c.Set("render_site", payload.Site)
+	c.Set("render_type", payload.Type)
+	c.Set("render_template", result.Template)
+	c.Set("render_output", payload.Output)
+	c.Set("render_html_size", result.HTMLSize)
+	c.Set("render_duration", result.Duration)
+	if result.TracePath != "" {
+		c.Header(cdpTraceHeader, result.TracePath)
+	}
+	if result.Cache != "" {
+		c.Header(renderCacheHeader, result.Cache)
+	}
+	setSignatureHeaders(c, result.Signature)
+	setAltTextHeader(c, result.Alt)
+
+	// 指定了投递目标时，返回投递回执而不是渲染结果本身
+	if len(payload.Deliver) > 0 {
+		resp := gin.H{"template": result.Template, "delivery_id": result.DeliveryID, "deliveries": result.Receipts}
+		if result.Moderation != nil && result.Moderation.Flagged {
+			resp["moderation"] = result.Moderation
+		}
+		c.JSON(http.StatusOK, ok(resp))
 		return
 	}
 
-	// 输出类型: json 执行 JS 并返回序列化结果
-	if payload.Output == "json" {
-		c.Header("Content-Type", "application/json")
-		result, err := RenderJS(buf.String(), timeoutMs, payload.UserAgent)
+	if payload.Response == ResponseURL {
+		obj, err := storeRenderResult(c, payload, result)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, errResp(err.Error()))
+			loggerFor(c.Request.Context()).Error("❌ 渲染结果保存失败", zap.Error(err))
+			c.Set("render_error", err.Error())
+			c.JSON(http.StatusInternalServerError, errResp("failed to store result"))
 			return
 		}
-		c.JSON(http.StatusOK, ok(result))
-		c.Set("render_site", payload.Site)
-		c.Set("render_type", payload.Type)
-		c.Set("render_template", tmplPath)
-		c.Set("render_output", payload.Output)
-		c.Set("render_html_size", buf.Len())
+		obj.Alt = result.Alt
+		c.JSON(http.StatusOK, ok(obj))
 		return
 	}
 
-	// 截图
-	imgBytes, err := RenderScreenshot(buf.String(), timeoutMs)
-	if err != nil {
-		logger.Error("❌ 截图失败", zap.Error(err), zap.String("template", tmplPath))
-		c.JSON(http.StatusInternalServerError, errResp(err.Error()))
-		return
+	switch payload.Output {
+	case "json":
+		c.JSON(http.StatusOK, ok(result.JSON))
+	default:
+		writeBody(c, result.ContentType, result.Body)
+		if payload.Output == "image" {
+			c.Set("render_img_size", len(result.Body))
+		}
 	}
+}
 
-	c.Header("Content-Type", "image/png")
-	c.Writer.Write(imgBytes)
-	c.Set("render_site", payload.Site)
-	c.Set("render_type", payload.Type)
-	c.Set("render_template", tmplPath)
-	c.Set("render_output", payload.Output)
-	c.Set("render_html_size", buf.Len())
-	c.Set("render_img_size", len(imgBytes))
+// RenderResult 一次渲染的产物
+type RenderResult struct {
+	Template    string // 使用的模板路径
+	ContentType string
+	Body        []byte   // image/html 输出的内容
+	Frames      [][]byte // options.frames 开启时的逐帧 PNG，Body 为打包后的 zip；不进入渲染缓存
+	JSON        any      // json 输出的结果
+	HTMLSize    int
+	Duration    time.Duration      // 渲染管线耗时，不含排队与响应写出
+	TracePath   string             // options.trace 开启时的 CDP 日志文件
+	Cache       string             // 渲染缓存状态：HIT/MISS/BYPASS，未启用缓存时为空
+	Signature   string             // signing.enabled 时 Body 的 Ed25519 签名（base64）
+	Alt         string             // 替代文本，模板附属配置未设置 alt 时为空
+	Moderation  *ModerationVerdict // 投递前的内容审核结果，未启用审核时为空
+
+	Receipts   []extension.Receipt // 投递回执，仅当请求指定 deliver 时填充
+	DeliveryID string              // 投递 ID，用于查询回执
+}
+
+// RenderError 携带 HTTP 状态码的渲染错误
+type RenderError struct {
+	Status int
+	Err    error
+}
+
+func (e *RenderError) Error() string { return e.Err.Error() }
+func (e *RenderError) Unwrap() error { return e.Err }
+
+func newRenderError(status int, err error) error {
+	return &RenderError{Status: status, Err: err}
+}
+
+// renderErrorStatus 返回错误对应的 HTTP 状态码，非 RenderError 视为 500
+func renderErrorStatus(err error) int {
+	var re *RenderError
+	if errors.As(err, &re) {
+		return re.Status
+	}
+	return http.StatusInternalServerError
 }
 
 func requestLoggerMiddleware() gin.HandlerFunc {
@@ -302,21 +519,33 @@ func requestLoggerMiddleware() gin.HandlerFunc {
 
 		latency := time.Since(start)
 		status := c.Writer.Status()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequestsTotal.Inc(route, strconv.Itoa(status))
 		clientIP := c.ClientIP()
 		method := c.Request.Method
 
 		fields := []zap.Field{
+			zap.String("request_id", c.GetString("request_id")),
 			zap.String("method", method),
 			zap.String("path", path),
 			zap.Int("status", status),
 			zap.String("latency", latency.String()),
 			zap.String("client_ip", clientIP),
 		}
+		if traceID := spanFrom(c.Request.Context()).TraceID(); traceID != "" {
+			fields = append(fields, zap.String("trace_id", traceID))
+		}
 
 		if query != "" {
 			fields = append(fields, zap.String("query", query))
 		}
 
+		if name, exists := c.Get("auth_name"); exists {
+			fields = append(fields, zap.String("token", name.(string)))
+		}
 		if site, exists := c.Get("render_site"); exists {
 			fields = append(fields, zap.String("site", site.(string)))
 		}
@@ -326,6 +555,9 @@ func requestLoggerMiddleware() gin.HandlerFunc {
 		if tmpl, exists := c.Get("render_template"); exists {
 			fields = append(fields, zap.String("template", tmpl.(string)))
 		}
+		if captureURL, exists := c.Get("capture_url"); exists {
+			fields = append(fields, zap.String("url", captureURL.(string)))
+		}
 		if output, exists := c.Get("render_output"); exists {
 			fields = append(fields, zap.String("output", output.(string)))
 		}
@@ -334,8 +566,24 @@ func requestLoggerMiddleware() gin.HandlerFunc {
 		} else if htmlSize, exists := c.Get("render_html_size"); exists {
 			fields = append(fields, zap.String("html_size", formatBytes(htmlSize.(int))))
 		}
+		if d, exists := c.Get("queue_wait"); exists {
+			fields = append(fields, zap.String("queue_wait", d.(time.Duration).String()))
+		}
+		if d, exists := c.Get("render_duration"); exists {
+			fields = append(fields, zap.String("render_duration", d.(time.Duration).String()))
+		}
+		if msg, exists := c.Get("render_error"); exists {
+			fields = append(fields, zap.String("error", msg.(string)))
+		}
 
-		logger.Info("❇️ 请求结果", fields...)
+		switch {
+		case status >= 500:
+			logger.Error("❇️ 请求结果", fields...)
+		case status >= 400:
+			logger.Warn("❇️ 请求结果", fields...)
+		default:
+			logger.Info("❇️ 请求结果", fields...)
+		}
 	}
 }
 
@@ -398,6 +646,10 @@ func findLinuxChromePath() string {
 		"/snap/bin/chromium",
 		"/usr/bin/microsoft-edge",
 		"/usr/bin/edge",
+		// chrome-headless-shell（chromedp/headless-shell 镜像等精简环境）
+		"/headless-shell/headless-shell",
+		"/usr/bin/chrome-headless-shell",
+		"/usr/bin/headless-shell",
 	}
 	for _, p := range paths {
 		if _, err := os.Stat(p); err == nil {
@@ -410,148 +662,128 @@ func findLinuxChromePath() string {
 	return ""
 }
 
-func RenderScreenshot(html string, timeoutMs int64) ([]byte, error) {
-	ctx, cancel := NewTabContext(timeoutMs)
-	defer cancel()
-
-	tmpFile, err := os.CreateTemp(os.TempDir(), "screenshot_*.html")
-	if err != nil {
-		return nil, err
+// pageSetupActions 导航前设置 UA、视口、配色、语言、请求头与注入脚本
+func pageSetupActions(opts RenderOptions) []chromedp.Action {
+	actions := opts.Chaos.actions()
+	if opts.UserAgent != "" {
+		actions = append(actions, emulation.SetUserAgentOverride(opts.UserAgent))
 	}
-	tmpPath := tmpFile.Name()
-	defer func() {
-		tmpFile.Close()
-		if err := os.Remove(tmpPath); err != nil {
-			logger.Debug("🗑️ 临时文件删除失败", zap.String("path", tmpPath), zap.Error(err))
-		} else {
-			logger.Debug("🗑️ 临时文件已删除", zap.String("path", tmpPath))
-		}
-	}()
-	_, err = tmpFile.WriteString(html)
-	if err != nil {
-		return nil, err
+	if vp := opts.Viewport; vp != nil {
+		actions = append(actions, emulation.SetDeviceMetricsOverride(int64(vp.Width), int64(vp.Height), vp.Scale, false))
 	}
-
-	absPath, _ := filepath.Abs(tmpPath)
-	fileURL := "file://" + absPath
-	if runtime.GOOS != "windows" {
-		fileURL = "file:///" + absPath
+	if opts.ColorScheme != "" {
+		actions = append(actions, emulateColorScheme(opts.ColorScheme))
 	}
-
-	err = chromedp.Run(ctx,
-		chromedp.Navigate(fileURL),
-		emulation.SetDefaultBackgroundColorOverride().WithColor(&cdp.RGBA{R: 0, G: 0, B: 0, A: 0}),
-		chromedp.WaitVisible("body", chromedp.ByQuery),
-		chromedp.Evaluate(`document.querySelector('body').scrollIntoView({block:'start', behavior:'instant'})`, nil),
-	)
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to evaluate JS: %w", err)
+	if opts.Lang != "" {
+		actions = append(actions, emulateLocale(opts.Lang))
+	}
+	if len(opts.ExtraHeaders) > 0 {
+		actions = append(actions, extraHeadersAction(opts.ExtraHeaders))
 	}
+	return append(actions, initScriptActions(opts.InitScripts)...)
+}
 
-	var js string
-	err = chromedp.Run(ctx,
-		chromedp.EvaluateAsDevTools(`(function() {
-				const el = document.querySelector('body');
-				const r = el.getBoundingClientRect();
-				const x = Math.max(0, Math.floor(r.left));
-				const y = Math.max(0, Math.floor(r.top + (window.scrollY || document.documentElement.scrollTop)));
-				const w = Math.ceil(r.width);
-				const h = Math.ceil(r.height);
-				const dpr = window.devicePixelRatio || 1;
-				return JSON.stringify({ x, y, w, h, dpr });
-			  })()`, &js),
-	)
+func RenderScreenshot(ctx context.Context, html string, opts RenderOptions) ([]byte, error) {
+	ctx, r, release, err := openScreenshotPage(ctx, html, opts)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
 
-	type Rect struct {
-		X, Y, W, H, DPR float64
-	}
-	var r Rect
-	err = json.Unmarshal([]byte(js), &r)
-	if err != nil {
-		return nil, err
+	// 超长卡片截断到 overflow.max_height，见 overflow.go
+	if opts.Overflow.active() && r.H > float64(opts.Overflow.MaxHeight) {
+		if r, err = truncateBody(ctx, opts.Overflow); err != nil {
+			return nil, fmt.Errorf("failed to truncate page: %w", err)
+		}
 	}
 
-	var full []byte
-	err = chromedp.Run(ctx, chromedp.FullScreenshot(&full, int(renderQuality.Load())))
+	// 由 Chrome 按 body 区域裁剪，见 screenshot.go
+	_, span := startSpan(ctx, "screenshot")
+	img, err := clipScreenshot(ctx, r, opts.Quality)
+	span.SetAttr("snapcast.screenshot_size", len(img))
+	span.End(err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to take screenshot: %w", err)
 	}
+	return img, nil
+}
 
-	if len(full) == 0 {
-		return nil, fmt.Errorf("screenshot data is empty")
-	}
+// openScreenshotPage 在新标签页中加载 HTML，等待页面可见后返回 body 的截图区域，release 关闭标签页
+func openScreenshotPage(ctx context.Context, html string, opts RenderOptions) (context.Context, frameRect, func(), error) {
+	tracker := trackerFrom(ctx)
+	ctx, cancel := tracker.Tab(opts.TimeoutMs)
 
-	img, err := png.Decode(bytes.NewReader(full))
+	load, unload, err := tracker.LoadHTML(html, opts.BaseURL, "screenshot")
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode screenshot: %w", err)
+		cancel()
+		return nil, frameRect{}, nil, err
 	}
-
-	if img == nil {
-		return nil, fmt.Errorf("decoded image is nil")
+	release := func() {
+		unload()
+		cancel()
 	}
 
-	x := int(r.X * r.DPR)
-	y := int(r.Y * r.DPR)
-	w := int(r.W * r.DPR)
-	h := int(r.H * r.DPR)
-
-	bounds := img.Bounds()
-	x = max(0, x)
-	y = max(0, y)
-	w = min(w, bounds.Dx()-x)
-	h = min(h, bounds.Dy()-y)
+	_, span := startSpan(ctx, "navigate")
+	runOpts := append(pageSetupActions(opts),
+		load,
+		emulation.SetDefaultBackgroundColorOverride().WithColor(&cdp.RGBA{R: 0, G: 0, B: 0, A: 0}),
+	)
+	err = chromedp.Run(ctx, runOpts...)
+	span.End(err)
+	if err != nil {
+		release()
+		return nil, frameRect{}, nil, fmt.Errorf("failed to evaluate JS: %w", err)
+	}
 
-	crop := image.Rect(x, y, x+w, y+h)
-	sub := image.NewRGBA(crop)
-	draw.Draw(sub, crop, img, crop.Min, draw.Src)
+	_, span = startSpan(ctx, "wait")
+	err = chromedp.Run(ctx,
+		chromedp.WaitVisible("body", chromedp.ByQuery),
+		chromedp.Evaluate(`document.querySelector('body').scrollIntoView({block:'start', behavior:'instant'})`, nil),
+	)
+	if err != nil {
+		span.End(err)
+		release()
+		return nil, frameRect{}, nil, fmt.Errorf("failed to evaluate JS: %w", err)
+	}
 
-	var out bytes.Buffer
-	err = png.Encode(&out, sub)
+	r, err := bodyRect(ctx)
+	span.End(err)
 	if err != nil {
-		return nil, err
+		release()
+		return nil, frameRect{}, nil, err
 	}
-	return out.Bytes(), nil
+	return ctx, r, release, nil
 }
 
-func RenderJS(html string, timeoutMs int64, userAgent string) (any, error) {
-	ctx, cancel := NewTabContext(timeoutMs)
+func RenderJS(ctx context.Context, html string, opts RenderOptions) (any, error) {
+	timeoutMs, userAgent := opts.TimeoutMs, opts.UserAgent
+	tracker := trackerFrom(ctx)
+	ctx, cancel := tracker.Tab(timeoutMs)
 	defer cancel()
 
-	tmpFile, err := os.CreateTemp(os.TempDir(), "snapcast_js_*.html")
-	if err != nil {
-		return nil, err
-	}
-	tmpPath := tmpFile.Name()
-	defer func() {
-		tmpFile.Close()
-		if err := os.Remove(tmpPath); err != nil {
-			logger.Debug("🗑️ 临时文件删除失败", zap.String("path", tmpPath), zap.Error(err))
-		} else {
-			logger.Debug("🗑️ 临时文件已删除", zap.String("path", tmpPath))
-		}
-	}()
-	_, err = tmpFile.WriteString(html)
+	load, release, err := tracker.LoadHTML(html, opts.BaseURL, "js")
 	if err != nil {
 		return nil, err
 	}
-
-	absPath, _ := filepath.Abs(tmpPath)
-	fileURL := "file://" + absPath
-	if runtime.GOOS != "windows" {
-		fileURL = "file:///" + absPath
-	}
+	defer release()
 
 	runOpts := []chromedp.Action{
-		chromedp.Navigate(fileURL),
+		load,
 		chromedp.WaitVisible("body", chromedp.ByQuery),
 	}
 	if userAgent != "" {
 		runOpts = append([]chromedp.Action{emulation.SetUserAgentOverride(userAgent)}, runOpts...)
 	}
+	if opts.ColorScheme != "" {
+		runOpts = append([]chromedp.Action{emulateColorScheme(opts.ColorScheme)}, runOpts...)
+	}
+	if opts.Lang != "" {
+		runOpts = append([]chromedp.Action{emulateLocale(opts.Lang)}, runOpts...)
+	}
+	if len(opts.ExtraHeaders) > 0 {
+		runOpts = append([]chromedp.Action{extraHeadersAction(opts.ExtraHeaders)}, runOpts...)
+	}
+	runOpts = append(initScriptActions(opts.InitScripts), runOpts...)
 
 	err = chromedp.Run(ctx, runOpts...)
 	if err != nil {
@@ -587,20 +819,45 @@ func RenderJS(html string, timeoutMs int64, userAgent string) (any, error) {
 	return result, nil
 }
 
+// extractToken 从 Authorization 头中取出 token，兼容 Bearer 前缀
+func extractToken(c *gin.Context) string {
+	authHeader := c.GetHeader("Authorization")
+	if len(authHeader) >= 7 && strings.ToLower(authHeader[:6]) == "bearer" {
+		return strings.TrimSpace(authHeader[6:])
+	}
+	return authHeader
+}
+
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
 		expected := globalAuthToken.Load()
-
-		if expected != "" {
-			token := authHeader
-			if len(authHeader) >= 7 && strings.ToLower(authHeader[:6]) == "bearer" {
-				token = strings.TrimSpace(authHeader[6:])
-			}
-			if token != expected {
-				logger.Warn("🔐 认证失败", zap.String("client_ip", GetClientIP(c)))
-				c.AbortWithStatusJSON(http.StatusUnauthorized, errResp("unauthorized"))
-				return
+		signed := globalHMACAuth.Load()
+
+		// 签名的资源代理请求由 Chrome 发起，不携带 token
+		if (expected != "" || signed != nil || hasAuthTokens()) && !isSignedAssetRequest(c) && !isStoredObjectRequest(c) && !trustedSocketRequest(c) && !isGitWebhookRequest(c) && !isPlaygroundPage(c) {
+			// 携带 X-Signature 时按 HMAC 签名校验，否则校验 token
+			if signed != nil && hasHMACSignature(c) {
+				if err := signed.Verify(c); err != nil {
+					loggerFor(c.Request.Context()).Warn("🔐 签名校验失败", zap.String("client_ip", GetClientIP(c)), zap.Error(err))
+					c.AbortWithStatusJSON(http.StatusUnauthorized, errResp("unauthorized: "+err.Error()))
+					return
+				}
+			} else {
+				principal := lookupAuthToken(extractToken(c), expected)
+				if principal == nil {
+					loggerFor(c.Request.Context()).Warn("🔐 认证失败", zap.String("client_ip", GetClientIP(c)))
+					c.AbortWithStatusJSON(http.StatusUnauthorized, errResp("unauthorized"))
+					return
+				}
+				if allowed, retryAfter := principal.Allow(); !allowed {
+					seconds := max(int(math.Ceil(retryAfter.Seconds())), 1)
+					loggerFor(c.Request.Context()).Warn("⚠️ token 限流触发", zap.String("token", principal.name), zap.Int("retry_after", seconds))
+					c.Header("Retry-After", strconv.Itoa(seconds))
+					c.AbortWithStatusJSON(http.StatusTooManyRequests, errResp("rate limit exceeded, try again later"))
+					return
+				}
+				c.Set("auth_name", principal.name)
+				c.Request = c.Request.WithContext(withPrincipal(c.Request.Context(), principal))
 			}
 		}
 		c.Next()
@@ -610,8 +867,8 @@ func AuthMiddleware() gin.HandlerFunc {
 func IPFilterMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		clientIP := GetClientIP(c)
-		if !globalIPList.IsAllowed(clientIP) {
-			logger.Warn("⛔ IP 被拒绝", zap.String("client_ip", clientIP))
+		if !globalIPList.IsAllowed(clientIP) && !isSignedAssetRequest(c) && !isStoredObjectRequest(c) && !trustedSocketRequest(c) {
+			loggerFor(c.Request.Context()).Warn("⛔ IP 被拒绝", zap.String("client_ip", clientIP))
 			c.AbortWithStatusJSON(http.StatusForbidden, errResp("ip forbidden"))
 			return
 		}
@@ -619,11 +876,17 @@ func IPFilterMiddleware() gin.HandlerFunc {
 	}
 }
 
-func NewTabContext(timeoutMs int64) (context.Context, context.CancelFunc) {
-	browserCtx, browserCancel := chromedp.NewContext(globalAllocCtx) // 新 tab
+func NewTabContext(timeoutMs int64, opts ...chromedp.ContextOption) (context.Context, context.CancelFunc) {
+	// CDP 跟踪的日志选项只能用于新启动的浏览器，此时单独启动
+	parent, shared, release := acquireBrowser(len(opts) > 0)
+	if shared {
+		opts = append(opts, chromedp.WithNewBrowserContext()) // 各次渲染的 Cookie 与存储互相隔离
+	}
+	browserCtx, browserCancel := chromedp.NewContext(parent, opts...) // 新 tab
 	ctx, cancel := context.WithTimeout(browserCtx, time.Duration(timeoutMs)*time.Millisecond)
 	return ctx, func() {
 		cancel()
 		browserCancel()
+		release()
 	}
 }
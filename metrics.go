@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====== 指标 ======
+//
+// 以 Prometheus 文本格式在 metrics.endpoint 暴露运行指标，不引入额外依赖。
+
+type metric interface {
+	write(b *strings.Builder)
+}
+
+var (
+	metricsMutex sync.RWMutex
+	metricsList  []metric
+)
+
+func registerMetric(m metric) {
+	metricsMutex.Lock()
+	metricsList = append(metricsList, m)
+	metricsMutex.Unlock()
+}
+
+// CounterVec 带标签的计数器
+type CounterVec struct {
+	name, help string
+	labels     []string
+	mu         sync.Mutex
+	values     map[string]float64
+}
+
+// NewCounterVec 创建并注册计数器
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labels: labels, values: make(map[string]float64)}
+	registerMetric(c)
+	return c
+}
+
+// Add 按标签值累加，标签值顺序与创建时的标签名一致
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\x00")
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+// Inc 按标签值加一
+func (c *CounterVec) Inc(labelValues ...string) { c.Add(1, labelValues...) }
+
+// Value 返回指定标签值的当前计数
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[strings.Join(labelValues, "\x00")]
+}
+
+func (c *CounterVec) write(b *strings.Builder) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeSamples(b, c.name, c.labels, c.values)
+}
+
+// GaugeVecFunc 采集时回调取值的仪表，回调返回标签值（以 \x00 连接）到数值的映射
+type GaugeVecFunc struct {
+	name, help string
+	labels     []string
+	fn         func() map[string]float64
+}
+
+// NewGaugeFunc 创建并注册无标签仪表
+func NewGaugeFunc(name, help string, fn func() float64) {
+	registerMetric(&GaugeVecFunc{name: name, help: help, fn: func() map[string]float64 {
+		return map[string]float64{"": fn()}
+	}})
+}
+
+// NewGaugeVecFunc 创建并注册带标签仪表
+func NewGaugeVecFunc(name, help string, fn func() map[string]float64, labels ...string) {
+	registerMetric(&GaugeVecFunc{name: name, help: help, labels: labels, fn: fn})
+}
+
+func (g *GaugeVecFunc) write(b *strings.Builder) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+	writeSamples(b, g.name, g.labels, g.fn())
+}
+
+// Histogram 无标签直方图
+type Histogram struct {
+	name, help string
+	buckets    []float64 // 升序的上界
+	mu         sync.Mutex
+	counts     []uint64 // 落入各区间（非累计）的次数，最后一项为 +Inf
+	sum        float64
+	count      uint64
+}
+
+// NewHistogram 创建并注册直方图
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	h := &Histogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets)+1)}
+	registerMetric(h)
+	return h
+}
+
+// Observe 记录一个观测值
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.mu.Lock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+	h.mu.Unlock()
+}
+
+func (h *Histogram) write(b *strings.Builder) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var cumulative uint64
+	for i, le := range h.buckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(b, "%s_bucket{le=%q} %d\n", h.name, formatMetricValue(le), cumulative)
+	}
+	fmt.Fprintf(b, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(b, "%s_sum %s\n%s_count %d\n", h.name, formatMetricValue(h.sum), h.name, h.count)
+}
+
+func writeSamples(b *strings.Builder, name string, labels []string, values map[string]float64) {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteString(name)
+		if len(labels) > 0 {
+			b.WriteByte('{')
+			for i, v := range strings.Split(k, "\x00") {
+				if i >= len(labels) {
+					break
+				}
+				if i > 0 {
+					b.WriteByte(',')
+				}
+				fmt.Fprintf(b, "%s=%q", labels[i], v)
+			}
+			b.WriteByte('}')
+		}
+		fmt.Fprintf(b, " %s\n", formatMetricValue(values[k]))
+	}
+}
+
+func formatMetricValue(v float64) string {
+	if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+		return fmt.Sprintf("%d", int64(v))
+	}
+	return fmt.Sprintf("%g", v)
+}
+
+// MetricsHandler 输出全部指标
+func MetricsHandler(c *gin.Context) {
+	var b strings.Builder
+	metricsMutex.RLock()
+	for _, m := range metricsList {
+		m.write(&b)
+	}
+	metricsMutex.RUnlock()
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
+
+var (
+	httpRequestsTotal = NewCounterVec("snapcast_http_requests_total", "HTTP requests by route and status code.", "route", "status")
+	rendersTotal      = NewCounterVec("snapcast_renders_total", "Completed render pipeline runs by result.", "result")
+	processStart      = time.Now()
+)
+
+func init() {
+	NewGaugeFunc("snapcast_uptime_seconds", "Seconds since the process started.", func() float64 {
+		return time.Since(processStart).Seconds()
+	})
+	NewGaugeFunc("snapcast_renders_in_flight", "Number of renders currently holding a concurrency slot.", func() float64 {
+		concurrentMutex.Lock()
+		defer concurrentMutex.Unlock()
+		return float64(currentConcurrent)
+	})
+}
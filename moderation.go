@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 内容审核 ======
+//
+// 投递前检查 data 中的文本（以及可选的渲染图片），命中本地关键词或审核接口判定违规时，
+// 按 moderation.action 阻止投递（block）或照常投递并在回执中标记（flag）。
+// 仅在请求指定 deliver 时生效，直接返回给调用方的渲染结果不受影响。
+
+// 审核动作
+const (
+	ModerationBlock = "block"
+	ModerationFlag  = "flag"
+)
+
+var moderationTotal = NewCounterVec("snapcast_moderation_total", "Moderation checks before delivery by result.", "result")
+
+// ModerationVerdict 审核结果
+type ModerationVerdict struct {
+	Flagged bool     `json:"flagged"`
+	Blocked bool     `json:"blocked"`
+	Reason  string   `json:"reason,omitempty"`
+	Matches []string `json:"matches,omitempty"` // 命中的本地关键词
+}
+
+type moderationSettings struct {
+	enabled   bool
+	action    string
+	fields    []string
+	keywords  []string         // 已转为小写
+	patterns  []*regexp.Regexp // /.../ 形式的规则
+	apiURL    string
+	apiToken  string
+	sendImage bool
+	failOpen  bool
+	client    *http.Client
+}
+
+var moderation atomic.Pointer[moderationSettings]
+
+// ConfigureModeration 按配置编译审核规则，由 ApplyDynamicConfig 调用
+func ConfigureModeration() {
+	s := &moderationSettings{
+		enabled:   viper.GetBool("moderation.enabled"),
+		action:    strings.ToLower(viper.GetString("moderation.action")),
+		fields:    viper.GetStringSlice("moderation.fields"),
+		apiURL:    viper.GetString("moderation.api.url"),
+		apiToken:  viper.GetString("moderation.api.token"),
+		sendImage: viper.GetBool("moderation.api.send_image"),
+		failOpen:  !viper.IsSet("moderation.api.fail_open") || viper.GetBool("moderation.api.fail_open"),
+	}
+	if s.action != ModerationBlock && s.action != ModerationFlag {
+		if s.action != "" {
+			logger.Warn("❗ moderation.action 无效", zap.String("action", s.action), zap.String("default", ModerationBlock))
+		}
+		s.action = ModerationBlock
+	}
+	for _, kw := range viper.GetStringSlice("moderation.keywords") {
+		if len(kw) > 2 && strings.HasPrefix(kw, "/") && strings.HasSuffix(kw, "/") {
+			re, err := regexp.Compile("(?i)" + kw[1:len(kw)-1])
+			if err != nil {
+				logger.Warn("❗ 审核规则无效，已忽略", zap.String("rule", kw), zap.Error(err))
+				continue
+			}
+			s.patterns = append(s.patterns, re)
+		} else if kw != "" {
+			s.keywords = append(s.keywords, strings.ToLower(kw))
+		}
+	}
+	timeout, _ := ParseDuration(viper.Get("moderation.api.timeout"))
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	s.client = &http.Client{Timeout: timeout}
+	moderation.Store(s)
+}
+
+// moderate 审核一次投递，未启用时返回 nil
+func moderate(ctx context.Context, payload *PushPayload, result *RenderResult) *ModerationVerdict {
+	s := moderation.Load()
+	if s == nil || !s.enabled {
+		return nil
+	}
+	log := loggerFor(ctx)
+	texts := moderationTexts(payload.Data, s.fields)
+
+	verdict := &ModerationVerdict{}
+	for _, text := range texts {
+		lower := strings.ToLower(text)
+		for _, kw := range s.keywords {
+			if strings.Contains(lower, kw) {
+				verdict.Matches = append(verdict.Matches, kw)
+			}
+		}
+		for _, re := range s.patterns {
+			if m := re.FindString(text); m != "" {
+				verdict.Matches = append(verdict.Matches, m)
+			}
+		}
+	}
+	if len(verdict.Matches) > 0 {
+		verdict.Flagged = true
+		verdict.Reason = "keyword"
+	} else if s.apiURL != "" {
+		flagged, reason, err := s.callAPI(ctx, payload, result, texts)
+		if err != nil {
+			moderationTotal.Inc("error")
+			log.Warn("⚠️ 审核接口调用失败", zap.Error(err), zap.Bool("fail_open", s.failOpen))
+			if s.failOpen {
+				return verdict
+			}
+			flagged, reason = true, "moderation api unavailable"
+		}
+		verdict.Flagged, verdict.Reason = flagged, reason
+	}
+
+	switch {
+	case !verdict.Flagged:
+		moderationTotal.Inc("pass")
+	case s.action == ModerationBlock:
+		verdict.Blocked = true
+		moderationTotal.Inc("blocked")
+		log.Warn("🚫 内容审核未通过，已阻止投递", zap.String("site", payload.Site), zap.String("type", payload.Type), zap.String("reason", verdict.Reason), zap.Strings("matches", verdict.Matches))
+	default:
+		moderationTotal.Inc("flagged")
+		log.Warn("🚩 内容审核标记", zap.String("site", payload.Site), zap.String("type", payload.Type), zap.String("reason", verdict.Reason), zap.Strings("matches", verdict.Matches))
+	}
+	return verdict
+}
+
+// moderationTexts 收集 data 中的字符串；fields 非空时仅收集指定的顶层字段（支持 a.b 路径）
+func moderationTexts(data any, fields []string) []string {
+	var texts []string
+	var walk func(v any)
+	walk = func(v any) {
+		switch val := v.(type) {
+		case string:
+			if val != "" {
+				texts = append(texts, val)
+			}
+		case map[string]any:
+			keys := make([]string, 0, len(val))
+			for k := range val {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				walk(val[k])
+			}
+		case []any:
+			for _, item := range val {
+				walk(item)
+			}
+		}
+	}
+	if len(fields) == 0 {
+		walk(data)
+		return texts
+	}
+	for _, field := range fields {
+		v := data
+		for _, part := range strings.Split(field, ".") {
+			m, isMap := v.(map[string]any)
+			if !isMap {
+				v = nil
+				break
+			}
+			v = m[part]
+		}
+		walk(v)
+	}
+	return texts
+}
+
+type moderationRequest struct {
+	Site        string   `json:"site"`
+	Type        string   `json:"type"`
+	Texts       []string `json:"texts"`
+	Image       string   `json:"image,omitempty"` // base64
+	ContentType string   `json:"content_type,omitempty"`
+}
+
+type moderationResponse struct {
+	Flagged bool   `json:"flagged"`
+	Reason  string `json:"reason"`
+}
+
+// callAPI 调用外部审核接口：POST {site, type, texts, image}，返回 {flagged, reason}
+func (s *moderationSettings) callAPI(ctx context.Context, payload *PushPayload, result *RenderResult, texts []string) (bool, string, error) {
+	body := moderationRequest{Site: payload.Site, Type: payload.Type, Texts: texts}
+	if s.sendImage && strings.HasPrefix(result.ContentType, "image/") {
+		body.Image = base64.StdEncoding.EncodeToString(result.Body)
+		body.ContentType = result.ContentType
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return false, "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.apiURL, bytes.NewReader(b))
+	if err != nil {
+		return false, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.apiToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiToken)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return false, "", fmt.Errorf("moderation api returned %s", resp.Status)
+	}
+	var out moderationResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&out); err != nil {
+		return false, "", fmt.Errorf("invalid moderation api response: %w", err)
+	}
+	if out.Flagged && out.Reason == "" {
+		out.Reason = "moderation api"
+	}
+	return out.Flagged, out.Reason, nil
+}
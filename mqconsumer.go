@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ====== 消息队列消费 ======
+//
+// 内置的 redis、nats Source 从消息队列中读取渲染任务，结果写回结果队列。多个 SnapCast 实例
+// 消费同一个队列即可水平扩展，调用方无需知道有多少渲染节点，也不需要开放 HTTP 端口：
+//
+//	sources:
+//	  jobs:
+//	    type: redis                    # 或 nats，见 mqredis.go、mqnats.go
+//	    concurrency: 4                 # 同时处理的任务数，默认 1；仍受 render.max_concurrency 限制
+//
+// 任务为 JSON，字段与 /render 请求相同，另有 id（原样带回结果，并作为请求 ID）与 reply_to（单独的结果队列）：
+//
+//	{"id": "job-1", "site": "bilibili", "type": "live", "data": {...}, "response": "url", "reply_to": "bot:results"}
+//
+// 结果同样为 JSON：
+//
+//	{"id": "job-1", "status": "ok", "template": "...", "content_type": "image/png", "body": "<base64>",
+//	 "duration_ms": 812}
+//	{"id": "job-1", "status": "ok", "url": "https://.../a.png", ...}        # "response": "url"
+//	{"id": "job-1", "status": "ok", "deliveries": [...]}                   # 指定了 deliver
+//	{"id": "job-1", "status": "error", "code": 422, "error": "..."}
+//
+// 无法解析的任务同样返回 error 结果（id 为空时只记录日志）。任务取出后即视为已消费，
+// 渲染失败不会放回队列，由调用方按结果决定是否重新提交。
+
+var mqJobsTotal = NewCounterVec("snapcast_mq_jobs_total", "Render jobs consumed from message queues by source and result.", "source", "result")
+
+// mqJob 队列中的渲染任务
+type mqJob struct {
+	PushPayload
+	ID      string `json:"id"`
+	ReplyTo string `json:"reply_to"`
+}
+
+// jobResult 写回队列的渲染结果，WebSocket 接口同样使用
+type jobResult struct {
+	ID          string `json:"id,omitempty"`
+	Status      string `json:"status"`
+	Code        int    `json:"code,omitempty"`
+	Error       string `json:"error,omitempty"`
+	Template    string `json:"template,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"` // base64
+	URL         string `json:"url,omitempty"`
+	Alt         string `json:"alt,omitempty"`
+	DeliveryID  string `json:"delivery_id,omitempty"`
+	Deliveries  any    `json:"deliveries,omitempty"`
+	JSON        any    `json:"json,omitempty"` // output 为 json 时的数据
+	DurationMs  int64  `json:"duration_ms"`
+}
+
+// processMQJob 解析并渲染一个任务，返回结果与任务指定的 reply_to
+func processMQJob(ctx context.Context, source string, msg []byte) (*jobResult, string) {
+	start := time.Now()
+	var job mqJob
+	if err := json.Unmarshal(msg, &job); err != nil {
+		mqJobsTotal.Inc(source, "invalid")
+		return &jobResult{Status: "error", Code: http.StatusBadRequest, Error: "invalid job: " + err.Error()}, ""
+	}
+	res, err := renderMQJob(ctx, &job)
+	if res == nil {
+		res = &jobResult{}
+	}
+	res.ID = job.ID
+	res.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		mqJobsTotal.Inc(source, "error")
+		res.Status, res.Code, res.Error = "error", renderErrorStatus(err), err.Error()
+		loggerFor(ctx).Warn("⚠️ 队列任务渲染失败", zap.String("source", source), zap.String("job", job.ID), zap.String("site", job.Site), zap.String("type", job.Type), zap.Error(err))
+		return res, job.ReplyTo
+	}
+	mqJobsTotal.Inc(source, "ok")
+	res.Status = "ok"
+	return res, job.ReplyTo
+}
+
+func renderMQJob(ctx context.Context, job *mqJob) (*jobResult, error) {
+	id := job.ID
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	ctx = withRequestID(ctx, id)
+	payload := &job.PushPayload
+	if payload.Site == "" || payload.Type == "" {
+		return nil, newRenderError(http.StatusBadRequest, errors.New("site and type are required"))
+	}
+
+	// 任务已从队列取出，排队已满或过载时等待而不是直接失败
+	release, _, err := acquireRenderSlot(ctx, payload.Site, payload.Priority)
+	for errors.Is(err, errRenderBusy) || errors.Is(err, errOverloaded) {
+		if !sleepContext(ctx, time.Second) {
+			break
+		}
+		release, _, err = acquireRenderSlot(ctx, payload.Site, payload.Priority)
+	}
+	if err != nil {
+		return nil, newRenderError(http.StatusServiceUnavailable, err)
+	}
+	defer release()
+	return renderJobResult(ctx, payload)
+}
+
+// renderJobResult 渲染并按 deliver、output、response 整理结果，调用方需已获取渲染许可
+func renderJobResult(ctx context.Context, payload *PushPayload) (*jobResult, error) {
+	result, err := renderPayload(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &jobResult{Template: result.Template, Alt: result.Alt}
+	switch {
+	case len(payload.Deliver) > 0:
+		res.DeliveryID, res.Deliveries = result.DeliveryID, result.Receipts
+	case payload.Output == "json":
+		res.JSON = result.JSON
+	case payload.Response == ResponseURL:
+		obj, err := storeResult(ctx, payload, result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store result: %w", err)
+		}
+		res.URL, res.ContentType = obj.URL, result.ContentType
+	default:
+		res.ContentType, res.Body = result.ContentType, result.Body
+	}
+	return res, nil
+}
+
+// mqBackoff 连接失败后的重连间隔，1s 起倍增至 30s
+func mqBackoff(failures int) time.Duration {
+	d := time.Second << min(failures, 5)
+	return min(d, 30*time.Second)
+}
+
+// sleepContext 等待 d，ctx 取消时提前返回 false
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"SnapCast/extension"
+)
+
+// ====== NATS 任务队列 ======
+//
+// 内置的 nats Source 以队列组订阅主题，同一组内每条任务只投给一个实例；结果发布到请求的回复主题
+// （request/reply）、任务的 reply_to 或配置的 results 主题：
+//
+//	sources:
+//	  jobs:
+//	    type: nats
+//	    url: "nats://127.0.0.1:4222"
+//	    subject: "snapcast.render"
+//	    queue_group: "snapcast"        # 默认 snapcast
+//	    results: "snapcast.results"    # 没有回复主题时使用，可选
+//	    token: ""                      # 或 user + password
+//	    concurrency: 4
+//
+// 提交任务：nats request snapcast.render '{"id": "job-1", "site": "bilibili", "type": "live", "data": {...}}'
+//
+// NATS 单条消息默认上限 1MB（服务端 max_payload），图片超出时返回错误结果，建议任务使用 "response": "url"。
+// 只实现了核心协议中用到的部分，不依赖 NATS 客户端库，暂不支持 TLS 与 JetStream。
+
+func init() {
+	extension.RegisterSource("nats", newNATSSource)
+}
+
+// natsSourceConfig sources.<name> 中 nats 的配置
+type natsSourceConfig struct {
+	URL         string `mapstructure:"url"`
+	Subject     string `mapstructure:"subject"`
+	QueueGroup  string `mapstructure:"queue_group"`
+	Results     string `mapstructure:"results"`
+	Token       string `mapstructure:"token"`
+	User        string `mapstructure:"user"`
+	Password    string `mapstructure:"password"`
+	Concurrency int    `mapstructure:"concurrency"`
+}
+
+type natsSource struct {
+	name   string
+	cfg    natsSourceConfig
+	addr   string
+	log    *zap.Logger
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newNATSSource(opts extension.SourceOptions) (extension.Source, error) {
+	var cfg natsSourceConfig
+	if err := viper.UnmarshalKey("sources."+opts.Name, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.URL == "" {
+		cfg.URL = "nats://127.0.0.1:4222"
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Scheme != "nats" || u.Host == "" {
+		return nil, fmt.Errorf("url must be a nats:// URL, got %q", cfg.URL)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	if u.User != nil && cfg.User == "" && cfg.Token == "" {
+		if p, hasPassword := u.User.Password(); hasPassword {
+			cfg.User, cfg.Password = u.User.Username(), p
+		} else {
+			cfg.Token = u.User.Username()
+		}
+	}
+	if cfg.Subject == "" {
+		return nil, errors.New("subject is required")
+	}
+	if cfg.QueueGroup == "" {
+		cfg.QueueGroup = "snapcast"
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	return &natsSource{name: opts.Name, cfg: cfg, addr: addr, log: opts.Logger}, nil
+}
+
+func (s *natsSource) Start(ctx context.Context) error {
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.run(ctx)
+	}()
+	s.log.Info("📥 开始消费 NATS 主题", zap.String("addr", s.addr), zap.String("subject", s.cfg.Subject), zap.String("queue_group", s.cfg.QueueGroup), zap.Int("concurrency", s.cfg.Concurrency))
+	return nil
+}
+
+func (s *natsSource) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run 维持连接，断开时按退避重连
+func (s *natsSource) run(ctx context.Context) {
+	failures := 0
+	for ctx.Err() == nil {
+		conn, err := s.dial(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				s.log.Warn("⚠️ NATS 连接失败", zap.String("addr", s.addr), zap.Error(err))
+			}
+			if !sleepContext(ctx, mqBackoff(failures)) {
+				return
+			}
+			failures++
+			continue
+		}
+		failures = 0
+		err = s.consume(ctx, conn)
+		conn.Close()
+		if err != nil && ctx.Err() == nil {
+			s.log.Warn("⚠️ NATS 连接中断，稍后重连", zap.Error(err))
+			if !sleepContext(ctx, mqBackoff(0)) {
+				return
+			}
+		}
+	}
+}
+
+// natsMsg 收到的任务消息
+type natsMsg struct {
+	reply string
+	data  []byte
+}
+
+// consume 读取消息交给 concurrency 个 worker 处理，连接断开后等待处理中的任务写回结果
+func (s *natsSource) consume(ctx context.Context, conn *natsConn) error {
+	// 只有空闲 worker 时才读下一条消息，其余任务留在 NATS 中交给组内其他实例
+	msgs := make(chan natsMsg)
+	var workers sync.WaitGroup
+	for i := 0; i < s.cfg.Concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for m := range msgs {
+				res, replyTo := processMQJob(context.WithoutCancel(ctx), s.name, m.data)
+				s.publish(conn, res, m.reply, replyTo)
+			}
+		}()
+	}
+	defer workers.Wait()
+	defer close(msgs)
+
+	// 停止时退订并打断读取，连接保留到处理中的任务写回结果
+	stop := context.AfterFunc(ctx, func() {
+		conn.write("UNSUB 1\r\n")
+		conn.conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+	if err := conn.subscribe(s.cfg.Subject, s.cfg.QueueGroup); err != nil {
+		return err
+	}
+	for {
+		m, err := conn.next()
+		if err != nil {
+			return err
+		}
+		select {
+		case msgs <- m:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// publish 发布结果：优先回复主题，其次任务的 reply_to，最后为 results
+func (s *natsSource) publish(conn *natsConn, res *jobResult, reply, replyTo string) {
+	subject := firstNonEmpty(reply, replyTo, s.cfg.Results)
+	if subject == "" {
+		s.log.Warn("❕ 队列任务没有结果主题，结果已丢弃", zap.String("job", res.ID), zap.String("status", res.Status))
+		return
+	}
+	b, err := json.Marshal(res)
+	if err == nil && conn.maxPayload > 0 && int64(len(b)) > conn.maxPayload {
+		b, err = json.Marshal(&jobResult{
+			ID: res.ID, Status: "error", Code: http.StatusRequestEntityTooLarge, DurationMs: res.DurationMs,
+			Error: fmt.Sprintf("result is %s, exceeds NATS max_payload %s; use \"response\": \"url\"", formatBytes(len(b)), formatBytes(int(conn.maxPayload))),
+		})
+	}
+	if err == nil {
+		err = conn.pub(subject, b)
+	}
+	if err != nil {
+		s.log.Warn("⚠️ NATS 结果发布失败", zap.String("job", res.ID), zap.String("subject", subject), zap.Error(err))
+	}
+}
+
+func (s *natsSource) dial(ctx context.Context) (*natsConn, error) {
+	d := net.Dialer{Timeout: 10 * time.Second}
+	nc, err := d.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, err
+	}
+	conn := &natsConn{conn: nc, r: bufio.NewReader(nc), log: s.log}
+	nc.SetDeadline(time.Now().Add(10 * time.Second))
+	if err := conn.handshake(s.cfg); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	nc.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// ---------- 协议 ----------
+
+// natsConn 最小的 NATS 连接：读取由 consume 独占，写入加锁
+type natsConn struct {
+	conn       net.Conn
+	r          *bufio.Reader
+	mu         sync.Mutex
+	maxPayload int64
+	log        *zap.Logger
+}
+
+func (c *natsConn) Close() error { return c.conn.Close() }
+
+func (c *natsConn) write(s string, payload ...[]byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := io.WriteString(c.conn, s); err != nil {
+		return err
+	}
+	for _, p := range payload {
+		if _, err := c.conn.Write(p); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(c.conn, "\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handshake 读取 INFO，发送 CONNECT 并以 PING/PONG 确认认证通过
+func (c *natsConn) handshake(cfg natsSourceConfig) error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	op, args, _ := strings.Cut(line, " ")
+	if !strings.EqualFold(op, "INFO") {
+		return fmt.Errorf("nats: unexpected greeting %q", line)
+	}
+	var info struct {
+		MaxPayload  int64 `json:"max_payload"`
+		TLSRequired bool  `json:"tls_required"`
+	}
+	if err := json.Unmarshal([]byte(args), &info); err != nil {
+		return fmt.Errorf("nats: invalid INFO: %w", err)
+	}
+	if info.TLSRequired {
+		return errors.New("nats: server requires TLS, which is not supported")
+	}
+	c.maxPayload = info.MaxPayload
+
+	connect := map[string]any{"verbose": false, "pedantic": false, "name": "SnapCast", "lang": "go", "version": "1", "protocol": 1}
+	if cfg.Token != "" {
+		connect["auth_token"] = cfg.Token
+	}
+	if cfg.User != "" {
+		connect["user"], connect["pass"] = cfg.User, cfg.Password
+	}
+	b, _ := json.Marshal(connect)
+	if err := c.write("CONNECT " + string(b) + "\r\nPING\r\n"); err != nil {
+		return err
+	}
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		switch op, args, _ := strings.Cut(line, " "); strings.ToUpper(op) {
+		case "PONG":
+			return nil
+		case "-ERR":
+			return fmt.Errorf("nats: %s", strings.Trim(args, "'"))
+		}
+	}
+}
+
+func (c *natsConn) subscribe(subject, group string) error {
+	return c.write(fmt.Sprintf("SUB %s %s 1\r\n", subject, group))
+}
+
+func (c *natsConn) pub(subject string, data []byte) error {
+	return c.write(fmt.Sprintf("PUB %s %d\r\n", subject, len(data)), data)
+}
+
+// next 读取下一条 MSG，途中应答 PING
+func (c *natsConn) next() (natsMsg, error) {
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return natsMsg{}, err
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "PING":
+			if err := c.write("PONG\r\n"); err != nil {
+				return natsMsg{}, err
+			}
+		case "-ERR":
+			// 权限等错误不会断开连接，只记录；服务端主动断开时由读取错误结束
+			c.log.Warn("⚠️ NATS 服务端错误", zap.String("error", strings.TrimPrefix(line, "-ERR ")))
+		case "MSG":
+			// MSG <subject> <sid> [reply-to] <#bytes>
+			if len(fields) != 4 && len(fields) != 5 {
+				return natsMsg{}, fmt.Errorf("nats: invalid MSG %q", line)
+			}
+			n, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil || n < 0 {
+				return natsMsg{}, fmt.Errorf("nats: invalid MSG %q", line)
+			}
+			data := make([]byte, n+2)
+			if _, err := io.ReadFull(c.r, data); err != nil {
+				return natsMsg{}, err
+			}
+			m := natsMsg{data: data[:n]}
+			if len(fields) == 5 {
+				m.reply = fields[3]
+			}
+			return m, nil
+		}
+	}
+}
+
+func (c *natsConn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"SnapCast/extension"
+)
+
+// ====== Redis 任务队列 ======
+//
+// 内置的 redis Source 以 BLPOP 从列表中取任务，结果 RPUSH 到结果列表（任务指定 reply_to 时写入该列表）。
+// 列表中的每个任务只会被一个消费者取走，多个实例消费同一列表即可分摊负载：
+//
+//	sources:
+//	  jobs:
+//	    type: redis
+//	    addr: "127.0.0.1:6379"
+//	    username: ""                   # Redis 6 ACL 用户，可选
+//	    password: ""
+//	    db: 0
+//	    tls: false
+//	    queue: "snapcast:jobs"         # 任务列表
+//	    results: "snapcast:results"    # 结果列表，为空时只写入任务的 reply_to
+//	    result_ttl: 1h                 # 结果列表的过期时间，0 为不过期
+//	    concurrency: 4
+//
+// 提交任务：RPUSH snapcast:jobs '{"id": "job-1", "site": "bilibili", "type": "live", "data": {...}}'
+// 等待结果：BLPOP snapcast:results 0（或任务中的 reply_to）
+//
+// 只实现了 RESP2 中用到的命令，不依赖 Redis 客户端库。
+
+const redisPopTimeout = 5 // BLPOP 超时（秒），用于及时响应 Stop
+
+func init() {
+	extension.RegisterSource("redis", newRedisSource)
+}
+
+// redisSourceConfig sources.<name> 中 redis 的配置
+type redisSourceConfig struct {
+	Addr        string `mapstructure:"addr"`
+	Username    string `mapstructure:"username"`
+	Password    string `mapstructure:"password"`
+	DB          int    `mapstructure:"db"`
+	TLS         bool   `mapstructure:"tls"`
+	Queue       string `mapstructure:"queue"`
+	Results     string `mapstructure:"results"`
+	ResultTTL   any    `mapstructure:"result_ttl"`
+	Concurrency int    `mapstructure:"concurrency"`
+}
+
+type redisSource struct {
+	name      string
+	cfg       redisSourceConfig
+	resultTTL time.Duration
+	log       *zap.Logger
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+func newRedisSource(opts extension.SourceOptions) (extension.Source, error) {
+	var cfg redisSourceConfig
+	if err := viper.UnmarshalKey("sources."+opts.Name, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Addr == "" {
+		cfg.Addr = "127.0.0.1:6379"
+	}
+	if cfg.Queue == "" {
+		cfg.Queue = "snapcast:jobs"
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+	s := &redisSource{name: opts.Name, cfg: cfg, log: opts.Logger}
+	if cfg.ResultTTL != nil {
+		d, err := ParseDuration(cfg.ResultTTL)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid result_ttl %v", cfg.ResultTTL)
+		}
+		s.resultTTL = d
+	}
+	return s, nil
+}
+
+func (s *redisSource) Start(ctx context.Context) error {
+	ctx, s.cancel = context.WithCancel(ctx)
+	for i := 0; i < s.cfg.Concurrency; i++ {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.worker(ctx)
+		}()
+	}
+	s.log.Info("📥 开始消费 Redis 队列", zap.String("addr", s.cfg.Addr), zap.String("queue", s.cfg.Queue), zap.Int("concurrency", s.cfg.Concurrency))
+	return nil
+}
+
+func (s *redisSource) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// worker 独占一个连接循环取任务，连接出错时按退避重连
+func (s *redisSource) worker(ctx context.Context) {
+	failures := 0
+	for ctx.Err() == nil {
+		conn, err := s.dial(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				s.log.Warn("⚠️ Redis 连接失败", zap.String("addr", s.cfg.Addr), zap.Error(err))
+			}
+			if !sleepContext(ctx, mqBackoff(failures)) {
+				return
+			}
+			failures++
+			continue
+		}
+		failures = 0
+		err = s.consume(ctx, conn)
+		conn.Close()
+		if err != nil && ctx.Err() == nil {
+			s.log.Warn("⚠️ Redis 连接中断，稍后重连", zap.Error(err))
+			if !sleepContext(ctx, mqBackoff(0)) {
+				return
+			}
+		}
+	}
+}
+
+func (s *redisSource) consume(ctx context.Context, conn *redisConn) error {
+	for ctx.Err() == nil {
+		// 等待任务时 ctx 取消则关闭连接，打断阻塞中的 BLPOP；已取出的任务仍会写回结果
+		stop := context.AfterFunc(ctx, func() { conn.Close() })
+		reply, err := conn.Do("BLPOP", s.cfg.Queue, strconv.Itoa(redisPopTimeout))
+		stop()
+		if err != nil {
+			return err
+		}
+		items, _ := reply.([]any)
+		if len(items) != 2 {
+			continue // 超时
+		}
+		msg, _ := items[1].(string)
+		// 渲染不受 Stop 打断，已取出的任务完成后再退出
+		res, replyTo := processMQJob(context.WithoutCancel(ctx), s.name, []byte(msg))
+		if err := s.publish(conn, res, replyTo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publish 将结果写入 results 与 reply_to
+func (s *redisSource) publish(conn *redisConn, res *jobResult, replyTo string) error {
+	b, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, 2)
+	if s.cfg.Results != "" {
+		keys = append(keys, s.cfg.Results)
+	}
+	if replyTo != "" && replyTo != s.cfg.Results {
+		keys = append(keys, replyTo)
+	}
+	if len(keys) == 0 {
+		s.log.Warn("❕ 队列任务没有结果队列，结果已丢弃", zap.String("job", res.ID), zap.String("status", res.Status))
+		return nil
+	}
+	for _, key := range keys {
+		if _, err := conn.Do("RPUSH", key, string(b)); err != nil {
+			return err
+		}
+		if s.resultTTL > 0 {
+			if _, err := conn.Do("PEXPIRE", key, strconv.FormatInt(s.resultTTL.Milliseconds(), 10)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *redisSource) dial(ctx context.Context) (*redisConn, error) {
+	d := net.Dialer{Timeout: 10 * time.Second}
+	var nc net.Conn
+	var err error
+	if s.cfg.TLS {
+		host, _, _ := net.SplitHostPort(s.cfg.Addr)
+		nc, err = (&tls.Dialer{NetDialer: &d, Config: &tls.Config{ServerName: host}}).DialContext(ctx, "tcp", s.cfg.Addr)
+	} else {
+		nc, err = d.DialContext(ctx, "tcp", s.cfg.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{conn: nc, r: bufio.NewReader(nc)}
+	if s.cfg.Password != "" {
+		args := []string{"AUTH", s.cfg.Password}
+		if s.cfg.Username != "" {
+			args = []string{"AUTH", s.cfg.Username, s.cfg.Password}
+		}
+		if _, err := conn.Do(args...); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("auth: %w", err)
+		}
+	}
+	if s.cfg.DB != 0 {
+		if _, err := conn.Do("SELECT", strconv.Itoa(s.cfg.DB)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("select db: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// ---------- RESP2 ----------
+
+// redisConn 最小的 Redis 连接，只用于顺序执行命令
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// redisError 服务端返回的错误（-ERR ...）
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+func (c *redisConn) Close() error { return c.conn.Close() }
+
+// Do 发送命令并读取回复：简单字符串与批量字符串为 string，整数为 int64，数组为 []any，空值为 nil
+func (c *redisConn) Do(args ...string) (any, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return nil, err
+	}
+	reply, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+	if e, isError := reply.(redisError); isError {
+		return nil, e
+	}
+	return reply, nil
+}
+
+func (c *redisConn) read() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return redisError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// ====== 存储对象名与元数据 ======
+//
+// 保存渲染结果时，对象名与元数据由模板生成，便于下游按站点、日期等组织与检索：
+//
+//	storage:
+//	  key: "{{.Site}}/{{.Type}}/{{date}}/{{hash}}{{.Ext}}"
+//	  metadata:
+//	    uid: "{{.Data.uid}}"
+//
+// 模板附属配置（.meta.yaml）中的 storage 覆盖全局配置，metadata 按名称合并。
+// 除模板函数外可用 date [layout]（默认 2006-01-02）、hash（内容 SHA-256 前 16 位）、id（随机）。
+
+const defaultObjectKey = "{{id}}{{.Ext}}"
+
+var metadataNameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// StorageMeta 模板附属配置中的存储设置
+type StorageMeta struct {
+	Key      string            `yaml:"key"`
+	Metadata map[string]string `yaml:"metadata"`
+}
+
+// objectKeyData 对象名与元数据模板的数据
+type objectKeyData struct {
+	Site   string
+	Type   string
+	Theme  string
+	Output string
+	Ext    string // 含点，如 .png
+	Data   any
+}
+
+var objectTemplates sync.Map // 模板源码 → *template.Template
+
+// parseObjectTemplate 解析并缓存对象名模板，date/hash/id 在执行时按结果替换
+func parseObjectTemplate(src string) (*template.Template, error) {
+	if t, cached := objectTemplates.Load(src); cached {
+		return t.(*template.Template), nil
+	}
+	funcs := maps.Clone(funcsList)
+	funcs["date"] = func(...string) string { return "" }
+	funcs["hash"] = func() string { return "" }
+	funcs["id"] = func() string { return "" }
+	t, err := template.New("storage").Option("missingkey=zero").Funcs(funcs).Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	objectTemplates.Store(src, t)
+	return t, nil
+}
+
+// objectNamer 为一次保存生成对象名与元数据
+type objectNamer struct {
+	data objectKeyData
+	now  time.Time
+	hash string
+	id   string
+}
+
+func newObjectNamer(payload *PushPayload, contentType string, body []byte) *objectNamer {
+	sum := sha256.Sum256(body)
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return &objectNamer{
+		data: objectKeyData{
+			Site:   payload.Site,
+			Type:   payload.Type,
+			Theme:  payload.Theme,
+			Output: payload.Output,
+			Ext:    contentTypeExt[contentType],
+			Data:   payload.Data,
+		},
+		now:  time.Now(),
+		hash: hex.EncodeToString(sum[:8]),
+		id:   hex.EncodeToString(b),
+	}
+}
+
+func (n *objectNamer) execute(src string) (string, error) {
+	t, err := parseObjectTemplate(src)
+	if err != nil {
+		return "", err
+	}
+	t, err = t.Clone()
+	if err != nil {
+		return "", err
+	}
+	t.Funcs(template.FuncMap{
+		"date": func(layout ...string) string {
+			if len(layout) > 0 {
+				return n.now.Format(layout[0])
+			}
+			return n.now.Format(time.DateOnly)
+		},
+		"hash": func() string { return n.hash },
+		"id":   func() string { return n.id },
+	})
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, n.data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.ReplaceAll(buf.String(), "<no value>", "")), nil
+}
+
+// Key 生成对象名，结果必须是不含 .. 的相对路径
+func (n *objectNamer) Key(src string) (string, error) {
+	if src == "" {
+		src = defaultObjectKey
+	}
+	key, err := n.execute(src)
+	if err != nil {
+		return "", fmt.Errorf("storage key: %w", err)
+	}
+	key = path.Clean(strings.TrimLeft(key, "/"))
+	if key == "." || key == ".." || strings.HasPrefix(key, "../") || strings.HasSuffix(key, ".meta.json") {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return key, nil
+}
+
+// Metadata 生成元数据，值为空的项忽略
+func (n *objectNamer) Metadata(srcs map[string]string) (map[string]string, error) {
+	if len(srcs) == 0 {
+		return nil, nil
+	}
+	out := make(map[string]string, len(srcs))
+	for name, src := range srcs {
+		value, err := n.execute(src)
+		if err != nil {
+			return nil, fmt.Errorf("storage metadata %s: %w", name, err)
+		}
+		if value != "" {
+			out[name] = value
+		}
+	}
+	return out, nil
+}
+
+// resolveStorageMeta 合并全局与模板的存储设置
+func resolveStorageMeta(meta *TemplateMeta) StorageMeta {
+	s := StorageMeta{
+		Key:      viper.GetString("storage.key"),
+		Metadata: viper.GetStringMapString("storage.metadata"),
+	}
+	if meta == nil {
+		return s
+	}
+	if meta.Storage.Key != "" {
+		s.Key = meta.Storage.Key
+	}
+	if len(meta.Storage.Metadata) > 0 {
+		merged := maps.Clone(s.Metadata)
+		if merged == nil {
+			merged = make(map[string]string)
+		}
+		maps.Copy(merged, meta.Storage.Metadata)
+		s.Metadata = merged
+	}
+	return s
+}
+
+// validate 检查对象名与元数据模板的语法
+func (s StorageMeta) validate() error {
+	if s.Key != "" {
+		if _, err := parseObjectTemplate(s.Key); err != nil {
+			return fmt.Errorf("storage key: %w", err)
+		}
+	}
+	for name, src := range s.Metadata {
+		if !metadataNameRegex.MatchString(name) {
+			return errors.New("invalid storage metadata name " + name + ": only letters, digits, '-' and '_' are allowed")
+		}
+		if _, err := parseObjectTemplate(src); err != nil {
+			return fmt.Errorf("storage metadata %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+//go:build !nodelivery
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"SnapCast/extension"
+)
+
+// ====== OneBot 投递 ======
+//
+// 内置的 onebot Sink 通过 OneBot HTTP API（go-cqhttp、LLOneBot、NapCat 等）把渲染结果直接发到 QQ 群或私聊，
+// 不再需要单独的转发服务：
+//
+//	sinks:
+//	  qq:
+//	    type: onebot
+//	    url: "http://127.0.0.1:5700"   # HTTP API 地址
+//	    access_token: ""               # 对应实现的 access_token
+//	    version: 11                    # 11（默认）或 12
+//	    caption: true                  # 将卡片的替代文本作为文字一起发送
+//	    timeout: 30s
+//
+// 请求中按 params 选择发送目标：
+//
+//	"deliver": [{"sink": "qq", "params": {"group_id": 123456}}]
+//	"deliver": [{"sink": "qq", "params": {"user_id": 10001, "text": "开播啦"}}]
+//	"deliver": [{"sink": "qq", "params": {"guild_id": "1", "channel_id": "2"}}]  # 仅 v12
+//
+// 多帧结果（options.frames、overflow split）在一条消息中发送全部图片。v11 以 base64:// 直接发送，
+// v12 先通过 upload_file 上传再按 file_id 发送。回执的 message_id 为实现返回的消息 ID。
+
+const defaultOneBotTimeout = 30 * time.Second
+
+func init() {
+	extension.RegisterSink("onebot", newOneBotSink)
+}
+
+// oneBotConfig sinks.<name> 中 onebot 的配置
+type oneBotConfig struct {
+	URL         string `mapstructure:"url"`
+	AccessToken string `mapstructure:"access_token"`
+	Version     int    `mapstructure:"version"`
+	Caption     bool   `mapstructure:"caption"`
+	Timeout     any    `mapstructure:"timeout"`
+}
+
+type oneBotSink struct {
+	cfg    oneBotConfig
+	client *http.Client
+}
+
+func newOneBotSink(opts extension.SinkOptions) (extension.Sink, error) {
+	var cfg oneBotConfig
+	if err := viper.UnmarshalKey("sinks."+opts.Name, &cfg); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(cfg.URL, "http://") && !strings.HasPrefix(cfg.URL, "https://") {
+		return nil, fmt.Errorf("url must be an http(s) URL, got %q", cfg.URL)
+	}
+	cfg.URL = strings.TrimSuffix(cfg.URL, "/")
+	switch cfg.Version {
+	case 0:
+		cfg.Version = 11
+	case 11, 12:
+	default:
+		return nil, fmt.Errorf("version must be 11 or 12, got %d", cfg.Version)
+	}
+	timeout := defaultOneBotTimeout
+	if cfg.Timeout != nil {
+		d, err := ParseDuration(cfg.Timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid timeout %v", cfg.Timeout)
+		}
+		timeout = d
+	}
+	return &oneBotSink{cfg: cfg, client: &http.Client{Timeout: timeout}}, nil
+}
+
+func (s *oneBotSink) Close() error { return nil }
+
+func (s *oneBotSink) Deliver(ctx context.Context, d *extension.Delivery) (*extension.Receipt, error) {
+	images, err := deliveryImages(d)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.target(d.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	var message []map[string]any
+	if text := paramString(d.Params, "text"); text != "" {
+		message = append(message, oneBotSegment("text", map[string]any{"text": text + "\n"}))
+	}
+	for _, img := range images {
+		if s.cfg.Version == 11 {
+			message = append(message, oneBotSegment("image", map[string]any{"file": "base64://" + base64.StdEncoding.EncodeToString(img.Body)}))
+			continue
+		}
+		var uploaded struct {
+			FileID string `json:"file_id"`
+		}
+		name := "snapcast" + contentTypeExt[img.ContentType]
+		if err := s.call(ctx, "upload_file", map[string]any{"type": "data", "name": name, "data": base64.StdEncoding.EncodeToString(img.Body)}, &uploaded); err != nil {
+			return nil, fmt.Errorf("upload image: %w", err)
+		}
+		message = append(message, oneBotSegment("image", map[string]any{"file_id": uploaded.FileID}))
+	}
+	if s.cfg.Caption && d.AltText != "" {
+		message = append(message, oneBotSegment("text", map[string]any{"text": "\n" + d.AltText}))
+	}
+	target["message"] = message
+
+	var sent struct {
+		MessageID any `json:"message_id"`
+	}
+	action := "send_msg"
+	if s.cfg.Version == 12 {
+		action = "send_message"
+	}
+	if err := s.call(ctx, action, target, &sent); err != nil {
+		return nil, err
+	}
+	return &extension.Receipt{MessageID: fmt.Sprint(sent.MessageID)}, nil
+}
+
+// target 由 params 生成发送目标：group_id 为群聊，user_id 为私聊，v12 另支持 guild_id + channel_id
+func (s *oneBotSink) target(params map[string]any) (map[string]any, error) {
+	group, user := paramString(params, "group_id"), paramString(params, "user_id")
+	guild, channel := paramString(params, "guild_id"), paramString(params, "channel_id")
+	if s.cfg.Version == 11 {
+		// v11 的 ID 为数字
+		typ, key, id := "group", "group_id", group
+		if id == "" {
+			typ, key, id = "private", "user_id", user
+		}
+		if id == "" {
+			return nil, errors.New("params.group_id or params.user_id is required")
+		}
+		n, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("params.%s must be a number, got %q", key, id)
+		}
+		return map[string]any{"message_type": typ, key: n}, nil
+	}
+	switch {
+	case group != "":
+		return map[string]any{"detail_type": "group", "group_id": group}, nil
+	case user != "":
+		return map[string]any{"detail_type": "private", "user_id": user}, nil
+	case guild != "" && channel != "":
+		return map[string]any{"detail_type": "channel", "guild_id": guild, "channel_id": channel}, nil
+	}
+	return nil, errors.New("params.group_id, params.user_id or params.guild_id with params.channel_id is required")
+}
+
+// call 调用 OneBot 动作，retcode 不为 0 时返回错误
+func (s *oneBotSink) call(ctx context.Context, action string, params map[string]any, out any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.URL+"/"+action, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.cfg.AccessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.cfg.AccessToken)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("onebot %s returned %s", action, resp.Status)
+	}
+	var res struct {
+		Status  string          `json:"status"`
+		Retcode int             `json:"retcode"`
+		Message string          `json:"message"`
+		Wording string          `json:"wording"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return fmt.Errorf("onebot %s: invalid response: %w", action, err)
+	}
+	if res.Retcode != 0 || res.Status == "failed" {
+		return fmt.Errorf("onebot %s failed: retcode %d %s", action, res.Retcode, firstNonEmpty(res.Message, res.Wording))
+	}
+	if out != nil && len(res.Data) > 0 && string(res.Data) != "null" {
+		return json.Unmarshal(res.Data, out)
+	}
+	return nil
+}
+
+func oneBotSegment(typ string, data map[string]any) map[string]any {
+	return map[string]any{"type": typ, "data": data}
+}
+
+// deliveryImages 投递的图片：多帧结果为全部帧，否则为 Body；非图片内容返回错误
+func deliveryImages(d *extension.Delivery) ([]extension.Frame, error) {
+	if len(d.Frames) > 0 {
+		return d.Frames, nil
+	}
+	if !strings.HasPrefix(d.ContentType, "image/") {
+		return nil, fmt.Errorf("cannot send %s as image", d.ContentType)
+	}
+	return []extension.Frame{{ContentType: d.ContentType, Body: d.Body}}, nil
+}
+
+// paramString 读取投递参数，数字转为不带小数点的字符串
+func paramString(params map[string]any, key string) string {
+	switch v := params[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
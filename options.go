@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/chromedp/cdproto/emulation"
+	"github.com/chromedp/chromedp"
+)
+
+// ====== 渲染参数 ======
+
+// 视口范围限制
+const (
+	minViewportSize  = 1
+	maxViewportSize  = 16384 // Chrome 单张纹理上限
+	minViewportScale = 0.1
+	maxViewportScale = 5.0
+)
+
+// prefers-color-scheme 取值
+const (
+	ColorSchemeLight = "light"
+	ColorSchemeDark  = "dark"
+)
+
+// RenderOptions 单次渲染的可调参数，请求中通过 options 字段传入，未设置的字段使用配置默认值
+type RenderOptions struct {
+	Quality   int              `json:"quality,omitempty"`    // 图片质量 1-100
+	Timeout   any              `json:"timeout,omitempty"`    // 超时，支持数字(毫秒)、"10s"、"5000ms"
+	UserAgent string           `json:"user_agent,omitempty"` // 自定义 UA
+	Viewport  *ViewportOptions `json:"viewport,omitempty"`   // 视口，/render 未设置时使用浏览器默认视口
+	Format    string           `json:"format,omitempty"`     // 输出格式：png(默认)、pdf，仅 output=image 时有效
+	PDF       *PDFOptions      `json:"pdf,omitempty"`        // PDF 页面参数，format=pdf 时生效
+	Trace     bool             `json:"trace,omitempty"`      // 记录本次渲染的 CDP 事件日志，需启用 debug.cdp_trace
+
+	ColorScheme string `json:"color_scheme,omitempty"` // 模拟 prefers-color-scheme：light、dark，默认取 theme
+	Lang        string `json:"lang,omitempty"`         // 卡片语言，如 zh-CN、en，默认取请求头 Accept-Language
+	Frames      bool   `json:"frames,omitempty"`       // 按模板中的 data-frame 元素分帧截图，打包为 zip，见 frames.go
+
+	Animation *AnimationOptions `json:"animation,omitempty"` // 录制页面动画输出 GIF/APNG（实验性），见 animation.go
+	Overflow  *OverflowOptions  `json:"overflow,omitempty"`  // 超长卡片截断或切分，覆盖 render.overflow，见 overflow.go
+
+	PostProcess *PostProcessOptions `json:"postprocess,omitempty"` // 图片后处理，覆盖 render.postprocess，见 postprocess.go
+	Watermark   *bool               `json:"watermark,omitempty"`   // false 时不叠加 watermark 配置的水印
+
+	TimeoutMs    int64             `json:"-"` // 解析后的超时(ms)
+	InitScripts  []string          `json:"-"` // 模板附属配置中导航前注入的脚本
+	ExtraHeaders map[string]string `json:"-"` // 站点配置中加载资源时附加的请求头，见 sites.go
+	BaseURL      string            `json:"-"` // 模板中相对路径的解析地址，见 document.go
+	Chaos        *chaosFault       `json:"-"` // debug.chaos 注入的故障，见 chaos.go
+}
+
+// RenderDefaults 配置文件中的渲染默认值，由 ApplyDynamicConfig 整体替换
+type RenderDefaults struct {
+	Quality      int
+	TimeoutMs    int64
+	MaxTimeoutMs int64           // 请求可指定的最大超时，超出时截断
+	Viewport     ViewportOptions // /capture 默认视口
+	PDF          PDFOptions
+	PostProcess  PostProcessOptions // 已校验的全局后处理参数
+
+	ColorProfile *colorProfile // 输出 PNG 嵌入的色彩配置，nil 表示不嵌入
+
+	MaxOutputBytes int             // 单次输出大小上限，0 为不限制，见 output.go
+	Overflow       OverflowOptions // 已校验的超长卡片默认处理方式
+}
+
+var renderDefaults atomic.Pointer[RenderDefaults]
+
+func currentRenderDefaults() *RenderDefaults {
+	if d := renderDefaults.Load(); d != nil {
+		return d
+	}
+	return &RenderDefaults{Quality: 100, TimeoutMs: 10000, MaxTimeoutMs: 60000, Viewport: ViewportOptions{Width: 1920, Height: 1080, Scale: 1.0}, PDF: PDFOptions{PageSize: "a4", Margin: "10mm"}, MaxOutputBytes: defaultMaxOutputBytes}
+}
+
+// ResolveRenderOptions 合并 payload 顶层的兼容字段（timeout、timeout_ms、user_agent）与 options，填充默认值并校验
+func ResolveRenderOptions(p *PushPayload) (RenderOptions, error) {
+	var opts RenderOptions
+	if p.Options != nil {
+		opts = *p.Options
+	}
+	if opts.Timeout == nil {
+		opts.Timeout = p.Timeout
+	}
+	if opts.Timeout == nil && p.TimeoutMs != 0 {
+		opts.Timeout = p.TimeoutMs
+	}
+	if opts.UserAgent == "" {
+		opts.UserAgent = p.UserAgent
+	}
+	if opts.Lang == "" {
+		opts.Lang = p.Lang
+	}
+	if opts.ColorScheme == "" && (p.Theme == ColorSchemeLight || p.Theme == ColorSchemeDark) {
+		opts.ColorScheme = p.Theme
+	}
+	return opts.withDefaults(currentRenderDefaults(), false)
+}
+
+// withDefaults 填充默认值并校验范围。fillViewport 为 true 时视口缺失的字段使用默认视口补齐。
+func (o RenderOptions) withDefaults(d *RenderDefaults, fillViewport bool) (RenderOptions, error) {
+	if o.Quality == 0 {
+		o.Quality = d.Quality
+	} else if o.Quality < 1 || o.Quality > 100 {
+		return o, optionError("options.quality must be between 1 and 100, got %d", o.Quality)
+	}
+
+	timeout, err := ParseDuration(o.Timeout)
+	if err != nil {
+		return o, optionError("options.timeout: %v", err)
+	}
+	if timeout < 0 {
+		return o, optionError("options.timeout must not be negative")
+	}
+	o.TimeoutMs = timeout.Milliseconds()
+	if o.TimeoutMs <= 0 {
+		o.TimeoutMs = d.TimeoutMs
+	}
+	if d.MaxTimeoutMs > 0 && o.TimeoutMs > d.MaxTimeoutMs {
+		o.TimeoutMs = d.MaxTimeoutMs
+	}
+
+	if o.Viewport != nil || fillViewport {
+		var vp ViewportOptions
+		if o.Viewport != nil {
+			vp = *o.Viewport
+		}
+		if err := vp.validate(); err != nil {
+			return o, err
+		}
+		if vp.Width == 0 {
+			vp.Width = d.Viewport.Width
+		}
+		if vp.Height == 0 {
+			vp.Height = d.Viewport.Height
+		}
+		if vp.Scale == 0 {
+			vp.Scale = d.Viewport.Scale
+		}
+		o.Viewport = &vp
+	}
+
+	if o.ColorScheme != "" && o.ColorScheme != ColorSchemeLight && o.ColorScheme != ColorSchemeDark {
+		return o, optionError("options.color_scheme must be light or dark, got %q", o.ColorScheme)
+	}
+	if o.Lang != "" && !langTagRegex.MatchString(o.Lang) {
+		return o, optionError("options.lang must be a language tag such as zh-CN, got %q", o.Lang)
+	}
+
+	pp := d.PostProcess
+	if o.PostProcess != nil {
+		if pp, err = o.PostProcess.withDefaults(d.PostProcess); err != nil {
+			return o, err
+		}
+	}
+	o.PostProcess = nil
+	if pp.active() {
+		o.PostProcess = &pp
+	}
+
+	if o.Animation != nil {
+		if o.Frames {
+			return o, optionError("options.animation is not supported with frames")
+		}
+		a, err := o.Animation.withDefaults()
+		if err != nil {
+			return o, err
+		}
+		o.Animation = &a
+	}
+
+	ov := d.Overflow
+	if o.Overflow != nil {
+		if ov, err = o.Overflow.withDefaults(d.Overflow); err != nil {
+			return o, err
+		}
+	}
+	o.Overflow = nil
+	if ov.active() {
+		o.Overflow = &ov
+	}
+
+	switch o.Format {
+	case "":
+		o.Format = FormatPNG
+	case FormatPNG:
+	case FormatPDF:
+		if o.Frames {
+			return o, optionError("options.frames is not supported with format pdf")
+		}
+		if o.Animation != nil {
+			return o, optionError("options.animation is not supported with format pdf")
+		}
+		var p PDFOptions
+		if o.PDF != nil {
+			p = *o.PDF
+		}
+		if p, err = p.withDefaults(d.PDF); err != nil {
+			return o, err
+		}
+		o.PDF = &p
+	default:
+		return o, optionError("options.format must be png or pdf, got %q", o.Format)
+	}
+	return o, nil
+}
+
+// validate 校验视口范围，零值表示未设置
+func (v ViewportOptions) validate() error {
+	if v.Width != 0 && (v.Width < minViewportSize || v.Width > maxViewportSize) {
+		return optionError("options.viewport.width must be between %d and %d, got %d", minViewportSize, maxViewportSize, v.Width)
+	}
+	if v.Height != 0 && (v.Height < minViewportSize || v.Height > maxViewportSize) {
+		return optionError("options.viewport.height must be between %d and %d, got %d", minViewportSize, maxViewportSize, v.Height)
+	}
+	if v.Scale != 0 && (v.Scale < minViewportScale || v.Scale > maxViewportScale) {
+		return optionError("options.viewport.scale must be between %g and %g, got %g", minViewportScale, maxViewportScale, v.Scale)
+	}
+	return nil
+}
+
+// emulateColorScheme 模拟 prefers-color-scheme 媒体特性
+func emulateColorScheme(scheme string) chromedp.Action {
+	return emulation.SetEmulatedMedia().WithFeatures([]*emulation.MediaFeature{{Name: "prefers-color-scheme", Value: scheme}})
+}
+
+func optionError(format string, args ...any) error {
+	return newRenderError(http.StatusBadRequest, fmt.Errorf(format, args...))
+}
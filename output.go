@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====== 输出大小 ======
+//
+// 渲染结果在管线中以完整的字节切片传递（缓存、签名、投递都需要完整内容），写出响应时带
+// Content-Length 直接从切片流式写入连接，不再经过 gin 的缓冲，客户端可以据此预分配或显示进度。
+//
+// render.max_output_size_mb（默认 50）限制单次输出的大小：超长动态等生成的巨型 PNG 会占满内存，
+// 多数聊天平台也会拒收，超过上限时返回 422 并说明实际大小，而不是把几十 MB 的图片发给调用方。
+// 编码 PNG 时超过上限立即停止，不会先编码出完整的图片。
+
+const defaultMaxOutputBytes = 50 << 20
+
+// errOutputTooLarge 输出超过 render.max_output_size_mb
+var errOutputTooLarge = errors.New("rendered output exceeds render.max_output_size_mb")
+
+var outputRejected = NewCounterVec("snapcast_output_too_large_total", "Renders rejected because the output exceeded render.max_output_size_mb, by output.", "output")
+
+// checkOutputSize 输出超过上限时返回 422 错误，错误信息中带实际大小与上限
+func checkOutputSize(output string, n int) error {
+	limit := currentRenderDefaults().MaxOutputBytes
+	if limit <= 0 || n <= limit {
+		return nil
+	}
+	return outputTooLargeError(output, fmt.Errorf("%w: %s > %s; lower options.viewport.scale or split the content", errOutputTooLarge, formatBytes(n), formatBytes(limit)))
+}
+
+// outputTooLargeError 包装为 422 并计数
+func outputTooLargeError(output string, err error) error {
+	if output == "" {
+		output = "image"
+	}
+	outputRejected.Inc(output)
+	return newRenderError(http.StatusUnprocessableEntity, err)
+}
+
+// limitedBuffer 写入超过 limit 字节时返回 errOutputTooLarge，limit 为 0 时不限制
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func newOutputBuffer() *limitedBuffer {
+	return &limitedBuffer{limit: currentRenderDefaults().MaxOutputBytes}
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.limit > 0 && b.Len()+len(p) > b.limit {
+		return 0, fmt.Errorf("%w (%s)", errOutputTooLarge, formatBytes(b.limit))
+	}
+	return b.Buffer.Write(p)
+}
+
+// writeBody 带 Content-Length 写出响应体
+func writeBody(c *gin.Context, contentType string, body []byte) {
+	c.DataFromReader(http.StatusOK, int64(len(body)), contentType, bytes.NewReader(body), nil)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/chromedp/chromedp"
+)
+
+// ====== 超长卡片 ======
+//
+// 长串评论、转发链等数据生成的卡片可能高达上万像素，Chrome 截图会被截断，聊天平台也常按尺寸拒收。
+// options.overflow（默认 render.overflow）设置单张图片的最大高度（CSS 像素），body 超过时：
+//   - truncate（默认）：body 截到 max_height，底部插入"内容过长"提示后截图，仍输出一张图片
+//   - split：按 max_height 纵向切成多张图片，与 options.frames 一样打包为 zip 返回、投递时作为相册发送；
+//     切分点尽量落在文字行、图片等元素之间，不切开单行文字
+// 未超过 max_height 时两种方式都按原样输出一张图片。只对普通截图生效，不影响 pdf、frames 与 animation。
+
+// overflow 处理方式
+const (
+	OverflowTruncate = "truncate"
+	OverflowSplit    = "split"
+)
+
+const (
+	minOverflowHeight     = 100
+	defaultOverflowNotice = "内容过长，以下已省略"
+)
+
+// OverflowOptions 超长卡片的处理方式
+type OverflowOptions struct {
+	MaxHeight int    `json:"max_height,omitempty" mapstructure:"max_height"` // 单张图片的最大高度（CSS 像素），0 为不限
+	Mode      string `json:"mode,omitempty" mapstructure:"mode"`             // truncate（默认）或 split
+	Text      string `json:"text,omitempty" mapstructure:"text"`             // truncate 时底部的提示文字
+}
+
+// withDefaults 未设置的字段使用配置默认值并校验
+func (o OverflowOptions) withDefaults(d OverflowOptions) (OverflowOptions, error) {
+	if o.MaxHeight == 0 {
+		o.MaxHeight = d.MaxHeight
+	}
+	if o.Mode == "" {
+		o.Mode = d.Mode
+	}
+	if o.Text == "" {
+		o.Text = d.Text
+	}
+	if o.MaxHeight != 0 && (o.MaxHeight < minOverflowHeight || o.MaxHeight > maxViewportSize) {
+		return o, optionError("options.overflow.max_height must be between %d and %d, got %d", minOverflowHeight, maxViewportSize, o.MaxHeight)
+	}
+	switch o.Mode {
+	case "":
+		o.Mode = OverflowTruncate
+	case OverflowTruncate, OverflowSplit:
+	default:
+		return o, optionError("options.overflow.mode must be truncate or split, got %q", o.Mode)
+	}
+	if o.Text == "" {
+		o.Text = defaultOverflowNotice
+	}
+	return o, nil
+}
+
+// active 是否设置了高度上限
+func (o *OverflowOptions) active() bool {
+	return o != nil && o.MaxHeight > 0
+}
+
+// splits 是否按 split 方式处理
+func (o *OverflowOptions) splits() bool {
+	return o.active() && o.Mode == OverflowSplit
+}
+
+// truncateBodyJS 将 body 截到指定高度并在底部插入提示；模板中带 data-continues 属性的元素（通常默认隐藏）
+// 代替默认提示显示，可自定义样式。
+const truncateBodyJS = `(function(maxHeight, text) {
+	const body = document.body;
+	body.style.height = maxHeight + 'px';
+	body.style.maxHeight = maxHeight + 'px';
+	body.style.overflow = 'hidden';
+	body.style.boxSizing = 'border-box';
+	if (getComputedStyle(body).position === 'static') body.style.position = 'relative';
+	let bg = getComputedStyle(body).backgroundColor;
+	if (!bg || bg === 'transparent' || bg === 'rgba(0, 0, 0, 0)') bg = getComputedStyle(document.documentElement).backgroundColor;
+	if (!bg || bg === 'transparent' || bg === 'rgba(0, 0, 0, 0)') bg = '#fff';
+	const footer = document.createElement('div');
+	footer.className = 'snapcast-continues';
+	footer.style.cssText = 'position:absolute;left:0;right:0;bottom:0;z-index:2147483647;padding:48px 0 14px;text-align:center;font-size:14px;color:#888;background:linear-gradient(to bottom, transparent, ' + bg + ' 60%)';
+	const custom = document.querySelector('[data-continues]');
+	if (custom) {
+		custom.hidden = false;
+		custom.style.display = '';
+		footer.appendChild(custom);
+	} else {
+		footer.textContent = text;
+	}
+	body.appendChild(footer);
+})`
+
+// truncateBody 截断 body 并返回新的截图区域
+func truncateBody(ctx context.Context, o *OverflowOptions) (frameRect, error) {
+	text, _ := json.Marshal(o.Text)
+	expr := fmt.Sprintf("%s(%d, %s)", truncateBodyJS, o.MaxHeight, text)
+	if err := chromedp.Run(ctx, chromedp.EvaluateAsDevTools(expr, nil)); err != nil {
+		return frameRect{}, err
+	}
+	return bodyRect(ctx)
+}
+
+// leafRectsJS 返回 body 内不可切开的元素（没有子元素的元素、图片等替换元素）在文档中的纵向范围
+const leafRectsJS = `(function() {
+	const sy = window.scrollY || document.documentElement.scrollTop;
+	const atomic = new Set(['IMG', 'VIDEO', 'CANVAS', 'IFRAME', 'PICTURE', 'svg']);
+	const spans = [];
+	for (const el of document.body.querySelectorAll('*')) {
+		if (el.childElementCount > 0 && !atomic.has(el.tagName)) continue;
+		if (el.closest('svg') && el.tagName !== 'svg') continue;
+		const r = el.getBoundingClientRect();
+		if (r.height <= 0 || r.width <= 0) continue;
+		spans.push([r.top + sy, r.bottom + sy]);
+	}
+	return JSON.stringify(spans);
+})()`
+
+// splitPoints 在 [top, top+height) 中按 maxHeight 选取切分位置：每段尽量靠近 maxHeight，
+// 切分线不穿过任何 spans 中的元素；在后半段内找不到这样的位置时直接在 maxHeight 处切开
+func splitPoints(top, height, maxHeight float64, spans [][2]float64) []float64 {
+	bottom := top + height
+	// 候选切分位置：元素的上下边缘
+	var edges []float64
+	fit := spans[:0:0]
+	for _, s := range spans {
+		// 比单张还高的元素总要被切开，不作为约束
+		if s[1]-s[0] >= maxHeight {
+			continue
+		}
+		fit = append(fit, s)
+		edges = append(edges, s[0], s[1])
+	}
+	spans = fit
+	sort.Float64s(edges)
+	crosses := func(y float64) bool {
+		for _, s := range spans {
+			if s[0] < y && y < s[1] {
+				return true
+			}
+		}
+		return false
+	}
+
+	var points []float64
+	start := top
+	for bottom-start > maxHeight {
+		limit := start + maxHeight
+		cut := limit
+		for i := sort.SearchFloat64s(edges, limit+1e-6) - 1; i >= 0 && edges[i] > start+maxHeight/2; i-- {
+			if !crosses(edges[i]) {
+				cut = edges[i]
+				break
+			}
+		}
+		points = append(points, cut)
+		start = cut
+	}
+	return points
+}
+
+// RenderSegments 截图，body 超过 overflow.max_height 时纵向切分为多张 PNG；未超过时只返回一张
+func RenderSegments(ctx context.Context, html string, opts RenderOptions) ([][]byte, error) {
+	ctx, r, release, err := openScreenshotPage(ctx, html, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	maxHeight := float64(opts.Overflow.MaxHeight)
+	if r.H <= maxHeight {
+		img, err := clipScreenshot(ctx, r, opts.Quality)
+		if err != nil {
+			return nil, fmt.Errorf("failed to take screenshot: %w", err)
+		}
+		return [][]byte{img}, nil
+	}
+
+	var js string
+	if err := chromedp.Run(ctx, chromedp.EvaluateAsDevTools(leafRectsJS, &js)); err != nil {
+		return nil, err
+	}
+	var spans [][2]float64
+	if err := json.Unmarshal([]byte(js), &spans); err != nil {
+		return nil, err
+	}
+
+	edges := append([]float64{r.Y}, splitPoints(r.Y, r.H, maxHeight, spans)...)
+	edges = append(edges, r.Y+r.H)
+	segments := make([][]byte, 0, len(edges)-1)
+	for i := 0; i+1 < len(edges); i++ {
+		seg := frameRect{X: r.X, Y: edges[i], W: r.W, H: edges[i+1] - edges[i]}
+		img, err := clipScreenshot(ctx, seg, opts.Quality)
+		if err != nil {
+			return nil, fmt.Errorf("failed to take screenshot of segment %d: %w", i+1, err)
+		}
+		segments = append(segments, img)
+	}
+	return segments, nil
+}
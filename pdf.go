@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// ====== PDF 输出 ======
+
+// 输出格式
+const (
+	FormatPNG = "png"
+	FormatPDF = "pdf"
+)
+
+// PageSizeAuto 单页 PDF，页面尺寸与内容一致，适合长动态归档
+const PageSizeAuto = "auto"
+
+// maxPDFPageInches Chrome 单页最大尺寸（200 英寸），超出时自动分页
+const maxPDFPageInches = 200.0
+
+// 常用纸张尺寸（英寸，纵向）
+var pageSizes = map[string][2]float64{
+	"a3":      {11.69, 16.54},
+	"a4":      {8.27, 11.69},
+	"a5":      {5.83, 8.27},
+	"letter":  {8.5, 11},
+	"legal":   {8.5, 14},
+	"tabloid": {11, 17},
+}
+
+// PDFOptions PDF 页面参数
+type PDFOptions struct {
+	PageSize  string `json:"page_size,omitempty"` // A3/A4/A5/Letter/Legal/Tabloid/auto
+	Landscape bool   `json:"landscape,omitempty"` // 横向
+	Margin    any    `json:"margin,omitempty"`    // 页边距，支持数字(毫米)、"10mm"、"1cm"、"0.5in"、"20px"
+
+	marginInches float64
+}
+
+// withDefaults 填充默认值并校验
+func (p PDFOptions) withDefaults(d PDFOptions) (PDFOptions, error) {
+	if p.PageSize == "" {
+		p.PageSize = d.PageSize
+	}
+	p.PageSize = strings.ToLower(p.PageSize)
+	if _, known := pageSizes[p.PageSize]; !known && p.PageSize != PageSizeAuto {
+		return p, optionError("options.pdf.page_size must be one of A3, A4, A5, Letter, Legal, Tabloid, auto, got %q", p.PageSize)
+	}
+	if p.Margin == nil {
+		p.Margin = d.Margin
+	}
+	margin, err := parseLength(p.Margin)
+	if err != nil {
+		return p, optionError("options.pdf.margin: %v", err)
+	}
+	if margin < 0 || margin > 2 {
+		return p, optionError("options.pdf.margin must be between 0 and 2in")
+	}
+	p.marginInches = margin
+	return p, nil
+}
+
+// parseLength 解析长度为英寸，纯数字按毫米处理
+func parseLength(v any) (float64, error) {
+	switch val := v.(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return float64(val) / 25.4, nil
+	case float64:
+		return val / 25.4, nil
+	case string:
+		s := strings.TrimSpace(strings.ToLower(val))
+		units := []struct {
+			suffix string
+			factor float64
+		}{{"mm", 1 / 25.4}, {"cm", 1 / 2.54}, {"in", 1}, {"px", 1.0 / 96}}
+		for _, u := range units {
+			if num, found := strings.CutSuffix(s, u.suffix); found {
+				f, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+				if err != nil {
+					return 0, fmt.Errorf("invalid length %q", val)
+				}
+				return f * u.factor, nil
+			}
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid length %q", val)
+		}
+		return f / 25.4, nil
+	default:
+		return 0, fmt.Errorf("unsupported length type %T", v)
+	}
+}
+
+// RenderPDF 使用 Chrome printToPDF 将 HTML 打印为 PDF
+func RenderPDF(ctx context.Context, html string, opts RenderOptions) ([]byte, error) {
+	tracker := trackerFrom(ctx)
+	ctx, cancel := tracker.Tab(opts.TimeoutMs)
+	defer cancel()
+
+	load, release, err := tracker.LoadHTML(html, opts.BaseURL, "pdf")
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	runOpts := append(pageSetupActions(opts),
+		load,
+		chromedp.WaitVisible("body", chromedp.ByQuery),
+	)
+	if err := chromedp.Run(ctx, runOpts...); err != nil {
+		return nil, fmt.Errorf("failed to load page: %w", err)
+	}
+
+	pdfOpts := opts.PDF
+	margin := pdfOpts.marginInches
+	var width, height float64
+	if pdfOpts.PageSize == PageSizeAuto {
+		// 按内容尺寸生成单页，超过 Chrome 上限时由 Chrome 自动分页
+		var size []float64
+		err := chromedp.Run(ctx, chromedp.Evaluate(`(function() {
+				const el = document.documentElement;
+				return [Math.ceil(el.scrollWidth), Math.ceil(el.scrollHeight)];
+			})()`, &size))
+		if err != nil || len(size) != 2 {
+			return nil, fmt.Errorf("failed to measure page: %v", err)
+		}
+		width = math.Min(size[0]/96+2*margin, maxPDFPageInches)
+		height = math.Min(size[1]/96+2*margin, maxPDFPageInches)
+	} else {
+		dims := pageSizes[pdfOpts.PageSize]
+		width, height = dims[0], dims[1]
+	}
+
+	var buf []byte
+	err = chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		var err error
+		buf, _, err = page.PrintToPDF().
+			WithPrintBackground(true).
+			WithLandscape(pdfOpts.Landscape && pdfOpts.PageSize != PageSizeAuto).
+			WithPaperWidth(width).
+			WithPaperHeight(height).
+			WithMarginTop(margin).
+			WithMarginBottom(margin).
+			WithMarginLeft(margin).
+			WithMarginRight(margin).
+			WithPreferCSSPageSize(false).
+			Do(ctx)
+		return err
+	}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to print pdf: %w", err)
+	}
+	if len(buf) == 0 {
+		return nil, fmt.Errorf("pdf data is empty")
+	}
+	return buf, nil
+}
@@ -0,0 +1,550 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"image"
+	"image/png"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// ====== 渲染管线 ======
+//
+// 一次渲染依次经过以下阶段，每个阶段都是一个中间件：
+//
+//	validate → transform → template → capture → postprocess → encode → deliver
+//
+// 通过 UseRenderMiddleware 可在任意阶段之前插入中间件。中间件与 gin 相同，
+// 调用 rc.Next() 继续执行后续阶段，不调用则中断管线（例如缓存命中时直接设置 rc.Result 返回）。
+
+type RenderStage string
+
+const (
+	StageValidate    RenderStage = "validate"    // 参数校验、选择模板
+	StageTransform   RenderStage = "transform"   // 数据转换
+	StageTemplate    RenderStage = "template"    // 执行模板生成 HTML
+	StageCapture     RenderStage = "capture"     // 浏览器截图 / 执行 JS
+	StagePostProcess RenderStage = "postprocess" // 图片后处理
+	StageEncode      RenderStage = "encode"      // 编码输出
+	StageDeliver     RenderStage = "deliver"     // 投递到 Sink
+)
+
+var renderStages = []RenderStage{StageValidate, StageTransform, StageTemplate, StageCapture, StagePostProcess, StageEncode, StageDeliver}
+
+// RenderMiddleware 渲染管线中间件
+type RenderMiddleware func(rc *RenderContext) error
+
+type namedRenderMiddleware struct {
+	name string
+	fn   RenderMiddleware
+}
+
+var (
+	renderMiddlewareMutex sync.RWMutex
+	renderMiddlewares     = make(map[RenderStage][]namedRenderMiddleware)
+	renderBuiltins        = map[RenderStage]RenderMiddleware{
+		StageValidate:    validateStage,
+		StageTransform:   transformStage,
+		StageTemplate:    templateStage,
+		StageCapture:     captureStage,
+		StagePostProcess: postProcessStage,
+		StageEncode:      encodeStage,
+		StageDeliver:     deliverStage,
+	}
+)
+
+// UseRenderMiddleware 在指定阶段的内置处理之前注册中间件，同一阶段按注册顺序执行
+func UseRenderMiddleware(stage RenderStage, name string, fn RenderMiddleware) {
+	renderMiddlewareMutex.Lock()
+	defer renderMiddlewareMutex.Unlock()
+	renderMiddlewares[stage] = append(renderMiddlewares[stage], namedRenderMiddleware{name: name, fn: fn})
+	logger.Debug("🧱 注册渲染中间件", zap.String("stage", string(stage)), zap.String("name", name))
+}
+
+// RenderContext 在渲染管线各阶段间传递状态
+type RenderContext struct {
+	Ctx      context.Context
+	Payload  *PushPayload
+	Options  RenderOptions // 合并默认值后的渲染参数
+	Template string        // 模板路径
+	Meta     *TemplateMeta // 模板附属配置，validate 阶段读取
+	HTML     []byte        // template 阶段产物
+
+	// Image 为 capture 阶段产出的已编码 PNG。后处理中间件通过 DecodedImage/SetImage
+	// 读写解码后的图片，encode 阶段仅在图片被修改过时重新编码。
+	Image   []byte
+	decoded image.Image
+	dirty   bool
+
+	PDF      []byte   // format=pdf 时 capture 阶段的产物，不经过图片后处理
+	Frames   [][]byte // options.frames 时 capture 阶段的逐帧 PNG，不经过图片后处理
+	Animated []byte   // options.animation 时 capture 阶段编码好的 GIF/APNG，不经过图片后处理
+
+	Result *RenderResult
+	Keys   map[string]any // 中间件间共享的自定义数据
+	Logger *zap.Logger    // 带请求 ID 的 logger
+
+	handlers []RenderMiddleware
+	index    int
+}
+
+// Next 执行下一个中间件
+func (rc *RenderContext) Next() error {
+	rc.index++
+	if rc.index >= len(rc.handlers) {
+		return nil
+	}
+	return rc.handlers[rc.index](rc)
+}
+
+// Set 保存自定义数据
+func (rc *RenderContext) Set(key string, value any) {
+	if rc.Keys == nil {
+		rc.Keys = make(map[string]any)
+	}
+	rc.Keys[key] = value
+}
+
+// Get 读取自定义数据
+func (rc *RenderContext) Get(key string) (any, bool) {
+	v, exists := rc.Keys[key]
+	return v, exists
+}
+
+// DecodedImage 返回解码后的截图，首次调用时解码
+func (rc *RenderContext) DecodedImage() (image.Image, error) {
+	if rc.decoded != nil {
+		return rc.decoded, nil
+	}
+	if len(rc.Image) == 0 {
+		return nil, errors.New("no image captured")
+	}
+	img, err := png.Decode(bytes.NewReader(rc.Image))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode screenshot: %w", err)
+	}
+	rc.decoded = img
+	return img, nil
+}
+
+// SetImage 替换截图，encode 阶段会重新编码
+func (rc *RenderContext) SetImage(img image.Image) {
+	rc.decoded = img
+	rc.dirty = true
+}
+
+// renderPayload 执行渲染管线，HTTP 接口与扩展 Source 共用
+func renderPayload(ctx context.Context, payload *PushPayload) (*RenderResult, error) {
+	start := time.Now()
+	ctx, span := startSpan(ctx, "render")
+	log := loggerFor(ctx)
+	tracker := newResourceTracker(log)
+	tracker.blockPrivate = payload.rawHTML != ""
+	defer tracker.Close()
+	ctx = withResourceTracker(ctx, tracker)
+	rc := &RenderContext{Ctx: ctx, Payload: payload, Logger: log, index: -1}
+	raw := archivePayload(payload)
+	inflight, untrack := trackInflight(rc)
+	defer untrack()
+
+	renderMiddlewareMutex.RLock()
+	for _, stage := range renderStages {
+		for _, mw := range renderMiddlewares[stage] {
+			rc.handlers = append(rc.handlers, inflight.stageTracker(stage, mw.fn))
+		}
+		rc.handlers = append(rc.handlers, inflight.stageTracker(stage, renderBuiltins[stage]))
+	}
+	renderMiddlewareMutex.RUnlock()
+
+	err := rc.Next()
+	if sandboxErr := tracker.SandboxErr(); sandboxErr != nil {
+		err = sandboxErr // 标签页被关闭导致的错误替换为超限原因
+	}
+	if entries, dropped := tracker.Console(); len(entries) > 0 {
+		logConsole(log, entries, dropped)
+		if payload.Debug {
+			payload.console = entries
+		}
+	}
+	if err == nil && rc.Result == nil {
+		err = errors.New("render pipeline produced no result")
+	}
+	span.SetAttr("snapcast.site", payload.Site)
+	span.SetAttr("snapcast.type", payload.Type)
+	span.SetAttr("snapcast.template", rc.Template)
+	span.SetAttr("snapcast.output", payload.Output)
+	if rc.Result != nil && rc.Result.Cache != "" {
+		span.SetAttr("snapcast.cache", rc.Result.Cache)
+	}
+	span.End(err)
+	if payload.warmup {
+		return rc.Result, err
+	}
+	archiveRender(ctx, raw, payload, rc, time.Since(start), err)
+	if err != nil {
+		recordFailure(ctx, raw, payload, rc, inflight.stage.Load().(RenderStage), time.Since(start), err)
+		rendersTotal.Inc("error")
+		observeSLO(rc.Template, time.Since(start), err)
+		return nil, err
+	}
+	rendersTotal.Inc("ok")
+	rc.Result.Duration = time.Since(start)
+	observeSLO(rc.Template, rc.Result.Duration, nil)
+	if rc.Result.Cache != "HIT" {
+		observeRenderCost(rc.Template, rc.Result.Duration, len(rc.Result.Body), tracker.JSHeap())
+	}
+	return rc.Result, nil
+}
+
+// ====== 内置阶段 ======
+
+func validateStage(rc *RenderContext) error {
+	payload := rc.Payload
+	if payload.Output == "" {
+		payload.Output = "image"
+	}
+	// output 字段校验
+	if payload.Output != "image" && payload.Output != "html" && payload.Output != "json" {
+		rc.Logger.Warn("❕ 无效的 output 参数", zap.String("output", payload.Output))
+		return newRenderError(http.StatusBadRequest, errors.New("invalid output: must be image, html, or json"))
+	}
+	switch payload.Response {
+	case "", ResponseBody:
+	case ResponseURL:
+		if globalImageStore == nil {
+			return newRenderError(http.StatusBadRequest, errors.New("response url requires storage.enabled"))
+		}
+		if payload.Output == "json" {
+			return newRenderError(http.StatusBadRequest, errors.New("response url requires output image or html"))
+		}
+	default:
+		return newRenderError(http.StatusBadRequest, errors.New("invalid response: must be body or url"))
+	}
+	// 解析并校验渲染参数
+	opts, err := ResolveRenderOptions(payload)
+	if err != nil {
+		rc.Logger.Warn("❕ 无效的渲染参数", zap.Error(err))
+		return err
+	}
+	if opts.Format == FormatPDF && payload.Output != "image" {
+		return newRenderError(http.StatusBadRequest, errors.New("options.format pdf requires output image"))
+	}
+	if opts.Frames && payload.Output != "image" {
+		return newRenderError(http.StatusBadRequest, errors.New("options.frames requires output image"))
+	}
+	if opts.Animation != nil && payload.Output != "image" {
+		return newRenderError(http.StatusBadRequest, errors.New("options.animation requires output image"))
+	}
+	if len(payload.IdempotencyKey) > 128 {
+		return newRenderError(http.StatusBadRequest, errors.New("idempotency_key must be at most 128 characters"))
+	}
+	// HTML 直出与试验场不经过 selectTemplate，site/type 同样用于 CDP 跟踪文件名、指标标签与日志
+	if !templateKeyRegex.MatchString(payload.Site) || !templateKeyRegex.MatchString(payload.Type) {
+		return newRenderError(http.StatusBadRequest, errors.New("invalid site or type: only letters, digits and underscore are allowed"))
+	}
+	if payload.Theme != "" && !templateKeyRegex.MatchString(payload.Theme) {
+		return newRenderError(http.StatusBadRequest, errors.New("invalid theme: only letters, digits and underscore are allowed"))
+	}
+	applySiteProfile(&opts, payload.Site)
+	rc.Options = opts
+	if logLevel.Level() == zapcore.DebugLevel {
+		debugPayload(*payload)
+	}
+
+	if p := principalFrom(rc.Ctx); p != nil && !p.allows(payload.Site, payload.Type) {
+		rc.Logger.Warn("⛔ token 无权渲染该模板", zap.String("token", p.name), zap.String("site", payload.Site), zap.String("type", payload.Type))
+		return newRenderError(http.StatusForbidden, fmt.Errorf("token not allowed for %s/%s", payload.Site, payload.Type))
+	}
+
+	if payload.rawHTML != "" || payload.templateSource != "" {
+		rc.Meta = &TemplateMeta{}
+		return rc.Next()
+	}
+	if !payload.warmup {
+		globalPayloadSamples.Record(payload) // 在查找模板之前，尚无模板的类型同样收集
+	}
+
+	rc.Template = selectTemplate(*payload)
+	if rc.Template == "" {
+		rc.Logger.Warn("❔ 未找到模板", zap.String("site", payload.Site), zap.String("type", payload.Type))
+		return newRenderError(http.StatusBadRequest, errors.New("no template found"))
+	}
+
+	// 附属配置在缓存之前读取，access 规则对缓存命中同样生效
+	if !payload.warmup {
+		globalTemplateUsage.Record(templateKeyOf(rc.Template))
+	}
+	rc.Meta, err = loadTemplateMeta(rc.Template)
+	if err != nil {
+		rc.Logger.Error("❌ 模板附属配置读取失败", zap.Error(err), zap.String("template", rc.Template))
+		return err
+	}
+	if p := principalFrom(rc.Ctx); !p.canAccess(rc.Meta.Access) {
+		rc.Logger.Warn("⛔ token 无权使用该模板", zap.String("token", p.name), zap.String("template", rc.Template))
+		return newRenderError(http.StatusForbidden, fmt.Errorf("token not allowed for template %s/%s", payload.Site, payload.Type))
+	}
+	return rc.Next()
+}
+
+func transformStage(rc *RenderContext) error {
+	// 按模板声明的适配器整理上游原始数据，见 adapter.go
+	if err := applyPayloadAdapter(rc); err != nil {
+		rc.Logger.Warn("⚠️ 数据适配失败", zap.Error(err), zap.String("template", rc.Template))
+		return err
+	}
+	// 按模板的 transform.yaml 映射原始数据，见 transform.go
+	if err := applyTemplateTransform(rc); err != nil {
+		rc.Logger.Error("❌ 数据映射失败", zap.Error(err), zap.String("template", rc.Template))
+		return err
+	}
+	// WASM 数据转换
+	if err := applyWasmTransforms(rc.Payload); err != nil {
+		rc.Logger.Error("❌ 数据转换失败", zap.Error(err), zap.String("template", rc.Template))
+		return err
+	}
+	// 按模板的 schema 校验转换后的数据，见 dataschema.go
+	if err := validatePayloadSchema(rc); err != nil {
+		return err
+	}
+	return rc.Next()
+}
+
+func templateStage(rc *RenderContext) error {
+	if rc.Payload.rawHTML != "" {
+		rc.HTML = []byte(rc.Payload.rawHTML)
+		rc.Options.BaseURL = currentDocumentConfig().baseURL
+		rc.Result = &RenderResult{HTMLSize: len(rc.HTML)}
+		return rc.Next()
+	}
+	var buf bytes.Buffer
+	meta := rc.Meta
+	rc.Options.InitScripts = meta.scriptSources
+	if rc.Payload.templateSource != "" {
+		rc.Options.BaseURL = currentDocumentConfig().baseURL
+	} else {
+		rc.Options.BaseURL = documentBaseURL(rc.Template)
+	}
+	if meta.seedRandomEnabled() {
+		rc.Options.InitScripts = append([]string{seedRandomScript(payloadSeed(rc.Payload))}, rc.Options.InitScripts...)
+	}
+
+	theme, lang := rc.Payload.Theme, rc.Options.Lang
+	_, span := startSpan(rc.Ctx, "template.parse")
+	name := filepath.Base(rc.Template)
+	if rc.Payload.templateSource != "" {
+		name = "playground"
+	}
+	tmpl := template.New(name).Funcs(funcsList).Funcs(template.FuncMap{
+		"theme": func() string { return theme },
+		"lang":  func() string { return lang },
+		"embedImage": func(rawURL string) template.URL {
+			return embedImage(rc.Ctx, rawURL)
+		},
+		"safeHTML": safeHTMLFunc(meta.SafeHTML),
+		"t":        translateFunc(lang),
+	})
+	var err error
+	if rc.Payload.templateSource != "" {
+		tmpl, err = tmpl.Parse(rc.Payload.templateSource)
+	} else {
+		tmpl, err = tmpl.ParseFiles(rc.Template)
+	}
+	span.End(err)
+	if err != nil {
+		rc.Logger.Error("❌ 模板解析失败", zap.Error(err), zap.String("template", rc.Template))
+		return err
+	}
+	if rc.Payload.Data != nil {
+		if logLevel.Level() == zapcore.DebugLevel {
+			debugFields(rc.Payload.Data)
+		}
+		_, span := startSpan(rc.Ctx, "template.execute")
+		err = safeExecuteTemplate(tmpl, rc.Payload.Data, &buf)
+		span.SetAttr("snapcast.html_size", buf.Len())
+		span.End(err)
+		if err != nil {
+			rc.Logger.Error("❌ 模板渲染失败", zap.Error(err), zap.String("template", rc.Template))
+			return fmt.Errorf("execute template failed: %v", err)
+		}
+	}
+	rc.HTML = buf.Bytes()
+	rc.Result = &RenderResult{Template: rc.Template, HTMLSize: buf.Len()}
+	if rc.Result.Alt, err = renderAltText(meta, rc.Payload.Data, theme, lang); err != nil {
+		rc.Logger.Warn("❕ 替代文本生成失败", zap.Error(err), zap.String("template", rc.Template))
+	}
+	return rc.Next()
+}
+
+func captureStage(rc *RenderContext) error {
+	if rc.Payload.Output != "html" {
+		start := time.Now()
+		defer func() { observeChromeLatency(time.Since(start)) }()
+	}
+	if err := captureWithRetry(rc); err != nil {
+		return err
+	}
+	return rc.Next()
+}
+
+// captureOnce 按 output 截图或执行 JS，失败时由 captureWithRetry 决定是否重试
+func captureOnce(rc *RenderContext) error {
+	var err error
+	switch rc.Payload.Output {
+	case "json":
+		// 执行 JS 并返回序列化结果
+		rc.Result.JSON, err = RenderJS(rc.Ctx, string(rc.HTML), rc.Options)
+		if err != nil {
+			return err
+		}
+	case "image":
+		if rc.Options.Format == FormatPDF {
+			rc.PDF, err = RenderPDF(rc.Ctx, string(rc.HTML), rc.Options)
+			if err != nil {
+				rc.Logger.Error("❌ PDF 生成失败", zap.Error(err), zap.String("template", rc.Template))
+				return err
+			}
+			break
+		}
+		if rc.Options.Frames {
+			rc.Frames, err = RenderFrames(rc.Ctx, string(rc.HTML), rc.Options)
+			if errors.Is(err, errNoFrames) {
+				return newRenderError(http.StatusBadRequest, err)
+			}
+			if err != nil {
+				rc.Logger.Error("❌ 分帧截图失败", zap.Error(err), zap.String("template", rc.Template))
+				return err
+			}
+			break
+		}
+		if rc.Options.Animation != nil {
+			rc.Animated, err = RenderAnimation(rc.Ctx, string(rc.HTML), rc.Options)
+			if err != nil {
+				rc.Logger.Error("❌ 动画录制失败", zap.Error(err), zap.String("template", rc.Template))
+				return err
+			}
+			break
+		}
+		if rc.Options.Overflow.splits() {
+			segments, err := RenderSegments(rc.Ctx, string(rc.HTML), rc.Options)
+			if err != nil {
+				rc.Logger.Error("❌ 截图失败", zap.Error(err), zap.String("template", rc.Template))
+				return err
+			}
+			// 未超过高度上限时按普通截图输出，超过时与分帧一样打包
+			if len(segments) == 1 {
+				rc.Image = segments[0]
+			} else {
+				rc.Logger.Debug("✂️ 超长卡片已切分", zap.Int("segments", len(segments)))
+				rc.Frames = segments
+			}
+			break
+		}
+		// 截图
+		rc.Image, err = RenderScreenshot(rc.Ctx, string(rc.HTML), rc.Options)
+		if err != nil {
+			rc.Logger.Error("❌ 截图失败", zap.Error(err), zap.String("template", rc.Template))
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeStage(rc *RenderContext) error {
+	if err := encodeOutput(rc); err != nil {
+		return err
+	}
+	if err := checkOutputSize(rc.Payload.Output, len(rc.Result.Body)); err != nil {
+		return err
+	}
+	return rc.Next()
+}
+
+// encodeOutput 按 output 生成响应内容
+func encodeOutput(rc *RenderContext) (err error) {
+	_, span := startSpan(rc.Ctx, "output")
+	defer func() { span.End(err) }()
+	result := rc.Result
+	switch rc.Payload.Output {
+	case "html":
+		// 直接返回渲染后的 HTML
+		result.ContentType = "text/html; charset=utf-8"
+		result.Body = rc.HTML
+	case "json":
+		b, _ := json.Marshal(result.JSON)
+		result.ContentType = "application/json"
+		result.Body = b
+	default:
+		if rc.PDF != nil {
+			result.ContentType = "application/pdf"
+			result.Body = rc.PDF
+			break
+		}
+		if rc.Frames != nil {
+			for i, frame := range rc.Frames {
+				img, err := applyColorProfile(frame)
+				if err != nil {
+					rc.Logger.Error("❌ 色彩配置写入失败", zap.Error(err), zap.String("template", rc.Template))
+					return err
+				}
+				rc.Frames[i] = img
+			}
+			body, err := zipFrames(rc.Frames)
+			if err != nil {
+				return err
+			}
+			result.ContentType = zipContentType
+			result.Body = body
+			result.Frames = rc.Frames
+			break
+		}
+		if rc.Animated != nil {
+			if rc.Options.Animation.Format == AnimationAPNG {
+				img, err := applyColorProfile(rc.Animated)
+				if err != nil {
+					rc.Logger.Error("❌ 色彩配置写入失败", zap.Error(err), zap.String("template", rc.Template))
+					return err
+				}
+				rc.Animated = img
+			}
+			result.ContentType = rc.Options.Animation.contentType()
+			result.Body = rc.Animated
+			break
+		}
+		if rc.dirty {
+			// 超过输出上限时立即停止编码，见 output.go
+			out := newOutputBuffer()
+			if err := png.Encode(out, rc.decoded); errors.Is(err, errOutputTooLarge) {
+				return outputTooLargeError(rc.Payload.Output, err)
+			} else if err != nil {
+				return err
+			}
+			rc.Image = out.Bytes()
+		}
+		img, err := applyColorProfile(rc.Image)
+		if err != nil {
+			rc.Logger.Error("❌ 色彩配置写入失败", zap.Error(err), zap.String("template", rc.Template))
+			return err
+		}
+		rc.Image = img
+		result.ContentType = "image/png"
+		result.Body = rc.Image
+	}
+	return nil
+}
+
+func deliverStage(rc *RenderContext) error {
+	if len(rc.Payload.Deliver) > 0 {
+		rc.Result.Receipts = deliverResult(rc.Ctx, rc.Payload, rc.Result)
+	}
+	return rc.Next()
+}
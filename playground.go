@@ -0,0 +1,153 @@
+//go:build !noadmin
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 模板试验场 ======
+//
+// template.playground 开启后，GET /playground 提供一个内置的网页：左侧编辑模板与 JSON 数据，
+// 右侧实时显示截图，渲染走与 /render 相同的管线（排队、字体、资源代理等）。
+//
+// 页面本身是静态文件，不需要认证；页面调用的接口与管理接口权限相同（不限权限范围的 token，
+// 未配置认证时仅本机），token 由页面保存在浏览器本地并通过 Authorization 请求头携带。
+
+const (
+	playgroundPath      = "/playground"
+	maxPlaygroundSource = 2 << 20
+)
+
+// PlaygroundRequest POST /playground/render 请求体
+type PlaygroundRequest struct {
+	Template string         `json:"template"`
+	Data     any            `json:"data"`
+	Site     string         `json:"site"` // 用于日志与指标，默认 playground
+	Type     string         `json:"type"` // 默认 draft
+	Theme    string         `json:"theme"`
+	Lang     string         `json:"lang"`
+	Output   string         `json:"output"` // "image"（默认）或 "html"
+	Options  *RenderOptions `json:"options,omitempty"`
+}
+
+// registerPlaygroundRoutes 注册模板试验场
+func registerPlaygroundRoutes(r *gin.Engine) {
+	if !viper.GetBool("template.playground") {
+		return
+	}
+	r.GET(playgroundPath, PlaygroundPageHandler)
+	g := r.Group(playgroundPath, adminGuard())
+	g.POST("/render", PlaygroundRenderHandler)
+	g.GET("/source/:site/:type", PlaygroundSourceHandler)
+	logger.Info("🧪 模板试验场已启用", zap.String("path", playgroundPath))
+}
+
+// isPlaygroundPage 是否为试验场页面本身，页面不含数据，由 AuthMiddleware 放行
+func isPlaygroundPage(c *gin.Context) bool {
+	return c.Request.Method == http.MethodGet && c.Request.URL.Path == playgroundPath && viper.GetBool("template.playground")
+}
+
+// PlaygroundPageHandler 返回内置的试验场页面
+func PlaygroundPageHandler(c *gin.Context) {
+	page, err := embeddedAssets.ReadFile("assets/playground.html")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errResp(err.Error()))
+		return
+	}
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page)
+}
+
+// PlaygroundRenderHandler 渲染提交的模板源码；模板语法错误返回 422 及行号，便于编辑器定位
+func PlaygroundRenderHandler(c *gin.Context) {
+	log := loggerFor(c.Request.Context())
+	var req PlaygroundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errResp(err.Error()))
+		return
+	}
+	if strings.TrimSpace(req.Template) == "" {
+		c.JSON(http.StatusBadRequest, errResp("template is required"))
+		return
+	}
+	if len(req.Template) > maxPlaygroundSource {
+		c.JSON(http.StatusRequestEntityTooLarge, errResp("template is too large"))
+		return
+	}
+	if req.Output != "" && req.Output != "image" && req.Output != "html" {
+		c.JSON(http.StatusBadRequest, errResp("invalid output: must be image or html"))
+		return
+	}
+	if check := validateTemplateSource(req.Template); !check.Valid {
+		c.JSON(http.StatusUnprocessableEntity, APIResponse{Status: "error", Message: check.Error, Data: check})
+		return
+	}
+	if req.Site == "" {
+		req.Site = "playground"
+	}
+	if req.Type == "" {
+		req.Type = "draft"
+	}
+	if !templateKeyRegex.MatchString(req.Site) || !templateKeyRegex.MatchString(req.Type) {
+		c.JSON(http.StatusBadRequest, errResp("invalid site or type: only letters, digits and underscore are allowed"))
+		return
+	}
+	payload := PushPayload{
+		Site:           req.Site,
+		Type:           req.Type,
+		Output:         req.Output,
+		Data:           req.Data,
+		Theme:          req.Theme,
+		Lang:           req.Lang,
+		Options:        req.Options,
+		Debug:          true, // 失败时页面显示控制台输出
+		templateSource: req.Template,
+	}
+	if payload.Data == nil {
+		payload.Data = map[string]any{}
+	}
+	c.Set("render_site", payload.Site)
+	c.Set("render_type", payload.Type)
+
+	release, acquired := acquireRequestSlot(c, payload.Site, payload.Priority)
+	if !acquired {
+		return
+	}
+	defer release()
+
+	result, err := renderPayload(c.Request.Context(), &payload)
+	if err != nil {
+		log.Warn("❕ 试验场渲染失败", zap.Error(err))
+		c.Set("render_error", err.Error())
+		c.JSON(renderErrorStatus(err), renderErrorResp(&payload, err))
+		return
+	}
+	writeRenderResult(c, &payload, result)
+}
+
+// PlaygroundSourceHandler 返回已有模板的源码与示例数据，作为试验场的起点
+func PlaygroundSourceHandler(c *gin.Context) {
+	tmplPath := selectTemplate(PushPayload{Site: c.Param("site"), Type: c.Param("type"), Theme: c.Query("theme")})
+	if tmplPath == "" {
+		c.JSON(http.StatusNotFound, errResp("no template found"))
+		return
+	}
+	source, err := os.ReadFile(tmplPath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errResp(err.Error()))
+		return
+	}
+	sample, err := loadSampleData(tmplPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		c.JSON(http.StatusInternalServerError, errResp(err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, ok(gin.H{"template": string(source), "sample": sample, "path": tmplPath}))
+}
@@ -0,0 +1,41 @@
+//go:build linux && cgo && !noplugin
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"plugin"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// LoadPlugins 加载插件目录中的全部 .so 文件。
+// 插件在自身 init 中调用 extension.RegisterSource/RegisterSink/RegisterTemplateFunc 完成注册，
+// 必须使用与主程序相同的 Go 版本和依赖版本构建（go build -buildmode=plugin）。
+func LoadPlugins(dir string) {
+	if dir == "" {
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		logger.Warn("⚠️ 插件目录读取失败", zap.String("dir", dir), zap.Error(err))
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".so") {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		if _, err := plugin.Open(path); err != nil {
+			logger.Error("❌ 插件加载失败", zap.String("path", path), zap.Error(err))
+			continue
+		}
+		logger.Info("🧩 插件已加载", zap.String("path", path))
+	}
+}
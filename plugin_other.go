@@ -0,0 +1,19 @@
+//go:build !linux || !cgo || noplugin
+
+package main
+
+import (
+	"path/filepath"
+
+	"go.uber.org/zap"
+)
+
+// LoadPlugins 当前平台或构建（noplugin）不支持 Go 插件，仅在发现 .so 文件时给出提示
+func LoadPlugins(dir string) {
+	if dir == "" {
+		return
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.so")); len(matches) > 0 {
+		logger.Warn("❕ 当前构建不支持 Go 插件，已忽略", zap.String("dir", dir), zap.Int("count", len(matches)))
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// ====== 图片后处理 ======
+//
+// 截图完成后按 render.postprocess 与请求 options.postprocess 依次执行：
+// 缩小到最大宽高以内（保持比例，宽高包含内边距与边框）、加内边距与边框、圆角、
+// 透明区域铺底色。聊天平台对图片尺寸有上限时，无需再额外部署缩放服务。
+// PDF 与多帧输出不经过后处理。
+
+// PostProcessOptions 图片后处理参数，单位为输出图片的像素
+type PostProcessOptions struct {
+	MaxWidth    int    `json:"max_width,omitempty" mapstructure:"max_width"`       // 最大宽度，超出时等比缩小
+	MaxHeight   int    `json:"max_height,omitempty" mapstructure:"max_height"`     // 最大高度
+	Padding     int    `json:"padding,omitempty" mapstructure:"padding"`           // 内边距，使用 background 填充，未设置时透明
+	Border      int    `json:"border,omitempty" mapstructure:"border"`             // 边框宽度
+	BorderColor string `json:"border_color,omitempty" mapstructure:"border_color"` // 边框颜色，默认 #000000
+	Radius      int    `json:"radius,omitempty" mapstructure:"radius"`             // 圆角半径
+	Background  string `json:"background,omitempty" mapstructure:"background"`     // 透明区域铺底色，如 #ffffff
+
+	border     color.RGBA
+	background *color.RGBA
+}
+
+// maxPostProcessSize 内边距、边框、圆角的上限
+const maxPostProcessSize = 1000
+
+// withDefaults 以配置为默认值合并请求参数（非零字段覆盖）并校验
+func (p PostProcessOptions) withDefaults(d PostProcessOptions) (PostProcessOptions, error) {
+	for _, f := range []struct {
+		dst *int
+		def int
+	}{{&p.MaxWidth, d.MaxWidth}, {&p.MaxHeight, d.MaxHeight}, {&p.Padding, d.Padding}, {&p.Border, d.Border}, {&p.Radius, d.Radius}} {
+		if *f.dst == 0 {
+			*f.dst = f.def
+		}
+	}
+	if p.BorderColor == "" {
+		p.BorderColor = d.BorderColor
+	}
+	if p.Background == "" {
+		p.Background = d.Background
+	}
+
+	if p.MaxWidth < 0 || p.MaxWidth > maxViewportSize || p.MaxHeight < 0 || p.MaxHeight > maxViewportSize {
+		return p, optionError("options.postprocess.max_width and max_height must be between 0 and %d", maxViewportSize)
+	}
+	for name, v := range map[string]int{"padding": p.Padding, "border": p.Border, "radius": p.Radius} {
+		if v < 0 || v > maxPostProcessSize {
+			return p, optionError("options.postprocess.%s must be between 0 and %d, got %d", name, maxPostProcessSize, v)
+		}
+	}
+	edge := 2 * (p.Padding + p.Border)
+	if (p.MaxWidth > 0 && p.MaxWidth <= edge) || (p.MaxHeight > 0 && p.MaxHeight <= edge) {
+		return p, optionError("options.postprocess.max_width and max_height must be larger than twice padding plus border")
+	}
+	p.border = color.RGBA{A: 0xff}
+	if p.BorderColor != "" {
+		c, err := parseHexColor(p.BorderColor)
+		if err != nil {
+			return p, optionError("options.postprocess.border_color: %v", err)
+		}
+		p.border = c
+	}
+	p.background = nil
+	if p.Background != "" {
+		c, err := parseHexColor(p.Background)
+		if err != nil {
+			return p, optionError("options.postprocess.background: %v", err)
+		}
+		p.background = &c
+	}
+	return p, nil
+}
+
+// active 是否需要处理
+func (p *PostProcessOptions) active() bool {
+	return p != nil && (p.MaxWidth > 0 || p.MaxHeight > 0 || p.Padding > 0 || p.Border > 0 || p.Radius > 0 || p.background != nil)
+}
+
+// parseHexColor 解析 #rgb、#rrggbb、#rrggbbaa
+func parseHexColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	if len(hex) != 8 {
+		return color.RGBA{}, fmt.Errorf("invalid color %q, expected #rgb, #rrggbb or #rrggbbaa", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q, expected #rgb, #rrggbb or #rrggbbaa", s)
+	}
+	return color.RGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+// postProcessStage 内置后处理阶段：后处理之后叠加水印
+func postProcessStage(rc *RenderContext) error {
+	if len(rc.Image) == 0 {
+		return rc.Next()
+	}
+	if p := rc.Options.PostProcess; p.active() {
+		img, err := rc.DecodedImage()
+		if err != nil {
+			return err
+		}
+		rc.SetImage(postProcess(img, p))
+	}
+	if watermarkEnabled(rc.Options) {
+		if err := watermarkStage(rc); err != nil {
+			rc.Logger.Warn("❕ 水印叠加失败，输出不带水印的图片", zap.Error(err))
+		}
+	}
+	return rc.Next()
+}
+
+// postProcessPNG 对已编码的 PNG 做后处理，用于不经过渲染管线的 /capture
+func postProcessPNG(data []byte, p *PostProcessOptions) ([]byte, error) {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode screenshot: %w", err)
+	}
+	var out bytes.Buffer
+	if err := png.Encode(&out, postProcess(img, p)); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// postProcess 依次执行缩放、内边距与边框、圆角、铺底色
+func postProcess(img image.Image, p *PostProcessOptions) image.Image {
+	edge := p.Padding + p.Border
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	scale := 1.0
+	if p.MaxWidth > 0 && w+2*edge > p.MaxWidth {
+		scale = min(scale, float64(p.MaxWidth-2*edge)/float64(w))
+	}
+	if p.MaxHeight > 0 && h+2*edge > p.MaxHeight {
+		scale = min(scale, float64(p.MaxHeight-2*edge)/float64(h))
+	}
+	if scale < 1 {
+		img = resizeArea(img, max(1, int(math.Round(float64(w)*scale))), max(1, int(math.Round(float64(h)*scale))))
+		b = img.Bounds()
+		w, h = b.Dx(), b.Dy()
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, w+2*edge, h+2*edge))
+	if p.Border > 0 {
+		draw.Draw(out, out.Bounds(), image.NewUniform(p.border), image.Point{}, draw.Src)
+		draw.Draw(out, out.Bounds().Inset(p.Border), image.Transparent, image.Point{}, draw.Src)
+	}
+	draw.Draw(out, image.Rect(edge, edge, edge+w, edge+h), img, b.Min, draw.Src)
+	if p.Radius > 0 {
+		roundCorners(out, p.Radius)
+	}
+	if p.background != nil {
+		flat := image.NewRGBA(out.Bounds())
+		draw.Draw(flat, flat.Bounds(), image.NewUniform(*p.background), image.Point{}, draw.Src)
+		draw.Draw(flat, flat.Bounds(), out, image.Point{}, draw.Over)
+		out = flat
+	}
+	return out
+}
+
+// roundCorners 将四角圆角以外的像素按覆盖比例变透明（抗锯齿）
+func roundCorners(img *image.RGBA, radius int) {
+	b := img.Bounds()
+	radius = min(radius, b.Dx()/2, b.Dy()/2)
+	r := float64(radius)
+	for dy := 0; dy < radius; dy++ {
+		for dx := 0; dx < radius; dx++ {
+			// 像素中心到圆心的距离，边缘 1 像素内线性过渡
+			dist := math.Hypot(r-float64(dx)-0.5, r-float64(dy)-0.5)
+			coverage := math.Max(0, math.Min(1, r-dist+0.5))
+			if coverage >= 1 {
+				continue
+			}
+			for _, pt := range [4]image.Point{
+				{b.Min.X + dx, b.Min.Y + dy},
+				{b.Max.X - 1 - dx, b.Min.Y + dy},
+				{b.Min.X + dx, b.Max.Y - 1 - dy},
+				{b.Max.X - 1 - dx, b.Max.Y - 1 - dy},
+			} {
+				i := img.PixOffset(pt.X, pt.Y)
+				for c := 0; c < 4; c++ { // 预乘 alpha，四个通道同比例缩放
+					img.Pix[i+c] = uint8(float64(img.Pix[i+c])*coverage + 0.5)
+				}
+			}
+		}
+	}
+}
+
+// resizeArea 按面积平均缩小图片，先水平后垂直两次一维重采样
+func resizeArea(src image.Image, dstW, dstH int) *image.RGBA {
+	b := src.Bounds()
+	srcW, srcH := b.Dx(), b.Dy()
+	rgba, ok := src.(*image.RGBA)
+	if !ok || rgba.Bounds().Min != (image.Point{}) {
+		rgba = image.NewRGBA(image.Rect(0, 0, srcW, srcH))
+		draw.Draw(rgba, rgba.Bounds(), src, b.Min, draw.Src)
+	}
+
+	xw := areaWeights(srcW, dstW)
+	tmp := make([]float32, dstW*srcH*4)
+	for y := 0; y < srcH; y++ {
+		row := rgba.Pix[y*rgba.Stride:]
+		for x, ws := range xw {
+			var acc [4]float32
+			for _, w := range ws {
+				for c := 0; c < 4; c++ {
+					acc[c] += float32(row[w.index*4+c]) * w.weight
+				}
+			}
+			copy(tmp[(y*dstW+x)*4:], acc[:])
+		}
+	}
+
+	yw := areaWeights(srcH, dstH)
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y, ws := range yw {
+		for x := 0; x < dstW; x++ {
+			var acc [4]float32
+			for _, w := range ws {
+				for c := 0; c < 4; c++ {
+					acc[c] += tmp[(w.index*dstW+x)*4+c] * w.weight
+				}
+			}
+			i := dst.PixOffset(x, y)
+			for c := 0; c < 4; c++ {
+				dst.Pix[i+c] = uint8(min(255, acc[c]+0.5))
+			}
+		}
+	}
+	return dst
+}
+
+type areaWeight struct {
+	index  int
+	weight float32
+}
+
+// areaWeights 每个目标像素覆盖的源像素及其面积占比
+func areaWeights(src, dst int) [][]areaWeight {
+	ratio := float64(src) / float64(dst)
+	out := make([][]areaWeight, dst)
+	for i := range out {
+		start, end := float64(i)*ratio, float64(i+1)*ratio
+		for j := int(start); j < src && float64(j) < end; j++ {
+			overlap := math.Min(end, float64(j+1)) - math.Max(start, float64(j))
+			if overlap > 0 {
+				out[i] = append(out[i], areaWeight{index: j, weight: float32(overlap / ratio)})
+			}
+		}
+	}
+	return out
+}
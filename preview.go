@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// samplePath 返回模板对应的示例数据文件路径，如 bilibili_live.html → bilibili_live.sample.json
+func samplePath(tmplPath string) string {
+	return strings.TrimSuffix(tmplPath, ".html") + ".sample.json"
+}
+
+// loadSampleData 读取模板的默认示例数据
+func loadSampleData(tmplPath string) (any, error) {
+	return loadSampleScenario(tmplPath, "")
+}
+
+// loadSampleScenario 读取模板指定场景的示例数据，主题变体没有单独的示例数据时使用基础模板的，见 scenarios.go
+func loadSampleScenario(tmplPath, scenario string) (any, error) {
+	if err := validateScenario(scenario); err != nil {
+		return nil, err
+	}
+	path := scenarioPath(tmplPath, scenario)
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		dir, name := filepath.Split(tmplPath)
+		if base, _, isVariant := strings.Cut(name, "."); isVariant && base+".html" != name {
+			path = scenarioPath(dir+base+".html", scenario)
+			b, err = os.ReadFile(path)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var data any
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, fmt.Errorf("invalid sample data %s: %w", path, err)
+	}
+	return data, nil
+}
+
+// PreviewHandler 使用模板目录中的示例数据渲染模板，便于在浏览器中直接查看效果。
+// 支持 ?output=html|json 切换输出模式，默认返回图片；?theme=dark 预览主题变体，?lang=en 预览其他语言，
+// ?scenario=live_end 使用命名场景的示例数据，?live=1 返回模板变更后自动刷新的预览页（见 livereload.go）。
+func PreviewHandler(c *gin.Context) {
+	if c.Query("live") == "1" {
+		tmplPath := selectTemplate(PushPayload{Site: c.Param("site"), Type: c.Param("type"), Theme: c.Query("theme")})
+		if tmplPath == "" {
+			c.JSON(http.StatusNotFound, errResp("no template found"))
+			return
+		}
+		writeLivePreview(c, tmplPath)
+		return
+	}
+	release, acquired := acquireRequestSlot(c, c.Param("site"), 0)
+	if !acquired {
+		return
+	}
+	defer release()
+
+	payload := PushPayload{
+		Site:   c.Param("site"),
+		Type:   c.Param("type"),
+		Output: c.DefaultQuery("output", "image"),
+		Theme:  c.Query("theme"),
+	}
+	if lang := c.Query("lang"); lang != "" {
+		payload.Options = &RenderOptions{Lang: lang}
+	} else if applyAcceptLanguage(&payload, c.GetHeader("Accept-Language")) {
+		c.Header("Vary", "Accept-Language")
+	}
+	tmplPath := selectTemplate(payload)
+	if tmplPath == "" {
+		c.JSON(http.StatusNotFound, errResp("no template found"))
+		return
+	}
+	scenario := c.Query("scenario")
+	data, err := loadSampleScenario(tmplPath, scenario)
+	if errors.Is(err, os.ErrNotExist) {
+		logger.Warn("❔ 未找到示例数据", zap.String("path", scenarioPath(tmplPath, scenario)))
+		c.JSON(http.StatusNotFound, errResp("no sample data found: "+scenarioPath(tmplPath, scenario)))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errResp(err.Error()))
+		return
+	}
+	payload.Data = data
+
+	result, err := renderPayload(c.Request.Context(), &payload)
+	if err != nil {
+		c.JSON(renderErrorStatus(err), renderErrorResp(&payload, err))
+		return
+	}
+	writeRenderResult(c, &payload, result)
+}
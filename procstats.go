@@ -0,0 +1,27 @@
+package main
+
+import "sort"
+
+// processInfo 子进程信息
+type processInfo struct {
+	PID  int    `json:"pid"`
+	Name string `json:"name"`
+	RSS  int64  `json:"rss_bytes"`
+}
+
+// browserProcesses 返回本地浏览器进程及其常驻内存总量，按 PID 排序；远程浏览器模式下为空
+func browserProcesses() ([]processInfo, int64) {
+	procs := childProcesses()
+	sort.Slice(procs, func(i, j int) bool { return procs[i].PID < procs[j].PID })
+	var total int64
+	for _, p := range procs {
+		total += p.RSS
+	}
+	return procs, total
+}
+
+// cpuTimes 主机 CPU 累计时间（jiffies）
+type cpuTimes struct {
+	idle  uint64
+	total uint64
+}
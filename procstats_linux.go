@@ -0,0 +1,104 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// childProcesses 返回本进程的全部子孙进程（即本地启动的浏览器进程树），读取 /proc
+func childProcesses() []processInfo {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	pageSize := int64(os.Getpagesize())
+	parents := make(map[int]int)
+	infos := make(map[int]processInfo)
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join("/proc", e.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		// pid (comm) state ppid ...，comm 可能包含空格与括号，以最后一个 ')' 分隔
+		stat := string(b)
+		open, end := strings.IndexByte(stat, '('), strings.LastIndexByte(stat, ')')
+		if open < 0 || end < open {
+			continue
+		}
+		fields := strings.Fields(stat[end+1:])
+		if len(fields) < 22 {
+			continue
+		}
+		ppid, _ := strconv.Atoi(fields[1])
+		rss, _ := strconv.ParseInt(fields[21], 10, 64)
+		parents[pid] = ppid
+		infos[pid] = processInfo{PID: pid, Name: stat[open+1 : end], RSS: rss * pageSize}
+	}
+
+	self := os.Getpid()
+	var out []processInfo
+	for pid, info := range infos {
+		for p := parents[pid]; p > 1; p = parents[p] {
+			if p == self {
+				out = append(out, info)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// readCPUTimes 读取 /proc/stat 中全部 CPU 的累计时间
+func readCPUTimes() (cpuTimes, bool) {
+	b, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return cpuTimes{}, false
+	}
+	line, _, _ := strings.Cut(string(b), "\n")
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return cpuTimes{}, false
+	}
+	var t cpuTimes
+	for i, f := range fields[1:] {
+		v, _ := strconv.ParseUint(f, 10, 64)
+		t.total += v
+		if i == 3 || i == 4 { // idle、iowait
+			t.idle += v
+		}
+	}
+	return t, true
+}
+
+// hostMemoryUsage 由 /proc/meminfo 的 MemTotal 与 MemAvailable 计算内存使用率
+func hostMemoryUsage() (float64, bool) {
+	b, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0, false
+	}
+	var total, available uint64
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total, _ = strconv.ParseUint(fields[1], 10, 64)
+		case "MemAvailable:":
+			available, _ = strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	if total == 0 || available > total {
+		return 0, false
+	}
+	return 1 - float64(available)/float64(total), true
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package main
+
+// childProcesses 仅 Linux 支持统计子进程
+func childProcesses() []processInfo {
+	return nil
+}
+
+// readCPUTimes 仅 Linux 支持采样 CPU 使用率
+func readCPUTimes() (cpuTimes, bool) {
+	return cpuTimes{}, false
+}
+
+// hostMemoryUsage 仅 Linux 支持采样内存使用率
+func hostMemoryUsage() (float64, bool) {
+	return 0, false
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 渲染队列 ======
+//
+// 并发数达到 render.max_concurrency 时，请求按 priority 排队等待（数值大的优先，相同时先到先得），
+// 队列长度超过 render.queue.size 或等待超过 render.queue.timeout 时返回 503。
+// 开播等时效性强的卡片可以设置较高的 priority，插到日常动态卡片之前。主机过载时低优先级请求不排队，见 shedding.go；
+// 按站点限制并发与公平分配见 fairness.go。
+
+const queueWaitHeader = "X-Queue-Wait-Ms"
+
+var (
+	errRenderBusy   = errors.New("server busy, try again later")
+	errQueueTimeout = errors.New("timed out waiting in render queue")
+)
+
+// slotWaiter 排队中的请求
+type slotWaiter struct {
+	site     string
+	priority int
+	seq      uint64
+	ready    chan struct{}
+	granted  bool // 已分配许可，由 concurrentMutex 保护
+	index    int
+}
+
+// waiterHeap 按 priority 降序、seq 升序排列的最大堆
+type waiterHeap []*slotWaiter
+
+func (h waiterHeap) Len() int { return len(h) }
+func (h waiterHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+func (h waiterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+func (h *waiterHeap) Push(x any) {
+	w := x.(*slotWaiter)
+	w.index = len(*h)
+	*h = append(*h, w)
+}
+func (h *waiterHeap) Pop() any {
+	old := *h
+	w := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return w
+}
+
+// 以下变量由 concurrentMutex 保护
+var (
+	renderQueue  waiterHeap
+	queueSeq     uint64
+	queueSize    = 100
+	queueTimeout = 30 * time.Second
+)
+
+var (
+	queueWaitSeconds = NewHistogram("snapcast_render_queue_wait_seconds", "Time spent waiting for a render slot.",
+		[]float64{0.01, 0.05, 0.1, 0.5, 1, 2, 5, 10, 30, 60})
+	queueRejectedTotal = NewCounterVec("snapcast_render_queue_rejected_total", "Requests that did not get a render slot by reason.", "reason")
+)
+
+func init() {
+	NewGaugeFunc("snapcast_render_queue_length", "Number of requests waiting for a render slot.", func() float64 {
+		concurrentMutex.Lock()
+		defer concurrentMutex.Unlock()
+		return float64(len(renderQueue))
+	})
+}
+
+// ConfigureRenderQueue 更新最大并发数与队列参数，由 ApplyDynamicConfig 调用；并发数调大时立即唤醒排队的请求
+func ConfigureRenderQueue(maxConc int) {
+	size := viper.GetInt("render.queue.size")
+	if size < 0 {
+		logger.Warn("❗ render.queue.size 不能为负数", zap.Int("size", size))
+		size = 0
+	}
+	timeout := 30 * time.Second
+	if viper.IsSet("render.queue.timeout") {
+		if d, err := ParseDuration(viper.Get("render.queue.timeout")); err != nil || d <= 0 {
+			logger.Warn("❗ render.queue.timeout 值无效", zap.Any("timeout", viper.Get("render.queue.timeout")), zap.String("default", "30s"))
+		} else {
+			timeout = d
+		}
+	}
+
+	concurrentMutex.Lock()
+	defer concurrentMutex.Unlock()
+	maxConcurrent = int32(maxConc)
+	queueSize, queueTimeout = size, timeout
+	grantWaitersLocked()
+}
+
+// acquireRenderSlot 获取并发许可，没有空闲许可或站点达到并发上限（见 fairness.go）时按 priority 排队。
+// 成功时返回释放函数与排队时间；队列已满、等待超时或 ctx 取消时返回错误。
+func acquireRenderSlot(ctx context.Context, site string, priority int) (func(), time.Duration, error) {
+	if shedLoad(priority) {
+		return nil, 0, errOverloaded
+	}
+	release := func() { releaseRenderSlot(site) }
+	concurrentMutex.Lock()
+	// 启用公平调度时，有空闲许可的情况下排队的请求都受站点上限限制，新请求可以直接获取
+	free := currentConcurrent < maxConcurrent && (len(renderQueue) == 0 || fairSettings != nil)
+	if free && siteAllowedLocked(site) {
+		currentConcurrent++
+		siteActive[site]++
+		concurrentMutex.Unlock()
+		return release, 0, nil
+	}
+	if free {
+		siteLimited.Inc(site) // 许可空闲但站点已达上限，不计入并发不足
+	} else {
+		queueSaturated = true
+	}
+	if len(renderQueue) >= queueSize {
+		concurrentMutex.Unlock()
+		queueRejectedTotal.Inc("full")
+		return nil, 0, errRenderBusy
+	}
+	queueSeq++
+	w := &slotWaiter{site: site, priority: priority, seq: queueSeq, ready: make(chan struct{})}
+	heap.Push(&renderQueue, w)
+	timeout := queueTimeout
+	concurrentMutex.Unlock()
+
+	start := time.Now()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-w.ready:
+	case <-timer.C:
+		err = errQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	wait := time.Since(start)
+
+	if err != nil {
+		concurrentMutex.Lock()
+		granted := w.granted
+		if !granted {
+			heap.Remove(&renderQueue, w.index)
+		}
+		concurrentMutex.Unlock()
+		if !granted {
+			reason := "timeout"
+			if err != errQueueTimeout {
+				reason = "canceled"
+			}
+			queueRejectedTotal.Inc(reason)
+			return nil, wait, err
+		}
+		// 超时与分配同时发生，按分配成功处理
+	}
+	queueWaitSeconds.Observe(wait.Seconds())
+	return release, wait, nil
+}
+
+// releaseRenderSlot 归还许可，有排队请求时直接转交给优先级最高的
+func releaseRenderSlot(site string) {
+	concurrentMutex.Lock()
+	defer concurrentMutex.Unlock()
+	currentConcurrent--
+	if siteActive[site]--; siteActive[site] <= 0 {
+		delete(siteActive, site)
+	}
+	grantWaitersLocked()
+}
+
+func grantWaitersLocked() {
+	for currentConcurrent < maxConcurrent && len(renderQueue) > 0 {
+		w := nextWaiterLocked()
+		if w == nil {
+			return
+		}
+		heap.Remove(&renderQueue, w.index)
+		w.granted = true
+		currentConcurrent++
+		siteActive[w.site]++
+		close(w.ready)
+	}
+}
+
+// acquireRequestSlot 为 HTTP 请求获取并发许可，失败时写出 503；排队时间写入响应头与访问日志
+func acquireRequestSlot(c *gin.Context, site string, priority int) (func(), bool) {
+	_, span := startSpan(c.Request.Context(), "queue")
+	release, wait, err := acquireRenderSlot(c.Request.Context(), site, priority)
+	span.SetAttr("snapcast.site", site)
+	span.SetAttr("snapcast.priority", priority)
+	span.End(err)
+	if wait > 0 {
+		c.Header(queueWaitHeader, strconv.FormatInt(wait.Milliseconds(), 10))
+		c.Set("queue_wait", wait)
+	}
+	if err != nil {
+		c.Set("render_error", err.Error())
+		retryAfter := "1"
+		if err == errOverloaded {
+			retryAfter = "5"
+		}
+		c.Header("Retry-After", retryAfter)
+		c.JSON(http.StatusServiceUnavailable, errResp(err.Error()))
+		return nil, false
+	}
+	return release, true
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"math"
+	"net/http"
 	"net/netip"
+	"strconv"
 	"sync"
 	"time"
 
@@ -9,17 +12,43 @@ import (
 	"go.uber.org/zap"
 )
 
+// 限流算法
+const (
+	RateLimitWindow      = "window"       // 滑动窗口
+	RateLimitTokenBucket = "token_bucket" // 令牌桶
+)
+
+// 限流维度
+const (
+	RateLimitByIP    = "ip"
+	RateLimitByToken = "token"
+)
+
 type RateLimiter struct {
 	mu       sync.RWMutex
 	window   time.Duration
 	maxReqs  int
 	maskBits int
-	requests map[uint64][]int64 // keyed by masked IP, value is slice of request timestamps
+	requests map[string][]int64 // keyed by masked IP or token, value is slice of request timestamps
 	enabled  bool
+
+	algorithm string
+	keyBy     string
+	rate      float64 // 令牌桶每秒补充数
+	burst     int     // 令牌桶容量
+	buckets   map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
 }
 
 var globalRateLimiter = &RateLimiter{
-	requests: make(map[uint64][]int64),
+	requests:  make(map[string][]int64),
+	buckets:   make(map[string]*tokenBucket),
+	algorithm: RateLimitWindow,
+	keyBy:     RateLimitByIP,
 }
 
 func ConfigureRateLimiter(enabled bool, window time.Duration, maxReqs int, maskBits int) {
@@ -30,7 +59,19 @@ func ConfigureRateLimiter(enabled bool, window time.Duration, maxReqs int, maskB
 	globalRateLimiter.window = window
 	globalRateLimiter.maxReqs = maxReqs
 	globalRateLimiter.maskBits = maskBits
-	globalRateLimiter.requests = make(map[uint64][]int64)
+	globalRateLimiter.requests = make(map[string][]int64)
+}
+
+// ConfigureTokenBucket 设置限流算法、维度与令牌桶参数
+func ConfigureTokenBucket(algorithm, keyBy string, rate float64, burst int) {
+	globalRateLimiter.mu.Lock()
+	defer globalRateLimiter.mu.Unlock()
+
+	globalRateLimiter.algorithm = algorithm
+	globalRateLimiter.keyBy = keyBy
+	globalRateLimiter.rate = rate
+	globalRateLimiter.burst = burst
+	globalRateLimiter.buckets = make(map[string]*tokenBucket)
 }
 
 // cleanup 定期清理过期的请求记录
@@ -38,7 +79,15 @@ func (r *RateLimiter) cleanup() {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	now := time.Now().UnixMilli()
+	// 令牌桶已回满的记录与新建无异，直接删除
+	nowTime := time.Now()
+	for key, b := range r.buckets {
+		if b.tokens+nowTime.Sub(b.last).Seconds()*r.rate >= float64(r.burst) {
+			delete(r.buckets, key)
+		}
+	}
+
+	now := nowTime.UnixMilli()
 	cutoff := now - r.window.Milliseconds()
 
 	for key, times := range r.requests {
@@ -56,29 +105,95 @@ func (r *RateLimiter) cleanup() {
 	}
 }
 
-// Allow 检查是否允许请求
-func (r *RateLimiter) Allow(ip string) bool {
+// Allow 检查是否允许请求，拒绝时返回建议的重试等待时间
+func (r *RateLimiter) Allow(key string) (bool, time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	if !r.enabled {
-		return true
+		return true, 0
+	}
+	if r.algorithm == RateLimitTokenBucket {
+		return r.allowTokenBucket(key)
+	}
+
+	now := time.Now().UnixMilli()
+	cutoff := now - r.window.Milliseconds()
+
+	// 清理过期记录
+	var valid []int64
+	for _, t := range r.requests[key] {
+		if t > cutoff {
+			valid = append(valid, t)
+		}
+	}
+
+	if len(valid) >= r.maxReqs {
+		r.requests[key] = valid
+		// 最早一条记录滑出窗口后即可重试
+		return false, time.Duration(valid[0]-cutoff) * time.Millisecond
+	}
+
+	// 记录新请求
+	valid = append(valid, now)
+	r.requests[key] = valid
+	return true, 0
+}
+
+// allowTokenBucket 令牌桶判定，调用方需持有锁
+func (r *RateLimiter) allowTokenBucket(key string) (bool, time.Duration) {
+	now := time.Now()
+	b, exists := r.buckets[key]
+	if !exists {
+		b = &tokenBucket{tokens: float64(r.burst), last: now}
+		r.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(r.burst), b.tokens+now.Sub(b.last).Seconds()*r.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if r.rate <= 0 {
+		return false, time.Minute
 	}
+	return false, time.Duration((1 - b.tokens) / r.rate * float64(time.Second))
+}
 
+// Key 计算请求的限流维度：按 token 限流时使用认证 token，缺失或无效时回退为掩码后的 IP。
+// 限流在认证之前执行，只有有效的 token 才单独计数，否则随意更换 token 即可绕过限流
+func (r *RateLimiter) Key(c *gin.Context) string {
+	r.mu.RLock()
+	keyBy, maskBits := r.keyBy, r.maskBits
+	r.mu.RUnlock()
+
+	if keyBy == RateLimitByToken {
+		if token := extractToken(c); lookupAuthToken(token, globalAuthToken.Load()) != nil {
+			return "token:" + token
+		}
+	}
+	return "ip:" + maskedIPKey(GetClientIP(c), maskBits)
+}
+
+// maskedIPKey 应用掩码获取 IP 的限流 key
+func maskedIPKey(ip string, maskBits int) string {
 	addr, err := netip.ParseAddr(ip)
 	if err != nil {
-		// 无效 IP 允许通过，由后续中间件处理
-		logger.Debug("⚠️ 无法解析 IP，跳过限流检查", zap.String("ip", ip), zap.Error(err))
-		return true
+		// 无效 IP 按原样计数
+		logger.Debug("⚠️ 无法解析 IP，按原始字符串限流", zap.String("ip", ip), zap.Error(err))
+		return ip
 	}
 
-	// 应用掩码获取 key
 	var key uint64
 	if addr.Is4() {
 		a := addr.As4()
-		bytesToUse := (r.maskBits + 7) / 8
+		bytesToUse := (maskBits + 7) / 8
 		if bytesToUse > 4 {
 			bytesToUse = 4
 		}
 		for i := 0; i < bytesToUse; i++ {
-			bitsToKeep := r.maskBits - i*8
+			bitsToKeep := maskBits - i*8
 			if bitsToKeep >= 8 {
 				key = (key << 8) | uint64(a[i])
 			} else if bitsToKeep > 0 {
@@ -88,12 +203,12 @@ func (r *RateLimiter) Allow(ip string) bool {
 	} else {
 		// IPv6 完整掩码支持
 		a := addr.As16()
-		bytesToUse := (r.maskBits + 7) / 8
+		bytesToUse := (maskBits + 7) / 8
 		if bytesToUse > 16 {
 			bytesToUse = 16
 		}
 		for i := 0; i < bytesToUse; i++ {
-			bitsToKeep := r.maskBits - i*8
+			bitsToKeep := maskBits - i*8
 			if bitsToKeep >= 8 {
 				key = (key << 8) | uint64(a[i])
 			} else if bitsToKeep > 0 {
@@ -101,30 +216,7 @@ func (r *RateLimiter) Allow(ip string) bool {
 			}
 		}
 	}
-
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	now := time.Now().UnixMilli()
-	cutoff := now - r.window.Milliseconds()
-
-	// 清理过期记录
-	var valid []int64
-	for _, t := range r.requests[key] {
-		if t > cutoff {
-			valid = append(valid, t)
-		}
-	}
-
-	if len(valid) >= r.maxReqs {
-		r.requests[key] = valid
-		return false
-	}
-
-	// 记录新请求
-	valid = append(valid, now)
-	r.requests[key] = valid
-	return true
+	return strconv.FormatUint(key, 16)
 }
 
 // StartCleanup 启动定期清理 goroutine
@@ -137,13 +229,23 @@ func StartRateLimiterCleanup(interval time.Duration) {
 	}()
 }
 
-// RateLimitMiddleware IP 限流中间件
+// RateLimitMiddleware 限流中间件，按 IP 或认证 token 计数
 func RateLimitMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		clientIP := GetClientIP(c)
-		if !globalRateLimiter.Allow(clientIP) {
-			logger.Warn("⚠️ IP 限流触发", zap.String("client_ip", clientIP))
-			c.AbortWithStatusJSON(429, errResp("rate limit exceeded, try again later"))
+		// 单张卡片可能引用大量远程图片，签名的资源代理请求不计入限流；存储对象由聊天平台拉取，同样不计入
+		if isSignedAssetRequest(c) || isStoredObjectRequest(c) {
+			c.Next()
+			return
+		}
+		key := globalRateLimiter.Key(c)
+		if allowed, retryAfter := globalRateLimiter.Allow(key); !allowed {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			if seconds < 1 {
+				seconds = 1
+			}
+			loggerFor(c.Request.Context()).Warn("⚠️ 限流触发", zap.String("client_ip", GetClientIP(c)), zap.Int("retry_after", seconds))
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, errResp("rate limit exceeded, try again later"))
 			return
 		}
 		c.Next()
@@ -0,0 +1,294 @@
+//go:build !nodelivery
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"SnapCast/extension"
+)
+
+// ====== 投递回执 ======
+//
+// 每次投递以投递 ID 记录各目标的回执（消息 ID），保留 delivery.receipts.ttl：
+//   - 投递 ID 取请求的 idempotency_key（或 Idempotency-Key 请求头），未指定时为 site/type/theme/data 的摘要
+//   - 同一投递 ID 的重试跳过已成功投递的目标，直接返回原回执（extra.duplicate 为 true）
+//   - GET /deliveries/:id 查询回执，排查“这张卡片到底发出去没有”
+//
+// 配置 delivery.receipts.file 时成功的回执追加写入文件，重启后仍然有效。
+
+// DeliveryRecord 一个投递 ID 下的全部成功回执
+type DeliveryRecord struct {
+	ID        string              `json:"id"`
+	Site      string              `json:"site"`
+	Type      string              `json:"type"`
+	CreatedAt time.Time           `json:"created_at"`
+	UpdatedAt time.Time           `json:"updated_at"`
+	Receipts  []extension.Receipt `json:"receipts"`
+	targets   map[string]int      // 目标标识 → Receipts 下标
+}
+
+// receiptLine 回执文件中的一行
+type receiptLine struct {
+	ID      string            `json:"id"`
+	Site    string            `json:"site"`
+	Type    string            `json:"type"`
+	Target  string            `json:"target"`
+	Receipt extension.Receipt `json:"receipt"`
+	Time    time.Time         `json:"time"`
+}
+
+type receiptStore struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	file      string
+	records   map[string]*DeliveryRecord
+	locks     map[string]*deliveryLock // 投递 ID → 进行中的投递，避免并发的相同请求重复投递
+	out       *os.File
+	lastSweep time.Time
+}
+
+type deliveryLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+var globalReceipts = &receiptStore{records: make(map[string]*DeliveryRecord), locks: make(map[string]*deliveryLock)}
+
+// configureReceiptStore 按配置设置保留时间与持久化文件，由 startSinks 调用
+func configureReceiptStore() {
+	ttl := 24 * time.Hour
+	if viper.IsSet("delivery.receipts.ttl") {
+		d, err := ParseDuration(viper.Get("delivery.receipts.ttl"))
+		if err != nil || d < 0 {
+			logger.Warn("❗ delivery.receipts.ttl 值无效", zap.Any("ttl", viper.Get("delivery.receipts.ttl")), zap.String("default", "24h"))
+		} else {
+			ttl = d
+		}
+	}
+	file := viper.GetString("delivery.receipts.file")
+
+	s := globalReceipts
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ttl = ttl
+	if file == s.file {
+		return
+	}
+	if s.out != nil {
+		s.out.Close()
+		s.out = nil
+	}
+	s.file = file
+	if file == "" || ttl == 0 {
+		return
+	}
+	if err := s.loadLocked(); err != nil {
+		logger.Warn("⚠️ 投递回执加载失败", zap.String("file", file), zap.Error(err))
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		logger.Warn("⚠️ 投递回执文件无法写入", zap.String("file", file), zap.Error(err))
+		return
+	}
+	out, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		logger.Warn("⚠️ 投递回执文件无法写入", zap.String("file", file), zap.Error(err))
+		return
+	}
+	s.out = out
+}
+
+// loadLocked 读取回执文件中未过期的记录，并重写文件去掉过期行
+func (s *receiptStore) loadLocked() error {
+	f, err := os.Open(s.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var kept []receiptLine
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		var line receiptLine
+		if json.Unmarshal(scanner.Bytes(), &line) != nil || time.Since(line.Time) > s.ttl {
+			continue
+		}
+		s.putLocked(line)
+		kept = append(kept, line)
+	}
+	f.Close()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	tmp := s.file + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(out)
+	for _, line := range kept {
+		enc.Encode(line)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	logger.Info("📒 已加载投递回执", zap.String("file", s.file), zap.Int("receipts", len(kept)))
+	return os.Rename(tmp, s.file)
+}
+
+func (s *receiptStore) putLocked(line receiptLine) {
+	rec, exists := s.records[line.ID]
+	if !exists {
+		rec = &DeliveryRecord{ID: line.ID, Site: line.Site, Type: line.Type, CreatedAt: line.Time, targets: make(map[string]int)}
+		s.records[line.ID] = rec
+	}
+	rec.UpdatedAt = line.Time
+	if i, found := rec.targets[line.Target]; found {
+		rec.Receipts[i] = line.Receipt
+		return
+	}
+	rec.targets[line.Target] = len(rec.Receipts)
+	rec.Receipts = append(rec.Receipts, line.Receipt)
+}
+
+// expiredLocked 记录是否已过期，过期的记录被删除
+func (s *receiptStore) expiredLocked(id string) bool {
+	rec, exists := s.records[id]
+	if !exists {
+		return true
+	}
+	if time.Since(rec.UpdatedAt) > s.ttl {
+		delete(s.records, id)
+		return true
+	}
+	return false
+}
+
+// Lock 串行化同一投递 ID 的投递，返回解锁函数
+func (s *receiptStore) Lock(id string) func() {
+	s.mu.Lock()
+	l, exists := s.locks[id]
+	if !exists {
+		l = &deliveryLock{}
+		s.locks[id] = l
+	}
+	l.refs++
+	s.mu.Unlock()
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		s.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(s.locks, id)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Lookup 返回目标已成功投递的回执
+func (s *receiptStore) Lookup(id, target string) (extension.Receipt, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ttl == 0 || s.expiredLocked(id) {
+		return extension.Receipt{}, false
+	}
+	rec := s.records[id]
+	i, found := rec.targets[target]
+	if !found {
+		return extension.Receipt{}, false
+	}
+	return rec.Receipts[i], true
+}
+
+// Record 记录成功投递的回执
+func (s *receiptStore) Record(id string, payload *PushPayload, target string, receipt extension.Receipt) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ttl == 0 {
+		return
+	}
+	s.expiredLocked(id)
+	if now := time.Now(); now.Sub(s.lastSweep) > time.Minute {
+		for rid, rec := range s.records {
+			if now.Sub(rec.UpdatedAt) > s.ttl {
+				delete(s.records, rid)
+			}
+		}
+		s.lastSweep = now
+	}
+	line := receiptLine{ID: id, Site: payload.Site, Type: payload.Type, Target: target, Receipt: receipt, Time: time.Now()}
+	s.putLocked(line)
+	if s.out != nil {
+		b, _ := json.Marshal(line)
+		if _, err := s.out.Write(append(b, '\n')); err != nil {
+			logger.Warn("⚠️ 投递回执写入失败", zap.String("file", s.file), zap.Error(err))
+		}
+	}
+}
+
+// Get 返回投递 ID 的记录副本
+func (s *receiptStore) Get(id string) (*DeliveryRecord, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.expiredLocked(id) {
+		return nil, false
+	}
+	rec := *s.records[id]
+	rec.Receipts = append([]extension.Receipt(nil), rec.Receipts...)
+	return &rec, true
+}
+
+// deliveryID 返回投递 ID：请求的 idempotency_key，未指定时为内容摘要
+func deliveryID(payload *PushPayload) string {
+	if payload.IdempotencyKey != "" {
+		return payload.IdempotencyKey
+	}
+	data, _ := json.Marshal(payload.Data)
+	h := sha256.New()
+	for _, part := range []string{payload.Site, payload.Type, payload.Theme, string(data)} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return "sha256-" + hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// targetKey 投递目标的标识：Sink 名与参数
+func targetKey(target extension.Target) string {
+	params, _ := json.Marshal(target.Params)
+	return target.Sink + " " + string(params)
+}
+
+// registerDeliveryRoutes 注册回执查询接口
+func registerDeliveryRoutes(r *gin.Engine) {
+	r.GET("/deliveries/:id", DeliveryLookupHandler)
+}
+
+// DeliveryLookupHandler 查询投递 ID 的回执，限定了 scopes 的 token 只能查询范围内的记录
+func DeliveryLookupHandler(c *gin.Context) {
+	rec, found := globalReceipts.Get(c.Param("id"))
+	if found {
+		if p := principalFrom(c.Request.Context()); p != nil && !p.allows(rec.Site, rec.Type) {
+			found = false
+		}
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, errResp("delivery not found"))
+		return
+	}
+	c.JSON(http.StatusOK, ok(rec))
+}
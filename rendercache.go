@@ -0,0 +1,359 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ====== 渲染结果缓存 ======
+//
+// 相同的请求（如反复查询的直播状态）直接返回缓存的渲染结果。缓存键为模板文件
+// （路径、修改时间、大小）、site/type/output、data 与合并默认值后的渲染参数的哈希，
+// 模板修改后自然失效，配置重载时清空。请求头 Cache-Control: no-cache 跳过读取缓存，
+// no-store 不写入缓存。
+
+const renderCacheHeader = "X-SnapCast-Cache"
+
+// 缓存状态，通过 X-SnapCast-Cache 响应头返回
+const (
+	CacheHit    = "HIT"
+	CacheMiss   = "MISS"
+	CacheBypass = "BYPASS"
+)
+
+var renderCacheTotal = NewCounterVec("snapcast_render_cache_total", "Render cache lookups by result.", "result")
+
+type renderCacheEntry struct {
+	key       string
+	result    RenderResult
+	createdAt time.Time
+}
+
+func (e *renderCacheEntry) size() int64 {
+	return int64(len(e.result.Body) + len(e.key) + 256)
+}
+
+// renderCacheMeta 磁盘缓存的元数据，与结果文件同名加 .json 后缀
+type renderCacheMeta struct {
+	Template    string    `json:"template"`
+	ContentType string    `json:"content_type"`
+	JSON        any       `json:"json,omitempty"`
+	HTMLSize    int       `json:"html_size"`
+	Signature   string    `json:"signature,omitempty"`
+	Alt         string    `json:"alt,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// RenderCache 内存 LRU + 可选磁盘持久化
+type RenderCache struct {
+	mu       sync.Mutex
+	enabled  bool
+	ll       *list.List
+	items    map[string]*list.Element
+	size     int64
+	maxBytes int64
+	ttl      time.Duration
+	dir      string
+}
+
+var globalRenderCache = &RenderCache{
+	ll:    list.New(),
+	items: make(map[string]*list.Element),
+}
+
+// Configure 按配置更新缓存参数并清空内存缓存，由 ApplyDynamicConfig 调用
+func (c *RenderCache) Configure(enabled bool, ttl time.Duration, maxBytes int64, dir string) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			logger.Warn("⚠️ 渲染缓存目录创建失败，仅使用内存缓存", zap.String("dir", dir), zap.Error(err))
+			dir = ""
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.enabled = enabled
+	c.ttl = ttl
+	c.maxBytes = maxBytes
+	c.dir = dir
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+	c.size = 0
+}
+
+func (c *RenderCache) Enabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.enabled
+}
+
+// Get 依次查找内存、磁盘缓存
+func (c *RenderCache) Get(key string) (*RenderResult, bool) {
+	c.mu.Lock()
+	if el, hit := c.items[key]; hit {
+		entry := el.Value.(*renderCacheEntry)
+		if time.Since(entry.createdAt) < c.ttl {
+			c.ll.MoveToFront(el)
+			c.mu.Unlock()
+			result := entry.result
+			return &result, true
+		}
+		c.removeElement(el)
+	}
+	dir, ttl := c.dir, c.ttl
+	c.mu.Unlock()
+
+	entry := loadRenderCacheDisk(dir, key, ttl)
+	if entry == nil {
+		return nil, false
+	}
+	c.add(entry)
+	result := entry.result
+	return &result, true
+}
+
+// Put 保存渲染结果，投递回执等与单次请求相关的字段不缓存
+func (c *RenderCache) Put(key string, r *RenderResult) {
+	entry := &renderCacheEntry{
+		key:       key,
+		result:    RenderResult{Template: r.Template, ContentType: r.ContentType, Body: r.Body, JSON: r.JSON, HTMLSize: r.HTMLSize, Signature: r.Signature, Alt: r.Alt},
+		createdAt: time.Now(),
+	}
+	c.add(entry)
+	c.mu.Lock()
+	dir := c.dir
+	c.mu.Unlock()
+	saveRenderCacheDisk(dir, entry)
+}
+
+func (c *RenderCache) add(entry *renderCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, exists := c.items[entry.key]; exists {
+		c.removeElement(el)
+	}
+	c.items[entry.key] = c.ll.PushFront(entry)
+	c.size += entry.size()
+	for c.size > c.maxBytes && c.ll.Len() > 1 {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// removeElement 调用方需持有锁
+func (c *RenderCache) removeElement(el *list.Element) {
+	entry := el.Value.(*renderCacheEntry)
+	c.ll.Remove(el)
+	delete(c.items, entry.key)
+	c.size -= entry.size()
+}
+
+func loadRenderCacheDisk(dir, key string, ttl time.Duration) *renderCacheEntry {
+	if dir == "" {
+		return nil
+	}
+	metaBytes, err := os.ReadFile(filepath.Join(dir, key+".json"))
+	if err != nil {
+		return nil
+	}
+	var meta renderCacheMeta
+	if json.Unmarshal(metaBytes, &meta) != nil || time.Since(meta.CreatedAt) >= ttl {
+		return nil
+	}
+	body, err := os.ReadFile(filepath.Join(dir, key))
+	if err != nil {
+		return nil
+	}
+	return &renderCacheEntry{
+		key:       key,
+		result:    RenderResult{Template: meta.Template, ContentType: meta.ContentType, Body: body, JSON: meta.JSON, HTMLSize: meta.HTMLSize, Signature: meta.Signature, Alt: meta.Alt},
+		createdAt: meta.CreatedAt,
+	}
+}
+
+func saveRenderCacheDisk(dir string, entry *renderCacheEntry) {
+	if dir == "" {
+		return
+	}
+	r := entry.result
+	meta, _ := json.Marshal(renderCacheMeta{Template: r.Template, ContentType: r.ContentType, JSON: r.JSON, HTMLSize: r.HTMLSize, Signature: r.Signature, Alt: r.Alt, CreatedAt: entry.createdAt})
+	if err := os.WriteFile(filepath.Join(dir, entry.key), r.Body, 0644); err != nil {
+		logger.Debug("⚠️ 渲染缓存写入磁盘失败", zap.Error(err))
+		return
+	}
+	_ = os.WriteFile(filepath.Join(dir, entry.key+".json"), meta, 0644)
+}
+
+// StartRenderCacheGC 定期清理磁盘上过期的渲染缓存
+func StartRenderCacheGC(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		for range ticker.C {
+			c := globalRenderCache
+			c.mu.Lock()
+			dir, ttl := c.dir, c.ttl
+			c.mu.Unlock()
+			if dir == "" {
+				continue
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				continue
+			}
+			removed := 0
+			for _, e := range entries {
+				if !isCacheFile(e.Name()) {
+					continue // 目录中的其他文件不属于缓存
+				}
+				info, err := e.Info()
+				if err != nil || time.Since(info.ModTime()) < ttl {
+					continue
+				}
+				if os.Remove(filepath.Join(dir, e.Name())) == nil {
+					removed++
+				}
+			}
+			if removed > 0 {
+				logger.Debug("🗑️ 已清理过期渲染缓存", zap.Int("files", removed))
+			}
+		}
+	}()
+}
+
+// isCacheFile 是否为渲染缓存或资源缓存写入的文件：以缓存键（sha256 十六进制）命名的内容及其 .json 元数据
+func isCacheFile(name string) bool {
+	key := strings.TrimSuffix(name, ".json")
+	if len(key) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(key)
+	return err == nil
+}
+
+// renderCacheKey 计算缓存键（含附属配置及其引用的脚本文件的修改时间），模板文件不可读时返回空字符串（不缓存）
+func renderCacheKey(rc *RenderContext) string {
+	info, err := os.Stat(rc.Template)
+	if err != nil {
+		return ""
+	}
+	data, err := json.Marshal(rc.Payload.Data) // map 按键排序，结果稳定
+	if err != nil {
+		return ""
+	}
+	opts, err := json.Marshal(rc.Options)
+	if err != nil {
+		return ""
+	}
+	h := sha256.New()
+	if meta, err := os.Stat(metaPath(rc.Template)); err == nil {
+		h.Write([]byte(strconv.FormatInt(meta.ModTime().UnixNano(), 10)))
+	}
+	if rc.Meta != nil {
+		for _, file := range rc.Meta.scriptFiles {
+			script, err := os.Stat(file)
+			if err != nil {
+				continue
+			}
+			for _, part := range []string{file, strconv.FormatInt(script.ModTime().UnixNano(), 10), strconv.FormatInt(script.Size(), 10)} {
+				h.Write([]byte(part))
+				h.Write([]byte{0})
+			}
+		}
+	}
+	for _, part := range []string{
+		rc.Template, strconv.FormatInt(info.ModTime().UnixNano(), 10), strconv.FormatInt(info.Size(), 10),
+		rc.Payload.Site, rc.Payload.Type, rc.Payload.Output, rc.Payload.Theme, currentLocaleVersion(),
+	} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	h.Write(data)
+	h.Write([]byte{0})
+	h.Write(opts)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// CacheDirective 请求头 Cache-Control 中与渲染缓存相关的指令
+type CacheDirective struct {
+	NoCache bool // 跳过读取缓存
+	NoStore bool // 不写入缓存
+}
+
+type cacheDirectiveKey struct{}
+
+// ParseCacheControl 解析 Cache-Control 请求头
+func ParseCacheControl(header string) CacheDirective {
+	var d CacheDirective
+	for _, part := range strings.Split(header, ",") {
+		switch strings.ToLower(strings.TrimSpace(part)) {
+		case "no-cache":
+			d.NoCache = true
+		case "no-store":
+			d.NoStore = true
+		}
+	}
+	return d
+}
+
+// withCacheDirective 将缓存指令写入 context
+func withCacheDirective(ctx context.Context, d CacheDirective) context.Context {
+	return context.WithValue(ctx, cacheDirectiveKey{}, d)
+}
+
+func cacheDirectiveFrom(ctx context.Context) CacheDirective {
+	d, _ := ctx.Value(cacheDirectiveKey{}).(CacheDirective)
+	return d
+}
+
+// renderCacheMiddleware 命中时直接返回缓存结果（仍执行投递），未命中时在渲染成功后写入缓存
+func renderCacheMiddleware(rc *RenderContext) error {
+	c := globalRenderCache
+	if !c.Enabled() || rc.Options.Trace || rc.Payload.warmup {
+		return rc.Next()
+	}
+	key := renderCacheKey(rc)
+	if key == "" {
+		return rc.Next()
+	}
+	directive := cacheDirectiveFrom(rc.Ctx)
+
+	if !directive.NoCache {
+		if result, hit := c.Get(key); hit {
+			renderCacheTotal.Inc("hit")
+			rc.Logger.Debug("💾 渲染缓存命中", zap.String("key", key[:16]))
+			result.Cache = CacheHit
+			rc.Result = result
+			if len(rc.Payload.Deliver) > 0 {
+				rc.Result.Receipts = deliverResult(rc.Ctx, rc.Payload, rc.Result)
+			}
+			return nil
+		}
+	}
+
+	if err := rc.Next(); err != nil {
+		return err
+	}
+	if rc.Result == nil {
+		return nil
+	}
+	if directive.NoCache {
+		renderCacheTotal.Inc("bypass")
+		rc.Result.Cache = CacheBypass
+	} else {
+		renderCacheTotal.Inc("miss")
+		rc.Result.Cache = CacheMiss
+	}
+	if !directive.NoStore {
+		c.Put(key, rc.Result)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap/zapcore"
+)
+
+// cmdRender 不启动 HTTP 服务，直接渲染一次并写出结果：
+//
+//	snapcast render --site bilibili --type live --data data.json --out card.png
+//
+// 用于模板开发、CI 中的图片对比与定时任务。配置文件不存在时使用内置默认配置。
+func cmdRender(args []string) int {
+	fset := flag.NewFlagSet("render", flag.ContinueOnError)
+	site := fset.String("site", "", "站点名称（必填）")
+	typ := fset.String("type", "", "类型名称（必填）")
+	dataFile := fset.String("data", "", "数据文件（JSON），- 为标准输入；为空则使用模板的示例数据")
+	scenario := fset.String("scenario", "", "示例数据场景，如 live_end，未指定 --data 时生效")
+	output := fset.String("output", "image", "输出模式：image、html、json")
+	theme := fset.String("theme", "", "主题，如 light、dark")
+	lang := fset.String("lang", "", "卡片语言，如 zh-CN、en")
+	optionsJSON := fset.String("options", "", `渲染参数（JSON），如 '{"format":"jpeg","quality":80}'`)
+	out := fset.String("out", "", "输出文件，- 为标准输出；默认 <site>_<type>.<扩展名>")
+	configFile := fset.String("config", setupConfigFile, "配置文件，不存在时使用内置默认配置")
+	templateDir := fset.String("templates", "", "模板目录，默认使用配置中的 template.dir")
+	timeout := fset.Duration("timeout", time.Minute, "整体超时")
+	verbose := fset.Bool("v", false, "输出详细日志")
+	fset.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: snapcast render --site 站点 --type 类型 [--data 文件] [--out 文件] [选项]")
+		fset.PrintDefaults()
+	}
+	if err := fset.Parse(args); err != nil || *site == "" || *typ == "" || fset.NArg() > 0 {
+		fset.Usage()
+		return 2
+	}
+
+	payload := PushPayload{Site: *site, Type: *typ, Output: *output, Theme: *theme}
+	if *optionsJSON != "" {
+		if err := json.Unmarshal([]byte(*optionsJSON), &payload.Options); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ --options 不是有效的 JSON:", err)
+			return 2
+		}
+	}
+	if *lang != "" {
+		if payload.Options == nil {
+			payload.Options = &RenderOptions{}
+		}
+		payload.Options.Lang = *lang
+	}
+
+	if err := initOneShotRender(*configFile, *templateDir, *verbose); err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+	defer globalAllocCancel()
+	if err := loadRenderData(&payload, *dataFile, *scenario); err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	result, err := renderPayload(ctx, &payload)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ 渲染失败:", err)
+		return 1
+	}
+
+	dst := *out
+	if dst == "" {
+		dst = *site + "_" + *typ + contentTypeExt[result.ContentType]
+	}
+	if dst == "-" {
+		_, err = os.Stdout.Write(result.Body)
+	} else {
+		err = os.WriteFile(dst, result.Body, 0644)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ 写出结果失败:", err)
+		return 1
+	}
+	if dst != "-" {
+		fmt.Fprintf(os.Stderr, "✅ 已渲染 %s（%s，%d 字节，%s）\n", dst, result.Template, len(result.Body), result.Duration.Round(time.Millisecond))
+	}
+	return 0
+}
+
+// initOneShotRender 准备命令行渲染环境：日志写 stderr（stdout 留给输出），加载配置、模板、扩展并启动浏览器。
+// 成功后由调用方负责 globalAllocCancel。
+func initOneShotRender(configFile, templateDir string, verbose bool) error {
+	logLevel.SetLevel(zapcore.WarnLevel)
+	initLogger("stderr")
+	if err := loadRenderConfig(configFile); err != nil {
+		return fmt.Errorf("配置文件加载失败: %w", err)
+	}
+	if verbose {
+		logLevel.SetLevel(zapcore.DebugLevel)
+	} else {
+		logLevel.SetLevel(zapcore.WarnLevel)
+	}
+
+	if templateDir == "" {
+		templateDir = viper.GetString("template.dir")
+	}
+	if err := loadTemplates(templateDir); err != nil {
+		return fmt.Errorf("加载模板失败: %w", err)
+	}
+
+	// 与服务模式相同的扩展与渲染环境，不启用缓存、签名与资源代理
+	LoadPlugins(viper.GetString("plugins.dir"))
+	LoadWasmModules(viper.GetString("wasm.dir"))
+	applyExtensionFuncs()
+	UseRenderMiddleware(StageTransform, "cdp-trace", traceMiddleware)
+	viper.Set("assets.enabled", false)
+	InitAssetProxy()
+	fontOpts := InitFonts()
+	if remoteURL := viper.GetString("render.remote_debugging_url"); remoteURL != "" {
+		InitRemoteAllocator(remoteURL)
+	} else {
+		InitGlobalAllocator(resolveBrowserPath(), fontOpts...)
+	}
+	return nil
+}
+
+// loadRenderConfig 读取配置文件，不存在时使用内置默认配置，不会在磁盘上生成文件
+func loadRenderConfig(file string) error {
+	bindEnv()
+	viper.SetConfigType("yaml")
+	if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+		if err := viper.ReadConfig(bytes.NewReader(defaultConfig())); err != nil {
+			return err
+		}
+	} else {
+		viper.SetConfigFile(file)
+		if err := viper.ReadInConfig(); err != nil {
+			return err
+		}
+		if err := applyConfigMigration(); err != nil {
+			return err
+		}
+	}
+	ApplyDynamicConfig()
+	return nil
+}
+
+// loadRenderData 读取 --data 指定的数据，未指定时使用模板 scenario 场景的示例数据
+func loadRenderData(payload *PushPayload, file, scenario string) error {
+	if file == "" {
+		tmplPath := selectTemplate(*payload)
+		if tmplPath == "" {
+			return fmt.Errorf("未找到模板 %s/%s", payload.Site, payload.Type)
+		}
+		data, err := loadSampleScenario(tmplPath, scenario)
+		if errors.Is(err, os.ErrNotExist) && scenario != "" {
+			return fmt.Errorf("未找到示例数据 %s", scenarioPath(tmplPath, scenario))
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			payload.Data = map[string]any{}
+			return nil
+		}
+		payload.Data = data
+		return err
+	}
+
+	var raw []byte
+	var err error
+	if file == "-" {
+		raw, err = io.ReadAll(os.Stdin)
+	} else {
+		raw, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, &payload.Data); err != nil {
+		return fmt.Errorf("数据文件不是有效的 JSON: %w", err)
+	}
+	return nil
+}
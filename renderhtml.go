@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/chromedp/cdproto/fetch"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== HTML 直出截图 ======
+//
+// POST /render/html 接收上游已生成好的完整 HTML，跳过模板直接截图：
+//
+//	{"html": "<html>...</html>", "css": "body{margin:0}", "options": {"viewport": {"width": 600}}}
+//
+// 仍然经过渲染管线的 capture 及之后的阶段（字体、资源代理、签名、保存等），与 /capture 一样不对限定了 scopes 的 token 开放。
+//
+// HTML 完全由调用方提供，端点默认关闭，需配置 server.html_endpoint 开启。页面的请求经 Fetch 拦截：
+// 指向内网、回环、链路本地地址（如云厂商元数据 169.254.169.254）的请求、file:// 资源与 iframe 一律拒绝，
+// 经签名的资源代理地址除外。
+
+// HTMLRenderPayload /render/html 请求体
+type HTMLRenderPayload struct {
+	HTML     string         `json:"html"`
+	CSS      string         `json:"css"`      // 追加到 </head> 之前的样式
+	Site     string         `json:"site"`     // 用于日志、指标与对象名，默认 html
+	Type     string         `json:"type"`     // 默认 raw
+	Output   string         `json:"output"`   // "image"（默认）或 "json"
+	Response string         `json:"response"` // "body"（默认）或 "url"
+	Priority int            `json:"priority"`
+	Debug    bool           `json:"debug"` // 失败时在响应中附带页面控制台输出
+	Options  *RenderOptions `json:"options,omitempty"`
+}
+
+// htmlEndpoint 端点路径，未配置或为空字符串时关闭
+func htmlEndpoint() string {
+	return viper.GetString("server.html_endpoint")
+}
+
+// HTMLRenderHandler 截图请求中的 HTML
+func HTMLRenderHandler(c *gin.Context) {
+	log := loggerFor(c.Request.Context())
+	if p := principalFrom(c.Request.Context()); p != nil && p.scoped() {
+		log.Warn("⛔ token 权限范围不包含 HTML 直出", zap.String("token", p.name))
+		c.JSON(http.StatusForbidden, errResp("token scope does not allow raw html"))
+		return
+	}
+	var req HTMLRenderPayload
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error("❕ 传递参数有误", zap.Error(err))
+		c.Set("render_error", err.Error())
+		c.JSON(http.StatusBadRequest, errResp(err.Error()))
+		return
+	}
+	if strings.TrimSpace(req.HTML) == "" {
+		c.JSON(http.StatusBadRequest, errResp("html is required"))
+		return
+	}
+	if req.Output == "html" {
+		c.JSON(http.StatusBadRequest, errResp("invalid output: must be image or json"))
+		return
+	}
+	if req.Site == "" {
+		req.Site = "html"
+	}
+	if req.Type == "" {
+		req.Type = "raw"
+	}
+	if !templateKeyRegex.MatchString(req.Site) || !templateKeyRegex.MatchString(req.Type) {
+		c.JSON(http.StatusBadRequest, errResp("invalid site or type: only letters, digits and underscore are allowed"))
+		return
+	}
+	payload := PushPayload{
+		Site:     req.Site,
+		Type:     req.Type,
+		Output:   req.Output,
+		Response: req.Response,
+		Priority: req.Priority,
+		Debug:    req.Debug,
+		Options:  req.Options,
+		rawHTML:  injectCSS(req.HTML, req.CSS),
+	}
+	c.Set("render_site", payload.Site)
+	c.Set("render_type", payload.Type)
+	if applyAcceptLanguage(&payload, c.GetHeader("Accept-Language")) {
+		c.Header("Vary", "Accept-Language")
+	}
+
+	release, acquired := acquireRequestSlot(c, payload.Site, payload.Priority)
+	if !acquired {
+		return
+	}
+	defer release()
+
+	result, err := renderPayload(c.Request.Context(), &payload)
+	if err != nil {
+		c.Set("render_error", err.Error())
+		c.JSON(renderErrorStatus(err), renderErrorResp(&payload, err))
+		return
+	}
+	writeRenderResult(c, &payload, result)
+}
+
+// injectCSS 将样式插入 </head> 之前，没有 head 时放在文档开头
+func injectCSS(html, css string) string {
+	if strings.TrimSpace(css) == "" {
+		return html
+	}
+	style := "<style>" + strings.ReplaceAll(css, "</style", `<\/style`) + "</style>"
+	if i := strings.Index(strings.ToLower(html), "</head>"); i >= 0 {
+		return html[:i] + style + html[i:]
+	}
+	return style + html
+}
+
+// blockPrivateRequests 返回在加载 HTML 前启用请求拦截的动作，docURL 为页面本身的地址
+func blockPrivateRequests(docURL string, log *zap.Logger) chromedp.Action {
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		chromedp.ListenTarget(ctx, func(ev any) {
+			e, isPaused := ev.(*fetch.EventRequestPaused)
+			if !isPaused {
+				return
+			}
+			go func() {
+				if reason := blockedRequestReason(ctx, e, docURL); reason != "" {
+					log.Warn("⛔ 已拦截 HTML 页面的请求", zap.String("url", e.Request.URL), zap.String("reason", reason))
+					_ = fetch.FailRequest(e.RequestID, network.ErrorReasonBlockedByClient).Do(ctx)
+					return
+				}
+				_ = fetch.ContinueRequest(e.RequestID).Do(ctx)
+			}()
+		})
+		return fetch.Enable().WithPatterns([]*fetch.RequestPattern{{URLPattern: "*"}}).Do(ctx)
+	})
+}
+
+// blockedRequestReason 判断调用方 HTML 发起的请求是否允许，拒绝时返回原因
+func blockedRequestReason(ctx context.Context, e *fetch.EventRequestPaused, docURL string) string {
+	raw := e.Request.URL
+	if raw == docURL {
+		return ""
+	}
+	if ac := globalAssetCache; ac.endpoint != "" && strings.HasPrefix(raw, ac.baseURL+ac.endpoint+"?") {
+		return "" // 资源代理只拉取签名过且经 validateURL 校验的地址
+	}
+	if e.ResourceType == network.ResourceTypeDocument {
+		// iframe 与脚本发起的跳转；跨站 iframe 运行在独立的目标中，不经过本页的拦截
+		return "document"
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "invalid url"
+	}
+	switch u.Scheme {
+	case "data", "blob", "about":
+		return ""
+	case "http", "https", "ws", "wss":
+	default:
+		return "scheme " + u.Scheme
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if isPrivateIP(ip.String()) {
+			return "private address"
+		}
+		return ""
+	}
+	lctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(lctx, host)
+	if err != nil {
+		return "dns lookup failed"
+	}
+	for _, a := range addrs {
+		if isPrivateIP(a.IP.String()) {
+			return "private address"
+		}
+	}
+	return ""
+}
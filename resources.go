@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chromedp/chromedp"
+	"go.uber.org/zap"
+)
+
+// ====== 渲染资源追踪 ======
+//
+// 每次渲染创建一个 resourceTracker，临时文件、浏览器标签页等资源通过 Track 登记，
+// 正常路径下由调用方释放；渲染结束时仍未释放的资源会被强制回收并计入
+// snapcast_resources_reclaimed_total。进程异常退出遗留的临时文件由定期清理回收。
+
+// 资源类型
+const (
+	ResourceTempFile = "temp_file"
+	ResourceTab      = "tab"
+)
+
+// tempFilePrefix 渲染临时文件前缀，定期清理仅处理此前缀的文件
+const tempFilePrefix = "snapcast_"
+
+// orphanTempFileAge 超过该时间的临时文件视为遗留（远大于渲染超时上限）
+const orphanTempFileAge = 10 * time.Minute
+
+var (
+	resourcesReclaimed = NewCounterVec("snapcast_resources_reclaimed_total", "Leaked render resources reclaimed by the tracker or the orphan sweep.", "kind")
+	activeMutex        sync.Mutex
+	activeCounts       = map[string]float64{ResourceTempFile: 0, ResourceTab: 0}
+)
+
+func init() {
+	NewGaugeVecFunc("snapcast_resources_active", "Render resources currently held.", func() map[string]float64 {
+		activeMutex.Lock()
+		defer activeMutex.Unlock()
+		out := make(map[string]float64, len(activeCounts))
+		for k, v := range activeCounts {
+			out[k] = v
+		}
+		return out
+	}, "kind")
+}
+
+func adjustActive(kind string, delta float64) {
+	activeMutex.Lock()
+	activeCounts[kind] += delta
+	activeMutex.Unlock()
+}
+
+type trackedResource struct {
+	kind    string
+	name    string
+	cleanup func() error
+}
+
+type resourceTracker struct {
+	mu    sync.Mutex
+	items map[int]*trackedResource
+	next  int
+	log   *zap.Logger
+	trace *cdpTrace // options.trace 开启时记录标签页的 CDP 消息
+
+	blockPrivate bool // 页面 HTML 由调用方提供（/render/html），拦截访问内网与本地文件的请求
+
+	jsHeap    int64          // 标签页关闭前采样的 JS 堆峰值，见 accounting.go
+	sandboxes []*pageSandbox // 各标签页的资源上限监视，见 sandbox.go
+	console   pageConsole    // 各标签页的控制台输出，见 console.go
+}
+
+type trackerKey struct{}
+
+func newResourceTracker(log *zap.Logger) *resourceTracker {
+	return &resourceTracker{items: make(map[int]*trackedResource), log: log}
+}
+
+// withResourceTracker 将追踪器写入 context
+func withResourceTracker(ctx context.Context, t *resourceTracker) context.Context {
+	return context.WithValue(ctx, trackerKey{}, t)
+}
+
+// trackerFrom 读取 context 中的追踪器，不存在时返回独立追踪器（仅由调用方释放）
+func trackerFrom(ctx context.Context) *resourceTracker {
+	if t, ok := ctx.Value(trackerKey{}).(*resourceTracker); ok {
+		return t
+	}
+	return newResourceTracker(loggerFor(ctx))
+}
+
+// Track 登记资源，返回的 release 执行清理并注销，可重复调用
+func (t *resourceTracker) Track(kind, name string, cleanup func() error) (release func()) {
+	t.mu.Lock()
+	id := t.next
+	t.next++
+	t.items[id] = &trackedResource{kind: kind, name: name, cleanup: cleanup}
+	t.mu.Unlock()
+	adjustActive(kind, 1)
+
+	return func() {
+		t.mu.Lock()
+		r, exists := t.items[id]
+		delete(t.items, id)
+		t.mu.Unlock()
+		if exists {
+			t.release(r)
+		}
+	}
+}
+
+func (t *resourceTracker) release(r *trackedResource) {
+	adjustActive(r.kind, -1)
+	if err := r.cleanup(); err != nil {
+		t.log.Debug("🗑️ 资源释放失败", zap.String("kind", r.kind), zap.String("name", r.name), zap.Error(err))
+	}
+}
+
+// Close 回收全部未释放的资源，渲染结束时调用
+func (t *resourceTracker) Close() {
+	t.mu.Lock()
+	items := t.items
+	t.items = make(map[int]*trackedResource)
+	t.mu.Unlock()
+
+	for _, r := range items {
+		t.log.Warn("♻️ 回收未释放的渲染资源", zap.String("kind", r.kind), zap.String("name", r.name))
+		resourcesReclaimed.Inc(r.kind)
+		t.release(r)
+	}
+}
+
+// TempHTML 将 HTML 写入临时文件并返回 file:// 地址
+func (t *resourceTracker) TempHTML(html, name string) (string, func(), error) {
+	tmpFile, err := os.CreateTemp(os.TempDir(), tempFilePrefix+name+"_*.html")
+	if err != nil {
+		return "", nil, err
+	}
+	tmpPath := tmpFile.Name()
+	release := t.Track(ResourceTempFile, tmpPath, func() error {
+		tmpFile.Close()
+		return os.Remove(tmpPath)
+	})
+	if _, err := tmpFile.WriteString(html); err != nil {
+		release()
+		return "", nil, err
+	}
+	tmpFile.Close()
+
+	absPath, _ := filepath.Abs(tmpPath)
+	fileURL := "file://" + absPath
+	if runtime.GOOS != "windows" {
+		fileURL = "file:///" + absPath
+	}
+	return fileURL, release, nil
+}
+
+// Tab 打开新的浏览器标签页
+func (t *resourceTracker) Tab(timeoutMs int64) (context.Context, func()) {
+	var opts []chromedp.ContextOption
+	if t.trace != nil {
+		opts = t.trace.contextOptions()
+	}
+	ctx, cancel := NewTabContext(timeoutMs, opts...)
+	t.console.watch(ctx)
+	if s := watchSandbox(ctx, cancel, t.log); s != nil {
+		t.mu.Lock()
+		t.sandboxes = append(t.sandboxes, s)
+		t.mu.Unlock()
+	}
+	release := t.Track(ResourceTab, "tab", func() error {
+		t.sampleJSHeap(ctx)
+		cancel()
+		return nil
+	})
+	return ctx, release
+}
+
+// Console 返回本次渲染中页面的控制台输出与丢弃的条数
+func (t *resourceTracker) Console() ([]ConsoleEntry, int) {
+	return t.console.Entries()
+}
+
+// SandboxErr 返回本次渲染中标签页超出资源上限的原因，未超限时为 nil
+func (t *resourceTracker) SandboxErr() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, s := range t.sandboxes {
+		if err := s.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartOrphanSweep 启动时及之后定期清理异常退出遗留的临时文件
+func StartOrphanSweep(interval time.Duration) {
+	go func() {
+		sweepOrphanTempFiles()
+		ticker := time.NewTicker(interval)
+		for range ticker.C {
+			sweepOrphanTempFiles()
+		}
+	}()
+}
+
+func sweepOrphanTempFiles() {
+	dir := os.TempDir()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	removed := 0
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, tempFilePrefix) || !strings.HasSuffix(name, ".html") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || time.Since(info.ModTime()) < orphanTempFileAge {
+			continue
+		}
+		if os.Remove(filepath.Join(dir, name)) == nil {
+			removed++
+		}
+	}
+	if removed > 0 {
+		resourcesReclaimed.Add(float64(removed), ResourceTempFile)
+		logger.Info("♻️ 已清理遗留的临时文件", zap.Int("files", removed), zap.String("dir", dir))
+	}
+}
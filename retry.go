@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 截图重试 ======
+//
+// 浏览器空闲一段时间后的第一次渲染偶尔会超时（context deadline exceeded）或得到一张空白截图，
+// 重试通常即可成功。render.retry 配置后，capture 阶段遇到这两类失败时换一个新标签页重试，
+// 全部失败才返回错误：
+//   - timeout：标签页超时，每次重试都有完整的渲染超时，最坏情况下总耗时为 (count+1) × timeout
+//   - blank：截图所有像素相同（blank: true 时检查），重试后仍为空白时返回最后一次的截图
+// 客户端已断开、页面超出资源上限（见 sandbox.go）与请求参数错误不重试。支持热重载。
+
+type retryPolicy struct {
+	count   int
+	backoff time.Duration
+	blank   bool
+}
+
+var (
+	retrySettings atomic.Pointer[retryPolicy]
+	renderRetries = NewCounterVec("snapcast_render_retries_total", "Capture attempts retried after a transient failure, by reason.", "reason")
+)
+
+// 重试原因
+const (
+	retryTimeout = "timeout"
+	retryBlank   = "blank"
+)
+
+var errBlankScreenshot = errors.New("screenshot is blank")
+
+// ConfigureRenderRetry 读取 render.retry，由 ApplyDynamicConfig 调用
+func ConfigureRenderRetry() {
+	p := &retryPolicy{
+		count:   max(viper.GetInt("render.retry.count"), 0),
+		backoff: 200 * time.Millisecond,
+		blank:   viper.GetBool("render.retry.blank"),
+	}
+	if v := viper.Get("render.retry.backoff"); v != nil && v != "" {
+		d, err := ParseDuration(v)
+		if err != nil || d < 0 {
+			logger.Warn("❗ render.retry.backoff 值无效，使用默认值 200ms", zap.Any("backoff", v))
+		} else {
+			p.backoff = d
+		}
+	}
+	retrySettings.Store(p)
+}
+
+// captureWithRetry 执行 capture，可重试的失败按 backoff 指数退避后重试
+func captureWithRetry(rc *RenderContext) error {
+	p := retrySettings.Load()
+	if p == nil || p.count == 0 || rc.Payload.Output == "html" {
+		return captureOnce(rc)
+	}
+	for attempt := 0; ; attempt++ {
+		err := captureOnce(rc)
+		if err == nil && p.blank && rc.Image != nil {
+			if blank, img := isBlankScreenshot(rc.Image); blank {
+				err = errBlankScreenshot
+			} else if img != nil {
+				rc.decoded = img // 后处理无需再次解码
+			}
+		}
+		reason := retryReason(rc, err)
+		if reason == "" {
+			return err
+		}
+		if attempt >= p.count {
+			if errors.Is(err, errBlankScreenshot) {
+				rc.Logger.Warn("❕ 重试后截图仍为空白，返回该截图", zap.String("template", rc.Template), zap.Int("attempts", attempt+1))
+				return nil
+			}
+			return err
+		}
+		renderRetries.Inc(reason)
+		wait := p.backoff << attempt
+		rc.Logger.Warn("🔁 截图失败，重试", zap.String("reason", reason), zap.Int("attempt", attempt+1), zap.Duration("backoff", wait), zap.Error(err))
+		select {
+		case <-rc.Ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+		rc.Image, rc.decoded = nil, nil
+	}
+}
+
+// retryReason 返回失败的重试原因，不可重试时为空
+func retryReason(rc *RenderContext, err error) string {
+	if err == nil || rc.Ctx.Err() != nil {
+		return ""
+	}
+	if errors.Is(err, errBlankScreenshot) {
+		return retryBlank
+	}
+	if trackerFrom(rc.Ctx).SandboxErr() != nil {
+		return ""
+	}
+	var re *RenderError
+	if errors.As(err, &re) && re.Status != http.StatusInternalServerError {
+		return ""
+	}
+	// 部分 chromedp 错误以 %v 包装，只能按文本判断
+	if errors.Is(err, context.DeadlineExceeded) || strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		return retryTimeout
+	}
+	return ""
+}
+
+// isBlankScreenshot 判断截图是否所有像素相同，同时返回解码后的图片
+func isBlankScreenshot(data []byte) (bool, image.Image) {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return false, nil
+	}
+	b := img.Bounds()
+	if b.Empty() {
+		return true, img
+	}
+	switch m := img.(type) {
+	case *image.NRGBA:
+		return uniformPixels(m.Pix, m.Stride, b.Dx()*4, b.Dy()), img
+	case *image.RGBA:
+		return uniformPixels(m.Pix, m.Stride, b.Dx()*4, b.Dy()), img
+	}
+	first := img.At(b.Min.X, b.Min.Y)
+	r0, g0, b0, a0 := first.RGBA()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if r, g, bl, a := img.At(x, y).RGBA(); r != r0 || g != g0 || bl != b0 || a != a0 {
+				return false, img
+			}
+		}
+	}
+	return true, img
+}
+
+// uniformPixels 比较 4 字节像素的每一行是否都与第一个像素相同
+func uniformPixels(pix []byte, stride, rowBytes, rows int) bool {
+	first := pix[:4]
+	for y := 0; y < rows; y++ {
+		row := pix[y*stride : y*stride+rowBytes]
+		for x := 0; x < rowBytes; x += 4 {
+			if !bytes.Equal(row[x:x+4], first) {
+				return false
+			}
+		}
+	}
+	return true
+}
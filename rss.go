@@ -0,0 +1,677 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"SnapCast/extension"
+)
+
+// ====== RSS/Atom 订阅 ======
+//
+// 内置的 rss Source 按间隔轮询 RSS 2.0、RSS 1.0 与 Atom 订阅，将新条目用指定模板渲染后
+// 投递到 deliver 中的 Sink，或直接 POST 到 webhook，SnapCast 本身即可完成从订阅到图片的整条流程：
+//
+//	sources:
+//	  bili_blog:
+//	    type: rss
+//	    url: "https://example.com/feed.xml"
+//	    interval: 10m                  # 轮询间隔，默认 10m，最小 1m
+//	    template: rss/item             # 渲染使用的 site/type，默认 rss/item
+//	    deliver: [{sink: qq, params: {group_id: 123456}}]
+//	    webhook: "https://example.com/hook" # 可选，multipart 上传图片与条目信息
+//	    max_items: 5                   # 单次轮询最多渲染的新条目，默认 10
+//	    skip_existing: true            # 首次轮询时已有的条目只记录不推送，默认 true
+//	    state_file: data/bili_blog.json # 已推送条目的记录，重启后不重复推送
+//
+// 模板数据：
+//
+//	{"feed": {"title", "link", "url"}, "id", "title", "link", "author", "published",
+//	 "summary", "content", "image", "categories"}
+//
+// published 为 RFC 3339；summary 为去掉标签的纯文本，content 为原始 HTML（需 safe_html 输出）；
+// image 取第一个图片附件、media:content/thumbnail 或正文中的第一张图片。
+// 渲染失败的条目在下次轮询时重试，连续失败 3 次后跳过。
+
+const (
+	defaultFeedInterval = 10 * time.Minute
+	minFeedInterval     = time.Minute
+	defaultFeedMaxItems = 10
+	maxFeedSize         = 10 << 20
+	maxFeedSeen         = 1000 // 记录的已推送条目数，超过时丢弃最早的
+	maxFeedAttempts     = 3
+)
+
+var (
+	feedPolls   = NewCounterVec("snapcast_feed_polls_total", "RSS/Atom feed polls by source and result.", "source", "result")
+	feedEntries = NewCounterVec("snapcast_feed_entries_total", "RSS/Atom feed entries rendered by source and result.", "source", "result")
+)
+
+func init() {
+	extension.RegisterSource("rss", newFeedSource)
+}
+
+// feedConfig sources.<name> 中 rss 的配置
+type feedConfig struct {
+	URL          string             `mapstructure:"url"`
+	Interval     any                `mapstructure:"interval"`
+	Template     string             `mapstructure:"template"`
+	Deliver      []extension.Target `mapstructure:"deliver"`
+	Webhook      string             `mapstructure:"webhook"`
+	MaxItems     int                `mapstructure:"max_items"`
+	SkipExisting *bool              `mapstructure:"skip_existing"`
+	StateFile    string             `mapstructure:"state_file"`
+	UserAgent    string             `mapstructure:"user_agent"`
+}
+
+// feedSource 轮询一个订阅
+type feedSource struct {
+	name     string
+	cfg      feedConfig
+	site     string
+	typ      string
+	interval time.Duration
+	host     extension.Host
+	log      *zap.Logger
+	client   *http.Client
+	cancel   context.CancelFunc
+	done     chan struct{}
+	etag     string
+	modified string
+	primed   bool     // 是否已完成首次轮询
+	seen     []string // 已推送条目的 key，按时间顺序
+	seenSet  map[string]bool
+	attempts map[string]int // 渲染失败次数
+}
+
+func newFeedSource(opts extension.SourceOptions) (extension.Source, error) {
+	var cfg feedConfig
+	if err := viper.UnmarshalKey("sources."+opts.Name, &cfg); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(cfg.URL, "http://") && !strings.HasPrefix(cfg.URL, "https://") {
+		return nil, fmt.Errorf("url must be an http(s) URL, got %q", cfg.URL)
+	}
+	s := &feedSource{
+		name:     opts.Name,
+		cfg:      cfg,
+		site:     "rss",
+		typ:      "item",
+		interval: defaultFeedInterval,
+		host:     opts.Host,
+		log:      opts.Logger,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		seenSet:  make(map[string]bool),
+		attempts: make(map[string]int),
+	}
+	if cfg.Template != "" {
+		site, typ, found := strings.Cut(cfg.Template, "/")
+		if !found || site == "" || typ == "" {
+			return nil, fmt.Errorf("template must be site/type, got %q", cfg.Template)
+		}
+		s.site, s.typ = site, typ
+	}
+	if cfg.Interval != nil {
+		d, err := ParseDuration(cfg.Interval)
+		if err != nil || d < minFeedInterval {
+			return nil, fmt.Errorf("interval must be at least %s, got %v", minFeedInterval, cfg.Interval)
+		}
+		s.interval = d
+	}
+	if s.cfg.MaxItems <= 0 {
+		s.cfg.MaxItems = defaultFeedMaxItems
+	}
+	if len(cfg.Deliver) == 0 && cfg.Webhook == "" {
+		return nil, errors.New("deliver or webhook is required")
+	}
+	if err := s.loadState(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *feedSource) Start(ctx context.Context) error {
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			s.poll(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *feedSource) Stop(ctx context.Context) error {
+	if s.cancel == nil {
+		return nil
+	}
+	s.cancel()
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// poll 拉取一次订阅并推送新条目
+func (s *feedSource) poll(ctx context.Context) {
+	feed, err := s.fetch(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			feedPolls.Inc(s.name, "error")
+			s.log.Warn("⚠️ 订阅拉取失败", zap.String("url", s.cfg.URL), zap.Error(err))
+		}
+		return
+	}
+	if feed == nil {
+		feedPolls.Inc(s.name, "not_modified")
+		return
+	}
+	feedPolls.Inc(s.name, "ok")
+
+	// 订阅中的条目通常按时间倒序，从旧到新推送
+	var fresh []feedEntry
+	for i := len(feed.Entries) - 1; i >= 0; i-- {
+		if !s.seenSet[feed.Entries[i].key()] {
+			fresh = append(fresh, feed.Entries[i])
+		}
+	}
+	if !s.primed && len(s.seen) == 0 && (s.cfg.SkipExisting == nil || *s.cfg.SkipExisting) {
+		for _, e := range fresh {
+			s.markSeen(e.key())
+		}
+		s.primed = true
+		s.saveState()
+		s.log.Info("📰 订阅已就绪，已有条目不推送", zap.String("url", s.cfg.URL), zap.Int("entries", len(fresh)))
+		return
+	}
+	s.primed = true
+	if len(fresh) > s.cfg.MaxItems {
+		// 积压过多时只推送最新的 max_items 条，其余直接记为已推送
+		for _, e := range fresh[:len(fresh)-s.cfg.MaxItems] {
+			s.markSeen(e.key())
+		}
+		s.log.Warn("❕ 新条目超过 max_items，较早的条目已跳过", zap.Int("new", len(fresh)), zap.Int("max_items", s.cfg.MaxItems))
+		fresh = fresh[len(fresh)-s.cfg.MaxItems:]
+	}
+	for _, e := range fresh {
+		if ctx.Err() != nil {
+			break
+		}
+		s.publish(ctx, feed, e)
+	}
+	s.saveState()
+}
+
+// publish 渲染并投递一个条目
+func (s *feedSource) publish(ctx context.Context, feed *parsedFeed, e feedEntry) {
+	key := e.key()
+	data := e.templateData(feed)
+	result, err := s.host.Render(ctx, extension.Job{
+		Site:           s.site,
+		Type:           s.typ,
+		Data:           data,
+		Deliver:        s.cfg.Deliver,
+		IdempotencyKey: "rss-" + s.name + "-" + key[:16],
+	})
+	if err == nil {
+		// 任一目标投递失败时整体重试，已成功的目标按投递 ID 跳过，见 receipts.go
+		for _, r := range result.Receipts {
+			if r.Error != "" {
+				err = fmt.Errorf("deliver to %s: %s", r.Sink, r.Error)
+				break
+			}
+		}
+	}
+	if err == nil && s.cfg.Webhook != "" {
+		err = s.postWebhook(ctx, data, result)
+	}
+	if err != nil {
+		s.attempts[key]++
+		if s.attempts[key] < maxFeedAttempts {
+			feedEntries.Inc(s.name, "retry")
+			s.log.Warn("⚠️ 订阅条目推送失败，下次轮询重试", zap.String("title", e.Title), zap.Int("attempt", s.attempts[key]), zap.Error(err))
+			return
+		}
+		feedEntries.Inc(s.name, "failed")
+		s.log.Error("❌ 订阅条目推送失败，已跳过", zap.String("title", e.Title), zap.Error(err))
+	} else {
+		feedEntries.Inc(s.name, "ok")
+		s.log.Info("📰 订阅条目已推送", zap.String("title", e.Title), zap.String("link", e.Link))
+	}
+	delete(s.attempts, key)
+	s.markSeen(key)
+}
+
+// postWebhook 以 multipart/form-data 上传图片（image）与条目信息（entry，JSON）
+func (s *feedSource) postWebhook(ctx context.Context, data map[string]any, result *extension.Result) error {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	entry, _ := json.Marshal(map[string]any{"source": s.name, "site": s.site, "type": s.typ, "entry": data})
+	if err := w.WriteField("entry", string(entry)); err != nil {
+		return err
+	}
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", `form-data; name="image"; filename="card`+contentTypeExt[result.ContentType]+`"`)
+	header.Set("Content-Type", result.ContentType)
+	part, err := w.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(result.Body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.Webhook, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// fetch 拉取并解析订阅，未修改（304）时返回 nil
+func (s *feedSource) fetch(ctx context.Context) (*parsedFeed, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.cfg.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	ua := s.cfg.UserAgent
+	if ua == "" {
+		ua = "SnapCast"
+	}
+	req.Header.Set("User-Agent", ua)
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/xml;q=0.9, text/xml;q=0.8, */*;q=0.5")
+	// 有待重试的条目时不使用条件请求，否则未修改的订阅返回 304 就不会再重试
+	if s.etag != "" && len(s.attempts) == 0 {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+	if s.modified != "" && len(s.attempts) == 0 {
+		req.Header.Set("If-Modified-Since", s.modified)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed returned %s", resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxFeedSize {
+		return nil, fmt.Errorf("feed exceeds %s", formatBytes(maxFeedSize))
+	}
+	feed, err := parseFeed(b)
+	if err != nil {
+		return nil, err
+	}
+	if feed.URL == "" {
+		feed.URL = s.cfg.URL
+	}
+	s.etag, s.modified = resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	return feed, nil
+}
+
+func (s *feedSource) markSeen(key string) {
+	if s.seenSet[key] {
+		return
+	}
+	s.seen = append(s.seen, key)
+	s.seenSet[key] = true
+	if len(s.seen) > maxFeedSeen {
+		for _, k := range s.seen[:len(s.seen)-maxFeedSeen] {
+			delete(s.seenSet, k)
+		}
+		s.seen = append([]string(nil), s.seen[len(s.seen)-maxFeedSeen:]...)
+	}
+}
+
+// feedState state_file 的内容
+type feedState struct {
+	URL  string   `json:"url"`
+	Seen []string `json:"seen"`
+}
+
+func (s *feedSource) loadState() error {
+	if s.cfg.StateFile == "" {
+		return nil
+	}
+	b, err := os.ReadFile(s.cfg.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var state feedState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return fmt.Errorf("invalid state_file %s: %w", s.cfg.StateFile, err)
+	}
+	for _, key := range state.Seen {
+		s.markSeen(key)
+	}
+	s.primed = len(s.seen) > 0
+	return nil
+}
+
+func (s *feedSource) saveState() {
+	if s.cfg.StateFile == "" {
+		return
+	}
+	if err := s.writeState(); err != nil {
+		s.log.Warn("⚠️ 订阅状态保存失败", zap.String("file", s.cfg.StateFile), zap.Error(err))
+	}
+}
+
+func (s *feedSource) writeState() error {
+	b, err := json.Marshal(feedState{URL: s.cfg.URL, Seen: s.seen})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.cfg.StateFile), 0755); err != nil {
+		return err
+	}
+	tmp := s.cfg.StateFile + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.cfg.StateFile)
+}
+
+// ---------- 解析 ----------
+
+// parsedFeed 解析后的订阅
+type parsedFeed struct {
+	Title   string
+	Link    string
+	URL     string
+	Entries []feedEntry
+}
+
+// feedEntry 统一 RSS 与 Atom 的条目
+type feedEntry struct {
+	ID         string
+	Title      string
+	Link       string
+	Author     string
+	Published  time.Time
+	Content    string // HTML
+	Image      string
+	Categories []string
+}
+
+// key 条目的唯一标识：优先 guid/id，其次链接与标题
+func (e feedEntry) key() string {
+	id := e.ID
+	if id == "" {
+		id = e.Link + "\x00" + e.Title
+	}
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+var (
+	htmlTagRegex = regexp.MustCompile(`(?s)<[^>]*>`)
+	imgSrcRegex  = regexp.MustCompile(`(?i)<img[^>]+src\s*=\s*["']([^"']+)["']`)
+	spaceRegex   = regexp.MustCompile(`[\s\x{00a0}]+`)
+)
+
+// templateData 模板数据
+func (e feedEntry) templateData(feed *parsedFeed) map[string]any {
+	summary := strings.TrimSpace(spaceRegex.ReplaceAllString(html.UnescapeString(htmlTagRegex.ReplaceAllString(e.Content, " ")), " "))
+	image := e.Image
+	if image == "" {
+		if m := imgSrcRegex.FindStringSubmatch(e.Content); m != nil {
+			image = html.UnescapeString(m[1])
+		}
+	}
+	data := map[string]any{
+		"feed":       map[string]any{"title": feed.Title, "link": feed.Link, "url": feed.URL},
+		"id":         e.ID,
+		"title":      e.Title,
+		"link":       e.Link,
+		"author":     e.Author,
+		"summary":    summary,
+		"content":    e.Content,
+		"image":      image,
+		"categories": e.Categories,
+		"published":  "",
+	}
+	if !e.Published.IsZero() {
+		data["published"] = e.Published.Format(time.RFC3339)
+	}
+	return data
+}
+
+// xmlFeed 同时匹配 RSS 2.0（rss/channel/item）、RSS 1.0（rdf:RDF/item）与 Atom（feed/entry）
+type xmlFeed struct {
+	XMLName xml.Name
+	Title   string     `xml:"title"`
+	Links   []atomLink `xml:"link"`
+	Channel struct {
+		Title string    `xml:"title"`
+		Link  string    `xml:"link"`
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Items   []rssItem   `xml:"item"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        string   `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Date        string   `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Author      string   `xml:"author"`
+	Creator     string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Description string   `xml:"description"`
+	Encoded     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	Categories  []string `xml:"category"`
+	Enclosures  []struct {
+		URL  string `xml:"url,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"enclosure"`
+	Media []mediaElement `xml:"http://search.yahoo.com/mrss/ content"`
+	Thumb []mediaElement `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+}
+
+type mediaElement struct {
+	URL    string `xml:"url,attr"`
+	Medium string `xml:"medium,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Links     []atomLink `xml:"link"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+	Summary   string     `xml:"summary"`
+	Content   string     `xml:"content"`
+	Authors   []struct {
+		Name string `xml:"name"`
+	} `xml:"author"`
+	Categories []struct {
+		Term string `xml:"term,attr"`
+	} `xml:"category"`
+	Media []mediaElement `xml:"http://search.yahoo.com/mrss/ content"`
+	Thumb []mediaElement `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+}
+
+// parseFeed 解析 RSS 或 Atom 文档，只支持 UTF-8 编码
+func parseFeed(b []byte) (*parsedFeed, error) {
+	var doc xmlFeed
+	dec := xml.NewDecoder(bytes.NewReader(b))
+	dec.Strict = false
+	dec.Entity = xml.HTMLEntity
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		switch strings.ToLower(charset) {
+		case "utf-8", "utf8", "us-ascii", "ascii":
+			return input, nil
+		}
+		return nil, fmt.Errorf("unsupported feed charset %q", charset)
+	}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid feed: %w", err)
+	}
+
+	feed := &parsedFeed{}
+	switch strings.ToLower(doc.XMLName.Local) {
+	case "rss", "rdf":
+		feed.Title, feed.Link = strings.TrimSpace(doc.Channel.Title), strings.TrimSpace(doc.Channel.Link)
+		for _, item := range append(doc.Channel.Items, doc.Items...) {
+			feed.Entries = append(feed.Entries, item.entry())
+		}
+	case "feed":
+		feed.Title, feed.Link = strings.TrimSpace(doc.Title), alternateLink(doc.Links)
+		for _, entry := range doc.Entries {
+			feed.Entries = append(feed.Entries, entry.entry())
+		}
+	default:
+		return nil, fmt.Errorf("not an RSS or Atom feed: <%s>", doc.XMLName.Local)
+	}
+	return feed, nil
+}
+
+func (item rssItem) entry() feedEntry {
+	e := feedEntry{
+		ID:         strings.TrimSpace(item.GUID),
+		Title:      strings.TrimSpace(item.Title),
+		Link:       strings.TrimSpace(item.Link),
+		Author:     strings.TrimSpace(firstNonEmpty(item.Creator, item.Author)),
+		Published:  parseFeedTime(firstNonEmpty(item.PubDate, item.Date)),
+		Content:    firstNonEmpty(item.Encoded, item.Description),
+		Image:      mediaImage(item.Media, item.Thumb),
+		Categories: item.Categories,
+	}
+	for _, enc := range item.Enclosures {
+		if e.Image == "" && strings.HasPrefix(enc.Type, "image/") {
+			e.Image = enc.URL
+		}
+	}
+	return e
+}
+
+func (entry atomEntry) entry() feedEntry {
+	e := feedEntry{
+		ID:        strings.TrimSpace(entry.ID),
+		Title:     strings.TrimSpace(entry.Title),
+		Link:      alternateLink(entry.Links),
+		Published: parseFeedTime(firstNonEmpty(entry.Published, entry.Updated)),
+		Content:   firstNonEmpty(entry.Content, entry.Summary),
+		Image:     mediaImage(entry.Media, entry.Thumb),
+	}
+	if len(entry.Authors) > 0 {
+		e.Author = strings.TrimSpace(entry.Authors[0].Name)
+	}
+	for _, c := range entry.Categories {
+		e.Categories = append(e.Categories, c.Term)
+	}
+	for _, l := range entry.Links {
+		if e.Image == "" && l.Rel == "enclosure" && strings.HasPrefix(l.Type, "image/") {
+			e.Image = l.Href
+		}
+	}
+	return e
+}
+
+// alternateLink Atom 中 rel 为 alternate（或缺省）的链接
+func alternateLink(links []atomLink) string {
+	for _, l := range links {
+		if l.Rel == "" || l.Rel == "alternate" {
+			return strings.TrimSpace(l.Href)
+		}
+	}
+	return ""
+}
+
+func mediaImage(lists ...[]mediaElement) string {
+	for _, list := range lists {
+		for _, m := range list {
+			if m.URL != "" && (m.Medium == "image" || strings.HasPrefix(m.Type, "image/") || (m.Medium == "" && m.Type == "")) {
+				return m.URL
+			}
+		}
+	}
+	return ""
+}
+
+// feedTimeLayouts RSS（RFC 822 及常见变体）与 Atom（RFC 3339）的时间格式
+var feedTimeLayouts = []string{
+	time.RFC1123Z, time.RFC1123, time.RFC3339, time.RFC3339Nano,
+	"Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST", "2 Jan 2006 15:04:05 -0700",
+	time.RFC822Z, time.RFC822, "2006-01-02 15:04:05", "2006-01-02",
+}
+
+func parseFeedTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range feedTimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
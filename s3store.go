@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// ====== S3 兼容对象存储 ======
+//
+// storage.backend 为 s3 时渲染结果上传到对象存储，多个机器人实例直接从存储拉取图片，
+// 不再经由 SnapCast 转发。阿里云 OSS、腾讯云 COS、MinIO 等均提供 S3 兼容接口，
+// 配置对应的 endpoint 即可。请求使用 AWS Signature V4 签名。
+//
+// 配置了 public_url（公共读 Bucket 或 CDN 域名）时返回 public_url/<对象名>，否则返回有效期为
+// storage.ttl 的预签名地址（最长 7 天）。对象本身的过期清理请使用 Bucket 的生命周期规则。
+
+const (
+	s3Algorithm       = "AWS4-HMAC-SHA256"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3MaxPresign      = 7 * 24 * time.Hour
+)
+
+// S3Store 上传到 S3 兼容的对象存储
+type S3Store struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	pathStyle bool
+	prefix    string
+	publicURL string
+	acl       string
+	ttl       time.Duration
+	client    *http.Client
+}
+
+// newS3Store 读取 storage.s3 配置
+func newS3Store(ttl time.Duration) (*S3Store, error) {
+	s := &S3Store{
+		region:    viper.GetString("storage.s3.region"),
+		bucket:    viper.GetString("storage.s3.bucket"),
+		accessKey: viper.GetString("storage.s3.access_key"),
+		secretKey: viper.GetString("storage.s3.secret_key"),
+		pathStyle: viper.GetBool("storage.s3.path_style"),
+		prefix:    strings.Trim(viper.GetString("storage.s3.prefix"), "/"),
+		publicURL: strings.TrimRight(viper.GetString("storage.s3.public_url"), "/"),
+		acl:       viper.GetString("storage.s3.acl"),
+		ttl:       min(ttl, s3MaxPresign),
+	}
+	if s.bucket == "" || s.accessKey == "" || s.secretKey == "" {
+		return nil, errors.New("storage.s3.bucket, access_key and secret_key are required")
+	}
+	if s.region == "" {
+		s.region = "us-east-1"
+	}
+	endpoint := viper.GetString("storage.s3.endpoint")
+	if endpoint == "" {
+		endpoint = "https://s3." + s.region + ".amazonaws.com"
+	}
+	u, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid storage.s3.endpoint %q", endpoint)
+	}
+	s.endpoint = u
+	timeout, _ := ParseDuration(viper.Get("storage.s3.timeout"))
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	s.client = &http.Client{Timeout: timeout}
+	return s, nil
+}
+
+// objectURL 返回对象的请求地址（不含签名）
+func (s *S3Store) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path = "/" + s.bucket + "/" + key
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	u.RawPath = s3EscapePath(u.Path)
+	return &u
+}
+
+// Put 上传对象，元数据以 x-amz-meta-* 保存（非 ASCII 值按 URL 编码）
+func (s *S3Store) Put(ctx context.Context, key, contentType string, body []byte, metadata map[string]string) (*StoredObject, error) {
+	if s.prefix != "" {
+		key = s.prefix + "/" + key
+	}
+	u := s.objectURL(key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Type", contentType)
+	if s.acl != "" {
+		req.Header.Set("x-amz-acl", s.acl)
+	}
+	for name, value := range metadata {
+		req.Header.Set("x-amz-meta-"+strings.ToLower(name), s3MetadataValue(value))
+	}
+	sum := sha256.Sum256(body)
+	s.sign(req, hex.EncodeToString(sum[:]), time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("s3 upload failed: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	obj := &StoredObject{Key: key, Metadata: metadata}
+	if s.publicURL != "" {
+		obj.URL = s.publicURL + "/" + s3EscapePath(key)
+		return obj, nil
+	}
+	now := time.Now().UTC()
+	obj.URL = s.presign(key, now)
+	obj.ExpiresAt = now.Add(s.ttl).Truncate(time.Second)
+	return obj, nil
+}
+
+// sign 为请求添加 Authorization 头
+func (s *S3Store) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	names := []string{"host"}
+	values := map[string]string{"host": req.URL.Host}
+	for name, v := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			names = append(names, lower)
+			values[lower] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + values[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method, req.URL.EscapedPath(), s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+	scope := s.scope(now)
+	signature := s.signature(now, s.stringToSign(amzDate, scope, canonical))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.accessKey, scope, signedHeaders, signature))
+}
+
+// presign 生成预签名的 GET 地址
+func (s *S3Store) presign(key string, now time.Time) string {
+	u := s.objectURL(key)
+	amzDate := now.Format("20060102T150405Z")
+	scope := s.scope(now)
+	q := url.Values{}
+	q.Set("X-Amz-Algorithm", s3Algorithm)
+	q.Set("X-Amz-Credential", s.accessKey+"/"+scope)
+	q.Set("X-Amz-Date", amzDate)
+	q.Set("X-Amz-Expires", strconv.Itoa(int(s.ttl.Seconds())))
+	q.Set("X-Amz-SignedHeaders", "host")
+	query := s3CanonicalQuery(q)
+
+	canonical := strings.Join([]string{
+		http.MethodGet, u.EscapedPath(), query, "host:" + u.Host + "\n", "host", s3UnsignedPayload,
+	}, "\n")
+	signature := s.signature(now, s.stringToSign(amzDate, scope, canonical))
+	u.RawQuery = query + "&X-Amz-Signature=" + signature
+	return u.String()
+}
+
+func (s *S3Store) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.region + "/s3/aws4_request"
+}
+
+func (s *S3Store) stringToSign(amzDate, scope, canonical string) string {
+	sum := sha256.Sum256([]byte(canonical))
+	return s3Algorithm + "\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+}
+
+func (s *S3Store) signature(now time.Time, stringToSign string) string {
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Escape 按 SigV4 的规则编码，仅保留 A-Z a-z 0-9 - _ . ~
+func s3Escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3EscapePath(p string) string {
+	return s3Escape(p, true)
+}
+
+// s3CanonicalQuery 按键排序并编码查询参数
+func s3CanonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, s3Escape(k, false)+"="+s3Escape(v, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3MetadataValue 元数据只能是 ASCII，含其他字符时按 URL 编码
+func s3MetadataValue(v string) string {
+	for i := 0; i < len(v); i++ {
+		if v[i] < 0x20 || v[i] > 0x7e {
+			return url.QueryEscape(v)
+		}
+	}
+	return v
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/chromedp/cdproto/cdp"
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/cdproto/performance"
+	"github.com/chromedp/cdproto/runtime"
+	"github.com/chromedp/chromedp"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 页面资源上限 ======
+//
+// 渲染都是同一个浏览器中的标签页（见 browserrecycle.go），异常的模板或恶意构造的请求数据（海量节点、
+// 死循环、拉取大量资源）会拖慢甚至卡死整个浏览器。render.sandbox 为每个标签页设置上限，超出时立即关闭标签页，请求返回 422：
+//   - max_dom_nodes：DOM 节点数（Performance.getMetrics 的 Nodes）
+//   - max_requests / max_resource_mb：页面发起的子资源请求数与传输字节数（Network 事件）
+//   - script_timeout：脚本累计执行时间（ScriptDuration）；主线程无响应超过该时长同样视为超限
+// 各项为 0 时不检查，支持热重载。
+
+// sandboxPollInterval 采样页面指标的间隔
+const sandboxPollInterval = 200 * time.Millisecond
+
+type sandboxLimits struct {
+	maxNodes      int64
+	maxRequests   int64
+	maxBytes      int64
+	scriptTimeout time.Duration
+}
+
+func (l *sandboxLimits) enabled() bool {
+	return l != nil && (l.maxNodes > 0 || l.maxRequests > 0 || l.maxBytes > 0 || l.scriptTimeout > 0)
+}
+
+var (
+	sandboxSettings  atomic.Pointer[sandboxLimits]
+	sandboxViolation = NewCounterVec("snapcast_sandbox_violations_total", "Renders aborted for exceeding a page resource limit.", "limit")
+)
+
+// ConfigureSandbox 读取 render.sandbox，由 ApplyDynamicConfig 调用
+func ConfigureSandbox() {
+	l := &sandboxLimits{
+		maxNodes:    viper.GetInt64("render.sandbox.max_dom_nodes"),
+		maxRequests: viper.GetInt64("render.sandbox.max_requests"),
+		maxBytes:    viper.GetInt64("render.sandbox.max_resource_mb") << 20,
+	}
+	if v := viper.Get("render.sandbox.script_timeout"); v != nil && v != "" {
+		d, err := ParseDuration(v)
+		if err != nil || d < 0 {
+			logger.Warn("❗ render.sandbox.script_timeout 值无效，不限制脚本执行时间", zap.Any("script_timeout", v))
+		} else {
+			l.scriptTimeout = d
+		}
+	}
+	if !l.enabled() {
+		sandboxSettings.Store(nil)
+		return
+	}
+	sandboxSettings.Store(l)
+}
+
+// sandboxError 页面超出资源上限
+func sandboxError(limit, format string, args ...any) error {
+	return newRenderError(http.StatusUnprocessableEntity, fmt.Errorf("page exceeded sandbox limit %s: "+format, append([]any{limit}, args...)...))
+}
+
+// pageSandbox 监视一个标签页的资源使用，超限时记录原因并关闭标签页
+type pageSandbox struct {
+	limits   *sandboxLimits
+	ctx      context.Context
+	abort    func()
+	log      *zap.Logger
+	once     sync.Once // 首个事件到达（标签页已创建）时开始采样
+	mu       sync.Mutex
+	err      error
+	requests int64
+	bytes    int64
+}
+
+// watchSandbox 在标签页上安装资源监视，未配置上限时返回 nil
+func watchSandbox(ctx context.Context, abort func(), log *zap.Logger) *pageSandbox {
+	limits := sandboxSettings.Load()
+	if !limits.enabled() {
+		return nil
+	}
+	s := &pageSandbox{limits: limits, ctx: ctx, abort: abort, log: log}
+	chromedp.ListenTarget(ctx, func(ev any) {
+		s.once.Do(func() { go s.poll() })
+		switch e := ev.(type) {
+		case *network.EventRequestWillBeSent:
+			if e.Type == network.ResourceTypeDocument && e.Initiator != nil && e.Initiator.Type == network.InitiatorTypeOther {
+				return // 导航本身不计入子资源
+			}
+			if strings.HasPrefix(e.Request.URL, "data:") {
+				return
+			}
+			s.mu.Lock()
+			s.requests++
+			n := s.requests
+			s.mu.Unlock()
+			if limits.maxRequests > 0 && n > limits.maxRequests {
+				s.fail("requests", sandboxError("max_requests", "more than %d subresource requests", limits.maxRequests))
+			}
+		case *network.EventLoadingFinished:
+			s.mu.Lock()
+			s.bytes += int64(e.EncodedDataLength)
+			n := s.bytes
+			s.mu.Unlock()
+			if limits.maxBytes > 0 && n > limits.maxBytes {
+				s.fail("bytes", sandboxError("max_resource_mb", "subresources transferred more than %d MB", limits.maxBytes>>20))
+			}
+		}
+	})
+	return s
+}
+
+// poll 定期读取 DOM 节点数与脚本执行时间，调用无响应的时长计入脚本执行时间
+func (s *pageSandbox) poll() {
+	c := chromedp.FromContext(s.ctx)
+	if c == nil || c.Target == nil {
+		return
+	}
+	exec := cdp.WithExecutor(s.ctx, c.Target)
+	if err := performance.Enable().Do(exec); err != nil {
+		return
+	}
+	ticker := time.NewTicker(sandboxPollInterval)
+	defer ticker.Stop()
+	var busySince time.Time
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		timeout := sandboxPollInterval * 5
+		if s.limits.scriptTimeout > 0 {
+			timeout = min(timeout, s.limits.scriptTimeout)
+		}
+		pctx, cancel := context.WithTimeout(exec, timeout)
+		metrics, err := performance.GetMetrics().Do(pctx)
+		cancel()
+		if s.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			if busySince.IsZero() {
+				busySince = time.Now().Add(-timeout)
+			}
+			if s.limits.scriptTimeout > 0 && time.Since(busySince) >= s.limits.scriptTimeout {
+				s.fail("script", sandboxError("script_timeout", "page unresponsive for more than %s", s.limits.scriptTimeout))
+				return
+			}
+			continue
+		}
+		busySince = time.Time{}
+		for _, m := range metrics {
+			switch {
+			case m.Name == "Nodes" && s.limits.maxNodes > 0 && int64(m.Value) > s.limits.maxNodes:
+				s.fail("dom_nodes", sandboxError("max_dom_nodes", "%d DOM nodes, max %d", int64(m.Value), s.limits.maxNodes))
+				return
+			case m.Name == "ScriptDuration" && s.limits.scriptTimeout > 0 && m.Value > s.limits.scriptTimeout.Seconds():
+				s.fail("script", sandboxError("script_timeout", "scripts ran for more than %s", s.limits.scriptTimeout))
+				return
+			}
+		}
+	}
+}
+
+// fail 记录第一个超限原因，中断脚本并关闭标签页
+func (s *pageSandbox) fail(limit string, err error) {
+	s.mu.Lock()
+	first := s.err == nil
+	if first {
+		s.err = err
+	}
+	s.mu.Unlock()
+	if !first {
+		return
+	}
+	sandboxViolation.Inc(limit)
+	s.log.Warn("🧱 页面超出资源上限，已中止渲染", zap.Error(err))
+	go func() {
+		if c := chromedp.FromContext(s.ctx); c != nil && c.Target != nil {
+			tctx, cancel := context.WithTimeout(s.ctx, time.Second)
+			_ = runtime.TerminateExecution().Do(cdp.WithExecutor(tctx, c.Target))
+			cancel()
+		}
+		s.abort()
+	}()
+}
+
+// Err 返回超限原因，未超限时为 nil
+func (s *pageSandbox) Err() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// ====== 富文本白名单 ======
+//
+// html/template 会转义数据中的 HTML，动态正文等富文本只能显示原始标签。模板附属配置中
+// 设置 safe_html: true 后，模板可使用 {{safeHTML .content}} 输出经过白名单清洗的 HTML：
+// 只保留常见的排版标签与属性，链接与图片仅允许 http/https（图片另允许 data:image/），
+// script、style、iframe 等连同内容一起丢弃，事件属性与内联样式全部移除。
+// 未开启的模板调用 safeHTML 时渲染失败，避免在不知情的情况下把请求数据当作 HTML 输出。
+
+var errSafeHTMLDisabled = errors.New("safeHTML is not enabled for this template, set safe_html: true in its .meta.yaml")
+
+// sanitizeAllowedTags 允许的标签及各自允许的属性
+var sanitizeAllowedTags = map[atom.Atom][]string{
+	atom.A: {"href", "title"}, atom.Abbr: {"title"}, atom.B: nil, atom.Blockquote: nil, atom.Br: nil,
+	atom.Code: nil, atom.Del: nil, atom.Div: nil, atom.Em: nil, atom.Figcaption: nil, atom.Figure: nil,
+	atom.H1: nil, atom.H2: nil, atom.H3: nil, atom.H4: nil, atom.H5: nil, atom.H6: nil, atom.Hr: nil,
+	atom.I: nil, atom.Img: {"src", "alt", "title", "width", "height"}, atom.Ins: nil, atom.Li: nil,
+	atom.Mark: nil, atom.Ol: nil, atom.P: nil, atom.Pre: nil, atom.S: nil, atom.Small: nil, atom.Span: nil,
+	atom.Strong: nil, atom.Sub: nil, atom.Sup: nil, atom.Table: nil, atom.Tbody: nil, atom.Td: {"colspan", "rowspan"},
+	atom.Th: {"colspan", "rowspan"}, atom.Thead: nil, atom.Tr: nil, atom.U: nil, atom.Ul: nil,
+}
+
+// sanitizeGlobalAttrs 所有允许的标签都可以携带的属性
+var sanitizeGlobalAttrs = []string{"class", "lang", "dir"}
+
+// sanitizeDropContent 连同内容一起丢弃的标签
+var sanitizeDropContent = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Iframe: true, atom.Object: true, atom.Embed: true,
+	atom.Noscript: true, atom.Template: true, atom.Textarea: true, atom.Select: true, atom.Svg: true,
+	atom.Math: true, atom.Title: true, atom.Head: true,
+}
+
+var sanitizeNumberRegex = regexp.MustCompile(`^[0-9]{1,4}$`)
+
+// sanitizeHTML 按白名单清洗 HTML 片段，不允许的标签去掉标签保留文本
+func sanitizeHTML(src string) string {
+	var out strings.Builder
+	z := html.NewTokenizer(strings.NewReader(src))
+	var open []atom.Atom // 已输出的未闭合标签，用于在结尾补齐
+	dropDepth, dropTag := 0, atom.Atom(0)
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken { // io.EOF 或输入过长
+			break
+		}
+		tok := z.Token()
+		if dropDepth > 0 {
+			switch {
+			case tt == html.StartTagToken && tok.DataAtom == dropTag:
+				dropDepth++
+			case tt == html.EndTagToken && tok.DataAtom == dropTag:
+				dropDepth--
+			}
+			continue
+		}
+		switch tt {
+		case html.TextToken:
+			out.WriteString(html.EscapeString(tok.Data))
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if sanitizeDropContent[tok.DataAtom] {
+				if tt == html.StartTagToken {
+					dropDepth, dropTag = 1, tok.DataAtom
+				}
+				continue
+			}
+			attrs, allowed := sanitizeAllowedTags[tok.DataAtom]
+			if !allowed {
+				continue
+			}
+			out.WriteString("<" + tok.DataAtom.String())
+			for _, a := range tok.Attr {
+				if v, ok := sanitizeAttr(tok.DataAtom, a, attrs); ok {
+					fmt.Fprintf(&out, ` %s="%s"`, a.Key, html.EscapeString(v))
+				}
+			}
+			if tok.DataAtom == atom.A {
+				out.WriteString(` rel="nofollow noopener"`)
+			}
+			out.WriteString(">")
+			if tt == html.StartTagToken && !voidElement(tok.DataAtom) {
+				open = append(open, tok.DataAtom)
+			}
+		case html.EndTagToken:
+			// 只闭合已打开的标签，多余的结束标签丢弃
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] != tok.DataAtom {
+					continue
+				}
+				for j := len(open) - 1; j >= i; j-- {
+					out.WriteString("</" + open[j].String() + ">")
+				}
+				open = open[:i]
+				break
+			}
+		}
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		out.WriteString("</" + open[i].String() + ">")
+	}
+	return out.String()
+}
+
+// sanitizeAttr 检查属性是否允许，返回清洗后的值
+func sanitizeAttr(tag atom.Atom, a html.Attribute, allowed []string) (string, bool) {
+	if a.Namespace != "" {
+		return "", false
+	}
+	key := strings.ToLower(a.Key)
+	permitted := false
+	for _, name := range allowed {
+		permitted = permitted || name == key
+	}
+	for _, name := range sanitizeGlobalAttrs {
+		permitted = permitted || name == key
+	}
+	if !permitted {
+		return "", false
+	}
+	switch key {
+	case "href":
+		return sanitizeURL(a.Val, false)
+	case "src":
+		return sanitizeURL(a.Val, tag == atom.Img)
+	case "width", "height", "colspan", "rowspan":
+		return a.Val, sanitizeNumberRegex.MatchString(strings.TrimSpace(a.Val))
+	}
+	return a.Val, true
+}
+
+// sanitizeURL 只允许 http/https，图片另允许 data:image/（不含 svg）
+func sanitizeURL(raw string, image bool) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	lower := strings.ToLower(raw)
+	if image && strings.HasPrefix(lower, "data:image/") && !strings.HasPrefix(lower, "data:image/svg") {
+		return raw, true
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.String(), true
+	}
+	return "", false
+}
+
+func voidElement(a atom.Atom) bool {
+	return a == atom.Br || a == atom.Hr || a == atom.Img
+}
+
+// safeHTMLFunc 模板函数 safeHTML，enabled 为模板附属配置的 safe_html
+func safeHTMLFunc(enabled bool) func(v any) (template.HTML, error) {
+	return func(v any) (template.HTML, error) {
+		if !enabled {
+			return "", errSafeHTMLDisabled
+		}
+		if v == nil {
+			return "", nil
+		}
+		return template.HTML(sanitizeHTML(fmt.Sprint(v))), nil
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ====== 示例数据场景 ======
+//
+// 除默认的 <type>.sample.json 外，模板旁的 <type>.sample.<场景>.json 为命名场景，
+// 如 live.sample.live_end.json、live.sample.long_title.json，用于覆盖开播/下播、超长标题等
+// 边界布局。预览接口 ?scenario= 选择场景，/preview/:site/:type/scenarios 列出全部场景；
+// snapcast test 对每个场景分别比较基准图（<type>@<场景>.png）；snapcast render --scenario 指定场景。
+// 主题变体缺少的场景使用基础模板的示例数据。
+
+// defaultScenario 默认示例数据（<type>.sample.json）的场景名
+const defaultScenario = "default"
+
+var scenarioNameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// scenarioPath 返回场景的示例数据路径，默认场景为 samplePath
+func scenarioPath(tmplPath, scenario string) string {
+	if scenario == "" || scenario == defaultScenario {
+		return samplePath(tmplPath)
+	}
+	return strings.TrimSuffix(tmplPath, ".html") + ".sample." + scenario + ".json"
+}
+
+// scenarioFiles 列出模板的示例数据文件，返回场景名 → 文件名，默认场景为 default
+func scenarioFiles(tmplPath string) map[string]string {
+	dir, name := filepath.Split(tmplPath)
+	prefix := strings.TrimSuffix(name, ".html") + ".sample"
+	files := make(map[string]string)
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return files
+	}
+	for _, e := range entries {
+		n := e.Name()
+		if e.IsDir() || !strings.HasPrefix(n, prefix) || !strings.HasSuffix(n, ".json") {
+			continue
+		}
+		switch rest := strings.TrimSuffix(strings.TrimPrefix(n, prefix), ".json"); {
+		case rest == "":
+			files[defaultScenario] = n
+		case strings.HasPrefix(rest, ".") && scenarioNameRegex.MatchString(rest[1:]):
+			files[rest[1:]] = n
+		}
+	}
+	return files
+}
+
+// sampleScenarios 返回模板的场景名，默认场景在前，其余按名称排序
+func sampleScenarios(tmplPath string) []string {
+	files := scenarioFiles(tmplPath)
+	dir, name := filepath.Split(tmplPath)
+	if base, _, isVariant := strings.Cut(name, "."); isVariant && base+".html" != name {
+		for n, f := range scenarioFiles(dir + base + ".html") {
+			if _, exists := files[n]; !exists {
+				files[n] = f
+			}
+		}
+	}
+	names := make([]string, 0, len(files))
+	for n := range files {
+		names = append(names, n)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if (names[i] == defaultScenario) != (names[j] == defaultScenario) {
+			return names[i] == defaultScenario
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// validateScenario 校验场景名
+func validateScenario(scenario string) error {
+	if scenario != "" && !scenarioNameRegex.MatchString(scenario) {
+		return fmt.Errorf("invalid scenario %q: only letters, digits, '-' and '_' are allowed", scenario)
+	}
+	return nil
+}
+
+// PreviewScenariosHandler 列出模板可用于预览的示例数据场景
+func PreviewScenariosHandler(c *gin.Context) {
+	tmplPath := selectTemplate(PushPayload{Site: c.Param("site"), Type: c.Param("type"), Theme: c.Query("theme")})
+	if tmplPath == "" {
+		c.JSON(http.StatusNotFound, errResp("no template found"))
+		return
+	}
+	c.JSON(http.StatusOK, ok(gin.H{"template": tmplPath, "scenarios": sampleScenarios(tmplPath)}))
+}
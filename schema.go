@@ -0,0 +1,418 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+)
+
+// ====== 请求数据结构推断 ======
+//
+// 为新的推送类型写模板前，需要先知道上游会发来哪些字段。开启 schema.samples 后，每个 site/type
+// 保留最近若干条请求的 data（包括还没有模板的类型），由此推断 JSON Schema 并生成引用了全部字段的模板骨架：
+//
+//	GET /admin/schema/:site/:type                  # {"samples": n, "schema": {...}, "template": "..."}
+//	GET /admin/schema/:site/:type?format=template  # 只返回模板骨架
+//	snapcast schema [--template out.html] data1.json data2.json ...
+//
+// 样本只保存在内存中。
+
+const maxSchemaSampleSize = 256 << 10 // 单条样本上限，超过时不保存
+
+// payloadSamples 每个 site/type 最近的请求数据，保存序列化后的 JSON，避免后续阶段修改 data 影响样本
+type payloadSamples struct {
+	mu      sync.Mutex
+	limit   int
+	maxKeys int
+	samples map[string][][]byte
+	updated map[string]time.Time
+}
+
+var globalPayloadSamples = &payloadSamples{samples: make(map[string][][]byte), updated: make(map[string]time.Time)}
+
+// ConfigurePayloadSamples 读取 schema.samples 与 schema.max_keys，由 ApplyDynamicConfig 调用
+func ConfigurePayloadSamples() {
+	s := globalPayloadSamples
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit = max(viper.GetInt("schema.samples"), 0)
+	s.maxKeys = viper.GetInt("schema.max_keys")
+	if s.maxKeys <= 0 {
+		s.maxKeys = 200
+	}
+	if s.limit == 0 {
+		clear(s.samples)
+		clear(s.updated)
+	}
+}
+
+// Record 保存一条请求数据，site/type 数量超过上限时淘汰最久未更新的
+func (s *payloadSamples) Record(payload *PushPayload) {
+	if payload.Data == nil || !templateKeyRegex.MatchString(payload.Site) || !templateKeyRegex.MatchString(payload.Type) {
+		return
+	}
+	s.mu.Lock()
+	limit := s.limit
+	s.mu.Unlock()
+	if limit == 0 {
+		return
+	}
+	b, err := json.Marshal(payload.Data)
+	if err != nil || len(b) > maxSchemaSampleSize {
+		return
+	}
+
+	key := payload.Site + "/" + payload.Type
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.samples[key]; !exists && len(s.samples) >= s.maxKeys {
+		oldest, oldestTime := "", time.Time{}
+		for k, t := range s.updated {
+			if oldest == "" || t.Before(oldestTime) {
+				oldest, oldestTime = k, t
+			}
+		}
+		delete(s.samples, oldest)
+		delete(s.updated, oldest)
+	}
+	list := append(s.samples[key], b)
+	if len(list) > s.limit {
+		list = list[len(list)-s.limit:]
+	}
+	s.samples[key] = list
+	s.updated[key] = time.Now()
+}
+
+// Get 返回 site/type 的全部样本
+func (s *payloadSamples) Get(key string) []any {
+	s.mu.Lock()
+	raw := append([][]byte(nil), s.samples[key]...)
+	s.mu.Unlock()
+	values := make([]any, 0, len(raw))
+	for _, b := range raw {
+		var v any
+		if json.Unmarshal(b, &v) == nil {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// schemaNode 汇总同一位置上观察到的全部值
+type schemaNode struct {
+	count     int             // 出现次数
+	types     map[string]bool // JSON Schema 类型
+	props     map[string]*schemaNode
+	objects   int // 其中对象的个数，用于计算 required
+	items     *schemaNode
+	strings   int
+	uris      int
+	dateTimes int
+}
+
+func newSchemaNode() *schemaNode {
+	return &schemaNode{types: make(map[string]bool)}
+}
+
+func (n *schemaNode) add(v any) {
+	n.count++
+	switch v := v.(type) {
+	case nil:
+		n.types["null"] = true
+	case bool:
+		n.types["boolean"] = true
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			n.types["integer"] = true
+		} else {
+			n.types["number"] = true
+		}
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			n.types["integer"] = true
+		} else {
+			n.types["number"] = true
+		}
+	case string:
+		n.types["string"] = true
+		n.strings++
+		if strings.HasPrefix(v, "http://") || strings.HasPrefix(v, "https://") {
+			n.uris++
+		}
+		if _, err := time.Parse(time.RFC3339, v); err == nil {
+			n.dateTimes++
+		}
+	case []any:
+		n.types["array"] = true
+		if n.items == nil {
+			n.items = newSchemaNode()
+		}
+		for _, item := range v {
+			n.items.add(item)
+		}
+	case map[string]any:
+		n.types["object"] = true
+		n.objects++
+		if n.props == nil {
+			n.props = make(map[string]*schemaNode)
+		}
+		for key, value := range v {
+			child, exists := n.props[key]
+			if !exists {
+				child = newSchemaNode()
+				n.props[key] = child
+			}
+			child.add(value)
+		}
+	}
+}
+
+// schema 转换为 JSON Schema，同时出现整数与小数时合并为 number
+func (n *schemaNode) schema() map[string]any {
+	out := make(map[string]any)
+	if n.types["integer"] && n.types["number"] {
+		delete(n.types, "integer")
+	}
+	types := make([]string, 0, len(n.types))
+	for t := range n.types {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	switch len(types) {
+	case 0:
+	case 1:
+		out["type"] = types[0]
+	default:
+		out["type"] = types
+	}
+	if n.strings > 0 && n.strings == n.uris {
+		out["format"] = "uri"
+	} else if n.strings > 0 && n.strings == n.dateTimes {
+		out["format"] = "date-time"
+	}
+	if n.props != nil {
+		props := make(map[string]any, len(n.props))
+		var required []string
+		for key, child := range n.props {
+			props[key] = child.schema()
+			if child.count == n.objects {
+				required = append(required, key)
+			}
+		}
+		sort.Strings(required)
+		out["properties"] = props
+		if len(required) > 0 {
+			out["required"] = required
+		}
+	}
+	if n.items != nil && n.items.count > 0 {
+		out["items"] = n.items.schema()
+	}
+	return out
+}
+
+// inferSchema 由样本推断 JSON Schema
+func inferSchema(samples []any) map[string]any {
+	root := newSchemaNode()
+	for _, v := range samples {
+		root.add(v)
+	}
+	schema := root.schema()
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	return schema
+}
+
+var identRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// fieldRef 模板中引用字段的表达式，非标识符的键使用 index
+func fieldRef(key string) string {
+	if identRegex.MatchString(key) {
+		return "." + key
+	}
+	b, _ := json.Marshal(key)
+	return "(index . " + string(b) + ")"
+}
+
+// skeletonTemplate 生成逐项引用全部字段的模板骨架，可在此基础上调整样式
+func skeletonTemplate(site, typ string, samples []any) string {
+	root := newSchemaNode()
+	for _, v := range samples {
+		root.add(v)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, `<!DOCTYPE html>
+<html lang="{{or lang "zh-CN"}}">
+<head>
+  <meta charset="UTF-8">
+  <title>%s/%s</title>
+  <style>
+    body { font-family: "Segoe UI", "PingFang SC", sans-serif; margin: 0; padding: 20px; background: #f9f9f9; }
+    .card { background: #fff; border-radius: 10px; box-shadow: 0 2px 8px rgba(0,0,0,0.1); padding: 20px; max-width: 800px; margin: auto; }
+    .field { display: flex; padding: 6px 0; font-size: 14px; }
+    .label { flex: 0 0 140px; color: #888; }
+    .group { margin-left: 16px; }
+    img { max-width: 240px; border-radius: 6px; }
+  </style>
+</head>
+<body>
+  <!-- 由 %d 条请求数据生成的模板骨架 -->
+  <div class="card">
+`, site, typ, len(samples))
+	writeSkeletonFields(&b, root, 2)
+	b.WriteString("  </div>\n</body>\n</html>\n")
+	return b.String()
+}
+
+func writeSkeletonFields(b *strings.Builder, n *schemaNode, depth int) {
+	keys := make([]string, 0, len(n.props))
+	for key := range n.props {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	indent := strings.Repeat("  ", depth)
+	for _, key := range keys {
+		child := n.props[key]
+		ref := fieldRef(key)
+		label := htmlEscaper.Replace(key)
+		switch {
+		case child.types["object"]:
+			fmt.Fprintf(b, "%s{{with %s}}\n%s<div class=\"field\"><span class=\"label\">%s</span></div>\n%s<div class=\"group\">\n", indent, ref, indent, label, indent)
+			writeSkeletonFields(b, child, depth+1)
+			fmt.Fprintf(b, "%s</div>\n%s{{end}}\n", indent, indent)
+		case child.types["array"] && child.items != nil && child.items.props != nil:
+			fmt.Fprintf(b, "%s<div class=\"field\"><span class=\"label\">%s</span></div>\n%s{{range %s}}\n%s<div class=\"group\">\n", indent, label, indent, ref, indent)
+			writeSkeletonFields(b, child.items, depth+1)
+			fmt.Fprintf(b, "%s</div>\n%s{{end}}\n", indent, indent)
+		case child.types["array"]:
+			fmt.Fprintf(b, "%s<div class=\"field\"><span class=\"label\">%s</span><span>{{range $i, $v := %s}}{{if $i}}, {{end}}{{$v}}{{end}}</span></div>\n", indent, label, ref)
+		case child.strings > 0 && child.strings == child.uris && imageFieldRegex.MatchString(key):
+			fmt.Fprintf(b, "%s<div class=\"field\"><span class=\"label\">%s</span><img src=\"{{%s}}\"></div>\n", indent, label, ref)
+		case child.types["integer"] || child.types["number"]:
+			// 避免大整数输出为 1e+06
+			fmt.Fprintf(b, "%s<div class=\"field\"><span class=\"label\">%s</span><span>{{toString %s}}</span></div>\n", indent, label, ref)
+		default:
+			fmt.Fprintf(b, "%s<div class=\"field\"><span class=\"label\">%s</span><span>{{%s}}</span></div>\n", indent, label, ref)
+		}
+	}
+}
+
+var (
+	imageFieldRegex = regexp.MustCompile(`(?i)(face|avatar|cover|pic|image|img|icon|thumb|banner|logo)`)
+	htmlEscaper     = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "{{", "&#123;&#123;")
+)
+
+// AdminSchemaHandler 由最近的请求数据推断 JSON Schema 与模板骨架
+func AdminSchemaHandler(c *gin.Context) {
+	site, typ := c.Param("site"), c.Param("type")
+	samples := globalPayloadSamples.Get(site + "/" + typ)
+	if len(samples) == 0 {
+		c.JSON(http.StatusNotFound, errResp("no samples collected for "+site+"/"+typ+", check schema.samples"))
+		return
+	}
+	switch c.Query("format") {
+	case "":
+		c.JSON(http.StatusOK, ok(gin.H{
+			"samples":  len(samples),
+			"schema":   inferSchema(samples),
+			"template": skeletonTemplate(site, typ, samples),
+		}))
+	case "schema":
+		c.JSON(http.StatusOK, inferSchema(samples))
+	case "template":
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(skeletonTemplate(site, typ, samples)))
+	default:
+		c.JSON(http.StatusBadRequest, errResp("invalid format: must be schema or template"))
+	}
+}
+
+// readJSONValues 依次读取 JSON 文档，支持单个 JSON 与每行一个的 JSON Lines
+func readJSONValues(r io.Reader) ([]any, error) {
+	dec := json.NewDecoder(r)
+	var values []any
+	for {
+		var v any
+		err := dec.Decode(&v)
+		if errors.Is(err, io.EOF) {
+			return values, nil
+		}
+		if err != nil {
+			return values, err
+		}
+		values = append(values, v)
+	}
+}
+
+// cmdSchema 由数据文件推断 JSON Schema 并可生成模板骨架
+func cmdSchema(args []string) int {
+	fset := flag.NewFlagSet("schema", flag.ContinueOnError)
+	site := fset.String("site", "site", "模板骨架中的站点名")
+	typ := fset.String("type", "type", "模板骨架中的类型名")
+	tmplOut := fset.String("template", "", "模板骨架输出路径，- 为标准输出")
+	schemaOut := fset.String("out", "-", "JSON Schema 输出路径，- 为标准输出")
+	fset.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: snapcast schema [--template out.html] [--out schema.json] [数据文件 ...]（省略文件时读取标准输入，支持 JSON Lines）")
+		fset.PrintDefaults()
+	}
+	if err := fset.Parse(args); err != nil {
+		return 2
+	}
+
+	var samples []any
+	files := fset.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	for _, name := range files {
+		var r io.Reader = os.Stdin
+		if name != "-" {
+			f, err := os.Open(name)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "❌", err)
+				return 1
+			}
+			defer f.Close()
+			r = f
+		}
+		values, err := readJSONValues(r)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %s: %v\n", name, err)
+			return 1
+		}
+		samples = append(samples, values...)
+	}
+	if len(samples) == 0 {
+		fmt.Fprintln(os.Stderr, "❌ 没有读取到数据")
+		return 1
+	}
+
+	schema, _ := json.MarshalIndent(inferSchema(samples), "", "  ")
+	outputs := []struct{ path, content string }{{*schemaOut, string(schema) + "\n"}}
+	if *tmplOut != "" {
+		outputs = append(outputs, struct{ path, content string }{*tmplOut, skeletonTemplate(*site, *typ, samples)})
+	}
+	for _, o := range outputs {
+		if o.path == "-" {
+			fmt.Print(o.content)
+			continue
+		}
+		if err := writeFileAll(o.path, []byte(o.content)); err != nil {
+			fmt.Fprintln(os.Stderr, "❌", err)
+			return 1
+		}
+		fmt.Fprintln(os.Stderr, "✅ 已写入", o.path)
+	}
+	return 0
+}
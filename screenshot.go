@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+)
+
+// ====== 区域截图 ======
+//
+// 截图区域（body 或 data-frame 元素）通过 Page.captureScreenshot 的 clip 参数交给 Chrome 裁剪，
+// 而不是截取整页后在 Go 中解码、裁剪、再编码：长页面的整页截图解码后可达上百 MB，
+// 裁剪在 Chrome 内完成时 Go 侧不需要解码图片。
+//
+// clip 使用文档坐标（CSS 像素），Chrome 按 devicePixelRatio 输出实际像素，
+// 与原先按 DPR 换算裁剪坐标的结果相同。
+
+// bodyRectJS 返回 body 相对文档的位置，超出文档的部分已截掉
+const bodyRectJS = `(function() {
+	const el = document.querySelector('body');
+	const r = el.getBoundingClientRect();
+	const doc = document.documentElement;
+	const x = Math.max(0, Math.floor(r.left + (window.scrollX || doc.scrollLeft)));
+	const y = Math.max(0, Math.floor(r.top + (window.scrollY || doc.scrollTop)));
+	const w = Math.min(Math.ceil(r.width), doc.scrollWidth - x);
+	const h = Math.min(Math.ceil(r.height), doc.scrollHeight - y);
+	return JSON.stringify({ x, y, w, h });
+})()`
+
+// errEmptyClip 截图区域宽或高为 0
+var errEmptyClip = errors.New("screenshot area is empty")
+
+// bodyRect 返回 body 的截图区域
+func bodyRect(ctx context.Context) (frameRect, error) {
+	var js string
+	if err := chromedp.Run(ctx, chromedp.EvaluateAsDevTools(bodyRectJS, &js)); err != nil {
+		return frameRect{}, err
+	}
+	var r frameRect
+	if err := json.Unmarshal([]byte(js), &r); err != nil {
+		return frameRect{}, err
+	}
+	return r, nil
+}
+
+// clipScreenshot 截取文档中的一块区域（CSS 像素）并返回 PNG。
+// quality < 100 时与原先的整页截图一样由 Chrome 按 JPEG 压缩，再转换为 PNG 保持输出格式不变，
+// 只有这种情况需要解码。
+func clipScreenshot(ctx context.Context, r frameRect, quality int) ([]byte, error) {
+	if r.W <= 0 || r.H <= 0 {
+		return nil, errEmptyClip
+	}
+	capture := page.CaptureScreenshot().
+		WithCaptureBeyondViewport(true).
+		WithFromSurface(true).
+		WithClip(&page.Viewport{X: r.X, Y: r.Y, Width: r.W, Height: r.H, Scale: 1})
+	lossy := quality > 0 && quality < 100
+	if lossy {
+		capture = capture.WithFormat(page.CaptureScreenshotFormatJpeg).WithQuality(int64(quality))
+	} else {
+		capture = capture.WithFormat(page.CaptureScreenshotFormatPng)
+	}
+
+	var buf []byte
+	err := chromedp.Run(ctx, chromedp.ActionFunc(func(ctx context.Context) error {
+		var err error
+		buf, err = capture.Do(ctx)
+		return err
+	}))
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) == 0 {
+		return nil, fmt.Errorf("screenshot data is empty")
+	}
+	if !lossy {
+		return buf, nil
+	}
+	img, _, err := image.Decode(bytes.NewReader(buf))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode screenshot: %w", err)
+	}
+	var out bytes.Buffer
+	if err := png.Encode(&out, img); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// clampRect 将区域限制在 w×h 的文档内，完全在文档外时返回 false
+func clampRect(r frameRect, w, h float64) (frameRect, bool) {
+	x0, y0 := math.Max(r.X, 0), math.Max(r.Y, 0)
+	x1, y1 := math.Min(r.X+r.W, w), math.Min(r.Y+r.H, h)
+	if x1 <= x0 || y1 <= y0 {
+		return frameRect{}, false
+	}
+	return frameRect{X: x0, Y: y0, W: x1 - x0, H: y1 - y0}, true
+}
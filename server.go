@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== HTTP 服务参数 ======
+//
+// 渲染耗时较长，慢客户端可能长时间占用连接，小内存主机上需要限制各阶段的超时。
+// 以下配置修改需重启。
+
+// serverDuration 读取时长配置，未设置或无效时使用默认值，"0" 表示不限制
+func serverDuration(key string, def time.Duration) time.Duration {
+	if !viper.IsSet(key) {
+		return def
+	}
+	d, err := ParseDuration(viper.Get(key))
+	if err != nil || d < 0 {
+		logger.Warn("❗ "+key+" 值无效", zap.Any("value", viper.Get(key)), zap.Duration("default", def))
+		return def
+	}
+	return d
+}
+
+// newHTTPServer 按 server.* 配置创建 HTTP 服务，tlsConfig 非 nil 时以 HTTPS 提供服务（见 tls.go）
+func newHTTPServer(addr string, handler http.Handler, tlsConfig *tls.Config) *http.Server {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ConnContext:       markUnixConn,
+		ReadHeaderTimeout: serverDuration("server.read_header_timeout", 10*time.Second),
+		ReadTimeout:       serverDuration("server.read_timeout", 30*time.Second),
+		WriteTimeout:      serverDuration("server.write_timeout", 120*time.Second),
+		IdleTimeout:       serverDuration("server.idle_timeout", 120*time.Second),
+		MaxHeaderBytes:    viper.GetInt("server.max_header_bytes"),
+	}
+
+	// 写超时从读完请求头开始计算，需覆盖排队与渲染时间
+	if srv.WriteTimeout > 0 {
+		concurrentMutex.Lock()
+		queueWait := queueTimeout
+		concurrentMutex.Unlock()
+		if renderTimeout := time.Duration(currentRenderDefaults().MaxTimeoutMs) * time.Millisecond; srv.WriteTimeout <= renderTimeout+queueWait {
+			logger.Warn("⚠️ server.write_timeout 不大于 render.max_timeout 与 render.queue.timeout 之和，渲染完成前连接可能被关闭",
+				zap.Duration("write_timeout", srv.WriteTimeout), zap.Duration("render_timeout", renderTimeout), zap.Duration("queue_timeout", queueWait))
+		}
+	}
+
+	// 未启用 TLS 时 HTTP/2 以 h2c（明文，需客户端直接使用 HTTP/2）提供，HTTP/1.1 始终可用
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	if viper.GetBool("server.http2") {
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+	}
+	srv.Protocols = &protocols
+	logger.Debug("🌐 HTTP 服务参数",
+		zap.Duration("read_header_timeout", srv.ReadHeaderTimeout), zap.Duration("read_timeout", srv.ReadTimeout),
+		zap.Duration("write_timeout", srv.WriteTimeout), zap.Duration("idle_timeout", srv.IdleTimeout),
+		zap.Int("max_header_bytes", srv.MaxHeaderBytes), zap.Bool("http2", viper.GetBool("server.http2")))
+	return srv
+}
+
+// ====== 监听地址 ======
+//
+// server.listen 为空时监听 server.host:server.port；设置为 unix:///var/run/snapcast.sock 时改为监听
+// Unix 域套接字，供同一主机上的机器人进程调用。套接字的访问权限由文件权限（server.socket_mode）控制，
+// server.socket_auth 为 false（默认）时经套接字的请求跳过 token/HMAC 认证与 IP 过滤。
+
+const unixListenPrefix = "unix://"
+
+type unixConnKey struct{}
+
+// listenAddr 返回监听地址的描述与 Unix 套接字路径（TCP 时为空）
+func listenAddr() (addr, socket string, err error) {
+	listen := viper.GetString("server.listen")
+	switch {
+	case strings.HasPrefix(listen, unixListenPrefix):
+		socket = strings.TrimPrefix(listen, unixListenPrefix)
+		if socket == "" {
+			return "", "", errors.New("server.listen: empty unix socket path")
+		}
+		return listen, socket, nil
+	case listen != "":
+		return strings.TrimPrefix(listen, "tcp://"), "", nil
+	}
+	port := viper.GetString("server.port")
+	if port == "" {
+		return "", "", errors.New("server.port 不能为空")
+	}
+	return net.JoinHostPort(viper.GetString("server.host"), port), "", nil
+}
+
+// newListener 按 server.listen 创建监听，Unix 套接字会先删除遗留的套接字文件
+func newListener() (net.Listener, error) {
+	addr, socket, err := listenAddr()
+	if err != nil {
+		return nil, err
+	}
+	if socket == "" {
+		return net.Listen("tcp", addr)
+	}
+	if info, err := os.Lstat(socket); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", socket)
+		}
+		_ = os.Remove(socket) // 上次未正常退出遗留的套接字
+	}
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	mode := os.FileMode(0660)
+	if s := viper.GetString("server.socket_mode"); s != "" {
+		m, err := strconv.ParseUint(s, 8, 32)
+		if err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("invalid server.socket_mode %q: %w", s, err)
+		}
+		mode = os.FileMode(m)
+	}
+	if err := os.Chmod(socket, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// markUnixConn 作为 http.Server.ConnContext，标记经 Unix 套接字建立的连接
+func markUnixConn(ctx context.Context, c net.Conn) context.Context {
+	if c.LocalAddr().Network() == "unix" {
+		return context.WithValue(ctx, unixConnKey{}, true)
+	}
+	return ctx
+}
+
+// isUnixSocketRequest 判断请求是否经 Unix 套接字到达
+func isUnixSocketRequest(c *gin.Context) bool {
+	unix, _ := c.Request.Context().Value(unixConnKey{}).(bool)
+	return unix
+}
+
+// trustedSocketRequest 经 Unix 套接字且未开启 server.socket_auth 的请求免认证与 IP 过滤
+func trustedSocketRequest(c *gin.Context) bool {
+	return isUnixSocketRequest(c) && !viper.GetBool("server.socket_auth")
+}
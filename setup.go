@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap/zapcore"
+)
+
+// ====== 首次运行配置向导 ======
+
+const setupConfigFile = "snapcast.yaml"
+
+// cmdSetup 交互式生成 snapcast.yaml：检测浏览器、生成认证 token、释放示例模板并执行一次测试渲染
+func cmdSetup(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "用法: snapcast setup")
+		return 2
+	}
+	InitLogger()
+	in := bufio.NewReader(os.Stdin)
+	if _, err := os.Stat(setupConfigFile); err == nil {
+		if !confirm(in, setupConfigFile+" 已存在，是否覆盖", false) {
+			fmt.Println("❕ 已取消")
+			return 0
+		}
+	}
+	if err := runSetup(in); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ 配置失败:", err)
+		return 1
+	}
+	return 0
+}
+
+// runSetup 执行向导流程，也在首次启动且终端可交互时由 ensureConfigFile 调用
+func runSetup(in *bufio.Reader) error {
+	// 向导期间关闭日志，错误由向导自行输出，避免干扰交互
+	prevLevel := logLevel.Level()
+	logLevel.SetLevel(zapcore.DPanicLevel)
+	defer logLevel.SetLevel(prevLevel)
+
+	fmt.Println("🧙 SnapCast 配置向导（直接回车使用默认值）")
+	fmt.Println()
+
+	// 1. 浏览器
+	browserPath := resolveBrowserPath()
+	if browserPath != "" {
+		fmt.Println("🧭 检测到浏览器:", browserPath)
+	} else {
+		fmt.Println("❕ 未检测到 Chrome/Edge，请手动输入路径（留空则启动时再次自动检测）")
+	}
+	browserPath = prompt(in, "浏览器路径", browserPath)
+
+	// 2. 监听端口
+	port := prompt(in, "监听端口", "8080")
+	for {
+		if n, err := strconv.Atoi(port); err == nil && n > 0 && n < 65536 {
+			break
+		}
+		fmt.Println("❕ 无效的端口:", port)
+		port = prompt(in, "监听端口", "8080")
+	}
+
+	// 3. 认证 token
+	token := ""
+	if confirm(in, "是否启用认证", true) {
+		token = prompt(in, "认证 token", generateToken())
+	}
+
+	// 4. 模板目录
+	templateDir := prompt(in, "模板目录", "./templates")
+
+	config := defaultConfig()
+	config = setConfigValue(config, "server", "port", port)
+	config = setConfigValue(config, "auth", "token", strconv.Quote(token))
+	config = setConfigValue(config, "template", "dir", strconv.Quote(templateDir))
+	config = setConfigValue(config, "render", "browser_path", strconv.Quote(browserPath))
+	if err := os.WriteFile(setupConfigFile, config, 0644); err != nil {
+		return err
+	}
+	fmt.Println("✅ 已生成", setupConfigFile)
+
+	written, err := scaffoldTemplates(templateDir, false)
+	if err != nil {
+		return err
+	}
+	for _, f := range written {
+		fmt.Println("✅ 已生成", f)
+	}
+	if token != "" {
+		fmt.Println()
+		fmt.Println("🔐 请求时需携带: Authorization: Bearer " + token)
+	}
+
+	// 5. 测试渲染
+	fmt.Println()
+	if !confirm(in, "是否执行一次测试渲染", true) {
+		return nil
+	}
+	out, err := setupTestRender(browserPath, templateDir)
+	if err != nil {
+		fmt.Println("❌ 测试渲染失败:", err)
+		fmt.Println("   请检查 render.browser_path 后运行 snapcast 启动服务")
+		return nil
+	}
+	fmt.Println("✅ 测试渲染成功:", out)
+	return nil
+}
+
+// setupTestRender 使用刚生成的配置与示例数据渲染第一个示例模板
+func setupTestRender(browserPath, templateDir string) (string, error) {
+	viper.SetConfigFile(setupConfigFile)
+	if err := viper.ReadInConfig(); err != nil {
+		return "", err
+	}
+	level := logLevel.Level()
+	ApplyDynamicConfig()
+	logLevel.SetLevel(level)
+
+	if err := loadTemplates(templateDir); err != nil {
+		return "", err
+	}
+	payload := PushPayload{Site: "bilibili", Type: "live"}
+	tmplPath := selectTemplate(payload)
+	if tmplPath == "" {
+		return "", fmt.Errorf("示例模板 bilibili_live.html 不存在")
+	}
+	data, err := loadSampleData(tmplPath)
+	if err != nil {
+		return "", err
+	}
+	payload.Data = data
+
+	if browserPath == "" {
+		browserPath = resolveBrowserPath()
+	}
+	InitGlobalAllocator(browserPath)
+	defer globalAllocCancel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	result, err := renderPayload(ctx, &payload)
+	if err != nil {
+		return "", err
+	}
+	out := "snapcast_test.png"
+	if err := os.WriteFile(out, result.Body, 0644); err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// isInteractive 判断标准输入是否为终端
+func isInteractive() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func prompt(in *bufio.Reader, label, def string) string {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", label, def)
+	} else {
+		fmt.Printf("%s: ", label)
+	}
+	line, _ := in.ReadString('\n')
+	if line = strings.TrimSpace(line); line != "" {
+		return line
+	}
+	return def
+}
+
+func confirm(in *bufio.Reader, label string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	for {
+		fmt.Printf("%s [%s]: ", label, hint)
+		line, err := in.ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "":
+			return def
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		}
+		if err != nil {
+			return def
+		}
+	}
+}
+
+func generateToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// setConfigValue 替换 YAML 中 section.key 的值，保留缩进与行尾注释
+func setConfigValue(doc []byte, section, key, value string) []byte {
+	lines := strings.Split(string(doc), "\n")
+	keyRegex := regexp.MustCompile(`^(\s+` + regexp.QuoteMeta(key) + `:\s*)("[^"]*"|[^\s#]*)(.*)$`)
+	current := ""
+	for i, line := range lines {
+		if line != "" && line[0] != ' ' && line[0] != '#' {
+			current = strings.TrimSuffix(strings.TrimSpace(line), ":")
+			continue
+		}
+		if current != section {
+			continue
+		}
+		if m := keyRegex.FindStringSubmatch(line); m != nil {
+			lines[i] = m[1] + value + m[3]
+			break
+		}
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 过载保护 ======
+//
+// 后台每 2 秒采样主机 CPU、内存使用率与最近截图耗时（浏览器响应速度）。任一指标超过 render.shedding 中的阈值时
+// 进入过载状态，priority 低于 min_priority 的请求在排队前直接返回 503，把浏览器留给开播通知等高优先级请求。
+// 所有指标回落到阈值的 90% 以下时退出过载状态，避免在阈值附近反复切换。
+
+var errOverloaded = errors.New("server overloaded, try again later")
+
+// sheddingConfig 过载保护参数，阈值为 0 表示不检查该项
+type sheddingConfig struct {
+	enabled       bool
+	cpu           float64
+	memory        float64
+	chromeLatency time.Duration
+	minPriority   int
+}
+
+// loadMonitor 最近一次采样的结果，由 mu 保护
+type loadMonitor struct {
+	mu            sync.Mutex
+	config        sheddingConfig
+	cpu           float64 // 0-1，无法采样时为 -1
+	memory        float64
+	chromeLatency time.Duration // 截图耗时的指数移动平均
+	lastCapture   time.Time
+	overloaded    bool
+	reasons       []string
+	prevCPU       cpuTimes
+}
+
+var globalLoad = &loadMonitor{cpu: -1, memory: -1}
+
+var (
+	loadShedTotal = NewCounterVec("snapcast_load_shed_total", "Low-priority requests rejected while the host was overloaded, by reason.", "reason")
+)
+
+func init() {
+	NewGaugeFunc("snapcast_host_cpu_usage", "Host CPU usage ratio sampled for load shedding, -1 if unavailable.", func() float64 {
+		globalLoad.mu.Lock()
+		defer globalLoad.mu.Unlock()
+		return globalLoad.cpu
+	})
+	NewGaugeFunc("snapcast_host_memory_usage", "Host memory usage ratio sampled for load shedding, -1 if unavailable.", func() float64 {
+		globalLoad.mu.Lock()
+		defer globalLoad.mu.Unlock()
+		return globalLoad.memory
+	})
+	NewGaugeFunc("snapcast_chrome_latency_seconds", "Moving average of screenshot capture time.", func() float64 {
+		globalLoad.mu.Lock()
+		defer globalLoad.mu.Unlock()
+		return globalLoad.chromeLatency.Seconds()
+	})
+	NewGaugeFunc("snapcast_overloaded", "Whether load shedding is currently active.", func() float64 {
+		globalLoad.mu.Lock()
+		defer globalLoad.mu.Unlock()
+		if globalLoad.overloaded {
+			return 1
+		}
+		return 0
+	})
+}
+
+// ConfigureLoadShedding 读取 render.shedding，由 ApplyDynamicConfig 调用
+func ConfigureLoadShedding() {
+	cfg := sheddingConfig{
+		enabled:     viper.GetBool("render.shedding.enabled"),
+		cpu:         0.9,
+		memory:      0.9,
+		minPriority: 1,
+	}
+	for key, dst := range map[string]*float64{"cpu": &cfg.cpu, "memory": &cfg.memory} {
+		if !viper.IsSet("render.shedding." + key) {
+			continue
+		}
+		v := viper.GetFloat64("render.shedding." + key)
+		if v < 0 || v > 1 {
+			logger.Warn("❗ render.shedding."+key+" 应在 0-1 之间", zap.Float64(key, v), zap.Float64("default", *dst))
+			continue
+		}
+		*dst = v
+	}
+	cfg.chromeLatency = 5 * time.Second
+	if viper.IsSet("render.shedding.chrome_latency") {
+		if d, err := ParseDuration(viper.Get("render.shedding.chrome_latency")); err != nil || d < 0 {
+			logger.Warn("❗ render.shedding.chrome_latency 值无效", zap.Any("chrome_latency", viper.Get("render.shedding.chrome_latency")), zap.String("default", "5s"))
+		} else {
+			cfg.chromeLatency = d
+		}
+	}
+	if viper.IsSet("render.shedding.min_priority") {
+		cfg.minPriority = viper.GetInt("render.shedding.min_priority")
+	}
+
+	globalLoad.mu.Lock()
+	defer globalLoad.mu.Unlock()
+	globalLoad.config = cfg
+	if !cfg.enabled && globalLoad.overloaded {
+		globalLoad.overloaded, globalLoad.reasons = false, nil
+	}
+}
+
+// StartLoadMonitor 启动后台采样
+func StartLoadMonitor(interval time.Duration) {
+	globalLoad.sample()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			globalLoad.sample()
+		}
+	}()
+}
+
+func (m *loadMonitor) sample() {
+	cur, cpuOK := readCPUTimes()
+	memory, memOK := hostMemoryUsage()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cpu = -1
+	if cpuOK && m.prevCPU.total > 0 && cur.total > m.prevCPU.total {
+		m.cpu = 1 - float64(cur.idle-m.prevCPU.idle)/float64(cur.total-m.prevCPU.total)
+	}
+	if cpuOK {
+		m.prevCPU = cur
+	}
+	m.memory = -1
+	if memOK {
+		m.memory = memory
+	}
+	// 低优先级请求被拒绝后截图变少，长时间没有截图时平均耗时逐步衰减，避免一直停留在过载状态
+	if time.Since(m.lastCapture) > 30*time.Second {
+		m.chromeLatency /= 2
+	}
+	if !m.config.enabled {
+		return
+	}
+
+	// 未过载时按阈值判断，过载时需回落到阈值的 90% 以下才恢复
+	factor := 1.0
+	if m.overloaded {
+		factor = 0.9
+	}
+	var reasons []string
+	if m.config.cpu > 0 && m.cpu >= m.config.cpu*factor {
+		reasons = append(reasons, "cpu")
+	}
+	if m.config.memory > 0 && m.memory >= m.config.memory*factor {
+		reasons = append(reasons, "memory")
+	}
+	if m.config.chromeLatency > 0 && float64(m.chromeLatency) >= float64(m.config.chromeLatency)*factor {
+		reasons = append(reasons, "chrome")
+	}
+	overloaded := len(reasons) > 0
+	if overloaded && !m.overloaded {
+		logger.Warn("🔥 主机过载，开始拒绝低优先级请求", zap.Strings("reasons", reasons), zap.Float64("cpu", round2(m.cpu)), zap.Float64("memory", round2(m.memory)), zap.Duration("chrome_latency", m.chromeLatency), zap.Int("min_priority", m.config.minPriority))
+	} else if !overloaded && m.overloaded {
+		logger.Info("🧊 主机负载恢复", zap.Float64("cpu", round2(m.cpu)), zap.Float64("memory", round2(m.memory)), zap.Duration("chrome_latency", m.chromeLatency))
+	}
+	m.overloaded, m.reasons = overloaded, reasons
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// observeChromeLatency 记录一次截图耗时
+func observeChromeLatency(d time.Duration) {
+	globalLoad.mu.Lock()
+	defer globalLoad.mu.Unlock()
+	globalLoad.lastCapture = time.Now()
+	if globalLoad.chromeLatency == 0 {
+		globalLoad.chromeLatency = d
+		return
+	}
+	globalLoad.chromeLatency = time.Duration(0.8*float64(globalLoad.chromeLatency) + 0.2*float64(d))
+}
+
+// shedLoad 过载时拒绝低优先级请求，返回是否拒绝
+func shedLoad(priority int) bool {
+	globalLoad.mu.Lock()
+	shed := globalLoad.config.enabled && globalLoad.overloaded && priority < globalLoad.config.minPriority
+	reason := strings.Join(globalLoad.reasons, ",")
+	globalLoad.mu.Unlock()
+	if shed {
+		loadShedTotal.Inc(reason)
+	}
+	return shed
+}
+
+// loadStatus 管理接口展示的负载状态
+func loadStatus() map[string]any {
+	globalLoad.mu.Lock()
+	defer globalLoad.mu.Unlock()
+	reasons := globalLoad.reasons
+	if reasons == nil {
+		reasons = []string{}
+	}
+	return map[string]any{
+		"cpu":               round2(globalLoad.cpu),
+		"memory":            round2(globalLoad.memory),
+		"chrome_latency_ms": globalLoad.chromeLatency.Milliseconds(),
+		"overloaded":        globalLoad.overloaded,
+		"reasons":           reasons,
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 渲染结果签名 ======
+//
+// 启用 signing.enabled 后，使用服务端 Ed25519 私钥对响应内容签名，下游可用公钥验证图片确实来自
+// 本实例且未被篡改。签名通过 X-SnapCast-Signature 响应头返回；signing.embed 开启时同时以
+// tEXt 块写入 PNG，签名覆盖去掉该块后的图片，便于图片脱离 HTTP 响应后单独验证。
+
+const (
+	signatureHeader   = "X-SnapCast-Signature"
+	signatureKeyID    = "X-SnapCast-Key-Id"
+	signatureChunkKey = "snapcast-signature"
+)
+
+type signer struct {
+	key   ed25519.PrivateKey
+	keyID string
+	embed bool
+}
+
+var globalSigner *signer
+
+// InitSigning 加载或生成签名私钥，返回是否启用
+func InitSigning() bool {
+	if !viper.GetBool("signing.enabled") {
+		return false
+	}
+	keyFile := viper.GetString("signing.key_file")
+	if keyFile == "" {
+		keyFile = "./snapcast_signing.key"
+	}
+	key, created, err := loadOrCreateSigningKey(keyFile)
+	if err != nil {
+		logger.Fatal("❌ 签名私钥加载失败", zap.String("key_file", keyFile), zap.Error(err))
+	}
+	globalSigner = &signer{key: key, keyID: signingKeyID(key.Public().(ed25519.PublicKey)), embed: viper.GetBool("signing.embed")}
+	if created {
+		logger.Info("🔑 已生成签名私钥", zap.String("key_file", keyFile), zap.String("key_id", globalSigner.keyID))
+	}
+	UseRenderMiddleware(StageDeliver, "sign", signMiddleware)
+	logger.Info("✍️ 渲染结果签名已启用", zap.String("key_id", globalSigner.keyID), zap.Bool("embed", globalSigner.embed))
+	return true
+}
+
+// loadOrCreateSigningKey 读取 PKCS#8 PEM 私钥，文件不存在时生成
+func loadOrCreateSigningKey(path string) (ed25519.PrivateKey, bool, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, false, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, false, err
+		}
+		if dir := filepath.Dir(path); dir != "." {
+			if err := os.MkdirAll(dir, 0700); err != nil {
+				return nil, false, err
+			}
+		}
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+			return nil, false, err
+		}
+		return key, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, false, errors.New("no PEM block found")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, false, err
+	}
+	key, isEd25519 := parsed.(ed25519.PrivateKey)
+	if !isEd25519 {
+		return nil, false, errors.New("signing key must be ed25519")
+	}
+	return key, false, nil
+}
+
+// signingKeyID 公钥 SHA-256 的前 8 字节，便于下游区分多个实例或轮换后的密钥
+func signingKeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Sign 返回 base64 编码的签名；embed 开启且内容为 PNG 时返回写入签名块后的内容
+func (s *signer) Sign(body []byte, contentType string) ([]byte, string) {
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, body))
+	if s.embed && contentType == "image/png" {
+		if embedded, err := insertPNGTextChunk(body, signatureChunkKey, s.keyID+":"+sig); err == nil {
+			body = embedded
+		}
+	}
+	return body, sig
+}
+
+// insertPNGTextChunk 在 IEND 之前写入 tEXt 块
+func insertPNGTextChunk(data []byte, key, value string) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) || len(data) < len(pngSignature)+12 {
+		return nil, errors.New("not a png image")
+	}
+	iend := len(data) - 12
+	if string(data[iend+4:iend+8]) != "IEND" {
+		return nil, errors.New("png does not end with IEND")
+	}
+	var out bytes.Buffer
+	out.Grow(len(data) + len(key) + len(value) + 13)
+	out.Write(data[:iend])
+	writePNGChunk(&out, "tEXt", []byte(key+"\x00"+value))
+	out.Write(data[iend:])
+	return out.Bytes(), nil
+}
+
+// extractPNGSignature 取出 PNG 中的签名块，返回去掉该块后的图片、密钥 ID 与签名
+func extractPNGSignature(data []byte) ([]byte, string, string, bool) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return data, "", "", false
+	}
+	prefix := []byte(signatureChunkKey + "\x00")
+	for pos := len(pngSignature); pos+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + length
+		if end > len(data) {
+			break
+		}
+		if string(data[pos+4:pos+8]) == "tEXt" && bytes.HasPrefix(data[pos+8:pos+8+length], prefix) {
+			keyID, sig, _ := strings.Cut(string(data[pos+8+len(prefix):pos+8+length]), ":")
+			stripped := append(append([]byte{}, data[:pos]...), data[end:]...)
+			return stripped, keyID, sig, true
+		}
+		pos = end
+	}
+	return data, "", "", false
+}
+
+// signMiddleware 在投递前签名，投递的内容与响应一致
+func signMiddleware(rc *RenderContext) error {
+	if r := rc.Result; r != nil && len(r.Body) > 0 && rc.Payload.Output != "json" {
+		r.Body, r.Signature = globalSigner.Sign(r.Body, r.ContentType)
+	}
+	return rc.Next()
+}
+
+// setSignatureHeaders 写入签名响应头
+func setSignatureHeaders(c *gin.Context, sig string) {
+	if sig == "" || globalSigner == nil {
+		return
+	}
+	c.Header(signatureHeader, "ed25519="+sig)
+	c.Header(signatureKeyID, globalSigner.keyID)
+}
+
+// PublicKeyHandler 返回 PEM 格式的签名公钥
+func PublicKeyHandler(c *gin.Context) {
+	der, err := x509.MarshalPKIXPublicKey(globalSigner.key.Public())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errResp(err.Error()))
+		return
+	}
+	c.Header(signatureKeyID, globalSigner.keyID)
+	c.Data(http.StatusOK, "application/x-pem-file", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+// cmdVerify 使用本地私钥（或公钥文件）验证文件签名：snapcast verify [--sig 签名] [--key 文件] <文件>
+func cmdVerify(args []string) int {
+	fset := flag.NewFlagSet("verify", flag.ContinueOnError)
+	sigFlag := fset.String("sig", "", "X-SnapCast-Signature 响应头的值，为空则读取 PNG 内嵌的签名")
+	keyFile := fset.String("key", "./snapcast_signing.key", "签名私钥或公钥（PEM）")
+	fset.Usage = func() {
+		fmt.Fprintln(os.Stderr, "用法: snapcast verify [--sig 签名] [--key 文件] <文件>")
+		fset.PrintDefaults()
+	}
+	if err := fset.Parse(args); err != nil || fset.NArg() != 1 {
+		fset.Usage()
+		return 2
+	}
+	data, err := os.ReadFile(fset.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+	pub, err := loadVerifyKey(*keyFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ 密钥读取失败:", err)
+		return 1
+	}
+
+	// 签名始终覆盖去掉签名块后的内容
+	data, keyID, embedded, found := extractPNGSignature(data)
+	sig := strings.TrimPrefix(*sigFlag, "ed25519=")
+	if sig == "" {
+		if !found {
+			fmt.Fprintln(os.Stderr, "❌ 文件中没有内嵌签名，请通过 --sig 指定")
+			return 1
+		}
+		sig = embedded
+		if keyID != signingKeyID(pub) {
+			fmt.Fprintf(os.Stderr, "❌ 密钥不匹配: 签名使用 %s，当前密钥为 %s\n", keyID, signingKeyID(pub))
+			return 1
+		}
+	}
+	raw, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil || !ed25519.Verify(pub, data, raw) {
+		fmt.Fprintln(os.Stderr, "❌ 签名无效")
+		return 1
+	}
+	fmt.Println("✅ 签名有效，key_id:", signingKeyID(pub))
+	return 0
+}
+
+// loadVerifyKey 读取 PEM 私钥或公钥，返回公钥
+func loadVerifyKey(path string) (ed25519.PublicKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	var parsed any
+	if block.Type == "PUBLIC KEY" {
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	} else {
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch k := parsed.(type) {
+	case ed25519.PublicKey:
+		return k, nil
+	case ed25519.PrivateKey:
+		return k.Public().(ed25519.PublicKey), nil
+	}
+	return nil, errors.New("key must be ed25519")
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/chromedp/cdproto/network"
+	"github.com/chromedp/chromedp"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 站点配置 ======
+//
+// sites.<site> 为某个站点的全部模板设置浏览器加载资源时的请求头，例如 B 站图片 CDN
+// 拒绝没有 Referer 的请求，模板中的头像在 Chrome 里会 403：
+//
+//	sites:
+//	  bilibili:
+//	    headers: {Referer: "https://www.bilibili.com/"}
+//	    user_agent: "Mozilla/5.0 ..."   # 请求未指定 options.user_agent 时使用
+//
+// 请求头通过 Network.setExtraHTTPHeaders 附加到页面发出的全部请求上。Cookie、Authorization 等
+// 带凭据的请求头在生效配置（/admin/config、snapcast config show）中脱敏。
+
+// SiteProfile 单个站点的配置
+type SiteProfile struct {
+	Headers   map[string]string `mapstructure:"headers"`
+	UserAgent string            `mapstructure:"user_agent"`
+}
+
+var siteProfiles atomic.Pointer[map[string]SiteProfile]
+
+var headerNameRegex = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+
+// ConfigureSiteProfiles 加载 sites，由 ApplyDynamicConfig 调用
+func ConfigureSiteProfiles() {
+	var raw map[string]SiteProfile
+	if err := viper.UnmarshalKey("sites", &raw); err != nil {
+		logger.Warn("❗ sites 格式无效", zap.Error(err))
+		return
+	}
+	profiles := make(map[string]SiteProfile, len(raw))
+	for site, p := range raw {
+		headers := make(map[string]string, len(p.Headers))
+		for name, value := range p.Headers {
+			canonical := http.CanonicalHeaderKey(name) // viper 会将键转为小写
+			if !headerNameRegex.MatchString(name) || canonical == "Host" || canonical == "Content-Length" {
+				logger.Warn("❗ sites 中的请求头无效，已忽略", zap.String("site", site), zap.String("header", name))
+				continue
+			}
+			headers[canonical] = value
+		}
+		p.Headers = headers
+		profiles[strings.ToLower(site)] = p
+	}
+	siteProfiles.Store(&profiles)
+}
+
+// siteProfileFor 返回站点配置，站点名不区分大小写
+func siteProfileFor(site string) SiteProfile {
+	if p := siteProfiles.Load(); p != nil {
+		return (*p)[strings.ToLower(site)]
+	}
+	return SiteProfile{}
+}
+
+// applySiteProfile 将站点配置合并到渲染参数，请求中的 user_agent 优先
+func applySiteProfile(opts *RenderOptions, site string) {
+	p := siteProfileFor(site)
+	if opts.UserAgent == "" {
+		opts.UserAgent = p.UserAgent
+	}
+	opts.ExtraHeaders = p.Headers
+}
+
+// extraHeadersAction 为页面之后发出的全部请求附加请求头
+func extraHeadersAction(headers map[string]string) chromedp.Action {
+	h := make(network.Headers, len(headers))
+	for name, value := range headers {
+		h[name] = value
+	}
+	return chromedp.ActionFunc(func(ctx context.Context) error {
+		if err := network.Enable().Do(ctx); err != nil {
+			return err
+		}
+		return network.SetExtraHTTPHeaders(h).Do(ctx)
+	})
+}
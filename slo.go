@@ -0,0 +1,319 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 延迟与错误率 SLO ======
+//
+// slo.objectives 为模板（site/type，支持 * 通配）定义延迟与成功率目标，渲染结果按分钟
+// 汇总。预算消耗速率（burn rate）= 窗口内未达标比例 / (1 - 目标)，5 分钟与 1 小时窗口
+// 同时超过 slo.burn_rate 时发出告警，回落后发出恢复通知。客户端错误（4xx）不计入错误预算。
+
+// sloBuckets 按分钟保留的桶数，覆盖最长的 1 小时窗口
+const sloBuckets = 60
+
+// SLO 种类
+const (
+	sloLatency = "latency"
+	sloError   = "error"
+)
+
+// sloWindows 计算消耗速率的窗口（分钟）
+var sloWindows = []struct {
+	name    string
+	minutes int64
+}{{"5m", 5}, {"1h", 60}}
+
+// SLOObjective 配置中的一项目标
+type SLOObjective struct {
+	Template      string  `mapstructure:"template" json:"template"`             // 模板键，如 news/headline、news/*，* 为所有模板
+	Latency       any     `mapstructure:"latency" json:"latency,omitempty"`     // 延迟阈值，如 "3s"
+	LatencyTarget float64 `mapstructure:"latency_target" json:"latency_target"` // 延迟在阈值内的请求比例，如 0.99
+	ErrorTarget   float64 `mapstructure:"error_target" json:"error_target"`     // 成功率目标，如 0.995
+}
+
+type sloBucket struct {
+	minute              int64
+	total, errors, slow float64
+}
+
+type sloTracker struct {
+	SLOObjective
+	latency time.Duration
+
+	mu      sync.Mutex
+	buckets [sloBuckets]sloBucket
+	firing  map[string]bool
+}
+
+type sloConfig struct {
+	burnRate    float64
+	minRequests float64
+	trackers    []*sloTracker
+}
+
+var sloSettings atomic.Pointer[sloConfig]
+
+// ConfigureSLO 读取 slo 配置，由 ApplyDynamicConfig 调用。目标不变的项保留已有统计。
+func ConfigureSLO() {
+	cfg := &sloConfig{burnRate: 14.4, minRequests: 10}
+	if viper.IsSet("slo.burn_rate") {
+		if v := viper.GetFloat64("slo.burn_rate"); v > 0 {
+			cfg.burnRate = v
+		} else {
+			logger.Warn("❗ slo.burn_rate 应大于 0", zap.Float64("burn_rate", v), zap.Float64("default", cfg.burnRate))
+		}
+	}
+	if viper.IsSet("slo.min_requests") {
+		cfg.minRequests = viper.GetFloat64("slo.min_requests")
+	}
+
+	var objectives []SLOObjective
+	if err := viper.UnmarshalKey("slo.objectives", &objectives); err != nil {
+		logger.Warn("❗ slo.objectives 格式无效", zap.Error(err))
+	}
+	previous := make(map[string]*sloTracker)
+	if old := sloSettings.Load(); old != nil {
+		for _, t := range old.trackers {
+			previous[sloTrackerID(t.SLOObjective)] = t
+		}
+	}
+	for _, o := range objectives {
+		if err := o.validate(); err != nil {
+			logger.Warn("❗ slo 目标无效，已忽略", zap.String("template", o.Template), zap.Error(err))
+			continue
+		}
+		if t, exists := previous[sloTrackerID(o)]; exists {
+			cfg.trackers = append(cfg.trackers, t)
+			continue
+		}
+		latency, _ := ParseDuration(o.Latency)
+		cfg.trackers = append(cfg.trackers, &sloTracker{SLOObjective: o, latency: latency, firing: make(map[string]bool)})
+	}
+	sloSettings.Store(cfg)
+}
+
+func (o SLOObjective) validate() error {
+	if o.Template == "" {
+		return fmt.Errorf("template is required")
+	}
+	if _, err := path.Match(o.Template, ""); err != nil {
+		return fmt.Errorf("invalid template pattern: %w", err)
+	}
+	if o.LatencyTarget < 0 || o.LatencyTarget >= 1 || o.ErrorTarget < 0 || o.ErrorTarget >= 1 {
+		return fmt.Errorf("targets must be between 0 and 1 (exclusive)")
+	}
+	if o.LatencyTarget == 0 && o.ErrorTarget == 0 {
+		return fmt.Errorf("latency_target or error_target is required")
+	}
+	if o.LatencyTarget > 0 {
+		d, err := ParseDuration(o.Latency)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("latency must be a positive duration when latency_target is set")
+		}
+	}
+	return nil
+}
+
+func sloTrackerID(o SLOObjective) string {
+	return fmt.Sprintf("%s\x00%v\x00%g\x00%g", o.Template, o.Latency, o.LatencyTarget, o.ErrorTarget)
+}
+
+func (t *sloTracker) matches(key string) bool {
+	if t.Template == "*" {
+		return true
+	}
+	ok, _ := path.Match(t.Template, key)
+	return ok
+}
+
+// observeSLO 记录一次渲染结果，template 为模板路径
+func observeSLO(template string, d time.Duration, err error) {
+	cfg := sloSettings.Load()
+	if cfg == nil || len(cfg.trackers) == 0 || template == "" {
+		return
+	}
+	key := templateKeyOf(template)
+	if key == "" {
+		return
+	}
+	failed := err != nil && renderErrorStatus(err) >= http.StatusInternalServerError
+	if err != nil && !failed {
+		return
+	}
+	minute := time.Now().Unix() / 60
+	for _, t := range cfg.trackers {
+		if t.matches(key) {
+			t.record(minute, d, failed)
+		}
+	}
+}
+
+func (t *sloTracker) record(minute int64, d time.Duration, failed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b := &t.buckets[minute%sloBuckets]
+	if b.minute != minute {
+		*b = sloBucket{minute: minute}
+	}
+	b.total++
+	switch {
+	case failed:
+		b.errors++
+	case t.latency > 0 && d > t.latency:
+		b.slow++
+	}
+}
+
+// window 汇总最近 minutes 分钟（含当前分钟）的计数
+func (t *sloTracker) window(now, minutes int64) sloBucket {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var sum sloBucket
+	for _, b := range t.buckets {
+		if b.minute > now-minutes && b.minute <= now {
+			sum.total += b.total
+			sum.errors += b.errors
+			sum.slow += b.slow
+		}
+	}
+	return sum
+}
+
+// burnRates 返回各 SLO 在各窗口的消耗速率，及各窗口的请求数
+func (t *sloTracker) burnRates(now int64) (map[string]map[string]float64, map[string]float64) {
+	rates := make(map[string]map[string]float64)
+	totals := make(map[string]float64, len(sloWindows))
+	for _, w := range sloWindows {
+		sum := t.window(now, w.minutes)
+		totals[w.name] = sum.total
+		for kind, target := range map[string]float64{sloLatency: t.LatencyTarget, sloError: t.ErrorTarget} {
+			if target == 0 {
+				continue
+			}
+			if rates[kind] == nil {
+				rates[kind] = make(map[string]float64, len(sloWindows))
+			}
+			bad := sum.errors
+			if kind == sloLatency {
+				bad = sum.slow
+			}
+			var rate float64
+			if sum.total > 0 {
+				rate = bad / sum.total / (1 - target)
+			}
+			rates[kind][w.name] = rate
+		}
+	}
+	return rates, totals
+}
+
+// StartSLOEvaluator 定期计算消耗速率并发送告警
+func StartSLOEvaluator(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			evaluateSLOs(time.Now())
+		}
+	}()
+}
+
+func evaluateSLOs(now time.Time) {
+	cfg := sloSettings.Load()
+	if cfg == nil {
+		return
+	}
+	minute := now.Unix() / 60
+	for _, t := range cfg.trackers {
+		rates, totals := t.burnRates(minute)
+		for kind, byWindow := range rates {
+			burning := totals["1h"] >= cfg.minRequests
+			for _, w := range sloWindows {
+				burning = burning && byWindow[w.name] >= cfg.burnRate
+			}
+			t.mu.Lock()
+			changed := t.firing[kind] != burning
+			t.firing[kind] = burning
+			t.mu.Unlock()
+			if !changed {
+				continue
+			}
+			target := t.ErrorTarget
+			if kind == sloLatency {
+				target = t.LatencyTarget
+			}
+			a := Alert{
+				Name:   "slo_burn_rate",
+				Labels: map[string]string{"template": t.Template, "slo": kind},
+				Values: map[string]float64{"burn_rate_5m": byWindow["5m"], "burn_rate_1h": byWindow["1h"], "threshold": cfg.burnRate, "target": target},
+				Time:   now,
+			}
+			if burning {
+				a.Status = AlertFiring
+				a.Summary = fmt.Sprintf("模板 %s 的 %s SLO 预算消耗过快（1h 速率 %.1f）", t.Template, kind, byWindow["1h"])
+			} else {
+				a.Status = AlertResolved
+				a.Summary = fmt.Sprintf("模板 %s 的 %s SLO 预算消耗已恢复", t.Template, kind)
+			}
+			notifyAlert(a)
+		}
+	}
+}
+
+// sloStatus 管理接口中的 SLO 状态
+func sloStatus() []map[string]any {
+	cfg := sloSettings.Load()
+	if cfg == nil {
+		return nil
+	}
+	minute := time.Now().Unix() / 60
+	out := make([]map[string]any, 0, len(cfg.trackers))
+	for _, t := range cfg.trackers {
+		rates, totals := t.burnRates(minute)
+		t.mu.Lock()
+		firing := make([]string, 0, len(t.firing))
+		for kind, on := range t.firing {
+			if on {
+				firing = append(firing, kind)
+			}
+		}
+		t.mu.Unlock()
+		out = append(out, map[string]any{
+			"objective": t.SLOObjective,
+			"requests":  totals,
+			"burn_rate": rates,
+			"firing":    firing,
+		})
+	}
+	return out
+}
+
+func init() {
+	NewGaugeVecFunc("snapcast_slo_burn_rate", "Error budget burn rate by SLO objective, kind and window.", func() map[string]float64 {
+		cfg := sloSettings.Load()
+		if cfg == nil {
+			return nil
+		}
+		minute := time.Now().Unix() / 60
+		values := make(map[string]float64)
+		for _, t := range cfg.trackers {
+			rates, _ := t.burnRates(minute)
+			for kind, byWindow := range rates {
+				for window, v := range byWindow {
+					values[t.Template+"\x00"+kind+"\x00"+window] = v
+				}
+			}
+		}
+		return values
+	}, "template", "slo", "window")
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 渲染结果存储 ======
+//
+// 请求指定 "response": "url" 时不在响应体中返回图片，而是保存后返回访问地址：
+//
+//	{"status": "ok", "data": {"url": "http://host/images/<id>.png", "expires_at": "..."}}
+//
+// 多数聊天平台接收图片地址比接收原始字节方便得多。本地存储的文件按 storage.ttl 过期清理，
+// 访问地址免认证，默认文件名随机生成，对象名与元数据的模板见 objectkey.go。
+// storage.backend 为 s3 时上传到对象存储，见 s3store.go。
+
+// 响应方式
+const (
+	ResponseBody = "body"
+	ResponseURL  = "url"
+)
+
+// StoredObject 保存后的渲染结果
+type StoredObject struct {
+	URL       string            `json:"url"`
+	Key       string            `json:"key"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at,omitzero"`
+	Alt       string            `json:"alt,omitempty"` // 替代文本，见 alttext.go
+}
+
+// ImageStore 渲染结果存储后端
+type ImageStore interface {
+	Put(ctx context.Context, key, contentType string, body []byte, metadata map[string]string) (*StoredObject, error)
+}
+
+var globalImageStore ImageStore
+
+// contentTypeExt 存储对象的扩展名
+var contentTypeExt = map[string]string{
+	"image/png":                 ".png",
+	"image/jpeg":                ".jpg",
+	"image/webp":                ".webp",
+	"image/gif":                 ".gif",
+	"image/apng":                ".png",
+	"application/pdf":           ".pdf",
+	"application/zip":           ".zip",
+	"text/html; charset=utf-8":  ".html",
+	"application/json":          ".json",
+	"text/plain; charset=utf-8": ".txt",
+}
+
+type baseURLKey struct{}
+
+// withBaseURL 记录请求的对外地址，未配置 base_url 时用于拼接访问地址
+func withBaseURL(ctx context.Context, baseURL string) context.Context {
+	return context.WithValue(ctx, baseURLKey{}, baseURL)
+}
+
+// requestBaseURL 由请求推断对外地址，优先使用反向代理设置的 X-Forwarded-Proto/Host
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	host := c.Request.Host
+	if fwd := c.GetHeader("X-Forwarded-Host"); fwd != "" {
+		host = fwd
+	}
+	return scheme + "://" + host
+}
+
+// LocalStore 保存在本地目录，由 SnapCast 自身提供访问
+type LocalStore struct {
+	dir       string
+	endpoint  string
+	baseURL   string
+	ttl       time.Duration
+	immutable bool // 对象名不会被覆盖，响应可标记为 immutable
+}
+
+// InitStorage 按配置初始化存储后端，返回本地存储（需要注册访问路由）或 nil
+func InitStorage() *LocalStore {
+	if !viper.GetBool("storage.enabled") {
+		return nil
+	}
+	ttl, _ := ParseDuration(viper.Get("storage.ttl"))
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	if err := resolveStorageMeta(nil).validate(); err != nil {
+		logger.Fatal("❌ 存储对象名配置无效", zap.Error(err))
+	}
+
+	switch backend := viper.GetString("storage.backend"); backend {
+	case "", "local":
+	case "s3":
+		s3, err := newS3Store(ttl)
+		if err != nil {
+			logger.Fatal("❌ 对象存储配置无效", zap.Error(err))
+		}
+		globalImageStore = s3
+		logger.Info("🗄️ 渲染结果存储已启用（S3）", zap.String("endpoint", s3.endpoint.String()), zap.String("bucket", s3.bucket), zap.Bool("public", s3.publicURL != ""))
+		return nil
+	default:
+		logger.Fatal("❌ storage.backend 无效，可选 local、s3", zap.String("backend", backend))
+	}
+
+	s := &LocalStore{
+		dir:       viper.GetString("storage.local.dir"),
+		endpoint:  strings.TrimRight(viper.GetString("storage.local.endpoint"), "/"),
+		baseURL:   strings.TrimRight(viper.GetString("storage.local.base_url"), "/"),
+		ttl:       ttl,
+		immutable: !viper.IsSet("storage.local.immutable") || viper.GetBool("storage.local.immutable"),
+	}
+	if s.dir == "" {
+		s.dir = "./images"
+	}
+	if s.endpoint == "" {
+		s.endpoint = "/images"
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		logger.Fatal("❌ 存储目录创建失败", zap.String("dir", s.dir), zap.Error(err))
+	}
+	globalImageStore = s
+	go s.gcLoop()
+	logger.Info("🗄️ 渲染结果存储已启用", zap.String("dir", s.dir), zap.String("endpoint", s.endpoint), zap.Duration("ttl", ttl))
+	return s
+}
+
+// Put 写入文件并返回访问地址，过期时间按文件修改时间计算；元数据写入同名 .meta.json
+func (s *LocalStore) Put(ctx context.Context, key, _ string, body []byte, metadata map[string]string) (*StoredObject, error) {
+	file := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(file, body, 0644); err != nil {
+		return nil, err
+	}
+	if len(metadata) > 0 {
+		b, _ := json.Marshal(metadata)
+		if err := os.WriteFile(file+".meta.json", b, 0644); err != nil {
+			return nil, err
+		}
+	}
+	baseURL := s.baseURL
+	if baseURL == "" {
+		baseURL, _ = ctx.Value(baseURLKey{}).(string)
+	}
+	return &StoredObject{
+		URL:       baseURL + s.endpoint + "/" + key,
+		Key:       key,
+		Metadata:  metadata,
+		ExpiresAt: time.Now().Add(s.ttl).UTC().Truncate(time.Second),
+	}, nil
+}
+
+// isStoredObjectRequest 判断是否为存储对象的访问请求，此类请求由聊天平台发起，免认证、IP 过滤与限流
+func isStoredObjectRequest(c *gin.Context) bool {
+	s, isLocal := globalImageStore.(*LocalStore)
+	return isLocal && (c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead) &&
+		strings.HasPrefix(c.Request.URL.Path, s.endpoint+"/")
+}
+
+// ServeHTTP 返回未过期的存储对象，支持 Range 与 If-None-Match/If-Modified-Since 条件请求，
+// 缓存有效期为剩余保存时长，便于 CDN 与聊天平台缓存
+func (s *LocalStore) ServeHTTP(c *gin.Context) {
+	key := strings.TrimPrefix(path.Clean(c.Param("key")), "/")
+	if key == "" || key == "." || strings.HasPrefix(key, "..") || strings.HasSuffix(key, ".meta.json") {
+		c.JSON(http.StatusNotFound, errResp("image not found"))
+		return
+	}
+	f, err := os.Open(filepath.Join(s.dir, filepath.FromSlash(key)))
+	if err != nil {
+		c.JSON(http.StatusNotFound, errResp("image not found"))
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() || time.Since(info.ModTime()) >= s.ttl {
+		c.JSON(http.StatusNotFound, errResp("image not found"))
+		return
+	}
+
+	expires := info.ModTime().Add(s.ttl)
+	cacheControl := "public, max-age=" + strconv.Itoa(int(time.Until(expires).Seconds()))
+	if s.immutable {
+		cacheControl += ", immutable"
+	}
+	h := c.Writer.Header()
+	h.Set("Cache-Control", cacheControl)
+	h.Set("Expires", expires.UTC().Format(http.TimeFormat))
+	h.Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), f)
+}
+
+// gcLoop 定期删除过期文件（含元数据）
+func (s *LocalStore) gcLoop() {
+	interval := s.ttl / 4
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	for range ticker.C {
+		removed := 0
+		_ = filepath.WalkDir(s.dir, func(p string, d os.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if info, err := d.Info(); err == nil && time.Since(info.ModTime()) >= s.ttl {
+				if os.Remove(p) == nil {
+					removed++
+				}
+			}
+			return nil
+		})
+		if removed > 0 {
+			logger.Debug("🗑️ 已清理过期的渲染结果", zap.Int("files", removed))
+		}
+	}
+}
+
+// storeRenderResult 按全局与模板的存储设置生成对象名与元数据，保存渲染结果并返回访问地址
+func storeRenderResult(c *gin.Context, payload *PushPayload, result *RenderResult) (*StoredObject, error) {
+	return storeResult(withBaseURL(c.Request.Context(), requestBaseURL(c)), payload, result)
+}
+
+// storeResult 保存渲染结果，未配置 storage.local.base_url 时访问地址取 ctx 中的请求地址
+func storeResult(ctx context.Context, payload *PushPayload, result *RenderResult) (*StoredObject, error) {
+	if globalImageStore == nil {
+		return nil, errors.New("storage not enabled")
+	}
+	meta, err := loadTemplateMeta(result.Template)
+	if err != nil {
+		return nil, err
+	}
+	settings := resolveStorageMeta(meta)
+	namer := newObjectNamer(payload, result.ContentType, result.Body)
+	key, err := namer.Key(settings.Key)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := namer.Metadata(settings.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	return globalImageStore.Put(ctx, key, result.ContentType, result.Body, metadata)
+}
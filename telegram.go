@@ -0,0 +1,325 @@
+//go:build !nodelivery
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+
+	"SnapCast/extension"
+)
+
+// ====== Telegram 投递 ======
+//
+// 内置的 telegram Sink 通过 Bot API 把渲染结果发到 Telegram 聊天。只需配置 token：
+//
+//	delivery:
+//	  telegram:
+//	    token: "123456:ABC-DEF"   # 配置后自动创建名为 telegram 的 Sink
+//
+// 需要多个机器人或自定义参数时按 Sink 声明实例，未设置 token 时使用 delivery.telegram.token：
+//
+//	sinks:
+//	  tg_news:
+//	    type: telegram
+//	    token: "123456:ABC-DEF"
+//	    api_url: "https://api.telegram.org"   # 自建 Bot API 服务器时修改
+//	    caption: true                         # 将卡片的替代文本作为图片说明，默认 true
+//
+// 请求中指定聊天：
+//
+//	"deliver": [{"sink": "telegram", "params": {"chat_id": -1001234567890}}]
+//	"deliver": [{"sink": "telegram", "params": {"chat_id": "@channel", "caption": "开播啦", "message_thread_id": 5, "silent": true}}]
+//
+// 图片按 Bot API 的限制自动转换：sendPhoto 要求不超过 10MB、宽高之和不超过 10000、宽高比不超过 20，
+// 超出时先缩小并转为 JPEG，仍不满足（如超长卡片）则以 sendDocument 发送原图（上限 50MB）。
+// 多帧结果以 sendMediaGroup 按每组 10 张发送。遇到 429 时按 retry_after 等待后重试一次（最多 10 秒）。
+
+const (
+	telegramPhotoMaxBytes    = 10 << 20
+	telegramPhotoMaxSides    = 10000 // 宽高之和
+	telegramPhotoMaxRatio    = 20
+	telegramDocumentMaxBytes = 50 << 20
+	telegramCaptionMaxRunes  = 1024
+	telegramMediaGroupMax    = 10
+	telegramMaxRetryAfter    = 10 * time.Second
+	telegramJPEGQuality      = 90
+)
+
+func init() {
+	extension.RegisterSink("telegram", newTelegramSink)
+}
+
+// telegramConfig sinks.<name> 中 telegram 的配置
+type telegramConfig struct {
+	Token   string `mapstructure:"token"`
+	APIURL  string `mapstructure:"api_url"`
+	Caption *bool  `mapstructure:"caption"`
+	Timeout any    `mapstructure:"timeout"`
+}
+
+type telegramSink struct {
+	cfg    telegramConfig
+	client *http.Client
+	log    *zap.Logger
+}
+
+func newTelegramSink(opts extension.SinkOptions) (extension.Sink, error) {
+	var cfg telegramConfig
+	if err := viper.UnmarshalKey("sinks."+opts.Name, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Token == "" {
+		cfg.Token = viper.GetString("delivery.telegram.token")
+	}
+	if cfg.Token == "" {
+		return nil, errors.New("token is required (or set delivery.telegram.token)")
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = "https://api.telegram.org"
+	}
+	cfg.APIURL = strings.TrimSuffix(cfg.APIURL, "/")
+	timeout := 60 * time.Second
+	if cfg.Timeout != nil {
+		d, err := ParseDuration(cfg.Timeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid timeout %v", cfg.Timeout)
+		}
+		timeout = d
+	}
+	return &telegramSink{cfg: cfg, client: &http.Client{Timeout: timeout}, log: opts.Logger}, nil
+}
+
+func (s *telegramSink) Close() error { return nil }
+
+func (s *telegramSink) Deliver(ctx context.Context, d *extension.Delivery) (*extension.Receipt, error) {
+	chatID := paramString(d.Params, "chat_id")
+	if chatID == "" {
+		return nil, errors.New("params.chat_id is required")
+	}
+	images, err := deliveryImages(d)
+	if err != nil {
+		return nil, err
+	}
+	caption := paramString(d.Params, "caption")
+	if caption == "" && (s.cfg.Caption == nil || *s.cfg.Caption) {
+		caption = d.AltText
+	}
+	if utf8.RuneCountInString(caption) > telegramCaptionMaxRunes {
+		caption = string([]rune(caption)[:telegramCaptionMaxRunes-1]) + "…"
+	}
+	fields := map[string]string{"chat_id": chatID}
+	if thread := paramString(d.Params, "message_thread_id"); thread != "" {
+		fields["message_thread_id"] = thread
+	}
+	if silent, _ := d.Params["silent"].(bool); silent {
+		fields["disable_notification"] = "true"
+	}
+
+	if len(images) == 1 {
+		photo, asDocument, err := telegramPhoto(images[0])
+		if err != nil {
+			return nil, err
+		}
+		fields["caption"] = caption
+		method, field := "sendPhoto", "photo"
+		if asDocument {
+			method, field = "sendDocument", "document"
+			s.log.Debug("❕ 图片超出 Telegram 照片限制，以文件发送", zap.Int("size", len(photo.Body)))
+		}
+		var msg struct {
+			MessageID int64 `json:"message_id"`
+		}
+		if err := s.call(ctx, method, fields, []telegramFile{{field: field, frame: photo}}, &msg); err != nil {
+			return nil, err
+		}
+		return &extension.Receipt{MessageID: strconv.FormatInt(msg.MessageID, 10)}, nil
+	}
+
+	// 多帧：每组最多 10 张，图片说明放在第一组的第一张
+	var ids []string
+	for start := 0; start < len(images); start += telegramMediaGroupMax {
+		end := min(start+telegramMediaGroupMax, len(images))
+		var media []map[string]string
+		var files []telegramFile
+		for i, img := range images[start:end] {
+			photo, asDocument, err := telegramPhoto(img)
+			if err != nil {
+				return nil, fmt.Errorf("frame %d: %w", start+i+1, err)
+			}
+			if asDocument {
+				return nil, fmt.Errorf("frame %d exceeds Telegram photo limits", start+i+1)
+			}
+			name := "f" + strconv.Itoa(i)
+			item := map[string]string{"type": "photo", "media": "attach://" + name}
+			if start == 0 && i == 0 && caption != "" {
+				item["caption"] = caption
+			}
+			media = append(media, item)
+			files = append(files, telegramFile{field: name, frame: photo})
+		}
+		if len(media) == 1 {
+			// sendMediaGroup 至少需要 2 项，剩余单张时单独发送
+			fields["caption"] = media[0]["caption"]
+			var msg struct {
+				MessageID int64 `json:"message_id"`
+			}
+			files[0].field = "photo"
+			if err := s.call(ctx, "sendPhoto", fields, files, &msg); err != nil {
+				return nil, err
+			}
+			ids = append(ids, strconv.FormatInt(msg.MessageID, 10))
+			continue
+		}
+		b, _ := json.Marshal(media)
+		groupFields := map[string]string{"media": string(b)}
+		for k, v := range fields {
+			if k != "caption" {
+				groupFields[k] = v
+			}
+		}
+		var msgs []struct {
+			MessageID int64 `json:"message_id"`
+		}
+		if err := s.call(ctx, "sendMediaGroup", groupFields, files, &msgs); err != nil {
+			return nil, err
+		}
+		for _, m := range msgs {
+			ids = append(ids, strconv.FormatInt(m.MessageID, 10))
+		}
+	}
+	receipt := &extension.Receipt{Extra: map[string]any{"message_ids": ids}}
+	if len(ids) > 0 {
+		receipt.MessageID = ids[0]
+	}
+	return receipt, nil
+}
+
+// telegramFile multipart 中上传的文件
+type telegramFile struct {
+	field string
+	frame extension.Frame
+}
+
+// call 以 multipart/form-data 调用 Bot API，429 时按 retry_after 等待后重试一次
+func (s *telegramSink) call(ctx context.Context, method string, fields map[string]string, files []telegramFile, out any) error {
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := s.post(ctx, method, fields, files, out)
+		if retryAfter <= 0 || retryAfter > telegramMaxRetryAfter || attempt > 0 {
+			return err
+		}
+		s.log.Warn("⏳ Telegram 限流，等待后重试", zap.String("method", method), zap.Duration("retry_after", retryAfter))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryAfter):
+		}
+	}
+}
+
+func (s *telegramSink) post(ctx context.Context, method string, fields map[string]string, files []telegramFile, out any) (time.Duration, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for k, v := range fields {
+		if v != "" {
+			w.WriteField(k, v)
+		}
+	}
+	for _, f := range files {
+		part, err := w.CreateFormFile(f.field, "snapcast"+contentTypeExt[f.frame.ContentType])
+		if err != nil {
+			return 0, err
+		}
+		part.Write(f.frame.Body)
+	}
+	if err := w.Close(); err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.APIURL+"/bot"+s.cfg.Token+"/"+method, &body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		// 错误信息中的地址带有 token，不原样返回
+		return 0, fmt.Errorf("telegram %s: %w", method, errors.Unwrap(err))
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	var res struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+		Parameters  struct {
+			RetryAfter int `json:"retry_after"`
+		} `json:"parameters"`
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return 0, fmt.Errorf("telegram %s returned %s", method, resp.Status)
+	}
+	if !res.OK {
+		return time.Duration(res.Parameters.RetryAfter) * time.Second, fmt.Errorf("telegram %s failed: %s", method, res.Description)
+	}
+	if out != nil {
+		return 0, json.Unmarshal(res.Result, out)
+	}
+	return 0, nil
+}
+
+// telegramPhoto 将图片转换为符合 sendPhoto 限制的格式；无法满足时返回原图并要求以文件发送
+func telegramPhoto(f extension.Frame) (extension.Frame, bool, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(f.Body))
+	if err != nil {
+		// 无法识别的格式（如 webp）按文件发送
+		return f, true, checkTelegramDocument(f)
+	}
+	w, h := cfg.Width, cfg.Height
+	ratio := float64(max(w, h)) / float64(max(min(w, h), 1))
+	if ratio > telegramPhotoMaxRatio {
+		return f, true, checkTelegramDocument(f)
+	}
+	if len(f.Body) <= telegramPhotoMaxBytes && w+h <= telegramPhotoMaxSides {
+		return f, false, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(f.Body))
+	if err != nil {
+		return f, true, checkTelegramDocument(f)
+	}
+	if w+h > telegramPhotoMaxSides {
+		scale := float64(telegramPhotoMaxSides) / float64(w+h)
+		w, h = max(int(float64(w)*scale), 1), max(int(float64(h)*scale), 1)
+		img = resizeArea(img, w, h)
+	}
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, img, &jpeg.Options{Quality: telegramJPEGQuality}); err != nil {
+		return f, false, err
+	}
+	if out.Len() > telegramPhotoMaxBytes {
+		return f, true, checkTelegramDocument(f)
+	}
+	return extension.Frame{ContentType: "image/jpeg", Body: out.Bytes()}, false, nil
+}
+
+func checkTelegramDocument(f extension.Frame) error {
+	if len(f.Body) > telegramDocumentMaxBytes {
+		return fmt.Errorf("image is %s, exceeds Telegram's %s limit", formatBytes(len(f.Body)), formatBytes(telegramDocumentMaxBytes))
+	}
+	return nil
+}
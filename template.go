@@ -6,13 +6,17 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"reflect"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
@@ -58,14 +62,37 @@ func debugPayload(p PushPayload) {
 
 var templateKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
 
+// defaultTemplateName 兜底模板的站点名与类型名
+const defaultTemplateName = "default"
+
 func selectTemplate(p PushPayload) string {
-	if !templateKeyRegex.MatchString(p.Site) || !templateKeyRegex.MatchString(p.Type) {
-		logger.Error("❌ 无效的站点或类型", zap.String("site", p.Site), zap.String("type", p.Type))
+	if !templateKeyRegex.MatchString(p.Site) || !templateKeyRegex.MatchString(p.Type) || (p.Theme != "" && !templateKeyRegex.MatchString(p.Theme)) {
+		logger.Error("❌ 无效的站点、类型或主题", zap.String("site", p.Site), zap.String("type", p.Type), zap.String("theme", p.Theme))
 		return ""
 	}
 	templateMutex.RLock()
 	defer templateMutex.RUnlock()
 	key := p.Site + "/" + p.Type
+	if path := lookupTemplate(key, p.Theme); path != "" || !viper.GetBool("template.fallback") {
+		return path
+	}
+	// 兜底：<site>/default.html，其次 default/default.html
+	for _, fallback := range []string{p.Site + "/" + defaultTemplateName, defaultTemplateName + "/" + defaultTemplateName} {
+		if path := lookupTemplate(fallback, p.Theme); path != "" {
+			logger.Debug("🪂 使用兜底模板", zap.String("key", key), zap.String("fallback", fallback))
+			return path
+		}
+	}
+	return ""
+}
+
+// lookupTemplate 优先返回主题变体，不存在时返回基础模板，调用方需持有读锁
+func lookupTemplate(key, theme string) string {
+	if theme != "" {
+		if path, ok := templateMap[key+"."+theme]; ok {
+			return path
+		}
+	}
 	return templateMap[key]
 }
 
@@ -79,74 +106,210 @@ func safeExecuteTemplate(tmpl *template.Template, data any, buf *bytes.Buffer) (
 	return
 }
 
+// templateReloadDebounce 合并短时间内的多个文件事件（编辑器保存、批量复制）为一次重新扫描
+const templateReloadDebounce = 200 * time.Millisecond
+
+// templateWatcher 模板目录的监听器，未开启 template.watch 时为 nil
+var templateWatcher *fsnotify.Watcher
+
+// watchTemplateDir 递归监听模板目录，任意变更都会触发一次去抖后的完整重新扫描
 func watchTemplateDir(dir string) {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		logger.Fatal("❌ 监听器启动失败", zap.Error(err))
 	}
+	templateWatcher = watcher
+	addWatchRecursive(watcher, dir)
+
 	go func() {
+		var (
+			timer   *time.Timer
+			mu      sync.Mutex
+			pending []string // 去抖期间变更的文件，用于通知受影响的模板，见 livereload.go
+		)
 		for {
 			select {
-			case event := <-watcher.Events:
-				if event.Op&(fsnotify.Create|fsnotify.Write) != 0 {
-					if strings.HasSuffix(event.Name, ".html") {
-						name := filepath.Base(event.Name)
-						parts := strings.Split(strings.TrimSuffix(name, ".html"), "_")
-						if len(parts) == 2 {
-							key := parts[0] + "/" + parts[1]
-							templateMutex.Lock()
-							templateMap[key] = event.Name
-							templateMutex.Unlock()
-							logger.Info("🆕 模板更新", zap.String("key", key), zap.String("path", event.Name))
-						}
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				// 新建的子目录需要加入监听
+				if event.Op&fsnotify.Create != 0 {
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+						addWatchRecursive(watcher, event.Name)
 					}
 				}
-				if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
-					if strings.HasSuffix(event.Name, ".html") {
-						name := filepath.Base(event.Name)
-						parts := strings.Split(strings.TrimSuffix(name, ".html"), "_")
-						if len(parts) == 2 {
-							key := parts[0] + "/" + parts[1]
-							templateMutex.Lock()
-							delete(templateMap, key)
-							templateMutex.Unlock()
-							logger.Info("🗑️ 模板移除", zap.String("key", key), zap.String("path", event.Name))
+				mu.Lock()
+				pending = append(pending, event.Name)
+				mu.Unlock()
+				if timer == nil {
+					timer = time.AfterFunc(templateReloadDebounce, func() {
+						mu.Lock()
+						files := pending
+						pending = nil
+						mu.Unlock()
+						if err := reloadTemplates(dir); err != nil {
+							logger.Error("❌ 模板重新扫描失败", zap.Error(err))
+							return
 						}
-					}
+						publishReload(ReloadTemplates, changedTemplateKeys(files))
+					})
+				} else {
+					timer.Reset(templateReloadDebounce)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
 				}
-			case err = <-watcher.Errors:
 				logger.Error("❌ 监听器错误", zap.Error(err))
 			}
 		}
 	}()
-	watcher.Add(dir)
+}
+
+// rewatchTemplateDir 模板目录被整体替换后重新加入监听（见 templatebundle.go）
+func rewatchTemplateDir(dir string) {
+	if templateWatcher != nil {
+		addWatchRecursive(templateWatcher, dir)
+	}
+}
+
+// addWatchRecursive 监听目录及其全部子目录
+func addWatchRecursive(watcher *fsnotify.Watcher, root string) {
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if d.Name() == ".git" {
+			return filepath.SkipDir // 模板仓库的 Git 元数据，见 templategit.go
+		}
+		if err := watcher.Add(path); err != nil {
+			logger.Warn("⚠️ 目录监听失败", zap.String("dir", path), zap.Error(err))
+		}
+		return nil
+	})
+}
+
+// scanTemplates 扫描模板目录，返回 key → 路径。支持两种布局：
+//
+//	<dir>/<site>/<type>.html   按站点分目录，type 可包含下划线（如 live_end）
+//	<dir>/<site>_<type>.html   旧版平铺命名
+//
+// 两种布局的 key 冲突时以分目录布局为准。更深层级的文件不作为模板加载。
+func scanTemplates(dir string) (map[string]string, error) {
+	nested := make(map[string]string)
+	flat := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".html") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return nil
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		name := strings.TrimSuffix(parts[len(parts)-1], ".html")
+		// 主题变体 <type>.<theme>.html，key 为 site/type.theme
+		name, theme, hasTheme := strings.Cut(name, ".")
+		if hasTheme && !templateKeyRegex.MatchString(theme) {
+			return nil
+		}
+		suffix := ""
+		if hasTheme {
+			suffix = "." + theme
+		}
+		switch len(parts) {
+		case 1:
+			if fields := strings.Split(name, "_"); len(fields) == 2 {
+				flat[fields[0]+"/"+fields[1]+suffix] = path // e.g. bilibili/dynamic
+			}
+		case 2:
+			if templateKeyRegex.MatchString(parts[0]) && templateKeyRegex.MatchString(name) {
+				nested[parts[0]+"/"+name+suffix] = path
+			}
+		}
+		return nil
+	})
+	for key, path := range flat {
+		if prev, exists := nested[key]; exists {
+			logger.Warn("❕ 模板 key 重复，使用分目录布局的文件", zap.String("key", key), zap.String("path", prev), zap.String("ignored", path))
+			continue
+		}
+		nested[key] = path
+	}
+	return nested, err
+}
+
+// reloadTemplates 重新扫描模板目录并整体替换模板表，输出新增、更新与移除的模板
+func reloadTemplates(dir string) error {
+	found, err := scanTemplates(dir)
+	if err != nil {
+		return err
+	}
+	if err := loadLocaleBundles(dir); err != nil {
+		logger.Warn("⚠️ 语言包加载失败", zap.Error(err))
+	}
+
+	templateMutex.Lock()
+	old := templateMap
+	templateMap = found
+	templateMutex.Unlock()
+
+	var changed []TemplateCheck
+	for key, path := range found {
+		if prev, exists := old[key]; !exists {
+			logger.Info("🆕 模板新增", zap.String("key", key), zap.String("path", path))
+		} else if prev != path {
+			logger.Info("🔁 模板路径变更", zap.String("key", key), zap.String("path", path))
+		}
+		// 内容变更无法从路径判断，统一重新校验
+		changed = append(changed, validateTemplateFile(key, path))
+	}
+	for key, path := range old {
+		if _, exists := found[key]; !exists {
+			logger.Info("🗑️ 模板移除", zap.String("key", key), zap.String("path", path))
+		}
+	}
+	logTemplateChecks(changed)
+	logger.Debug("🔄 模板已重新扫描", zap.Int("count", len(found)))
+	TriggerTemplateWarmup()
+	return nil
 }
 
 func loadTemplates(dir string) error {
-	files, err := os.ReadDir(dir)
-	if errors.Is(err, os.ErrNotExist) {
-		err = os.Mkdir(dir, os.ModePerm)
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		// 首次运行释放内置示例模板
+		written, err := scaffoldTemplates(dir, false)
 		if err != nil {
 			return err
 		}
+		logger.Info("📁 已生成示例模板", zap.String("dir", dir), zap.Int("files", len(written)))
 	} else if err != nil {
 		return err
 	}
 
+	found, err := scanTemplates(dir)
+	if err != nil {
+		return err
+	}
+	if err := loadLocaleBundles(dir); err != nil {
+		logger.Warn("⚠️ 语言包加载失败", zap.Error(err))
+	}
 	templateMutex.Lock()
-	defer templateMutex.Unlock()
-	for _, f := range files {
-		name := f.Name()
-		if strings.HasSuffix(name, ".html") {
-			parts := strings.Split(strings.TrimSuffix(name, ".html"), "_")
-			if len(parts) == 2 {
-				key := parts[0] + "/" + parts[1] // e.g. bilibili:dynamic
-				templateMap[key] = filepath.Join(dir, name)
-			}
+	templateMap = found
+	templateMutex.Unlock()
+	flat := 0
+	for k, v := range found {
+		logger.Info("✅ 支持的模板", zap.String("key", k), zap.String("path", v))
+		if filepath.Dir(v) == filepath.Clean(dir) {
+			flat++
 		}
 	}
-	for k, v := range templateMap {
-		logger.Info("✅ 支持的模板", zap.String("key", k), zap.String("path", v))
+	if flat > 0 {
+		logger.Info("💡 存在平铺布局的模板，可运行 snapcast templates migrate 迁移为分目录布局", zap.Int("count", flat))
 	}
 	return nil
 }
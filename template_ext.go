@@ -3,8 +3,10 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"html/template"
 	"math"
+	"math/rand/v2"
 	"strconv"
 	"strings"
 	"time"
@@ -20,6 +22,12 @@ var funcsList = template.FuncMap{
 	"toString":       toString,
 	"isPositive":     isPositive,
 	"now":            now,
+	"theme":          func() string { return "" }, // 当前请求的主题，渲染时按请求替换
+	"lang":           func() string { return "" }, // 当前请求的语言，渲染时按请求替换
+	// 远程图片内联为 data URI，渲染时按请求替换，见 embed.go
+	"embedImage": func(rawURL string) template.URL { return template.URL(rawURL) },
+	// 白名单清洗后的富文本，需在模板附属配置中开启 safe_html，见 sanitize.go
+	"safeHTML": safeHTMLFunc(false),
 
 	// ========== JSON ==========
 	"toJson": func(v any) template.JS {
@@ -147,6 +155,8 @@ var funcsList = template.FuncMap{
 		}
 		return a / b
 	},
+	"seededRandom": seededRandom,
+	"t":            translateFunc(""),
 }
 
 func formatTime(ts float64) string {
@@ -162,6 +172,18 @@ func formatDuration(startTs float64) string {
 	return fmt.Sprintf("%d小时%d分%d秒", h, m, s)
 }
 
+// seededRandom 返回 [min, max] 内的整数，相同 seed 始终得到相同结果
+func seededRandom(seed, min, max any) int {
+	lo, hi := toInt(min), toInt(max)
+	if hi < lo {
+		lo, hi = hi, lo
+	}
+	h := fnv.New64a()
+	h.Write([]byte(toString(seed)))
+	r := rand.New(rand.NewPCG(h.Sum64(), 0x5eed))
+	return lo + r.IntN(hi-lo+1)
+}
+
 func toInt(v any) int {
 	switch val := v.(type) {
 	case float64:
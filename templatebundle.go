@@ -0,0 +1,414 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 远程模板包 ======
+//
+// template.remote_url 指向一个 tar.gz 或 zip 模板包（如社区模板合集、CI 打包的发布产物），
+// SnapCast 下载后校验 sha256（template.remote_sha256，可选），解压到模板目录旁的临时目录，
+// 确认包含模板后整体替换模板目录并重新加载。下载或校验失败时保留现有模板。
+//
+// 包内只有一个顶层目录时（GitHub 的源码压缩包即是如此）以该目录为模板根目录。
+// 模板目录中会写入 .snapcast-bundle.json 记录来源与 ETag，再次拉取时未变更的包不会重新下载。
+// 与 template.git 互斥，以下配置修改需重启。
+
+const (
+	bundleMarker       = ".snapcast-bundle.json"
+	bundleTimeout      = 2 * time.Minute
+	maxBundleSize      = 64 << 20  // 下载大小上限
+	maxBundleExtracted = 256 << 20 // 解压后总大小上限
+	maxBundleFiles     = 10000
+)
+
+type templateBundle struct {
+	url    string
+	sha256 string // 小写十六进制，为空则不校验
+	dir    string
+	client *http.Client
+}
+
+// bundleState 记录在模板目录中的来源信息
+type bundleState struct {
+	URL          string    `json:"url"`
+	SHA256       string    `json:"sha256"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+var bundleFetches = NewCounterVec("snapcast_template_bundle_fetches_total", "Template bundle fetches, by result (updated, unchanged, failed).", "result")
+
+// InitTemplateBundle 按 template.remote_url 首次拉取模板包，需在加载模板之前调用
+func InitTemplateBundle() {
+	rawURL := viper.GetString("template.remote_url")
+	if rawURL == "" {
+		return
+	}
+	if viper.GetString("template.git.url") != "" {
+		logger.Error("❌ template.remote_url 与 template.git.url 不能同时使用，已忽略远程模板包")
+		return
+	}
+	b := &templateBundle{
+		url:    rawURL,
+		sha256: strings.ToLower(strings.TrimPrefix(strings.TrimSpace(viper.GetString("template.remote_sha256")), "sha256:")),
+		dir:    viper.GetString("template.dir"),
+		client: &http.Client{Timeout: bundleTimeout},
+	}
+	if _, err := b.fetch(); err != nil {
+		logger.Error("❌ 远程模板包拉取失败，使用模板目录中现有的文件", zap.String("url", b.url), zap.Error(err))
+	}
+
+	interval, err := ParseDuration(viper.Get("template.remote_interval"))
+	if err != nil {
+		logger.Warn("❗ template.remote_interval 值无效，不定期拉取", zap.Any("interval", viper.Get("template.remote_interval")))
+		interval = 0
+	}
+	if interval > 0 {
+		go b.loop(interval)
+	}
+	logger.Info("📦 远程模板包已启用", zap.String("url", b.url), zap.Bool("sha256", b.sha256 != ""), zap.Duration("interval", interval))
+}
+
+// loop 定期检查模板包是否更新
+func (b *templateBundle) loop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		updated, err := b.fetch()
+		if err != nil {
+			logger.Error("❌ 远程模板包拉取失败", zap.String("url", b.url), zap.Error(err))
+			continue
+		}
+		if !updated {
+			continue
+		}
+		// 模板目录已整体替换，原有的文件监听失效，重新加入
+		rewatchTemplateDir(b.dir)
+		if err := reloadTemplates(b.dir); err != nil {
+			logger.Error("❌ 模板重新扫描失败", zap.Error(err))
+			continue
+		}
+		publishReload(ReloadTemplates, nil)
+	}
+}
+
+// fetch 下载并安装模板包，返回模板目录是否被替换
+func (b *templateBundle) fetch() (updated bool, err error) {
+	defer func() {
+		switch {
+		case err != nil:
+			bundleFetches.Inc("failed")
+		case updated:
+			bundleFetches.Inc("updated")
+		default:
+			bundleFetches.Inc("unchanged")
+		}
+	}()
+
+	prev := b.installed()
+	ctx, cancel := context.WithTimeout(context.Background(), bundleTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.url, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("User-Agent", "SnapCast")
+	if prev != nil {
+		if prev.ETag != "" {
+			req.Header.Set("If-None-Match", prev.ETag)
+		}
+		if prev.LastModified != "" {
+			req.Header.Set("If-Modified-Since", prev.LastModified)
+		}
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && prev != nil {
+		logger.Debug("📦 远程模板包无更新", zap.String("url", b.url))
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("download %s: unexpected status %s", b.url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBundleSize+1))
+	if err != nil {
+		return false, fmt.Errorf("download %s: %w", b.url, err)
+	}
+	if len(data) > maxBundleSize {
+		return false, fmt.Errorf("bundle exceeds %d bytes", maxBundleSize)
+	}
+
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	if b.sha256 != "" && digest != b.sha256 {
+		return false, fmt.Errorf("sha256 mismatch: expected %s, got %s", b.sha256, digest)
+	}
+	state := bundleState{
+		URL:          b.url,
+		SHA256:       digest,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now(),
+	}
+	if prev != nil && prev.SHA256 == digest {
+		// 服务器不支持条件请求时内容可能未变，只更新记录
+		b.writeState(b.dir, state)
+		logger.Debug("📦 远程模板包无更新", zap.String("url", b.url), zap.String("sha256", digest[:12]))
+		return false, nil
+	}
+	if err := b.install(data, state); err != nil {
+		return false, err
+	}
+	logger.Info("📦 远程模板包已更新", zap.String("url", b.url), zap.String("sha256", digest[:12]), zap.Int("bytes", len(data)))
+	return true, nil
+}
+
+// installed 读取模板目录中的来源记录，来源不同或与配置的 sha256 不符时视为未安装
+func (b *templateBundle) installed() *bundleState {
+	s, err := readBundleState(b.dir)
+	if err != nil || s.URL != b.url || (b.sha256 != "" && s.SHA256 != b.sha256) {
+		return nil
+	}
+	return s
+}
+
+func readBundleState(dir string) (*bundleState, error) {
+	data, err := os.ReadFile(filepath.Join(dir, bundleMarker))
+	if err != nil {
+		return nil, err
+	}
+	var s bundleState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (b *templateBundle) writeState(dir string, s bundleState) {
+	data, _ := json.MarshalIndent(s, "", "  ")
+	if err := os.WriteFile(filepath.Join(dir, bundleMarker), data, 0644); err != nil {
+		logger.Warn("⚠️ 模板包记录写入失败", zap.Error(err))
+	}
+}
+
+// install 解压到模板目录旁的临时目录，确认包含模板后替换模板目录
+func (b *templateBundle) install(data []byte, state bundleState) error {
+	dir := filepath.Clean(b.dir)
+	parent, base := filepath.Dir(dir), filepath.Base(dir)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return err
+	}
+	staging, err := os.MkdirTemp(parent, "."+base+".bundle-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging) // 替换成功后已不存在
+
+	if err := extractBundle(data, staging); err != nil {
+		return fmt.Errorf("extract bundle: %w", err)
+	}
+	found, err := scanTemplates(staging)
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		return errors.New("bundle contains no templates")
+	}
+	b.writeState(staging, state)
+
+	// 两次重命名之间模板目录短暂不存在，期间读取模板文件的渲染会失败，窗口只有几毫秒
+	old := ""
+	if entries, err := os.ReadDir(dir); err == nil {
+		// 不是由模板包安装的目录（手动维护的模板）不覆盖
+		if _, err := readBundleState(dir); err != nil && len(entries) > 0 {
+			return fmt.Errorf("template dir %s is not empty and was not installed from a bundle", dir)
+		}
+		old = filepath.Join(parent, fmt.Sprintf(".%s.old-%d", base, time.Now().UnixNano()))
+		if err := os.Rename(dir, old); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(staging, dir); err != nil {
+		if old != "" {
+			_ = os.Rename(old, dir)
+		}
+		return err
+	}
+	if old != "" {
+		if err := os.RemoveAll(old); err != nil {
+			logger.Warn("⚠️ 旧模板目录删除失败", zap.String("dir", old), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// extractBundle 按文件头识别 zip 或 tar.gz 并解压到 dst
+func extractBundle(data []byte, dst string) error {
+	var files []bundleFile
+	var err error
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		files, err = readZipBundle(data)
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		files, err = readTarGzBundle(data)
+	default:
+		return errors.New("unsupported bundle format, expected .tar.gz or .zip")
+	}
+	if err != nil {
+		return err
+	}
+	prefix := commonBundleRoot(files)
+	for _, f := range files {
+		rel := strings.TrimPrefix(f.name, prefix)
+		if rel == "" {
+			continue
+		}
+		target := filepath.Join(dst, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, f.data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bundleFile 包内的一个普通文件，name 为清理后的相对路径
+type bundleFile struct {
+	name string
+	data []byte
+}
+
+// bundleName 清理包内路径，拒绝绝对路径与 ..（zip slip）
+func bundleName(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	clean := path.Clean(strings.TrimPrefix(name, "./"))
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("illegal path %q in bundle", name)
+	}
+	return clean, nil
+}
+
+// bundleBudget 统计解压的文件数与大小
+type bundleBudget struct {
+	files int
+	bytes int64
+}
+
+func (b *bundleBudget) read(name string, r io.Reader) ([]byte, error) {
+	b.files++
+	if b.files > maxBundleFiles {
+		return nil, fmt.Errorf("bundle has more than %d files", maxBundleFiles)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, maxBundleExtracted-b.bytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	b.bytes += int64(len(data))
+	if b.bytes > maxBundleExtracted {
+		return nil, fmt.Errorf("bundle exceeds %d bytes when extracted", maxBundleExtracted)
+	}
+	return data, nil
+}
+
+func readZipBundle(data []byte) ([]bundleFile, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	var files []bundleFile
+	var budget bundleBudget
+	for _, zf := range zr.File {
+		if !zf.Mode().IsRegular() {
+			continue // 目录与符号链接
+		}
+		name, err := bundleName(zf.Name)
+		if err != nil {
+			return nil, err
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, err
+		}
+		content, err := budget.read(name, rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, bundleFile{name: name, data: content})
+	}
+	return files, nil
+}
+
+func readTarGzBundle(data []byte) ([]bundleFile, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	var files []bundleFile
+	var budget bundleBudget
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue // 目录、链接与 pax 头
+		}
+		name, err := bundleName(hdr.Name)
+		if err != nil {
+			return nil, err
+		}
+		content, err := budget.read(name, tr)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, bundleFile{name: name, data: content})
+	}
+}
+
+// commonBundleRoot 所有文件位于同一个顶层目录时返回 "<目录>/"，否则为空
+func commonBundleRoot(files []bundleFile) string {
+	root := ""
+	for _, f := range files {
+		top, _, nested := strings.Cut(f.name, "/")
+		if !nested || (root != "" && top != root) {
+			return ""
+		}
+		root = top
+	}
+	if root == "" {
+		return ""
+	}
+	return root + "/"
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ====== 模板校验 ======
+
+// TemplateCheck 单个模板的校验结果
+type TemplateCheck struct {
+	Key    string `json:"key,omitempty"` // site/type
+	Path   string `json:"path,omitempty"`
+	Valid  bool   `json:"valid"`
+	Line   int    `json:"line,omitempty"`   // 出错行号
+	Column int    `json:"column,omitempty"` // 出错列号，部分错误不提供
+	Error  string `json:"error,omitempty"`
+}
+
+// 解析错误格式：template: name:line: msg 或 template: name:line:col: msg
+var templateErrorRegex = regexp.MustCompile(`^template: [^:]*:(\d+):(?:(\d+):)?\s*(.*)$`)
+
+// checkTemplateError 将解析错误拆分为行号、列号与错误信息
+func checkTemplateError(check *TemplateCheck, err error) {
+	check.Valid = false
+	check.Error = err.Error()
+	if m := templateErrorRegex.FindStringSubmatch(err.Error()); m != nil {
+		check.Line, _ = strconv.Atoi(m[1])
+		check.Column, _ = strconv.Atoi(m[2])
+		check.Error = m[3]
+	}
+}
+
+// validateTemplateFile 使用当前模板函数表解析模板文件
+func validateTemplateFile(key, path string) TemplateCheck {
+	check := TemplateCheck{Key: key, Path: path, Valid: true}
+	if _, err := template.New(filepath.Base(path)).Funcs(funcsList).ParseFiles(path); err != nil {
+		checkTemplateError(&check, err)
+	} else if _, err := loadTemplateMeta(path); err != nil {
+		check.Valid = false
+		check.Error = err.Error()
+	} else if err := checkSampleSchema(path); err != nil {
+		check.Valid = false
+		check.Error = err.Error()
+	}
+	return check
+}
+
+// checkSampleSchema 校验数据映射与 schema 文件本身，并要求示例数据（经适配器与映射转换后）符合 schema，
+// 避免预览与预热时才发现不一致
+func checkSampleSchema(path string) error {
+	transform, err := loadTemplateTransform(path)
+	if err != nil {
+		return err
+	}
+	schema, err := loadTemplateSchema(path)
+	if err != nil || schema == nil {
+		return err
+	}
+	sample, err := loadSampleData(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if meta, err := loadTemplateMeta(path); err == nil && meta.Adapter != "" {
+		if sample, err = adaptData(meta.Adapter, sample); err != nil {
+			return fmt.Errorf("sample data: %w", err)
+		}
+	}
+	if transform != nil {
+		if sample, err = transform.Apply(sample); err != nil {
+			return fmt.Errorf("sample data: %w", err)
+		}
+	}
+	if serr := schema.Validate(sample); serr != nil {
+		return fmt.Errorf("sample data: %w", serr)
+	}
+	return nil
+}
+
+// validateTemplateSource 解析未保存的模板源码，供部署前检查
+func validateTemplateSource(source string) TemplateCheck {
+	check := TemplateCheck{Valid: true}
+	if _, err := template.New("source").Funcs(funcsList).Parse(source); err != nil {
+		checkTemplateError(&check, err)
+	}
+	return check
+}
+
+// validateTemplates 校验已加载的全部模板，按 key 排序
+func validateTemplates() []TemplateCheck {
+	templateMutex.RLock()
+	paths := make(map[string]string, len(templateMap))
+	for k, v := range templateMap {
+		paths[k] = v
+	}
+	templateMutex.RUnlock()
+
+	checks := make([]TemplateCheck, 0, len(paths))
+	for key, path := range paths {
+		checks = append(checks, validateTemplateFile(key, path))
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Key < checks[j].Key })
+	return checks
+}
+
+// logTemplateChecks 输出校验失败的模板，返回失败数量
+func logTemplateChecks(checks []TemplateCheck) int {
+	failed := 0
+	for _, c := range checks {
+		if c.Valid {
+			continue
+		}
+		failed++
+		logger.Error("❌ 模板语法错误", zap.String("key", c.Key), zap.String("path", c.Path), zap.Int("line", c.Line), zap.String("error", c.Error))
+	}
+	return failed
+}
+
+type validateRequest struct {
+	Site    string `json:"site"`
+	Type    string `json:"type"`
+	Content string `json:"content"` // 直接校验模板源码
+}
+
+// TemplateValidateHandler 校验模板语法。
+// 请求体为空时校验全部模板；指定 site/type 时校验单个模板；指定 content 时校验提交的源码。
+func TemplateValidateHandler(c *gin.Context) {
+	var req validateRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, errResp(err.Error()))
+			return
+		}
+	}
+
+	var checks []TemplateCheck
+	switch {
+	case req.Content != "":
+		checks = []TemplateCheck{validateTemplateSource(req.Content)}
+	case req.Site != "" || req.Type != "":
+		payload := PushPayload{Site: req.Site, Type: req.Type}
+		path := selectTemplate(payload)
+		if path == "" {
+			c.JSON(http.StatusNotFound, errResp("no template found"))
+			return
+		}
+		checks = []TemplateCheck{validateTemplateFile(req.Site+"/"+req.Type, path)}
+	default:
+		checks = validateTemplates()
+	}
+
+	valid := true
+	for _, check := range checks {
+		valid = valid && check.Valid
+	}
+	c.JSON(http.StatusOK, ok(gin.H{"valid": valid, "templates": checks}))
+}
+
+// ====== 模板列表 ======
+
+// TemplateInfo 可用模板，主题变体合并到基础模板
+type TemplateInfo struct {
+	Key    string   `json:"key"` // site/type
+	Site   string   `json:"site"`
+	Type   string   `json:"type"`
+	Themes []string `json:"themes,omitempty"` // 存在 <type>.<theme>.html 变体的主题
+}
+
+// listTemplates 返回调用方可使用的模板，按 key 排序
+func listTemplates(p *authPrincipal) []TemplateInfo {
+	templateMutex.RLock()
+	paths := maps.Clone(templateMap)
+	templateMutex.RUnlock()
+
+	byKey := make(map[string]*TemplateInfo)
+	for key, path := range paths {
+		base, theme, _ := strings.Cut(key, ".")
+		if meta, err := loadTemplateMeta(path); err != nil || !p.canAccess(meta.Access) {
+			continue
+		}
+		info := byKey[base]
+		if info == nil {
+			site, typ, _ := strings.Cut(base, "/")
+			info = &TemplateInfo{Key: base, Site: site, Type: typ}
+			byKey[base] = info
+		}
+		if theme != "" {
+			info.Themes = append(info.Themes, theme)
+		}
+	}
+	list := make([]TemplateInfo, 0, len(byKey))
+	for _, info := range byKey {
+		sort.Strings(info.Themes)
+		list = append(list, *info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list
+}
+
+// TemplatesHandler 列出可用模板，配置了 access 的模板只对满足条件的 token 可见
+func TemplatesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, ok(gin.H{"templates": listTemplates(principalFrom(c.Request.Context()))}))
+}
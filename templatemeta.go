@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chromedp/cdproto/page"
+	"github.com/chromedp/chromedp"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// ====== 模板附属配置 ======
+//
+// 模板旁的同名 .meta.yaml（如 bilibili/live.meta.yaml、bilibili_live.meta.yaml）声明该模板的渲染环境，
+// 主题变体没有单独的附属配置时使用基础模板的。
+//
+//	scripts:                  # 导航前通过 Page.addScriptToEvaluateOnNewDocument 注入，按顺序执行
+//	  - polyfills.js          # 以 .js 结尾的单行为文件，相对附属配置所在目录
+//	  - "window.BILI_MOCK = true"
+//	seed_random: true         # 以请求内容为种子替换 Math.random，覆盖 render.seed_random
+//	storage:                  # "response": "url" 时的对象名与元数据模板，见 objectkey.go
+//	  key: "{{.Site}}/{{date}}/{{hash}}{{.Ext}}"
+//	  metadata: {uid: "{{.Data.uid}}"}
+//	access:                   # 可使用该模板的 auth.tokens，满足任一条件即可，未设置则不限
+//	  tokens: [bili-bot]      # token 名
+//	  claims: {team: [bili]}  # token 的 claims 每一项都需包含其中一个值
+//	alt: "{{.user.name}}：{{.text}}" # 替代文本模板，见 alttext.go
+//	safe_html: true           # 允许 {{safeHTML .content}} 输出白名单清洗后的 HTML，见 sanitize.go
+//	adapter: bilibili         # 请求数据为上游原始 JSON，由内置适配器整理为卡片模型，见 adapter.go
+//	golden:                   # snapcast test 的比较参数，见 golden.go
+//	  threshold: 0.01
+//	  ignore: [{x: 20, y: 300, width: 200, height: 40}]
+
+// TemplateMeta 模板附属配置
+type TemplateMeta struct {
+	Scripts    []string       `yaml:"scripts"`     // 导航前注入的脚本，内联源码或 .js 文件
+	SeedRandom *bool          `yaml:"seed_random"` // 未设置时使用 render.seed_random
+	Storage    StorageMeta    `yaml:"storage"`     // 保存渲染结果时的对象名与元数据模板，覆盖 storage.key/metadata
+	Access     TemplateAccess `yaml:"access"`      // 可使用该模板的 token，见 authPrincipal.canAccess
+	Golden     GoldenMeta     `yaml:"golden"`      // 基准图测试的阈值与忽略区域
+	Alt        string         `yaml:"alt"`         // 替代文本模板，数据与 HTML 模板相同
+	SafeHTML   bool           `yaml:"safe_html"`   // 允许模板使用 safeHTML 输出清洗后的富文本
+	Adapter    string         `yaml:"adapter"`     // 将上游原始数据整理为卡片模型的内置适配器，见 adapter.go
+
+	scriptSources []string // 读取文件后的脚本源码
+	scriptFiles   []string // 以文件引用的脚本路径，其修改时间计入渲染缓存键
+}
+
+// TemplateAccess 模板的访问规则
+type TemplateAccess struct {
+	Tokens []string            `yaml:"tokens"`
+	Claims map[string][]string `yaml:"claims"`
+}
+
+func (a TemplateAccess) empty() bool {
+	return len(a.Tokens) == 0 && len(a.Claims) == 0
+}
+
+// GoldenMeta 基准图测试参数，未设置的阈值使用命令行参数
+type GoldenMeta struct {
+	Threshold      *float64       `yaml:"threshold"`
+	PixelThreshold *float64       `yaml:"pixel_threshold"`
+	Ignore         []GoldenRegion `yaml:"ignore"`
+}
+
+// GoldenRegion 不参与比较的矩形区域，单位为截图像素（已乘以 viewport.scale）
+type GoldenRegion struct {
+	X      int `yaml:"x"`
+	Y      int `yaml:"y"`
+	Width  int `yaml:"width"`
+	Height int `yaml:"height"`
+}
+
+func (g GoldenMeta) validate() error {
+	if g.Threshold != nil && !validRatio(*g.Threshold) {
+		return fmt.Errorf("golden.threshold must be between 0 and 1, got %v", *g.Threshold)
+	}
+	if g.PixelThreshold != nil && !validRatio(*g.PixelThreshold) {
+		return fmt.Errorf("golden.pixel_threshold must be between 0 and 1, got %v", *g.PixelThreshold)
+	}
+	for i, r := range g.Ignore {
+		if r.X < 0 || r.Y < 0 || r.Width <= 0 || r.Height <= 0 {
+			return fmt.Errorf("golden.ignore[%d] must have non-negative x/y and positive width/height", i)
+		}
+	}
+	return nil
+}
+
+func (g GoldenMeta) ignoreRects() []image.Rectangle {
+	rects := make([]image.Rectangle, 0, len(g.Ignore))
+	for _, r := range g.Ignore {
+		rects = append(rects, image.Rect(r.X, r.Y, r.X+r.Width, r.Y+r.Height))
+	}
+	return rects
+}
+
+// metaPath 返回模板对应的附属配置路径，如 bilibili_live.html → bilibili_live.meta.yaml
+func metaPath(tmplPath string) string {
+	return strings.TrimSuffix(tmplPath, ".html") + ".meta.yaml"
+}
+
+// loadTemplateMeta 读取模板的附属配置，不存在时返回空配置
+func loadTemplateMeta(tmplPath string) (*TemplateMeta, error) {
+	path := metaPath(tmplPath)
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		dir, name := filepath.Split(tmplPath)
+		if base, _, isVariant := strings.Cut(name, "."); isVariant && base+".html" != name {
+			path = metaPath(dir + base + ".html")
+			b, err = os.ReadFile(path)
+		}
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return &TemplateMeta{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var meta TemplateMeta
+	if err := yaml.Unmarshal(b, &meta); err != nil {
+		return nil, fmt.Errorf("invalid template meta %s: %w", path, err)
+	}
+	if err := meta.Storage.validate(); err != nil {
+		return nil, fmt.Errorf("template meta %s: %w", path, err)
+	}
+	if err := meta.Golden.validate(); err != nil {
+		return nil, fmt.Errorf("template meta %s: %w", path, err)
+	}
+	if err := validateAltTemplate(meta.Alt); err != nil {
+		return nil, fmt.Errorf("template meta %s: %w", path, err)
+	}
+	if err := validateAdapterName(meta.Adapter); err != nil {
+		return nil, fmt.Errorf("template meta %s: %w", path, err)
+	}
+	for _, script := range meta.Scripts {
+		if strings.HasSuffix(script, ".js") && !strings.ContainsAny(script, "\n;") {
+			file := filepath.Join(filepath.Dir(path), script)
+			src, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("template meta %s: %w", path, err)
+			}
+			script = string(src)
+			meta.scriptFiles = append(meta.scriptFiles, file)
+		}
+		meta.scriptSources = append(meta.scriptSources, script)
+	}
+	return &meta, nil
+}
+
+// initScriptActions 在导航前注册脚本，页面内任何脚本执行之前生效
+func initScriptActions(scripts []string) []chromedp.Action {
+	actions := make([]chromedp.Action, 0, len(scripts))
+	for _, src := range scripts {
+		actions = append(actions, chromedp.ActionFunc(func(ctx context.Context) error {
+			_, err := page.AddScriptToEvaluateOnNewDocument(src).Do(ctx)
+			return err
+		}))
+	}
+	return actions
+}
+
+// seedRandomEnabled 是否为该模板固定 Math.random 的种子
+func (m *TemplateMeta) seedRandomEnabled() bool {
+	if m.SeedRandom != nil {
+		return *m.SeedRandom
+	}
+	return viper.GetBool("render.seed_random")
+}
+
+// payloadSeed 由 site/type 与 data 计算随机数种子，相同请求得到相同种子
+func payloadSeed(p *PushPayload) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(p.Site + "/" + p.Type + "\x00"))
+	data, _ := json.Marshal(p.Data)
+	h.Write(data)
+	return h.Sum32()
+}
+
+// seedRandomScript 以 mulberry32 替换 Math.random
+func seedRandomScript(seed uint32) string {
+	return fmt.Sprintf(`(() => {
+	let s = %d >>> 0;
+	Math.random = function () {
+		s = (s + 0x6D2B79F5) >>> 0;
+		let t = s;
+		t = Math.imul(t ^ (t >>> 15), t | 1);
+		t ^= t + Math.imul(t ^ (t >>> 7), t | 61);
+		return ((t ^ (t >>> 14)) >>> 0) / 4294967296;
+	};
+})();`, seed)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v3"
+)
+
+// ====== 模板目录布局迁移 ======
+//
+//	snapcast templates migrate [--dry-run] [目录]
+//
+// 将旧的平铺布局 site_type[.theme].html 移动为分目录布局 site/type[.theme].html，
+// 同名的附属文件（.sample.json、.sample.<场景>.json、.meta.yaml、.schema.json、.transform.yaml）一并移动。两种布局的模板 key 相同，请求与基准图无需修改。
+
+// templateSidecars 随模板移动的附属文件后缀
+var templateSidecars = []string{".sample.json", ".meta.yaml", ".schema.json", ".transform.yaml"}
+
+// templateMove 一次文件移动
+type templateMove struct {
+	from, to string
+}
+
+// flatTemplateName 解析平铺布局的文件名 site_type[.theme].html，返回分目录布局下的相对路径前缀 site/type[.theme]
+func flatTemplateName(name string) (site, rest string, ok bool) {
+	base, isHTML := strings.CutSuffix(name, ".html")
+	if !isHTML {
+		return "", "", false
+	}
+	key, theme, hasTheme := strings.Cut(base, ".")
+	if hasTheme && !templateKeyRegex.MatchString(theme) {
+		return "", "", false
+	}
+	fields := strings.Split(key, "_")
+	if len(fields) != 2 || !templateKeyRegex.MatchString(fields[0]) || !templateKeyRegex.MatchString(fields[1]) {
+		return "", "", false
+	}
+	rest = fields[1]
+	if hasTheme {
+		rest += "." + theme
+	}
+	return fields[0], rest, true
+}
+
+// planTemplateMigration 列出模板目录顶层需要移动的文件；目标已存在的模板不移动，作为冲突返回
+func planTemplateMigration(dir string) (moves []templateMove, conflicts []string, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		site, rest, ok := flatTemplateName(e.Name())
+		if !ok {
+			continue
+		}
+		prefix := strings.TrimSuffix(e.Name(), ".html")
+		group := []templateMove{{from: filepath.Join(dir, e.Name()), to: filepath.Join(dir, site, rest+".html")}}
+		for _, suffix := range templateSidecars {
+			from := filepath.Join(dir, prefix+suffix)
+			if _, err := os.Stat(from); err == nil {
+				group = append(group, templateMove{from: from, to: filepath.Join(dir, site, rest+suffix)})
+			}
+		}
+		for scenario, file := range scenarioFiles(filepath.Join(dir, e.Name())) {
+			if scenario != defaultScenario {
+				group = append(group, templateMove{from: filepath.Join(dir, file), to: filepath.Join(dir, site, rest+strings.TrimPrefix(file, prefix))})
+			}
+		}
+		conflict := false
+		for _, m := range group {
+			if _, err := os.Stat(m.to); err == nil {
+				conflicts = append(conflicts, m.to)
+				conflict = true
+			}
+		}
+		if !conflict {
+			moves = append(moves, group...)
+		}
+	}
+	sort.Slice(moves, func(i, j int) bool { return moves[i].from < moves[j].from })
+	return moves, conflicts, nil
+}
+
+// brokenMetaScripts 返回移动后无法从新位置找到的 .js 脚本（附属配置中的脚本路径相对其所在目录）
+func brokenMetaScripts(metaFile, newDir string) []string {
+	b, err := os.ReadFile(metaFile)
+	if err != nil {
+		return nil
+	}
+	var meta TemplateMeta
+	if yaml.Unmarshal(b, &meta) != nil {
+		return nil
+	}
+	var broken []string
+	for _, script := range meta.Scripts {
+		if !strings.HasSuffix(script, ".js") || strings.ContainsAny(script, "\n;") {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(newDir, script)); errors.Is(err, os.ErrNotExist) {
+			broken = append(broken, script)
+		}
+	}
+	return broken
+}
+
+func cmdTemplates(args []string) int {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, `用法: snapcast templates <子命令>
+
+子命令:
+  migrate [--dry-run] [目录]       将平铺布局 site_type.html 迁移为分目录布局 site/type.html，默认使用配置中的 template.dir
+  usage [--days 30] [--all] [--json]  列出超过指定天数未使用的模板，需配置 template.usage_file`)
+	}
+	if len(args) > 0 && args[0] == "usage" {
+		return cmdTemplatesUsage(args[1:])
+	}
+	if len(args) == 0 || args[0] != "migrate" {
+		usage()
+		return 2
+	}
+	fset := flag.NewFlagSet("templates migrate", flag.ContinueOnError)
+	dryRun := fset.Bool("dry-run", false, "仅输出迁移计划，不移动文件")
+	configFile := fset.String("config", setupConfigFile, "配置文件，用于读取 template.dir")
+	if err := fset.Parse(args[1:]); err != nil {
+		return 2
+	}
+	dir := fset.Arg(0)
+	if dir == "" {
+		logLevel.SetLevel(zapcore.ErrorLevel)
+		initLogger("stderr")
+		if err := loadRenderConfig(*configFile); err != nil {
+			fmt.Fprintln(os.Stderr, "❌ 配置文件加载失败:", err)
+			return 1
+		}
+		dir = viper.GetString("template.dir")
+	}
+
+	moves, conflicts, err := planTemplateMigration(dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+	for _, c := range conflicts {
+		fmt.Fprintf(os.Stderr, "⚠️ 目标已存在，跳过该模板: %s\n", c)
+	}
+	if len(moves) == 0 {
+		fmt.Println("❕ 没有需要迁移的平铺模板")
+		if len(conflicts) > 0 {
+			return 1
+		}
+		return 0
+	}
+
+	for _, m := range moves {
+		if *dryRun {
+			fmt.Printf("%s → %s\n", m.from, m.to)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(m.to), 0755); err != nil {
+			fmt.Fprintln(os.Stderr, "❌", err)
+			return 1
+		}
+		if err := os.Rename(m.from, m.to); err != nil {
+			fmt.Fprintln(os.Stderr, "❌", err)
+			return 1
+		}
+		fmt.Printf("✅ %s → %s\n", m.from, m.to)
+	}
+	for _, m := range moves {
+		if !strings.HasSuffix(m.to, ".meta.yaml") {
+			continue
+		}
+		src := m.to
+		if *dryRun {
+			src = m.from
+		}
+		for _, script := range brokenMetaScripts(src, filepath.Dir(m.to)) {
+			fmt.Fprintf(os.Stderr, "⚠️ %s 引用的脚本 %s 在新位置不存在，请移动脚本或修改路径\n", m.to, script)
+		}
+	}
+	if *dryRun {
+		fmt.Printf("\n共 %d 个文件待移动（--dry-run 未修改）\n", len(moves))
+	} else {
+		fmt.Printf("\n已移动 %d 个文件，模板 key 不变\n", len(moves))
+	}
+	if len(conflicts) > 0 {
+		return 1
+	}
+	return 0
+}
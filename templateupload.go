@@ -0,0 +1,309 @@
+//go:build !noadmin
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// ====== 模板上传与删除 ======
+//
+// template.upload 开启后，管理后台或 CI 可以远程管理模板：
+//
+//	PUT    /templates/:site/:type   上传模板（?theme= 为主题变体），校验通过后才写入模板目录
+//	DELETE /templates/:site/:type   删除模板及其附属配置、示例数据
+//
+// 与管理接口相同，需要不限权限范围的 token，未配置认证时仅允许本机访问。模板目录由
+// template.git 或 template.remote_url 同步时拒绝修改，否则下次同步会覆盖。
+
+const maxTemplateUpload = 2 << 20
+
+// templateUpload PUT 请求体；Content-Type 不是 JSON 时整个请求体作为模板源码
+type templateUpload struct {
+	Content   string          `json:"content"`
+	Meta      string          `json:"meta,omitempty"`      // 附属配置 <type>.meta.yaml 的内容，见 templatemeta.go
+	Sample    json.RawMessage `json:"sample,omitempty"`    // 示例数据 <type>.sample.json
+	Schema    json.RawMessage `json:"schema,omitempty"`    // 数据 schema <type>.schema.json，见 dataschema.go
+	Transform string          `json:"transform,omitempty"` // 数据映射 <type>.transform.yaml 的内容，见 transform.go
+}
+
+// templateWriteMu 串行化模板文件的写入与随后的重新扫描
+var templateWriteMu sync.Mutex
+
+// registerTemplateUploadRoutes 注册模板上传与删除接口
+func registerTemplateUploadRoutes(r *gin.Engine) {
+	if !viper.GetBool("template.upload") {
+		return
+	}
+	r.PUT("/templates/:site/:type", adminGuard(), TemplateUploadHandler)
+	r.DELETE("/templates/:site/:type", adminGuard(), TemplateDeleteHandler)
+	logger.Info("📤 模板上传接口已启用")
+}
+
+// uploadTarget 校验路径参数，返回模板键与写入路径（分目录布局）
+func uploadTarget(c *gin.Context) (key, path string, err error) {
+	site, typ, theme := c.Param("site"), c.Param("type"), c.Query("theme")
+	if !templateKeyRegex.MatchString(site) || !templateKeyRegex.MatchString(typ) {
+		return "", "", errors.New("invalid site or type")
+	}
+	key, name := site+"/"+typ, typ
+	if theme != "" {
+		if !templateKeyRegex.MatchString(theme) {
+			return "", "", errors.New("invalid theme")
+		}
+		key, name = key+"."+theme, name+"."+theme
+	}
+	return key, filepath.Join(viper.GetString("template.dir"), site, name+".html"), nil
+}
+
+// managedTemplateDir 模板目录由外部同步时返回来源说明
+func managedTemplateDir() string {
+	switch {
+	case globalTemplateRepo != nil:
+		return "template.git"
+	case viper.GetString("template.remote_url") != "":
+		return "template.remote_url"
+	}
+	return ""
+}
+
+// TemplateUploadHandler 校验并写入模板，新建返回 201，覆盖返回 200
+func TemplateUploadHandler(c *gin.Context) {
+	key, path, err := uploadTarget(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errResp(err.Error()))
+		return
+	}
+	if source := managedTemplateDir(); source != "" {
+		c.JSON(http.StatusConflict, errResp("template dir is managed by "+source))
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxTemplateUpload+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errResp(err.Error()))
+		return
+	}
+	if len(body) > maxTemplateUpload {
+		c.JSON(http.StatusRequestEntityTooLarge, errResp(fmt.Sprintf("template exceeds %d bytes", maxTemplateUpload)))
+		return
+	}
+	var up templateUpload
+	if strings.HasPrefix(c.ContentType(), "application/json") {
+		if err := json.Unmarshal(body, &up); err != nil {
+			c.JSON(http.StatusBadRequest, errResp(err.Error()))
+			return
+		}
+	} else {
+		up.Content = string(body)
+	}
+	if strings.TrimSpace(up.Content) == "" {
+		c.JSON(http.StatusBadRequest, errResp("template content is empty"))
+		return
+	}
+	if len(up.Sample) > 0 {
+		var sample map[string]any
+		if err := json.Unmarshal(up.Sample, &sample); err != nil {
+			c.JSON(http.StatusBadRequest, errResp("sample must be a JSON object: "+err.Error()))
+			return
+		}
+	}
+
+	check, err := validateUpload(key, path, up)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errResp(err.Error()))
+		return
+	}
+	if !check.Valid {
+		c.JSON(http.StatusUnprocessableEntity, APIResponse{Status: "error", Message: "template is invalid", Data: check})
+		return
+	}
+
+	templateWriteMu.Lock()
+	defer templateWriteMu.Unlock()
+	_, statErr := os.Stat(path)
+	created := errors.Is(statErr, os.ErrNotExist)
+	files := map[string][]byte{path: []byte(up.Content)}
+	if up.Meta != "" {
+		files[metaPath(path)] = []byte(up.Meta)
+	}
+	if len(up.Sample) > 0 {
+		files[samplePath(path)] = up.Sample
+	}
+	if len(up.Schema) > 0 {
+		files[schemaPath(path)] = up.Schema
+	}
+	if up.Transform != "" {
+		files[transformPath(path)] = []byte(up.Transform)
+	}
+	for dst, data := range files {
+		if err := writeFileAtomic(dst, data); err != nil {
+			loggerFor(c.Request.Context()).Error("❌ 模板写入失败", zap.String("path", dst), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, errResp(err.Error()))
+			return
+		}
+	}
+	if err := reloadTemplates(viper.GetString("template.dir")); err != nil {
+		c.JSON(http.StatusInternalServerError, errResp(err.Error()))
+		return
+	}
+	publishReload(ReloadTemplates, []string{key})
+
+	loggerFor(c.Request.Context()).Info("📤 模板已上传", zap.String("key", key), zap.String("path", path), zap.Bool("created", created), zap.String("client_ip", GetClientIP(c)))
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, ok(gin.H{"key": key, "path": path, "created": created}))
+}
+
+// validateUpload 将模板与附属配置写入临时目录后按已加载模板的方式校验，不影响模板目录
+func validateUpload(key, path string, up templateUpload) (TemplateCheck, error) {
+	tmp, err := os.MkdirTemp("", "snapcast-upload-")
+	if err != nil {
+		return TemplateCheck{}, err
+	}
+	defer os.RemoveAll(tmp)
+	// 附属配置引用的 .js 脚本相对模板所在目录，从模板目录复制到临时目录的对应位置；
+	// 脚本路径含 ../ 时模板放在相应深度的子目录中，复制的脚本不会落到临时目录之外
+	scripts := uploadMetaScripts(up.Meta)
+	dir := tmp
+	for _, script := range scripts {
+		for rel := filepath.Clean(script); strings.HasPrefix(rel, ".."+string(filepath.Separator)); rel = rel[3:] {
+			dir = filepath.Join(dir, "d")
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return TemplateCheck{}, err
+	}
+	staged := filepath.Join(dir, filepath.Base(path))
+	if err := os.WriteFile(staged, []byte(up.Content), 0644); err != nil {
+		return TemplateCheck{}, err
+	}
+	for _, script := range scripts {
+		src, err := os.ReadFile(filepath.Join(filepath.Dir(path), script))
+		if err != nil {
+			continue // 缺失的脚本由校验报告
+		}
+		dst := filepath.Join(dir, script)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return TemplateCheck{}, err
+		}
+		if err := os.WriteFile(dst, src, 0644); err != nil {
+			return TemplateCheck{}, err
+		}
+	}
+	sidecars := map[string][]byte{metaPath(staged): []byte(up.Meta), samplePath(staged): up.Sample, schemaPath(staged): up.Schema, transformPath(staged): []byte(up.Transform)}
+	for name, data := range sidecars {
+		if len(data) == 0 {
+			continue
+		}
+		if err := os.WriteFile(name, data, 0644); err != nil {
+			return TemplateCheck{}, err
+		}
+	}
+	check := validateTemplateFile(key, staged)
+	check.Path = path
+	if check.Error != "" {
+		check.Error = strings.ReplaceAll(check.Error, filepath.Dir(staged), filepath.Dir(path))
+	}
+	return check, nil
+}
+
+// uploadMetaScripts 返回上传的附属配置中以文件引用的 .js 脚本，配置无效时由校验报告
+func uploadMetaScripts(meta string) []string {
+	var m TemplateMeta
+	if meta == "" || yaml.Unmarshal([]byte(meta), &m) != nil {
+		return nil
+	}
+	var scripts []string
+	for _, script := range m.Scripts {
+		if strings.HasSuffix(script, ".js") && !strings.ContainsAny(script, "\n;") {
+			scripts = append(scripts, script)
+		}
+	}
+	return scripts
+}
+
+// writeFileAtomic 先写临时文件再重命名，文件监听与渲染不会读到写了一半的模板
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// TemplateDeleteHandler 删除模板；删除基础模板时一并删除附属配置与示例数据，主题变体不受影响
+func TemplateDeleteHandler(c *gin.Context) {
+	key, _, err := uploadTarget(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errResp(err.Error()))
+		return
+	}
+	if source := managedTemplateDir(); source != "" {
+		c.JSON(http.StatusConflict, errResp("template dir is managed by "+source))
+		return
+	}
+
+	templateWriteMu.Lock()
+	defer templateWriteMu.Unlock()
+	templateMutex.RLock()
+	path, exists := templateMap[key]
+	templateMutex.RUnlock()
+	if !exists {
+		c.JSON(http.StatusNotFound, errResp("template not found"))
+		return
+	}
+
+	files := []string{path, metaPath(path)}
+	if c.Query("theme") == "" {
+		files = append(files, samplePath(path), schemaPath(path), transformPath(path))
+		scenarios, _ := filepath.Glob(strings.TrimSuffix(path, ".html") + ".sample.*.json")
+		files = append(files, scenarios...)
+	}
+	var removed []string
+	for _, f := range files {
+		if err := os.Remove(f); err == nil {
+			removed = append(removed, f)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			c.JSON(http.StatusInternalServerError, errResp(err.Error()))
+			return
+		}
+	}
+	if err := reloadTemplates(viper.GetString("template.dir")); err != nil {
+		c.JSON(http.StatusInternalServerError, errResp(err.Error()))
+		return
+	}
+	publishReload(ReloadTemplates, []string{key})
+
+	loggerFor(c.Request.Context()).Info("🗑️ 模板已删除", zap.String("key", key), zap.Strings("files", removed), zap.String("client_ip", GetClientIP(c)))
+	c.JSON(http.StatusOK, ok(gin.H{"key": key, "removed": removed}))
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// ====== 模板使用统计 ======
+//
+// 记录每个模板（含主题变体与兜底模板）最近一次被使用的时间与次数，定期写入 template.usage_file。
+// GET /admin/templates/usage 与 snapcast templates usage 列出 N 天内没有被使用的模板，便于清理过时的卡片设计。
+
+// templateUsage 单个模板的使用记录
+type templateUsage struct {
+	LastUsed time.Time `json:"last_used"`
+	Count    int64     `json:"count"`
+}
+
+// templateUsageData 使用记录文件的内容
+type templateUsageData struct {
+	Since     time.Time                 `json:"since"` // 开始统计的时间，从未使用的模板按此计算闲置天数
+	Templates map[string]*templateUsage `json:"templates"`
+}
+
+type usageTracker struct {
+	mu    sync.Mutex
+	file  string
+	data  templateUsageData
+	dirty bool
+}
+
+var globalTemplateUsage = &usageTracker{data: templateUsageData{Since: time.Now(), Templates: make(map[string]*templateUsage)}}
+
+// InitTemplateUsage 读取已有的使用记录并每分钟写回文件，template.usage_file 为空时仅统计本次运行
+func InitTemplateUsage() {
+	file := viper.GetString("template.usage_file")
+	if file == "" {
+		return
+	}
+	t := globalTemplateUsage
+	data, err := loadTemplateUsage(file)
+	if err != nil {
+		logger.Warn("⚠️ 模板使用记录读取失败，重新开始统计", zap.String("file", file), zap.Error(err))
+	} else if data != nil {
+		t.data = *data
+	}
+	t.file = file
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := t.Flush(); err != nil {
+				logger.Warn("⚠️ 模板使用记录写入失败", zap.String("file", file), zap.Error(err))
+			}
+		}
+	}()
+}
+
+// loadTemplateUsage 读取使用记录文件，不存在时返回 nil
+func loadTemplateUsage(file string) (*templateUsageData, error) {
+	b, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var data templateUsageData
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, err
+	}
+	if data.Templates == nil {
+		data.Templates = make(map[string]*templateUsage)
+	}
+	return &data, nil
+}
+
+// Record 记录一次模板使用
+func (t *usageTracker) Record(key string) {
+	if key == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	u, exists := t.data.Templates[key]
+	if !exists {
+		u = &templateUsage{}
+		t.data.Templates[key] = u
+	}
+	u.LastUsed = time.Now()
+	u.Count++
+	t.dirty = true
+}
+
+// Flush 有新记录时写回文件
+func (t *usageTracker) Flush() error {
+	t.mu.Lock()
+	if t.file == "" || !t.dirty {
+		t.mu.Unlock()
+		return nil
+	}
+	b, err := json.MarshalIndent(t.data, "", "  ")
+	t.dirty = false
+	file := t.file
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// Snapshot 返回使用记录的副本
+func (t *usageTracker) Snapshot() templateUsageData {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	data := templateUsageData{Since: t.data.Since, Templates: make(map[string]*templateUsage, len(t.data.Templates))}
+	for key, u := range t.data.Templates {
+		copied := *u
+		data.Templates[key] = &copied
+	}
+	return data
+}
+
+// templateKeyOf 由模板路径反查 key
+func templateKeyOf(path string) string {
+	templateMutex.RLock()
+	defer templateMutex.RUnlock()
+	for key, p := range templateMap {
+		if p == path {
+			return key
+		}
+	}
+	return ""
+}
+
+// TemplateUsageEntry 使用报告中的一项
+type TemplateUsageEntry struct {
+	Key      string     `json:"key"`
+	Path     string     `json:"path"`
+	LastUsed *time.Time `json:"last_used"` // 从未使用时为 null
+	Count    int64      `json:"count"`
+	IdleDays int        `json:"idle_days"` // 距最近一次使用（从未使用时距开始统计）的天数
+	Unused   bool       `json:"unused"`    // 闲置天数不少于 days
+}
+
+// templateUsageReport 按闲置天数降序列出当前全部模板
+func templateUsageReport(data templateUsageData, templates map[string]string, days int, now time.Time) []TemplateUsageEntry {
+	entries := make([]TemplateUsageEntry, 0, len(templates))
+	for key, path := range templates {
+		e := TemplateUsageEntry{Key: key, Path: path}
+		idleSince := data.Since
+		if u, exists := data.Templates[key]; exists {
+			lastUsed := u.LastUsed
+			e.LastUsed, e.Count = &lastUsed, u.Count
+			idleSince = lastUsed
+		}
+		e.IdleDays = int(now.Sub(idleSince) / (24 * time.Hour))
+		e.Unused = e.IdleDays >= days
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].IdleDays != entries[j].IdleDays {
+			return entries[i].IdleDays > entries[j].IdleDays
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	return entries
+}
+
+// cmdTemplatesUsage 读取使用记录文件并列出闲置的模板
+func cmdTemplatesUsage(args []string) int {
+	fset := flag.NewFlagSet("templates usage", flag.ContinueOnError)
+	days := fset.Int("days", 30, "闲置天数阈值")
+	all := fset.Bool("all", false, "列出全部模板，而不只是闲置的")
+	asJSON := fset.Bool("json", false, "以 JSON 输出")
+	configFile := fset.String("config", setupConfigFile, "配置文件，用于读取 template.dir 与 template.usage_file")
+	if err := fset.Parse(args); err != nil {
+		return 2
+	}
+	logLevel.SetLevel(zapcore.ErrorLevel)
+	initLogger("stderr")
+	if err := loadRenderConfig(*configFile); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ 配置文件加载失败:", err)
+		return 1
+	}
+	file := viper.GetString("template.usage_file")
+	if file == "" {
+		fmt.Fprintln(os.Stderr, "❌ 未配置 template.usage_file，没有使用记录")
+		return 1
+	}
+	data, err := loadTemplateUsage(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ 使用记录读取失败:", err)
+		return 1
+	}
+	if data == nil {
+		fmt.Fprintln(os.Stderr, "❌ 使用记录不存在:", file)
+		return 1
+	}
+	templates, err := scanTemplates(viper.GetString("template.dir"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+
+	entries := templateUsageReport(*data, templates, *days, time.Now())
+	unused := 0
+	shown := entries[:0:0]
+	for _, e := range entries {
+		if e.Unused {
+			unused++
+		}
+		if *all || e.Unused {
+			shown = append(shown, e)
+		}
+	}
+	if *asJSON {
+		b, _ := json.MarshalIndent(shown, "", "  ")
+		fmt.Println(string(b))
+	} else {
+		for _, e := range shown {
+			last := "从未使用"
+			if e.LastUsed != nil {
+				last = e.LastUsed.Local().Format("2006-01-02 15:04")
+			}
+			fmt.Printf("%-32s %5d 天  %-16s %8d 次  %s\n", e.Key, e.IdleDays, last, e.Count, e.Path)
+		}
+		fmt.Printf("\n共 %d 个模板，%d 个超过 %d 天未使用（自 %s 起统计）\n", len(entries), unused, *days, data.Since.Local().Format("2006-01-02"))
+	}
+	return 0
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== TLS 与客户端证书 ======
+//
+// server.tls.cert_file/key_file 配置后直接以 HTTPS 提供服务，跨主机部署无需反向代理。
+// 证书文件更新（如自动续期）后在下一次握手时重新加载，无需重启。
+// client_ca_file 配置后校验客户端证书（mTLS）：
+//   - client_auth: require（默认）握手时要求客户端证书，存储对象等聊天平台访问的地址同样需要证书
+//   - client_auth: optional 握手时证书可选，除存储对象与签名资源外的请求仍要求有效的客户端证书
+// 客户端证书与 token 认证相互独立，二者都配置时都需要满足。以下配置修改需重启。
+
+// 客户端证书校验方式
+const (
+	ClientAuthRequire  = "require"
+	ClientAuthOptional = "optional"
+)
+
+// certReloader 按文件修改时间重新加载服务端证书
+type certReloader struct {
+	certFile, keyFile string
+	mu                sync.Mutex
+	cert              *tls.Certificate
+	modTime           time.Time
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil && r.cert != nil {
+		return r.cert, nil // 续期过程中文件暂时不可用，沿用旧证书
+	}
+	if err == nil && r.cert != nil && !certInfo.ModTime().After(r.modTime) {
+		return r.cert, nil
+	}
+	cert, loadErr := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if loadErr != nil {
+		if r.cert != nil {
+			logger.Warn("⚠️ TLS 证书重新加载失败，沿用旧证书", zap.String("cert_file", r.certFile), zap.Error(loadErr))
+			return r.cert, nil
+		}
+		return nil, loadErr
+	}
+	if r.cert != nil {
+		logger.Info("🔐 TLS 证书已重新加载", zap.String("cert_file", r.certFile))
+	}
+	r.cert = &cert
+	if err == nil {
+		r.modTime = certInfo.ModTime()
+	}
+	return r.cert, nil
+}
+
+// serverTLSConfig 按 server.tls 创建 TLS 配置，未配置证书时返回 nil
+func serverTLSConfig() (*tls.Config, error) {
+	certFile := viper.GetString("server.tls.cert_file")
+	keyFile := viper.GetString("server.tls.key_file")
+	if certFile == "" && keyFile == "" {
+		if viper.GetString("server.tls.client_ca_file") != "" {
+			return nil, errors.New("server.tls.client_ca_file requires cert_file and key_file")
+		}
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("server.tls.cert_file and key_file must be set together")
+	}
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := reloader.GetCertificate(nil); err != nil { // 启动时检查证书可用
+		return nil, fmt.Errorf("load certificate: %w", err)
+	}
+	cfg := &tls.Config{GetCertificate: reloader.GetCertificate, MinVersion: tls.VersionTLS12}
+	switch v := viper.GetString("server.tls.min_version"); v {
+	case "", "1.2":
+	case "1.3":
+		cfg.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("invalid server.tls.min_version %q: must be 1.2 or 1.3", v)
+	}
+
+	caFile := viper.GetString("server.tls.client_ca_file")
+	if caFile == "" {
+		return cfg, nil
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("read client_ca_file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("client_ca_file %s contains no PEM certificates", caFile)
+	}
+	cfg.ClientCAs = pool
+	switch mode := clientAuthMode(); mode {
+	case ClientAuthRequire:
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	case ClientAuthOptional:
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, fmt.Errorf("invalid server.tls.client_auth %q: must be require or optional", mode)
+	}
+	return cfg, nil
+}
+
+// clientAuthMode 返回客户端证书校验方式，未配置 client_ca_file 时为空
+func clientAuthMode() string {
+	if viper.GetString("server.tls.client_ca_file") == "" {
+		return ""
+	}
+	if mode := viper.GetString("server.tls.client_auth"); mode != "" {
+		return mode
+	}
+	return ClientAuthRequire
+}
+
+// ClientCertMiddleware client_auth 为 optional 时，要求存储对象与签名资源以外的请求携带有效的客户端证书
+func ClientCertMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isSignedAssetRequest(c) || isStoredObjectRequest(c) {
+			c.Next()
+			return
+		}
+		if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+			logger.Warn("⛔ 缺少客户端证书", zap.String("ip", c.ClientIP()), zap.String("path", c.Request.URL.Path))
+			c.AbortWithStatusJSON(http.StatusUnauthorized, errResp("client certificate required"))
+			return
+		}
+		c.Next()
+	}
+}
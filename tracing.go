@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 链路追踪 ======
+//
+// tracing.enabled 开启后，每个请求记录一条链路，以 OTLP/HTTP（JSON 编码）批量发送到
+// OpenTelemetry Collector、Jaeger、Tempo 等兼容端点，可以看到一次渲染的耗时分布在哪一步：
+//
+//	POST /render
+//	├── queue              排队等待并发名额
+//	└── render             渲染管线
+//	    ├── template.parse / template.execute
+//	    ├── navigate / wait / screenshot / crop / encode   截图的各个步骤
+//	    └── output         色彩配置写入等输出编码
+//
+// 请求头携带 W3C traceparent 时沿用调用方的 trace ID，并按其采样标记决定是否记录；
+// 否则按 tracing.sample_ratio 采样。以下配置修改需重启。
+
+// 链路中 span 的类型，对应 OTLP 的 SpanKind
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+)
+
+// traceSpan 一个计时区间，未开启追踪时为 nil，所有方法均可在 nil 上调用
+type traceSpan struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	sampled  bool
+	name     string
+	kind     int
+	start    time.Time
+
+	mu    sync.Mutex
+	end   time.Time
+	attrs map[string]any
+	err   string
+}
+
+type spanKey struct{}
+
+type traceExporter struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	ratio    float64
+	client   *http.Client
+
+	queue chan *traceSpan
+	done  chan struct{}
+}
+
+var globalTracer *traceExporter
+
+var exportedSpans = NewCounterVec("snapcast_trace_spans_total", "Trace spans handed to the OTLP exporter, by result.", "result")
+
+// 每批最多发送的 span 数与队列长度，队列满时丢弃
+const (
+	traceBatchSize  = 512
+	traceQueueSize  = 4096
+	traceFlushEvery = 5 * time.Second
+)
+
+// InitTracing 按 tracing 配置启用链路追踪
+func InitTracing() {
+	if !viper.GetBool("tracing.enabled") {
+		return
+	}
+	endpoint := viper.GetString("tracing.endpoint")
+	if endpoint == "" {
+		endpoint = "http://127.0.0.1:4318/v1/traces"
+	}
+	service := viper.GetString("tracing.service_name")
+	if service == "" {
+		service = "snapcast"
+	}
+	ratio := 1.0
+	if viper.IsSet("tracing.sample_ratio") {
+		ratio = math.Min(math.Max(viper.GetFloat64("tracing.sample_ratio"), 0), 1)
+	}
+	t := &traceExporter{
+		endpoint: endpoint,
+		headers:  viper.GetStringMapString("tracing.headers"),
+		service:  service,
+		ratio:    ratio,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		queue:    make(chan *traceSpan, traceQueueSize),
+		done:     make(chan struct{}),
+	}
+	globalTracer = t
+	go t.run()
+	logger.Info("🔭 链路追踪已启用", zap.String("endpoint", endpoint), zap.Float64("sample_ratio", ratio))
+}
+
+// ShutdownTracing 发送队列中剩余的 span，停止服务时调用
+func ShutdownTracing(ctx context.Context) {
+	t := globalTracer
+	if t == nil {
+		return
+	}
+	close(t.queue)
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		logger.Warn("⚠️ 链路数据未能全部发送", zap.Error(ctx.Err()))
+	}
+}
+
+// startSpan 在 ctx 中的 span 下创建子 span，未开启追踪时返回 nil
+func startSpan(ctx context.Context, name string) (context.Context, *traceSpan) {
+	t := globalTracer
+	if t == nil {
+		return ctx, nil
+	}
+	s := &traceSpan{name: name, kind: spanKindInternal, start: time.Now()}
+	_, _ = rand.Read(s.spanID[:])
+	if parent := spanFrom(ctx); parent != nil {
+		s.traceID, s.parentID, s.sampled = parent.traceID, parent.spanID, parent.sampled
+	} else {
+		_, _ = rand.Read(s.traceID[:])
+		s.sampled = t.sample(s.traceID)
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// sample 按 trace ID 的低 8 字节决定是否采样，同一 trace 的判断结果一致
+func (t *traceExporter) sample(traceID [16]byte) bool {
+	if t.ratio >= 1 {
+		return true
+	}
+	var n uint64
+	for _, b := range traceID[8:] {
+		n = n<<8 | uint64(b)
+	}
+	return float64(n>>11)/(1<<53) < t.ratio
+}
+
+// SetAttr 记录属性，值为字符串、整数、浮点数或布尔值
+func (s *traceSpan) SetAttr(key string, value any) {
+	if s == nil || !s.sampled {
+		return
+	}
+	s.mu.Lock()
+	if s.attrs == nil {
+		s.attrs = make(map[string]any)
+	}
+	s.attrs[key] = value
+	s.mu.Unlock()
+}
+
+// End 结束 span，err 非空时标记为失败
+func (s *traceSpan) End(err error) {
+	if s == nil || !s.sampled {
+		return
+	}
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	if err != nil {
+		s.err = err.Error()
+	}
+	s.mu.Unlock()
+	globalTracer.enqueue(s)
+}
+
+// TraceID 返回十六进制的 trace ID，用于日志关联，未采样时为空
+func (s *traceSpan) TraceID() string {
+	if s == nil || !s.sampled {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// spanFrom 返回 ctx 中当前的 span
+func spanFrom(ctx context.Context) *traceSpan {
+	s, _ := ctx.Value(spanKey{}).(*traceSpan)
+	return s
+}
+
+func (t *traceExporter) enqueue(s *traceSpan) {
+	defer func() { _ = recover() }() // 停止服务后结束的 span 直接丢弃
+	select {
+	case t.queue <- s:
+	default:
+		exportedSpans.Inc("dropped")
+	}
+}
+
+func (t *traceExporter) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(traceFlushEvery)
+	defer ticker.Stop()
+	batch := make([]*traceSpan, 0, traceBatchSize)
+	for {
+		select {
+		case s, open := <-t.queue:
+			if !open {
+				t.export(batch)
+				return
+			}
+			batch = append(batch, s)
+			if len(batch) < traceBatchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		t.export(batch)
+		batch = batch[:0]
+	}
+}
+
+// ====== OTLP/HTTP JSON ======
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"` // int64 在 OTLP JSON 中以字符串表示
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"` // 2 = ERROR
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string      `json:"traceId"`
+	SpanID            string      `json:"spanId"`
+	ParentSpanID      string      `json:"parentSpanId,omitempty"`
+	Name              string      `json:"name"`
+	Kind              int         `json:"kind"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string      `json:"endTimeUnixNano"`
+	Attributes        []otlpAttr  `json:"attributes,omitempty"`
+	Status            *otlpStatus `json:"status,omitempty"`
+}
+
+func otlpAttribute(key string, v any) otlpAttr {
+	var val otlpValue
+	switch x := v.(type) {
+	case string:
+		val.StringValue = &x
+	case bool:
+		val.BoolValue = &x
+	case int:
+		s := strconv.Itoa(x)
+		val.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(x, 10)
+		val.IntValue = &s
+	case float64:
+		val.DoubleValue = &x
+	default:
+		s := fmt.Sprint(x)
+		val.StringValue = &s
+	}
+	return otlpAttr{Key: key, Value: val}
+}
+
+func (s *traceSpan) otlp() otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := otlpSpan{
+		TraceID:           hex.EncodeToString(s.traceID[:]),
+		SpanID:            hex.EncodeToString(s.spanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+	}
+	if s.parentID != [8]byte{} {
+		out.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+	for k, v := range s.attrs {
+		out.Attributes = append(out.Attributes, otlpAttribute(k, v))
+	}
+	if s.err != "" {
+		out.Status = &otlpStatus{Code: 2, Message: s.err}
+	}
+	return out
+}
+
+func (t *traceExporter) export(batch []*traceSpan) {
+	if len(batch) == 0 {
+		return
+	}
+	spans := make([]otlpSpan, len(batch))
+	for i, s := range batch {
+		spans[i] = s.otlp()
+	}
+	host, _ := os.Hostname()
+	body, err := json.Marshal(map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{"attributes": []otlpAttr{
+				otlpAttribute("service.name", t.service),
+				otlpAttribute("host.name", host),
+			}},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": "snapcast"},
+				"spans": spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := t.client.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			err = fmt.Errorf("collector returned %s", resp.Status)
+		}
+	}
+	if err != nil {
+		exportedSpans.Add(float64(len(batch)), "failed")
+		logger.Warn("⚠️ 链路数据发送失败", zap.String("endpoint", t.endpoint), zap.Int("spans", len(batch)), zap.Error(err))
+		return
+	}
+	exportedSpans.Add(float64(len(batch)), "exported")
+}
+
+// ====== HTTP 请求 ======
+
+// parseTraceparent 解析 W3C traceparent：00-<trace-id>-<parent-id>-<flags>
+func parseTraceparent(header string) (traceID [16]byte, parentID [8]byte, sampled bool, valid bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil || traceID == [16]byte{} {
+		return
+	}
+	if _, err := hex.Decode(parentID[:], []byte(parts[2])); err != nil || parentID == [8]byte{} {
+		return
+	}
+	return traceID, parentID, flags[0]&1 == 1, true
+}
+
+// TracingMiddleware 为每个请求创建服务端 span，需在 RequestIDMiddleware 之后注册
+func TracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if globalTracer == nil {
+			c.Next()
+			return
+		}
+		ctx, span := startSpan(c.Request.Context(), c.Request.Method+" "+c.Request.URL.Path)
+		if traceID, parentID, sampled, valid := parseTraceparent(c.GetHeader("traceparent")); valid {
+			span.traceID, span.parentID, span.sampled = traceID, parentID, sampled
+		}
+		span.kind = spanKindServer
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		if route := c.FullPath(); route != "" {
+			span.name = c.Request.Method + " " + route
+			span.SetAttr("http.route", route)
+		}
+		span.SetAttr("http.request.method", c.Request.Method)
+		span.SetAttr("url.path", c.Request.URL.Path)
+		span.SetAttr("client.address", GetClientIP(c))
+		span.SetAttr("http.response.status_code", c.Writer.Status())
+		if id := c.GetString("request_id"); id != "" {
+			span.SetAttr("snapcast.request_id", id)
+		}
+		var err error
+		if status := c.Writer.Status(); status >= http.StatusInternalServerError {
+			msg := c.GetString("render_error")
+			if msg == "" {
+				msg = http.StatusText(status)
+			}
+			err = errors.New(msg)
+		}
+		span.End(err)
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// ====== 数据映射 ======
+//
+// 上游接口的原始 JSON（B 站动态 API、RSS 条目等）层级深、字段名随版本变化，直接在模板里取值会让模板
+// 充满 {{with}} 与兜底逻辑。模板旁的 <type>.transform.yaml 声明式地把原始数据映射为模板需要的结构，
+// 在 transform 阶段、WASM 转换与 schema 校验之前执行，模板只需面对整理好的字段：
+//
+//	# templates/bilibili/dynamic.transform.yaml
+//	fields:
+//	  title: modules.module_dynamic.desc.text          # 源字段路径，数组下标用数字，-1 为最后一项
+//	  author.name: modules.module_author.name          # 目标键中的 . 生成嵌套对象
+//	  author.face:
+//	    from: [modules.module_author.face, owner.face]  # 依次取第一个存在且非 null 的字段
+//	    default: "https://i0.hdslb.com/bfs/face/member/noface.jpg"
+//	  published:
+//	    from: modules.module_author.pub_ts
+//	    convert: time                                   # string、int、float、bool、time（时间戳 → RFC 3339）、unix
+//	  pics:
+//	    from: modules.module_dynamic.major.draw.items
+//	    each: {url: src, width: width}                  # 数组逐项映射，路径相对于数组元素
+//	  summary:
+//	    template: "{{.owner.name}}：{{.desc.text}}"      # 文本模板，数据为原始 data，函数同模板
+//	  source: {value: bilibili}                        # 固定值
+//	keep: false                                        # true 时保留原始数据中未映射的字段
+//
+// 源字段不存在且没有 default 时不输出该字段，缺失的必填字段由 schema 校验报告（见 dataschema.go）。
+// 主题变体没有单独的映射时使用基础模板的；有映射的模板，示例数据也应为映射前的原始数据。
+
+// fieldMapping 单个目标字段的映射规则
+type fieldMapping struct {
+	From     []string
+	Value    any
+	Template string
+	Default  any
+	Convert  string
+	Each     map[string]*fieldMapping
+
+	tmpl *template.Template
+}
+
+// UnmarshalYAML 支持简写：值为字符串时表示源字段路径
+func (m *fieldMapping) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		m.From = []string{node.Value}
+		return nil
+	}
+	var raw struct {
+		From     yaml.Node                `yaml:"from"`
+		Value    any                      `yaml:"value"`
+		Template string                   `yaml:"template"`
+		Default  any                      `yaml:"default"`
+		Convert  string                   `yaml:"convert"`
+		Each     map[string]*fieldMapping `yaml:"each"`
+	}
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	switch raw.From.Kind {
+	case 0:
+	case yaml.ScalarNode:
+		m.From = []string{raw.From.Value}
+	default:
+		if err := raw.From.Decode(&m.From); err != nil {
+			return fmt.Errorf("from must be a path or a list of paths: %w", err)
+		}
+	}
+	m.Value, m.Template, m.Default, m.Convert, m.Each = raw.Value, raw.Template, raw.Default, raw.Convert, raw.Each
+	return nil
+}
+
+// dataTransform 已解析的 transform.yaml
+type dataTransform struct {
+	Fields map[string]*fieldMapping `yaml:"fields"`
+	Keep   bool                     `yaml:"keep"`
+}
+
+type cachedTransform struct {
+	modTime   time.Time
+	size      int64
+	transform *dataTransform
+}
+
+// transformCache 映射文件路径 → 解析结果，文件修改后重新解析
+var transformCache sync.Map
+
+// transformPath 返回模板对应的映射文件路径，如 bilibili_live.html → bilibili_live.transform.yaml
+func transformPath(tmplPath string) string {
+	return strings.TrimSuffix(tmplPath, ".html") + ".transform.yaml"
+}
+
+// loadTemplateTransform 读取模板的数据映射，没有时返回 nil
+func loadTemplateTransform(tmplPath string) (*dataTransform, error) {
+	path := transformPath(tmplPath)
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		dir, name := filepath.Split(tmplPath)
+		if base, _, isVariant := strings.Cut(name, "."); isVariant && base+".html" != name {
+			path = transformPath(dir + base + ".html")
+			info, err = os.Stat(path)
+		}
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := transformCache.Load(path); ok {
+		if c := v.(*cachedTransform); c.modTime.Equal(info.ModTime()) && c.size == info.Size() {
+			return c.transform, nil
+		}
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	t, err := parseDataTransform(b)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template transform %s: %w", path, err)
+	}
+	transformCache.Store(path, &cachedTransform{modTime: info.ModTime(), size: info.Size(), transform: t})
+	return t, nil
+}
+
+// parseDataTransform 解析映射并检查规则与文本模板
+func parseDataTransform(b []byte) (*dataTransform, error) {
+	var t dataTransform
+	if err := yaml.Unmarshal(b, &t); err != nil {
+		return nil, err
+	}
+	if len(t.Fields) == 0 {
+		return nil, errors.New("fields is empty")
+	}
+	if err := compileMappings(t.Fields, ""); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func compileMappings(fields map[string]*fieldMapping, prefix string) error {
+	for key, m := range fields {
+		name := prefix + key
+		if key == "" || strings.HasPrefix(key, ".") || strings.HasSuffix(key, ".") || strings.Contains(key, "..") {
+			return fmt.Errorf("field %q: invalid name", name)
+		}
+		if m == nil {
+			return fmt.Errorf("field %q: empty rule", name)
+		}
+		sources := 0
+		if len(m.From) > 0 {
+			sources++
+		}
+		if m.Value != nil {
+			sources++
+		}
+		if m.Template != "" {
+			sources++
+		}
+		if sources != 1 && !(sources == 0 && m.Default != nil) {
+			return fmt.Errorf("field %q: exactly one of from, value and template is required", name)
+		}
+		switch m.Convert {
+		case "", "string", "int", "float", "bool", "time", "unix":
+		default:
+			return fmt.Errorf("field %q: unknown convert %q", name, m.Convert)
+		}
+		if m.Template != "" {
+			tmpl, err := template.New(name).Option("missingkey=zero").Funcs(funcsList).Parse(m.Template)
+			if err != nil {
+				return fmt.Errorf("field %q: %w", name, err)
+			}
+			m.tmpl = tmpl
+		}
+		if m.Each != nil {
+			if len(m.From) == 0 {
+				return fmt.Errorf("field %q: each requires from", name)
+			}
+			if err := compileMappings(m.Each, name+"[]."); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Apply 映射数据，返回新的 data；原始数据不会被修改
+func (t *dataTransform) Apply(data any) (any, error) {
+	out := make(map[string]any, len(t.Fields))
+	if t.Keep {
+		if src, isObject := normalizeJSON(data).(map[string]any); isObject {
+			out = src
+		}
+	}
+	if err := applyMappings(t.Fields, data, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func applyMappings(fields map[string]*fieldMapping, src any, out map[string]any) error {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys) // 结果稳定，嵌套字段在父字段之后写入
+	for _, key := range keys {
+		v, found, err := fields[key].resolve(key, src)
+		if err != nil {
+			return err
+		}
+		if found {
+			setPath(out, key, v)
+		}
+	}
+	return nil
+}
+
+// resolve 计算目标字段的值，found 为 false 时不输出该字段
+func (m *fieldMapping) resolve(name string, src any) (v any, found bool, err error) {
+	switch {
+	case m.Value != nil:
+		v, found = m.Value, true
+	case m.tmpl != nil:
+		var buf bytes.Buffer
+		if err := m.tmpl.Execute(&buf, src); err != nil {
+			return nil, false, fmt.Errorf("transform field %s: %w", name, err)
+		}
+		v, found = strings.ReplaceAll(buf.String(), "<no value>", ""), true
+	default:
+		for _, p := range m.From {
+			if v, found = lookupPath(src, p); found && v != nil {
+				break
+			}
+			found = false
+		}
+	}
+	if found && m.Each != nil {
+		items, isList := v.([]any)
+		if !isList {
+			found = false
+		} else {
+			mapped := make([]any, 0, len(items))
+			for _, item := range items {
+				obj := make(map[string]any, len(m.Each))
+				if err := applyMappings(m.Each, item, obj); err != nil {
+					return nil, false, err
+				}
+				mapped = append(mapped, obj)
+			}
+			v = mapped
+		}
+	}
+	if found && m.Convert != "" {
+		v, found = convertValue(v, m.Convert)
+	}
+	if !found && m.Default != nil {
+		v, found = normalizeJSON(m.Default), true
+	}
+	return v, found, nil
+}
+
+// lookupPath 按 a.b.0.c 形式的路径取值，$ 或空路径为数据本身
+func lookupPath(v any, path string) (any, bool) {
+	if path == "" || path == "$" {
+		return v, true
+	}
+	for _, part := range strings.Split(strings.TrimPrefix(path, "$."), ".") {
+		switch node := v.(type) {
+		case map[string]any:
+			var exists bool
+			if v, exists = node[part]; !exists {
+				return nil, false
+			}
+		case []any:
+			i, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, false
+			}
+			if i < 0 {
+				i += len(node)
+			}
+			if i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// setPath 按 a.b.c 写入嵌套对象，中间不是对象时覆盖
+func setPath(out map[string]any, path string, v any) {
+	parts := strings.Split(path, ".")
+	for _, part := range parts[:len(parts)-1] {
+		child, isObject := out[part].(map[string]any)
+		if !isObject {
+			child = make(map[string]any)
+			out[part] = child
+		}
+		out = child
+	}
+	out[parts[len(parts)-1]] = v
+}
+
+// convertValue 按 convert 转换类型，无法转换时返回 false
+func convertValue(v any, to string) (any, bool) {
+	switch to {
+	case "string":
+		if v == nil {
+			return nil, false
+		}
+		return toString(v), true
+	case "int":
+		f, ok := numberValue(v)
+		return math.Trunc(f), ok
+	case "float":
+		return numberValue(v)
+	case "bool":
+		switch b := v.(type) {
+		case bool:
+			return b, true
+		case string:
+			parsed, err := strconv.ParseBool(b)
+			return parsed, err == nil
+		case float64:
+			return b != 0, true
+		}
+		return nil, false
+	case "time":
+		if s, isString := v.(string); isString {
+			if _, err := time.Parse(time.RFC3339, s); err == nil {
+				return s, true
+			}
+		}
+		f, ok := numberValue(v)
+		if !ok {
+			return nil, false
+		}
+		// 大于 1e12 的时间戳按毫秒处理
+		if f > 1e12 {
+			return time.UnixMilli(int64(f)).Format(time.RFC3339), true
+		}
+		return time.Unix(int64(f), 0).Format(time.RFC3339), true
+	case "unix":
+		if s, isString := v.(string); isString {
+			if t, err := time.Parse(time.RFC3339, s); err == nil {
+				return float64(t.Unix()), true
+			}
+		}
+		return numberValue(v)
+	}
+	return v, true
+}
+
+func numberValue(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil
+	case bool:
+		if n {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// normalizeJSON 转换为 JSON 解码后的类型，同时得到一份副本
+func normalizeJSON(v any) any {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var out any
+	if json.Unmarshal(b, &out) != nil {
+		return nil
+	}
+	return out
+}
+
+// applyTemplateTransform 按模板的 transform.yaml 映射请求数据
+func applyTemplateTransform(rc *RenderContext) error {
+	if rc.Template == "" {
+		return nil
+	}
+	t, err := loadTemplateTransform(rc.Template)
+	if err != nil || t == nil {
+		return err
+	}
+	data, err := t.Apply(normalizeJSON(rc.Payload.Data))
+	if err != nil {
+		return err
+	}
+	rc.Payload.Data = data
+	rc.Logger.Debug("🔀 已按模板映射请求数据", zap.String("template", rc.Template), zap.Int("fields", len(t.Fields)))
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 模板预热 ======
+//
+// template.warmup.enabled 开启后，启动时及模板变更后在后台用示例数据（<type>.sample.json）
+// 逐个渲染模板一次，提前加载浏览器的字体、着色器与脚本缓存以及系统文件缓存，减少每种卡片
+// 首次真实渲染的耗时。预热以最低优先级排队，不计入渲染统计、SLO、使用记录与渲染缓存。
+// 只预热新增或文件已修改的模板，没有示例数据的模板跳过。
+
+// warmupPriority 预热请求的排队优先级，低于所有正常请求，过载时直接放弃
+const warmupPriority = -1 << 30
+
+type templateWarmer struct {
+	mu      sync.Mutex
+	warmed  map[string]time.Time // 模板路径 → 预热时的修改时间
+	running bool
+	pending bool
+}
+
+var (
+	globalWarmer      = &templateWarmer{warmed: make(map[string]time.Time)}
+	templateWarmTotal = NewCounterVec("snapcast_template_warmups_total", "Template warm-up renders by result.", "result")
+)
+
+// TriggerTemplateWarmup 在后台预热模板，正在预热时合并为下一轮
+func TriggerTemplateWarmup() {
+	if !viper.GetBool("template.warmup.enabled") {
+		return
+	}
+	w := globalWarmer
+	w.mu.Lock()
+	if w.running {
+		w.pending = true
+		w.mu.Unlock()
+		return
+	}
+	w.running = true
+	w.mu.Unlock()
+	go w.run()
+}
+
+func (w *templateWarmer) run() {
+	for {
+		w.warmOnce()
+		w.mu.Lock()
+		if !w.pending {
+			w.running = false
+			w.mu.Unlock()
+			return
+		}
+		w.pending = false
+		w.mu.Unlock()
+	}
+}
+
+func (w *templateWarmer) warmOnce() {
+	timeout := 30 * time.Second
+	if d, err := ParseDuration(viper.Get("template.warmup.timeout")); err == nil && d > 0 {
+		timeout = d
+	}
+	start := time.Now()
+	var warmed, failed int
+	present := make(map[string]bool)
+	for _, tc := range goldenCases(nil) {
+		present[tc.tmpl] = true
+		info, err := os.Stat(tc.tmpl)
+		if err != nil {
+			continue
+		}
+		w.mu.Lock()
+		prev, done := w.warmed[tc.tmpl]
+		w.mu.Unlock()
+		if done && prev.Equal(info.ModTime()) {
+			continue
+		}
+
+		data, err := loadSampleData(tc.tmpl)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			templateWarmTotal.Inc("skipped")
+		case err != nil:
+			templateWarmTotal.Inc("error")
+			logger.Warn("❕ 模板预热跳过，示例数据无效", zap.String("key", tc.key), zap.Error(err))
+		default:
+			if err := warmTemplate(tc, data, timeout); err != nil {
+				failed++
+				templateWarmTotal.Inc("error")
+				logger.Warn("❕ 模板预热失败", zap.String("key", tc.key), zap.Error(err))
+			} else {
+				warmed++
+				templateWarmTotal.Inc("ok")
+			}
+		}
+		w.mu.Lock()
+		w.warmed[tc.tmpl] = info.ModTime()
+		w.mu.Unlock()
+	}
+
+	w.mu.Lock()
+	for path := range w.warmed {
+		if !present[path] {
+			delete(w.warmed, path)
+		}
+	}
+	w.mu.Unlock()
+	if warmed+failed > 0 {
+		logger.Info("🔥 模板预热完成", zap.Int("warmed", warmed), zap.Int("failed", failed), zap.Duration("duration", time.Since(start)))
+	}
+}
+
+// warmTemplate 以最低优先级获取渲染许可后渲染一次示例数据，结果丢弃
+func warmTemplate(tc goldenCase, data any, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	release, _, err := acquireRenderSlot(ctx, tc.site, warmupPriority)
+	if err != nil {
+		return err
+	}
+	defer release()
+	payload := PushPayload{Site: tc.site, Type: tc.typ, Theme: tc.theme, Output: "image", Data: data, warmup: true}
+	_, err = renderPayload(ctx, &payload)
+	return err
+}
@@ -0,0 +1,293 @@
+//go:build !noplugin
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"go.uber.org/zap"
+)
+
+// ====== WASM 扩展 ======
+//
+// 将 .wasm 文件放入 wasm.dir 即可扩展 SnapCast，模块运行在无文件系统、无网络的沙箱中。
+// 模块 ABI（数据均以 JSON 传递）：
+//
+//	alloc(size i32) i32                  必须导出，供宿主写入参数
+//	transform(ptr i32, len i32) i64      可选，输入 {"site","type","data"}，返回新的 data
+//	func_<name>(ptr i32, len i32) i64    可选，注册为模板函数 <name>，输入参数数组，返回任意 JSON 值
+//
+// <name> 须为合法标识符，且不能与内置模板函数或先加载的模块重名，否则忽略该函数。
+//
+// 返回值 i64 高 32 位为结果指针，低 32 位为结果长度。
+// 宿主提供 snapcast.log(ptr i32, len i32) 用于输出调试日志。
+
+type wasmModule struct {
+	name      string
+	compiled  wazero.CompiledModule
+	transform bool // 导出了签名正确的 transform
+}
+
+// wasmTransformRule 指定转换模块作用的模板，match 支持 "site/type"、"site/*"、"*"
+type wasmTransformRule struct {
+	Module string `mapstructure:"module"`
+	Match  string `mapstructure:"match"`
+}
+
+var (
+	wasmRuntime wazero.Runtime
+	wasmModules = make(map[string]*wasmModule)
+	wasmMutex   sync.RWMutex
+	wasmTimeout = time.Second
+)
+
+// LoadWasmModules 编译 wasm.dir 下全部模块，并将导出的 func_<name> 注册为模板函数
+func LoadWasmModules(dir string) {
+	if dir == "" {
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		logger.Warn("⚠️ WASM 目录读取失败", zap.String("dir", dir), zap.Error(err))
+		return
+	}
+
+	if t, err := ParseDuration(viper.Get("wasm.timeout")); err == nil && t > 0 {
+		wasmTimeout = t
+	}
+	memoryMB := viper.GetInt("wasm.memory_limit_mb")
+	if memoryMB <= 0 {
+		memoryMB = 16
+	}
+
+	ctx := context.Background()
+	cfg := wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(uint32(memoryMB * 16)). // 每页 64KB
+		WithCloseOnContextDone(true)
+	wasmRuntime = wazero.NewRuntimeWithConfig(ctx, cfg)
+	// 仅提供 WASI 的时钟与随机数等基础能力，不挂载任何目录
+	wasi_snapshot_preview1.MustInstantiate(ctx, wasmRuntime)
+	_, err = wasmRuntime.NewHostModuleBuilder("snapcast").
+		NewFunctionBuilder().
+		WithFunc(func(ctx context.Context, m api.Module, ptr, size uint32) {
+			if b, ok := m.Memory().Read(ptr, size); ok {
+				logger.Debug("🧊 WASM 日志", zap.String("module", m.Name()), zap.String("msg", string(b)))
+			}
+		}).
+		Export("log").
+		Instantiate(ctx)
+	if err != nil {
+		logger.Error("❌ WASM 宿主模块初始化失败", zap.Error(err))
+		return
+	}
+
+	wasmMutex.Lock()
+	defer wasmMutex.Unlock()
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".wasm") {
+			continue
+		}
+		file := filepath.Join(dir, e.Name())
+		code, err := os.ReadFile(file)
+		if err != nil {
+			logger.Error("❌ WASM 模块读取失败", zap.String("path", file), zap.Error(err))
+			continue
+		}
+		compiled, err := wasmRuntime.CompileModule(ctx, code)
+		if err != nil {
+			logger.Error("❌ WASM 模块编译失败", zap.String("path", file), zap.Error(err))
+			continue
+		}
+		exports := compiled.ExportedFunctions()
+		if err := checkWasmSignature(exports, "alloc", wasmAllocParams); err != nil {
+			logger.Error("❌ WASM 模块 alloc 导出无效", zap.String("path", file), zap.Error(err))
+			continue
+		}
+		mod := &wasmModule{name: strings.TrimSuffix(e.Name(), ".wasm"), compiled: compiled}
+		if _, found := exports["transform"]; found {
+			if err := checkWasmSignature(exports, "transform", wasmCallParams); err != nil {
+				logger.Error("❌ WASM 模块 transform 导出无效，已忽略", zap.String("path", file), zap.Error(err))
+			} else {
+				mod.transform = true
+			}
+		}
+		wasmModules[mod.name] = mod
+
+		var funcs []string
+		for export := range exports {
+			if fnName, found := strings.CutPrefix(export, "func_"); found {
+				if err := checkWasmSignature(exports, export, wasmCallParams); err != nil {
+					logger.Error("❌ WASM 模板函数导出无效，已忽略", zap.String("path", file), zap.Error(err))
+					continue
+				}
+				if !wasmFuncNameRegex.MatchString(fnName) {
+					logger.Error("❌ WASM 模板函数名不是合法标识符，已忽略", zap.String("path", file), zap.String("func", fnName))
+					continue
+				}
+				if _, exists := funcsList[fnName]; exists || slices.Contains(wasmReservedFuncs, fnName) {
+					logger.Error("❌ WASM 模板函数与已有函数重名，已忽略", zap.String("path", file), zap.String("func", fnName))
+					continue
+				}
+				funcsList[fnName] = mod.templateFunc(export)
+				funcs = append(funcs, fnName)
+			}
+		}
+		logger.Info("🧊 WASM 模块已加载", zap.String("path", file), zap.Bool("transform", mod.transform), zap.Strings("funcs", funcs))
+	}
+}
+
+// 导出函数的签名：alloc(i32) i32，transform 与 func_<name> 为 (i32, i32) i64
+// wasmReservedFuncs 模板语言的内置函数及 WASM 之后才注册的 asset，与 funcsList 一同视为已占用
+var wasmReservedFuncs = []string{"and", "call", "html", "index", "slice", "js", "len", "not", "or", "print", "printf", "println", "urlquery", "eq", "ge", "gt", "le", "lt", "ne", "asset"}
+
+var wasmFuncNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var (
+	wasmAllocParams = [2][]api.ValueType{{api.ValueTypeI32}, {api.ValueTypeI32}}
+	wasmCallParams  = [2][]api.ValueType{{api.ValueTypeI32, api.ValueTypeI32}, {api.ValueTypeI64}}
+)
+
+// checkWasmSignature 校验导出函数存在且参数、返回值类型符合约定
+func checkWasmSignature(exports map[string]api.FunctionDefinition, name string, sig [2][]api.ValueType) error {
+	def, found := exports[name]
+	if !found {
+		return fmt.Errorf("missing export %s", name)
+	}
+	if !slices.Equal(def.ParamTypes(), sig[0]) || !slices.Equal(def.ResultTypes(), sig[1]) {
+		return fmt.Errorf("export %s has signature %v -> %v, want %v -> %v", name,
+			valueTypeNames(def.ParamTypes()), valueTypeNames(def.ResultTypes()), valueTypeNames(sig[0]), valueTypeNames(sig[1]))
+	}
+	return nil
+}
+
+func valueTypeNames(types []api.ValueType) []string {
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = api.ValueTypeName(t)
+	}
+	return names
+}
+
+// call 在全新实例中调用导出函数，实例之间互不共享状态
+func (m *wasmModule) call(export string, input []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), wasmTimeout)
+	defer cancel()
+
+	inst, err := wasmRuntime.InstantiateModule(ctx, m.compiled,
+		wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize"))
+	if err != nil {
+		return nil, fmt.Errorf("wasm %s: instantiate: %w", m.name, err)
+	}
+	defer inst.Close(context.Background())
+
+	alloc, fn, mem := inst.ExportedFunction("alloc"), inst.ExportedFunction(export), inst.Memory()
+	if alloc == nil || fn == nil {
+		return nil, fmt.Errorf("wasm %s: missing export %s", m.name, export)
+	}
+	if mem == nil {
+		return nil, fmt.Errorf("wasm %s: module exports no memory", m.name)
+	}
+	res, err := alloc.Call(ctx, uint64(len(input)))
+	if err != nil {
+		return nil, fmt.Errorf("wasm %s: alloc: %w", m.name, err)
+	}
+	if len(res) != 1 {
+		return nil, fmt.Errorf("wasm %s: alloc returned %d values", m.name, len(res))
+	}
+	ptr := uint32(res[0])
+	if !mem.Write(ptr, input) {
+		return nil, fmt.Errorf("wasm %s: write out of range", m.name)
+	}
+	res, err = fn.Call(ctx, uint64(ptr), uint64(len(input)))
+	if err != nil {
+		return nil, fmt.Errorf("wasm %s: %s: %w", m.name, export, err)
+	}
+	if len(res) != 1 {
+		return nil, fmt.Errorf("wasm %s: %s returned %d values", m.name, export, len(res))
+	}
+	outPtr, outLen := uint32(res[0]>>32), uint32(res[0])
+	out, ok := mem.Read(outPtr, outLen)
+	if !ok {
+		return nil, fmt.Errorf("wasm %s: read out of range", m.name)
+	}
+	// 实例关闭后内存失效，需复制结果
+	return append([]byte(nil), out...), nil
+}
+
+func (m *wasmModule) templateFunc(export string) func(args ...any) (any, error) {
+	return func(args ...any) (any, error) {
+		input, err := json.Marshal(args)
+		if err != nil {
+			return nil, err
+		}
+		out, err := m.call(export, input)
+		if err != nil {
+			return nil, err
+		}
+		var v any
+		if err := json.Unmarshal(out, &v); err != nil {
+			return nil, fmt.Errorf("wasm %s: invalid result: %w", m.name, err)
+		}
+		return v, nil
+	}
+}
+
+// applyWasmTransforms 按 wasm.transforms 规则依次对 payload.Data 执行转换模块
+func applyWasmTransforms(p *PushPayload) error {
+	if wasmRuntime == nil {
+		return nil
+	}
+	var rules []wasmTransformRule
+	if err := viper.UnmarshalKey("wasm.transforms", &rules); err != nil {
+		return fmt.Errorf("invalid wasm.transforms: %w", err)
+	}
+	key := p.Site + "/" + p.Type
+	for _, rule := range rules {
+		if matched, _ := path.Match(rule.Match, key); !matched && rule.Match != "*" {
+			continue
+		}
+		wasmMutex.RLock()
+		mod, found := wasmModules[rule.Module]
+		wasmMutex.RUnlock()
+		if !found {
+			logger.Warn("❕ 未加载的 WASM 模块", zap.String("module", rule.Module))
+			continue
+		}
+		if !mod.transform {
+			return fmt.Errorf("wasm %s: module has no valid transform export", mod.name)
+		}
+		input, err := json.Marshal(map[string]any{"site": p.Site, "type": p.Type, "data": p.Data})
+		if err != nil {
+			return err
+		}
+		out, err := mod.call("transform", input)
+		if err != nil {
+			return err
+		}
+		var data any
+		if err := json.Unmarshal(out, &data); err != nil {
+			return fmt.Errorf("wasm %s: invalid transform result: %w", mod.name, err)
+		}
+		p.Data = data
+		logger.Debug("🧊 WASM 转换完成", zap.String("module", mod.name), zap.String("key", key))
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build noplugin
+
+package main
+
+import (
+	"path/filepath"
+
+	"go.uber.org/zap"
+)
+
+// 使用 noplugin 构建时不包含 WASM 运行时
+
+func LoadWasmModules(dir string) {
+	if dir == "" {
+		return
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.wasm")); len(matches) > 0 {
+		logger.Warn("❕ 当前构建不包含 WASM 运行时（noplugin），已忽略", zap.String("dir", dir), zap.Int("count", len(matches)))
+	}
+}
+
+func applyWasmTransforms(*PushPayload) error { return nil }
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ====== 水印 ======
+//
+// watermark.enabled 开启后，在每张输出图片上叠加水印图片（watermark.image）或文字
+// （watermark.text），用于卡片被转发时的署名。文字水印由浏览器按 font_size/color 渲染
+// 一次后缓存，与卡片使用相同的字体；请求 options.watermark: false 可关闭。
+// 水印在图片后处理之后叠加，PDF 与多帧输出不加水印。
+
+// 水印位置
+const (
+	WatermarkTopLeft     = "top-left"
+	WatermarkTopRight    = "top-right"
+	WatermarkBottomLeft  = "bottom-left"
+	WatermarkBottomRight = "bottom-right"
+	WatermarkCenter      = "center"
+)
+
+type watermarkConfig struct {
+	image    image.Image // 图片水印，未配置时为 nil
+	text     string
+	fontSize int
+	color    string
+	position string
+	opacity  float64
+	margin   int
+}
+
+var (
+	watermarkSettings atomic.Pointer[watermarkConfig]
+
+	// 文字水印按内容、样式与缩放缓存
+	watermarkTextMu    sync.Mutex
+	watermarkTextCache = make(map[string]image.Image)
+)
+
+// ConfigureWatermark 读取 watermark 配置，由 ApplyDynamicConfig 调用
+func ConfigureWatermark() {
+	if !viper.GetBool("watermark.enabled") {
+		watermarkSettings.Store(nil)
+		return
+	}
+	cfg := &watermarkConfig{
+		text:     strings.TrimSpace(viper.GetString("watermark.text")),
+		fontSize: 14,
+		color:    "#ffffff",
+		position: WatermarkBottomRight,
+		opacity:  0.6,
+		margin:   12,
+	}
+	if viper.IsSet("watermark.font_size") {
+		cfg.fontSize = viper.GetInt("watermark.font_size")
+	}
+	if c := viper.GetString("watermark.color"); c != "" {
+		if _, err := parseHexColor(c); err != nil {
+			logger.Warn("❗ watermark.color 无效，使用 #ffffff", zap.Error(err))
+		} else {
+			cfg.color = c
+		}
+	}
+	switch p := strings.ToLower(viper.GetString("watermark.position")); p {
+	case "":
+	case WatermarkTopLeft, WatermarkTopRight, WatermarkBottomLeft, WatermarkBottomRight, WatermarkCenter:
+		cfg.position = p
+	default:
+		logger.Warn("❗ watermark.position 无效，使用 bottom-right", zap.String("position", p))
+	}
+	if viper.IsSet("watermark.opacity") {
+		if v := viper.GetFloat64("watermark.opacity"); v > 0 && v <= 1 {
+			cfg.opacity = v
+		} else {
+			logger.Warn("❗ watermark.opacity 应在 0-1 之间", zap.Float64("opacity", v), zap.Float64("default", cfg.opacity))
+		}
+	}
+	if viper.IsSet("watermark.margin") {
+		cfg.margin = max(0, viper.GetInt("watermark.margin"))
+	}
+	if path := viper.GetString("watermark.image"); path != "" {
+		img, err := loadWatermarkImage(path)
+		if err != nil {
+			logger.Warn("❗ 水印图片加载失败", zap.String("image", path), zap.Error(err))
+		} else {
+			cfg.image = img
+		}
+	}
+	if cfg.image == nil && cfg.text == "" {
+		logger.Warn("❗ watermark 已启用但未配置 image 或 text，不加水印")
+		watermarkSettings.Store(nil)
+		return
+	}
+	if cfg.image == nil && (cfg.fontSize < 6 || cfg.fontSize > 200) {
+		logger.Warn("❗ watermark.font_size 应在 6-200 之间，使用 14", zap.Int("font_size", cfg.fontSize))
+		cfg.fontSize = 14
+	}
+	watermarkSettings.Store(cfg)
+}
+
+func loadWatermarkImage(path string) (image.Image, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode watermark image: %w", err)
+	}
+	return img, nil
+}
+
+// watermarkEnabled 本次渲染是否加水印
+func watermarkEnabled(opts RenderOptions) bool {
+	return watermarkSettings.Load() != nil && (opts.Watermark == nil || *opts.Watermark)
+}
+
+// watermarkImage 返回水印图片，文字水印首次使用时由浏览器渲染
+func (cfg *watermarkConfig) watermarkImage(ctx context.Context, scale float64) (image.Image, error) {
+	if cfg.image != nil {
+		return cfg.image, nil
+	}
+	if scale <= 0 {
+		scale = 1
+	}
+	key := fmt.Sprintf("%s\x00%d\x00%s\x00%g", cfg.text, cfg.fontSize, cfg.color, scale)
+	watermarkTextMu.Lock()
+	defer watermarkTextMu.Unlock()
+	if img, cached := watermarkTextCache[key]; cached {
+		return img, nil
+	}
+	doc := fmt.Sprintf(`<!DOCTYPE html><html><head>%s<style>html,body{margin:0;background:transparent}body{display:inline-block}</style></head>`+
+		`<body><span style="font-size:%dpx;color:%s;white-space:nowrap;line-height:1.2">%s</span></body></html>`,
+		fontFaceCSS, cfg.fontSize, cfg.color, html.EscapeString(cfg.text))
+	opts := currentRenderDefaults()
+	data, err := RenderScreenshot(ctx, doc, RenderOptions{
+		Quality:   100,
+		TimeoutMs: opts.TimeoutMs,
+		Viewport:  &ViewportOptions{Width: 1000, Height: 200, Scale: scale},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render watermark text: %w", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(watermarkTextCache) > 16 { // 配置或缩放变化后旧的条目不再使用
+		clear(watermarkTextCache)
+	}
+	watermarkTextCache[key] = img
+	return img, nil
+}
+
+// watermarkStage 为管线中的截图叠加水印
+func watermarkStage(rc *RenderContext) error {
+	cfg := watermarkSettings.Load()
+	if cfg == nil {
+		return nil
+	}
+	scale := 1.0
+	if rc.Options.Viewport != nil {
+		scale = rc.Options.Viewport.Scale
+	}
+	wm, err := cfg.watermarkImage(rc.Ctx, scale)
+	if err != nil {
+		return err
+	}
+	img, err := rc.DecodedImage()
+	if err != nil {
+		return err
+	}
+	rc.SetImage(applyWatermark(img, wm, cfg))
+	return nil
+}
+
+// applyWatermark 按位置、边距与不透明度叠加水印，水印大于图片时不叠加
+func applyWatermark(img image.Image, wm image.Image, cfg *watermarkConfig) image.Image {
+	b, wb := img.Bounds(), wm.Bounds()
+	w, h := wb.Dx(), wb.Dy()
+	if w+2*cfg.margin > b.Dx() || h+2*cfg.margin > b.Dy() {
+		return img
+	}
+	var at image.Point
+	switch cfg.position {
+	case WatermarkTopLeft:
+		at = image.Pt(b.Min.X+cfg.margin, b.Min.Y+cfg.margin)
+	case WatermarkTopRight:
+		at = image.Pt(b.Max.X-cfg.margin-w, b.Min.Y+cfg.margin)
+	case WatermarkBottomLeft:
+		at = image.Pt(b.Min.X+cfg.margin, b.Max.Y-cfg.margin-h)
+	case WatermarkCenter:
+		at = image.Pt(b.Min.X+(b.Dx()-w)/2, b.Min.Y+(b.Dy()-h)/2)
+	default:
+		at = image.Pt(b.Max.X-cfg.margin-w, b.Max.Y-cfg.margin-h)
+	}
+	out, ok := img.(*image.RGBA)
+	if !ok {
+		out = image.NewRGBA(b)
+		draw.Draw(out, b, img, b.Min, draw.Src)
+	}
+	mask := image.NewUniform(color.Alpha{A: uint8(cfg.opacity*255 + 0.5)})
+	draw.DrawMask(out, image.Rectangle{Min: at, Max: at.Add(image.Pt(w, h))}, wm, wb.Min, mask, image.Point{}, draw.Over)
+	return out
+}
+
+// watermarkPNG 对已编码的 PNG 叠加水印，用于不经过渲染管线的 /capture
+func watermarkPNG(ctx context.Context, data []byte, opts RenderOptions) ([]byte, error) {
+	cfg := watermarkSettings.Load()
+	if cfg == nil {
+		return data, nil
+	}
+	scale := 1.0
+	if opts.Viewport != nil {
+		scale = opts.Viewport.Scale
+	}
+	wm, err := cfg.watermarkImage(ctx, scale)
+	if err != nil {
+		return nil, err
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode screenshot: %w", err)
+	}
+	var out bytes.Buffer
+	if err := png.Encode(&out, applyWatermark(img, wm, cfg)); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+)
+
+// ====== WebSocket 渲染接口 ======
+//
+// 聊天机器人等高频调用方建立一次连接即可连续提交渲染任务，省去每个请求的 HTTP/TLS 开销：
+//
+//	server:
+//	  ws_endpoint: "/render/ws"   # 为空则关闭
+//	  ws_max_inflight: 4          # 单个连接同时处理的任务数，达到上限时暂停读取新任务
+//
+// 握手与普通请求一样经过 IP 过滤与 token 认证（Authorization 头），浏览器页面只允许同源连接。
+// 任务为 JSON 消息，字段与 /render 请求相同，另有 id 用于对应结果（并作为请求 ID）：
+//
+//	{"id": "1", "site": "bilibili", "type": "live", "data": {...}}
+//
+// 每个任务返回一条 JSON 文本消息；图片等内容紧跟在其后的二进制消息中，两条之间不会插入其他消息：
+//
+//	{"type": "result", "id": "1", "status": "ok", "template": "...", "content_type": "image/png", "size": 48213, "duration_ms": 812}
+//	<48213 字节的二进制消息>
+//	{"type": "result", "id": "2", "status": "error", "code": 429, "error": "rate limit exceeded, try again later", "retry_after_ms": 1200}
+//
+// output 为 json、"response": "url" 或指定 deliver 时只有文本消息，字段同消息队列的结果（见 mqconsumer.go）。
+// 任务并行处理，结果按完成顺序返回。限流与排队按任务计算，失败的任务带 retry_after_ms，由客户端决定是否重试。
+// 连接每 30 秒收到一次 {"type": "ping"}。
+
+const (
+	wsMessageResult      = "result"
+	wsMessagePing        = "ping"
+	defaultWSMaxInflight = 4
+)
+
+var (
+	wsConnections atomic.Int64
+	wsJobsTotal   = NewCounterVec("snapcast_ws_jobs_total", "Render jobs submitted over WebSocket by result.", "result")
+)
+
+func init() {
+	NewGaugeFunc("snapcast_ws_connections", "Open WebSocket render connections.", func() float64 {
+		return float64(wsConnections.Load())
+	})
+}
+
+// wsEndpoint WebSocket 渲染接口路径，为空表示关闭
+func wsEndpoint() string {
+	if !viper.IsSet("server.ws_endpoint") {
+		return "/render/ws"
+	}
+	return viper.GetString("server.ws_endpoint")
+}
+
+// wsMessage 发给客户端的文本消息
+type wsMessage struct {
+	Type string `json:"type"`
+	*jobResult
+	Size         int   `json:"size,omitempty"` // 紧随其后的二进制消息长度
+	RetryAfterMs int64 `json:"retry_after_ms,omitempty"`
+}
+
+// wsRenderConn 一个 WebSocket 渲染连接
+type wsRenderConn struct {
+	ws      *websocket.Conn
+	mu      sync.Mutex // 保证文本消息与其后的二进制消息相邻
+	rateKey string     // 按 IP 或 token 限流的键，握手时确定
+	lang    string     // 握手请求的 Accept-Language
+}
+
+// WSRenderHandler 以 WebSocket 接收渲染任务并返回结果
+func WSRenderHandler(c *gin.Context) {
+	ctx := withBaseURL(c.Request.Context(), requestBaseURL(c))
+	conn := &wsRenderConn{rateKey: globalRateLimiter.Key(c), lang: c.GetHeader("Accept-Language")}
+	server := websocket.Server{
+		Handshake: sameOriginHandshake,
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			_ = ws.SetDeadline(time.Time{}) // 清除 server.write_timeout 等遗留的连接超时
+			wsConnections.Add(1)
+			defer wsConnections.Add(-1)
+			conn.ws = ws
+			loggerFor(ctx).Info("🔌 WebSocket 渲染连接建立", zap.String("client_ip", GetClientIP(c)))
+			conn.serve(ctx)
+			loggerFor(ctx).Info("🔌 WebSocket 渲染连接关闭", zap.String("client_ip", GetClientIP(c)))
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// serve 读取任务直到连接关闭；连接关闭后取消未完成的任务
+func (w *wsRenderConn) serve(ctx context.Context) {
+	var jobs sync.WaitGroup
+	defer jobs.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		ping := time.NewTicker(30 * time.Second)
+		defer ping.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ping.C:
+				if w.send(&wsMessage{Type: wsMessagePing}, nil) != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	maxInflight := viper.GetInt("server.ws_max_inflight")
+	if maxInflight <= 0 {
+		maxInflight = defaultWSMaxInflight
+	}
+	inflight := make(chan struct{}, maxInflight)
+	for {
+		var msg []byte
+		if err := websocket.Message.Receive(w.ws, &msg); err != nil {
+			return
+		}
+		select {
+		case inflight <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			defer func() { <-inflight }()
+			w.handle(ctx, msg)
+		}()
+	}
+}
+
+// handle 处理一个任务并写回结果
+func (w *wsRenderConn) handle(ctx context.Context, msg []byte) {
+	start := time.Now()
+	var job mqJob
+	if err := json.Unmarshal(msg, &job); err != nil {
+		wsJobsTotal.Inc("invalid")
+		w.send(&wsMessage{Type: wsMessageResult, jobResult: &jobResult{Status: "error", Code: http.StatusBadRequest, Error: "invalid job: " + err.Error()}}, nil)
+		return
+	}
+	id := job.ID
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	ctx = withRequestID(ctx, id)
+	log := loggerFor(ctx)
+
+	res, body, retryAfter, err := w.render(ctx, &job.PushPayload)
+	if res == nil {
+		res = &jobResult{}
+	}
+	res.ID = job.ID
+	res.DurationMs = time.Since(start).Milliseconds()
+	out := &wsMessage{Type: wsMessageResult, jobResult: res, Size: len(body)}
+	if err != nil {
+		res.Status, res.Code, res.Error = "error", renderErrorStatus(err), err.Error()
+		out.RetryAfterMs = retryAfter.Milliseconds()
+		if retryAfter > 0 {
+			wsJobsTotal.Inc("rejected")
+		} else {
+			wsJobsTotal.Inc("error")
+		}
+		log.Warn("⚠️ WebSocket 任务失败", zap.String("job", job.ID), zap.String("site", job.Site), zap.String("type", job.Type), zap.Int("status", res.Code), zap.Error(err))
+	} else {
+		res.Status = "ok"
+		wsJobsTotal.Inc("ok")
+		log.Info("❇️ WebSocket 任务结果", zap.String("job", job.ID), zap.String("site", job.Site), zap.String("type", job.Type), zap.String("template", res.Template), zap.String("size", formatBytes(len(body))), zap.Int64("duration_ms", res.DurationMs))
+	}
+	if err := w.send(out, body); err != nil {
+		log.Debug("❕ WebSocket 结果发送失败", zap.String("job", job.ID), zap.Error(err))
+	}
+}
+
+// render 按任务限流、获取渲染许可并渲染；二进制内容单独返回，被拒绝时返回建议的重试间隔
+func (w *wsRenderConn) render(ctx context.Context, payload *PushPayload) (*jobResult, []byte, time.Duration, error) {
+	if payload.Site == "" || payload.Type == "" {
+		return nil, nil, 0, newRenderError(http.StatusBadRequest, errors.New("site and type are required"))
+	}
+	// 握手只经过一次限流中间件，连接上的每个任务按一个请求计入
+	if allowed, retryAfter := globalRateLimiter.Allow(w.rateKey); !allowed {
+		return nil, nil, max(retryAfter, time.Second), newRenderError(http.StatusTooManyRequests, errors.New("rate limit exceeded, try again later"))
+	}
+	if p := principalFrom(ctx); p != nil {
+		if allowed, retryAfter := p.Allow(); !allowed {
+			return nil, nil, max(retryAfter, time.Second), newRenderError(http.StatusTooManyRequests, errors.New("rate limit exceeded, try again later"))
+		}
+	}
+	applyAcceptLanguage(payload, w.lang)
+
+	release, _, err := acquireRenderSlot(ctx, payload.Site, payload.Priority)
+	if err != nil {
+		retryAfter := time.Second
+		if errors.Is(err, errOverloaded) {
+			retryAfter = 5 * time.Second
+		}
+		return nil, nil, retryAfter, newRenderError(http.StatusServiceUnavailable, err)
+	}
+	defer release()
+	res, err := renderJobResult(ctx, payload)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	body := res.Body
+	res.Body = nil
+	return res, body, 0, nil
+}
+
+// send 写出文本消息，body 不为空时紧接着写出二进制消息
+func (w *wsRenderConn) send(msg *wsMessage, body []byte) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := websocket.Message.Send(w.ws, string(b)); err != nil {
+		return err
+	}
+	if len(body) > 0 {
+		return websocket.Message.Send(w.ws, body)
+	}
+	return nil
+}